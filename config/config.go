@@ -0,0 +1,763 @@
+// Package config loads modem-stats settings from a YAML (or JSON) file, with
+// environment variables taking precedence over the file.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/msh100/modem-stats/modems"
+	"github.com/msh100/modem-stats/modems/superhub5"
+	"github.com/msh100/modem-stats/outputs"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/msh100/modem-stats/utils/logging"
+	"gopkg.in/yaml.v2"
+)
+
+type Config struct {
+	Modems      []modems.Config `yaml:"modems"`
+	Prometheus  Prometheus      `yaml:"prometheus"`
+	Loki        Loki            `yaml:"loki"`
+	RemoteWrite RemoteWrite     `yaml:"remote_write"`
+	VMImport    VMImport        `yaml:"vm_import"`
+	LineOutput  LineOutput      `yaml:"line_output"`
+	Log         Log             `yaml:"log"`
+	Aggregate   Aggregate       `yaml:"aggregate"`
+	TLS         TLS             `yaml:"tls"`
+	Proxy       Proxy           `yaml:"proxy"`
+	ModemsDir   ModemsDir       `yaml:"modems_dir"`
+}
+
+type Prometheus struct {
+	Port             int           `yaml:"port"`
+	Socket           string        `yaml:"socket"`
+	DisabledMetrics  []string      `yaml:"disabled_metrics"`
+	FlapWindow       time.Duration `yaml:"flap_window"`
+	MaxUpstreamPower float64       `yaml:"max_upstream_power"`
+	ChannelIDLabels  bool          `yaml:"channel_id_labels"`
+
+	// Consecutive failed scrapes before the watchdog resets the modem's
+	// connections (0 disables it), and whether it also reboots the modem
+	WatchdogThreshold int  `yaml:"watchdog_threshold"`
+	WatchdogReboot    bool `yaml:"watchdog_reboot"`
+
+	// Whether to fetch the event log with the statistics to report the
+	// offset of the modem's clock
+	ClockOffset bool `yaml:"clock_offset"`
+
+	// Whether to fetch the event log with the statistics to count its
+	// entries by priority and event code
+	EventCounts bool `yaml:"event_counts"`
+
+	// Whether to withhold the modem's counters from the first scrape
+	SkipFirstCounters bool `yaml:"skip_first_counters"`
+
+	// Whether to report how far each channel's counters have grown since the
+	// last scrape
+	CounterDeltas bool `yaml:"counter_deltas"`
+
+	// Whether to report the growth of each channel's error counters as a
+	// native histogram
+	ErrorHistogram bool `yaml:"error_histogram"`
+
+	// Minimum interval between fetches from the modem (0 disables the limit)
+	MinScrapeInterval time.Duration `yaml:"min_scrape_interval"`
+
+	// How long a scrape waits for the modem before being served the previous
+	// result (0 waits indefinitely)
+	CollectTimeout time.Duration `yaml:"collect_timeout"`
+
+	// Interval on which to fetch from the modem in the background, with
+	// scrapes served the last result (0 fetches on each scrape)
+	FetchInterval time.Duration `yaml:"fetch_interval"`
+
+	// Whether to stamp metrics with the time they were fetched from the
+	// modem rather than the time of the scrape
+	FetchTimestamps bool `yaml:"fetch_timestamps"`
+
+	// Frequency bands channels are expected in, channels outside them are
+	// counted as out of band
+	DownstreamBand Band `yaml:"downstream_band"`
+	UpstreamBand   Band `yaml:"upstream_band"`
+
+	// Weighting of the components of the health score
+	HealthWeights HealthWeights `yaml:"health_weights"`
+
+	// Thresholds by which downstream channels' power and SNR are graded
+	StatusThresholds StatusThresholds `yaml:"status_thresholds"`
+
+	// Number of channels the modem is expected to bond, for the bonding
+	// ratio (0 disables the ratio for that direction)
+	ExpectedDownstreamChannels int `yaml:"expected_downstream_channels"`
+	ExpectedUpstreamChannels   int `yaml:"expected_upstream_channels"`
+
+	// IDs of channels (in either direction) left out of the metrics
+	ExcludedChannels []int `yaml:"excluded_channels"`
+
+	// Directory each fetch from the modem is archived in (empty disables the
+	// archive), and how many fetches it keeps
+	SnapshotDir      string `yaml:"snapshot_dir"`
+	SnapshotMaxFiles int    `yaml:"snapshot_max_files"`
+
+	// Whether to label every metric with the modem's MAC address
+	MACLabel bool `yaml:"mac_label"`
+
+	// Whether to serve pages under /debug for inspecting what was scraped
+	DebugEndpoints bool `yaml:"debug_endpoints"`
+
+	// Whether to serve /probe, scraping any modem Prometheus names
+	ProbeEndpoint bool `yaml:"probe_endpoint"`
+}
+
+// Band is a range of channel frequencies in Hz
+type Band struct {
+	MinHz int `yaml:"min_hz"`
+	MaxHz int `yaml:"max_hz"`
+}
+
+func (b Band) valid() bool {
+	return b.MinHz >= 0 && b.MaxHz > b.MinHz
+}
+
+// HealthWeights weight the components of the health score, of which at least
+// one must be weighted
+type HealthWeights struct {
+	Lock   float64 `yaml:"lock"`
+	SNR    float64 `yaml:"snr"`
+	Power  float64 `yaml:"power"`
+	Errors float64 `yaml:"errors"`
+}
+
+func (w HealthWeights) valid() bool {
+	return w.Lock >= 0 && w.SNR >= 0 && w.Power >= 0 && w.Errors >= 0 &&
+		w.Lock+w.SNR+w.Power+w.Errors > 0
+}
+
+// StatusThresholds grade downstream channels' power (good or a warning
+// within so many dBmV either side of 0) and SNR (good or a warning from so
+// many dB)
+type StatusThresholds struct {
+	PowerGood float64 `yaml:"power_good_dbmv"`
+	PowerWarn float64 `yaml:"power_warn_dbmv"`
+	SNRGood   float64 `yaml:"snr_good_db"`
+	SNRWarn   float64 `yaml:"snr_warn_db"`
+}
+
+func (t StatusThresholds) valid() bool {
+	return t.PowerGood >= 0 && t.PowerGood <= t.PowerWarn && t.SNRWarn >= 0 && t.SNRWarn <= t.SNRGood
+}
+
+type Loki struct {
+	Endpoint     string            `yaml:"endpoint"`
+	Labels       map[string]string `yaml:"labels"`
+	PollInterval time.Duration     `yaml:"poll_interval"`
+	MaxAge       time.Duration     `yaml:"max_age"`
+
+	// Encoding of each push: none, gzip or snappy (sent as protobuf)
+	Encoding string `yaml:"encoding"`
+
+	// Endpoints pushed to in order when the endpoint is down
+	FailoverEndpoints []string `yaml:"failover_endpoints"`
+}
+
+type RemoteWrite struct {
+	URL      string        `yaml:"url"`
+	Interval time.Duration `yaml:"interval"`
+	Username string        `yaml:"username"`
+	Password string        `yaml:"password"`
+	Tenant   string        `yaml:"tenant"`
+}
+
+// VMImport pushes metrics to a VictoriaMetrics import endpoint
+type VMImport struct {
+	URL      string        `yaml:"url"`
+	Interval time.Duration `yaml:"interval"`
+	Username string        `yaml:"username"`
+	Password string        `yaml:"password"`
+}
+
+// LineOutput writes each modem's statistics, rendered through a Go
+// text/template, to a TCP, UDP or file sink
+type LineOutput struct {
+	Template string        `yaml:"template"`
+	Sink     string        `yaml:"sink"`
+	Interval time.Duration `yaml:"interval"`
+
+	// Whether to send gauges only when they have moved by more than the
+	// epsilon since last sent, counters always being sent
+	ChangedOnly    bool    `yaml:"changed_only"`
+	ChangedEpsilon float64 `yaml:"changed_epsilon"`
+}
+
+// Log sets the level (debug, info, warn or error) and format (text or json)
+// of the log
+type Log struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// TLS sets the client certificate and key (PEM files) presented to modems
+// which require mutual TLS
+type TLS struct {
+	ClientCert string `yaml:"client_cert"`
+	ClientKey  string `yaml:"client_key"`
+}
+
+// Proxy sets the proxy (socks5://, http:// or https://) modems are reached
+// through, for modems only reachable through a jump host
+type Proxy struct {
+	URL string `yaml:"url"`
+}
+
+// ModemsDir is a directory holding a config file for each modem, in
+// addition to those under modems, which is rescanned for files added,
+// changed and removed
+type ModemsDir struct {
+	Path           string        `yaml:"path"`
+	RescanInterval time.Duration `yaml:"rescan_interval"`
+}
+
+// Aggregate lists remote exporters whose metrics are aggregated, which are
+// served instead of the metrics of any modems
+type Aggregate struct {
+	Sources []AggregateSource `yaml:"sources"`
+}
+
+type AggregateSource struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+}
+
+// ParseAggregateSource parses a source given as name=url
+func ParseAggregateSource(raw string) (AggregateSource, error) {
+	parts := strings.SplitN(strings.TrimSpace(raw), "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return AggregateSource{}, fmt.Errorf("aggregate source %q must be given as name=url", raw)
+	}
+	return AggregateSource{Name: parts[0], URL: parts[1]}, nil
+}
+
+// Default returns the settings used for anything not configured
+func Default() *Config {
+	return &Config{
+		Prometheus: Prometheus{
+			FlapWindow:       outputs.DefaultFlapWindow,
+			MaxUpstreamPower: outputs.DefaultMaxUpstreamPower,
+
+			WatchdogThreshold: outputs.DefaultWatchdogThreshold,
+			SnapshotMaxFiles:  outputs.DefaultSnapshotMaxFiles,
+
+			DownstreamBand: Band{MinHz: outputs.DefaultDownstreamBand.Min, MaxHz: outputs.DefaultDownstreamBand.Max},
+			UpstreamBand:   Band{MinHz: outputs.DefaultUpstreamBand.Min, MaxHz: outputs.DefaultUpstreamBand.Max},
+
+			HealthWeights: HealthWeights{
+				Lock:   outputs.DefaultHealthWeights.Lock,
+				SNR:    outputs.DefaultHealthWeights.SNR,
+				Power:  outputs.DefaultHealthWeights.Power,
+				Errors: outputs.DefaultHealthWeights.Errors,
+			},
+			StatusThresholds: StatusThresholds{
+				PowerGood: outputs.DefaultStatusThresholds.PowerGood,
+				PowerWarn: outputs.DefaultStatusThresholds.PowerWarn,
+				SNRGood:   outputs.DefaultStatusThresholds.SNRGood,
+				SNRWarn:   outputs.DefaultStatusThresholds.SNRWarn,
+			},
+		},
+		Loki: Loki{
+			PollInterval: 60 * time.Second,
+			MaxAge:       outputs.DefaultLokiMaxAge,
+			Encoding:     outputs.LokiEncodingGzip,
+		},
+		RemoteWrite: RemoteWrite{
+			Interval: 60 * time.Second,
+		},
+		VMImport: VMImport{
+			Interval: 60 * time.Second,
+		},
+		LineOutput: LineOutput{
+			Interval: 60 * time.Second,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: logging.FormatText,
+		},
+		ModemsDir: ModemsDir{
+			RescanInterval: DefaultModemsDirRescanInterval,
+		},
+	}
+}
+
+// Load reads a config file, applies environment variable overrides and
+// validates the result
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	config := Default()
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return config, config.Finalize()
+}
+
+// Finalize applies environment variable overrides and validates the config
+func (c *Config) Finalize() error {
+	if err := c.applyEnv(); err != nil {
+		return err
+	}
+	return c.Validate()
+}
+
+// applyEnv overrides settings with those from environment variables
+func (c *Config) applyEnv() error {
+	// A config with several modems can only be replaced as a whole
+	if len(c.Modems) <= 1 || os.Getenv("MODEM_1_TYPE") != "" {
+		var base modems.Config
+		if len(c.Modems) == 1 {
+			base = c.Modems[0]
+		}
+		configs, err := modems.FromEnv(base)
+		if err != nil {
+			return err
+		}
+		if len(configs) > 1 || configs[0].Type != "" {
+			c.Modems = configs
+		}
+	}
+
+	var errs []string
+	envInt := func(key string, value *int) {
+		if raw := os.Getenv(key); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s must be a number, got %q", key, raw))
+				return
+			}
+			*value = parsed
+		}
+	}
+	envFloat := func(key string, value *float64) {
+		if raw := os.Getenv(key); raw != "" {
+			parsed, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s must be a number, got %q", key, raw))
+				return
+			}
+			*value = parsed
+		}
+	}
+	envDuration := func(key string, value *time.Duration) {
+		if raw := os.Getenv(key); raw != "" {
+			parsed, err := time.ParseDuration(raw)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s must be a duration (such as 1h), got %q", key, raw))
+				return
+			}
+			*value = parsed
+		}
+	}
+	envSeconds := func(key string, value *time.Duration) {
+		if raw := os.Getenv(key); raw != "" {
+			secs, err := strconv.Atoi(raw)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s must be a number of seconds, got %q", key, raw))
+				return
+			}
+			*value = time.Duration(secs) * time.Second
+		}
+	}
+	envBool := func(key string, value *bool) {
+		if raw := os.Getenv(key); raw != "" {
+			parsed, err := strconv.ParseBool(raw)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s must be true or false, got %q", key, raw))
+				return
+			}
+			*value = parsed
+		}
+	}
+	envString := func(key string, value *string) {
+		if raw := os.Getenv(key); raw != "" {
+			*value = raw
+		}
+	}
+
+	envInt("PROMETHEUS_PORT", &c.Prometheus.Port)
+	envString("PROMETHEUS_SOCKET", &c.Prometheus.Socket)
+	if raw := os.Getenv("DISABLED_METRICS"); raw != "" {
+		c.Prometheus.DisabledMetrics = strings.Split(raw, ",")
+	}
+	envDuration("FLAP_WINDOW", &c.Prometheus.FlapWindow)
+	envFloat("MAX_UPSTREAM_POWER", &c.Prometheus.MaxUpstreamPower)
+	envBool("CHANNEL_ID_LABELS", &c.Prometheus.ChannelIDLabels)
+	envInt("WATCHDOG_THRESHOLD", &c.Prometheus.WatchdogThreshold)
+	envBool("WATCHDOG_REBOOT", &c.Prometheus.WatchdogReboot)
+	envBool("CLOCK_OFFSET", &c.Prometheus.ClockOffset)
+	envBool("EVENT_COUNTS", &c.Prometheus.EventCounts)
+	envBool("COUNTER_DELTAS", &c.Prometheus.CounterDeltas)
+	envBool("ERROR_HISTOGRAM", &c.Prometheus.ErrorHistogram)
+	envBool("SKIP_FIRST_COUNTERS", &c.Prometheus.SkipFirstCounters)
+	envDuration("MIN_SCRAPE_INTERVAL", &c.Prometheus.MinScrapeInterval)
+	envDuration("COLLECT_TIMEOUT", &c.Prometheus.CollectTimeout)
+	envDuration("FETCH_INTERVAL", &c.Prometheus.FetchInterval)
+	envBool("FETCH_TIMESTAMPS", &c.Prometheus.FetchTimestamps)
+	envInt("DOWNSTREAM_BAND_MIN_HZ", &c.Prometheus.DownstreamBand.MinHz)
+	envInt("DOWNSTREAM_BAND_MAX_HZ", &c.Prometheus.DownstreamBand.MaxHz)
+	envInt("UPSTREAM_BAND_MIN_HZ", &c.Prometheus.UpstreamBand.MinHz)
+	envInt("UPSTREAM_BAND_MAX_HZ", &c.Prometheus.UpstreamBand.MaxHz)
+	envFloat("HEALTH_WEIGHT_LOCK", &c.Prometheus.HealthWeights.Lock)
+	envFloat("HEALTH_WEIGHT_SNR", &c.Prometheus.HealthWeights.SNR)
+	envFloat("HEALTH_WEIGHT_POWER", &c.Prometheus.HealthWeights.Power)
+	envFloat("HEALTH_WEIGHT_ERRORS", &c.Prometheus.HealthWeights.Errors)
+	envFloat("POWER_STATUS_GOOD_DBMV", &c.Prometheus.StatusThresholds.PowerGood)
+	envFloat("POWER_STATUS_WARN_DBMV", &c.Prometheus.StatusThresholds.PowerWarn)
+	envFloat("SNR_STATUS_GOOD_DB", &c.Prometheus.StatusThresholds.SNRGood)
+	envFloat("SNR_STATUS_WARN_DB", &c.Prometheus.StatusThresholds.SNRWarn)
+	envInt("EXPECTED_DOWNSTREAM_CHANNELS", &c.Prometheus.ExpectedDownstreamChannels)
+	envInt("EXPECTED_UPSTREAM_CHANNELS", &c.Prometheus.ExpectedUpstreamChannels)
+	envString("SNAPSHOT_DIR", &c.Prometheus.SnapshotDir)
+	envInt("SNAPSHOT_MAX_FILES", &c.Prometheus.SnapshotMaxFiles)
+	envBool("MAC_LABEL", &c.Prometheus.MACLabel)
+	envBool("DEBUG_ENDPOINTS", &c.Prometheus.DebugEndpoints)
+	envBool("PROBE_ENDPOINT", &c.Prometheus.ProbeEndpoint)
+	if raw := os.Getenv("EXCLUDED_CHANNELS"); raw != "" {
+		c.Prometheus.ExcludedChannels = nil
+		for _, id := range strings.Split(raw, ",") {
+			parsed, err := strconv.Atoi(strings.TrimSpace(id))
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("EXCLUDED_CHANNELS must be a list of channel IDs, got %q", raw))
+				break
+			}
+			c.Prometheus.ExcludedChannels = append(c.Prometheus.ExcludedChannels, parsed)
+		}
+	}
+
+	envString("LOKI_ENDPOINT", &c.Loki.Endpoint)
+	if raw := os.Getenv("LOKI_FAILOVER_ENDPOINTS"); raw != "" {
+		c.Loki.FailoverEndpoints = strings.Split(raw, ",")
+	}
+	envSeconds("LOKI_POLL_INTERVAL", &c.Loki.PollInterval)
+	envDuration("LOKI_MAX_AGE", &c.Loki.MaxAge)
+	envString("LOKI_ENCODING", &c.Loki.Encoding)
+
+	envString("REMOTE_WRITE_URL", &c.RemoteWrite.URL)
+	envSeconds("REMOTE_WRITE_INTERVAL", &c.RemoteWrite.Interval)
+	envString("REMOTE_WRITE_USERNAME", &c.RemoteWrite.Username)
+	envString("REMOTE_WRITE_PASSWORD", &c.RemoteWrite.Password)
+	envString("REMOTE_WRITE_TENANT", &c.RemoteWrite.Tenant)
+	envString("VM_IMPORT_URL", &c.VMImport.URL)
+	envSeconds("VM_IMPORT_INTERVAL", &c.VMImport.Interval)
+	envString("VM_IMPORT_USERNAME", &c.VMImport.Username)
+	envString("VM_IMPORT_PASSWORD", &c.VMImport.Password)
+
+	envString("LINE_OUTPUT_TEMPLATE", &c.LineOutput.Template)
+	envString("LINE_OUTPUT_SINK", &c.LineOutput.Sink)
+	envSeconds("LINE_OUTPUT_INTERVAL", &c.LineOutput.Interval)
+	envBool("LINE_OUTPUT_CHANGED_ONLY", &c.LineOutput.ChangedOnly)
+	envFloat("LINE_OUTPUT_CHANGED_EPSILON", &c.LineOutput.ChangedEpsilon)
+
+	envString("LOG_LEVEL", &c.Log.Level)
+	envString("LOG_FORMAT", &c.Log.Format)
+	envString("TLS_CLIENT_CERT", &c.TLS.ClientCert)
+	envString("TLS_CLIENT_KEY", &c.TLS.ClientKey)
+	envString("MODEM_PROXY", &c.Proxy.URL)
+	envString("MODEMS_DIR", &c.ModemsDir.Path)
+	envDuration("MODEMS_DIR_RESCAN_INTERVAL", &c.ModemsDir.RescanInterval)
+
+	if raw := os.Getenv("AGGREGATE_SOURCES"); raw != "" {
+		c.Aggregate.Sources = nil
+		for _, item := range strings.Split(raw, ",") {
+			source, err := ParseAggregateSource(item)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("AGGREGATE_SOURCES: %v", err))
+				continue
+			}
+			c.Aggregate.Sources = append(c.Aggregate.Sources, source)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Validate checks that the config is complete and consistent
+func (c *Config) Validate() error {
+	var errs []string
+
+	// An aggregator serves the metrics of other exporters rather than modems,
+	// and a modems directory may be empty until files are added
+	if len(c.Modems) == 0 && len(c.Aggregate.Sources) == 0 && c.ModemsDir.Path == "" {
+		errs = append(errs, "no modems configured")
+	}
+	for i, modem := range c.Modems {
+		errs = append(errs, validateModem(fmt.Sprintf("modems[%d]", i), modem)...)
+	}
+	if c.ModemsDir.Path != "" && c.ModemsDir.RescanInterval <= 0 {
+		errs = append(errs, "modems_dir.rescan_interval must be positive")
+	}
+
+	if c.Prometheus.Port < 0 || c.Prometheus.Port > 65535 {
+		errs = append(errs, fmt.Sprintf("prometheus.port %d is out of range", c.Prometheus.Port))
+	}
+	if c.Prometheus.FlapWindow <= 0 {
+		errs = append(errs, "prometheus.flap_window must be positive")
+	}
+	if c.Prometheus.MaxUpstreamPower <= 0 {
+		errs = append(errs, "prometheus.max_upstream_power must be positive")
+	}
+	if c.Prometheus.WatchdogThreshold < 0 {
+		errs = append(errs, "prometheus.watchdog_threshold must not be negative")
+	}
+	if c.Prometheus.MinScrapeInterval < 0 {
+		errs = append(errs, "prometheus.min_scrape_interval must not be negative")
+	}
+	if c.Prometheus.CollectTimeout < 0 {
+		errs = append(errs, "prometheus.collect_timeout must not be negative")
+	}
+	if c.Prometheus.FetchInterval < 0 {
+		errs = append(errs, "prometheus.fetch_interval must not be negative")
+	}
+	if !c.Prometheus.DownstreamBand.valid() {
+		errs = append(errs, "prometheus.downstream_band must have 0 <= min_hz < max_hz")
+	}
+	if !c.Prometheus.UpstreamBand.valid() {
+		errs = append(errs, "prometheus.upstream_band must have 0 <= min_hz < max_hz")
+	}
+	if !c.Prometheus.HealthWeights.valid() {
+		errs = append(errs, "prometheus.health_weights must not be negative, and must not all be 0")
+	}
+	if !c.Prometheus.StatusThresholds.valid() {
+		errs = append(errs, "prometheus.status_thresholds must have 0 <= power_good_dbmv <= power_warn_dbmv and 0 <= snr_warn_db <= snr_good_db")
+	}
+	if c.Prometheus.ExpectedDownstreamChannels < 0 || c.Prometheus.ExpectedUpstreamChannels < 0 {
+		errs = append(errs, "prometheus.expected_downstream_channels and expected_upstream_channels must not be negative")
+	}
+	if c.Prometheus.SnapshotDir != "" {
+		if c.Prometheus.SnapshotMaxFiles <= 0 {
+			errs = append(errs, "prometheus.snapshot_max_files must be positive")
+		}
+		if len(c.Modems) > 1 || c.ModemsDir.Path != "" {
+			errs = append(errs, "prometheus.snapshot_dir is only supported with a single modem")
+		}
+	}
+
+	if c.Loki.Endpoint != "" {
+		if _, err := url.ParseRequestURI(c.Loki.Endpoint); err != nil {
+			errs = append(errs, fmt.Sprintf("loki.endpoint is not a valid URL: %v", err))
+		}
+		for i, endpoint := range c.Loki.FailoverEndpoints {
+			if _, err := url.ParseRequestURI(endpoint); err != nil {
+				errs = append(errs, fmt.Sprintf("loki.failover_endpoints[%d] is not a valid URL: %v", i, err))
+			}
+		}
+		if c.Loki.PollInterval <= 0 {
+			errs = append(errs, "loki.poll_interval must be positive")
+		}
+	}
+	if c.Loki.MaxAge < 0 {
+		errs = append(errs, "loki.max_age must not be negative")
+	}
+	if !outputs.IsKnownLokiEncoding(c.Loki.Encoding) {
+		errs = append(errs, fmt.Sprintf("loki.encoding %q is unknown (expected one of %s)", c.Loki.Encoding, strings.Join(outputs.LokiEncodings, ", ")))
+	}
+
+	if c.RemoteWrite.URL != "" {
+		if _, err := url.ParseRequestURI(c.RemoteWrite.URL); err != nil {
+			errs = append(errs, fmt.Sprintf("remote_write.url is not a valid URL: %v", err))
+		}
+		if c.RemoteWrite.Interval <= 0 {
+			errs = append(errs, "remote_write.interval must be positive")
+		}
+	}
+
+	if c.VMImport.URL != "" {
+		if _, err := url.ParseRequestURI(c.VMImport.URL); err != nil {
+			errs = append(errs, fmt.Sprintf("vm_import.url is not a valid URL: %v", err))
+		}
+		if c.VMImport.Interval <= 0 {
+			errs = append(errs, "vm_import.interval must be positive")
+		}
+	}
+
+	if c.LineOutput.Sink != "" {
+		if _, err := outputs.ParseLineSink(c.LineOutput.Sink); err != nil {
+			errs = append(errs, fmt.Sprintf("line_output.sink: %v", err))
+		}
+		if c.LineOutput.Template == "" {
+			errs = append(errs, "line_output.template is required with a sink")
+		} else if _, err := outputs.ParseLineTemplate(c.LineOutput.Template); err != nil {
+			errs = append(errs, fmt.Sprintf("line_output.template: %v", err))
+		}
+		if c.LineOutput.Interval <= 0 {
+			errs = append(errs, "line_output.interval must be positive")
+		}
+		if c.LineOutput.ChangedEpsilon < 0 {
+			errs = append(errs, "line_output.changed_epsilon must not be negative")
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, source := range c.Aggregate.Sources {
+		if source.Name == "" {
+			errs = append(errs, fmt.Sprintf("aggregate.sources[%d]: name is required", i))
+		} else if names[source.Name] {
+			errs = append(errs, fmt.Sprintf("aggregate.sources[%d]: name %q is used more than once", i, source.Name))
+		}
+		names[source.Name] = true
+		if _, err := url.ParseRequestURI(source.URL); err != nil {
+			errs = append(errs, fmt.Sprintf("aggregate.sources[%d]: url is not a valid URL: %v", i, err))
+		}
+	}
+	if len(c.Aggregate.Sources) > 0 && c.Prometheus.Port == 0 && c.Prometheus.Socket == "" {
+		errs = append(errs, "aggregate requires prometheus.port or prometheus.socket")
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Sprintf("log.level: %v", err))
+	}
+	if !logging.ValidFormat(c.Log.Format) {
+		errs = append(errs, fmt.Sprintf("log.format %q is unknown (expected text or json)", c.Log.Format))
+	}
+
+	if (c.TLS.ClientCert == "") != (c.TLS.ClientKey == "") {
+		errs = append(errs, "tls.client_cert and tls.client_key must be set together")
+	}
+	if c.Proxy.URL != "" {
+		if _, err := utils.ParseProxy(c.Proxy.URL); err != nil {
+			errs = append(errs, fmt.Sprintf("proxy.url: %v", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// validateModem checks the config of a modem, named in any errors
+func validateModem(name string, modem modems.Config) []string {
+	var errs []string
+	if modem.Type == "" {
+		errs = append(errs, fmt.Sprintf("%s: type is required", name))
+	} else if !modems.IsKnownType(modem.Type) {
+		errs = append(errs, fmt.Sprintf("%s: unknown type %q (expected one of %s)", name, modem.Type, strings.Join(modems.Types, ", ")))
+	}
+	if !superhub5.IsKnownOFDMPowerScale(modem.OFDMPowerScale) {
+		errs = append(errs, fmt.Sprintf("%s: unknown ofdm_power_scale %q (expected one of %s)", name, modem.OFDMPowerScale, strings.Join(superhub5.OFDMPowerScales, ", ")))
+	}
+	if !superhub5.IsKnownScheme(modem.Scheme) {
+		errs = append(errs, fmt.Sprintf("%s: unknown scheme %q (expected one of %s)", name, modem.Scheme, strings.Join(superhub5.Schemes, ", ")))
+	}
+	for _, endpoint := range modem.Endpoints {
+		if !superhub5.IsKnownEndpoint(endpoint) {
+			errs = append(errs, fmt.Sprintf("%s: unknown endpoint %q (expected one of %s)", name, endpoint, strings.Join(superhub5.Endpoints, ", ")))
+		}
+	}
+	if modem.Type == modems.TypeJSONMap {
+		if modem.URL == "" {
+			errs = append(errs, fmt.Sprintf("%s: url is required for a %s modem", name, modems.TypeJSONMap))
+		}
+		for _, err := range modem.Mapping.Validate() {
+			errs = append(errs, fmt.Sprintf("%s: %s", name, err))
+		}
+	}
+	return errs
+}
+
+// Logger returns the logger for the config, which must be valid
+func (c *Config) Logger(out io.Writer) *logging.Logger {
+	level, _ := logging.ParseLevel(c.Log.Level)
+	return logging.New(out, level, c.Log.Format)
+}
+
+// AggregateSources returns the remote exporters to aggregate
+func (c *Config) AggregateSources() []outputs.AggregateSource {
+	var sources []outputs.AggregateSource
+	for _, source := range c.Aggregate.Sources {
+		sources = append(sources, outputs.AggregateSource{Name: source.Name, URL: source.URL})
+	}
+	return sources
+}
+
+// ExporterOptions returns the Prometheus exporter options for the config
+func (c *Config) ExporterOptions() []outputs.ExporterOption {
+	opts := []outputs.ExporterOption{
+		outputs.WithDisabledMetrics(c.Prometheus.DisabledMetrics...),
+		outputs.WithFlapWindow(c.Prometheus.FlapWindow),
+		outputs.WithMaxUpstreamPower(c.Prometheus.MaxUpstreamPower),
+		outputs.WithWatchdog(c.Prometheus.WatchdogThreshold, c.Prometheus.WatchdogReboot),
+		outputs.WithFrequencyBands(
+			outputs.FrequencyBand{Min: c.Prometheus.DownstreamBand.MinHz, Max: c.Prometheus.DownstreamBand.MaxHz},
+			outputs.FrequencyBand{Min: c.Prometheus.UpstreamBand.MinHz, Max: c.Prometheus.UpstreamBand.MaxHz},
+		),
+		outputs.WithHealthWeights(outputs.HealthWeights{
+			Lock:   c.Prometheus.HealthWeights.Lock,
+			SNR:    c.Prometheus.HealthWeights.SNR,
+			Power:  c.Prometheus.HealthWeights.Power,
+			Errors: c.Prometheus.HealthWeights.Errors,
+		}),
+		outputs.WithStatusThresholds(outputs.StatusThresholds{
+			PowerGood: c.Prometheus.StatusThresholds.PowerGood,
+			PowerWarn: c.Prometheus.StatusThresholds.PowerWarn,
+			SNRGood:   c.Prometheus.StatusThresholds.SNRGood,
+			SNRWarn:   c.Prometheus.StatusThresholds.SNRWarn,
+		}),
+	}
+	if c.Prometheus.ChannelIDLabels {
+		opts = append(opts, outputs.WithChannelIDLabels())
+	}
+	if c.Prometheus.ClockOffset {
+		opts = append(opts, outputs.WithClockOffset())
+	}
+	if c.Prometheus.EventCounts {
+		opts = append(opts, outputs.WithEventCounts())
+	}
+	if c.Prometheus.CounterDeltas {
+		opts = append(opts, outputs.WithCounterDeltas())
+	}
+	if c.Prometheus.ErrorHistogram {
+		opts = append(opts, outputs.WithErrorHistogram())
+	}
+	if c.Prometheus.MinScrapeInterval > 0 {
+		opts = append(opts, outputs.WithMinScrapeInterval(c.Prometheus.MinScrapeInterval))
+	}
+	if c.Prometheus.CollectTimeout > 0 {
+		opts = append(opts, outputs.WithCollectTimeout(c.Prometheus.CollectTimeout))
+	}
+	if c.Prometheus.FetchInterval > 0 {
+		opts = append(opts, outputs.WithFetchInterval(c.Prometheus.FetchInterval))
+	}
+	if c.Prometheus.FetchTimestamps {
+		opts = append(opts, outputs.WithFetchTimestamps())
+	}
+	if c.Prometheus.ExpectedDownstreamChannels > 0 || c.Prometheus.ExpectedUpstreamChannels > 0 {
+		opts = append(opts, outputs.WithExpectedChannels(c.Prometheus.ExpectedDownstreamChannels, c.Prometheus.ExpectedUpstreamChannels))
+	}
+	if c.Prometheus.SkipFirstCounters {
+		opts = append(opts, outputs.WithFirstScrapeCountersSkipped())
+	}
+	if len(c.Prometheus.ExcludedChannels) > 0 {
+		opts = append(opts, outputs.WithExcludedChannels(c.Prometheus.ExcludedChannels...))
+	}
+	if c.Prometheus.MACLabel {
+		opts = append(opts, outputs.WithMACLabel())
+	}
+	if c.Prometheus.DebugEndpoints {
+		opts = append(opts, outputs.WithDebugEndpoints())
+	}
+	if c.Prometheus.SnapshotDir != "" {
+		opts = append(opts, outputs.WithSnapshots(c.Prometheus.SnapshotDir, c.Prometheus.SnapshotMaxFiles))
+	}
+	return opts
+}
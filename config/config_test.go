@@ -0,0 +1,244 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/msh100/modem-stats/modems"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clearEnv unsets the environment variables which override the config
+func clearEnv(t *testing.T) {
+	for _, key := range []string{
+		"ROUTER_TYPE", "ROUTER_IP", "ROUTER_USER", "ROUTER_PASS", "SH_VERSION", "MODEM_1_TYPE",
+		"ROUTER_OFDM_POWER_SCALE", "ROUTER_ENDPOINTS", "ROUTER_SCHEME",
+		"PROMETHEUS_PORT", "PROMETHEUS_SOCKET", "DISABLED_METRICS", "FLAP_WINDOW", "MAX_UPSTREAM_POWER", "CHANNEL_ID_LABELS",
+		"WATCHDOG_THRESHOLD", "WATCHDOG_REBOOT", "CLOCK_OFFSET", "EVENT_COUNTS", "COUNTER_DELTAS", "ERROR_HISTOGRAM", "SKIP_FIRST_COUNTERS", "MIN_SCRAPE_INTERVAL", "COLLECT_TIMEOUT", "FETCH_INTERVAL", "FETCH_TIMESTAMPS",
+		"DOWNSTREAM_BAND_MIN_HZ", "DOWNSTREAM_BAND_MAX_HZ", "UPSTREAM_BAND_MIN_HZ", "UPSTREAM_BAND_MAX_HZ",
+		"HEALTH_WEIGHT_LOCK", "HEALTH_WEIGHT_SNR", "HEALTH_WEIGHT_POWER", "HEALTH_WEIGHT_ERRORS",
+		"POWER_STATUS_GOOD_DBMV", "POWER_STATUS_WARN_DBMV", "SNR_STATUS_GOOD_DB", "SNR_STATUS_WARN_DB",
+		"EXPECTED_DOWNSTREAM_CHANNELS", "EXPECTED_UPSTREAM_CHANNELS", "EXCLUDED_CHANNELS",
+		"LOKI_ENDPOINT", "LOKI_FAILOVER_ENDPOINTS", "LOKI_POLL_INTERVAL", "LOKI_MAX_AGE", "LOKI_ENCODING",
+		"REMOTE_WRITE_URL", "REMOTE_WRITE_INTERVAL", "REMOTE_WRITE_USERNAME", "REMOTE_WRITE_PASSWORD", "REMOTE_WRITE_TENANT",
+		"VM_IMPORT_URL", "VM_IMPORT_INTERVAL", "VM_IMPORT_USERNAME", "VM_IMPORT_PASSWORD",
+		"SNAPSHOT_DIR", "SNAPSHOT_MAX_FILES", "MAC_LABEL", "DEBUG_ENDPOINTS", "PROBE_ENDPOINT",
+		"LINE_OUTPUT_TEMPLATE", "LINE_OUTPUT_SINK", "LINE_OUTPUT_INTERVAL", "LINE_OUTPUT_CHANGED_ONLY", "LINE_OUTPUT_CHANGED_EPSILON",
+		"LOG_LEVEL", "LOG_FORMAT", "TLS_CLIENT_CERT", "TLS_CLIENT_KEY", "MODEM_PROXY", "AGGREGATE_SOURCES",
+		"MODEMS_DIR", "MODEMS_DIR_RESCAN_INTERVAL",
+	} {
+		t.Setenv(key, "")
+	}
+}
+
+func writeConfig(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+	return path
+}
+
+func TestLoad_Example(t *testing.T) {
+	clearEnv(t)
+
+	config, err := Load("../config.example.yaml")
+	require.NoError(t, err)
+
+	assert.Equal(t, []modems.Config{
+		{Type: "superhub5", IPAddress: "192.168.100.1", Labels: map[string]string{"modem": "upstairs"}},
+		{Type: "tc4400", IPAddress: "192.168.100.2", Username: "user", Password: "password", Labels: map[string]string{"modem": "office"}},
+	}, config.Modems)
+	assert.Equal(t, Prometheus{
+		Port:             9000,
+		DisabledMetrics:  []string{"upstream_t1_timeout_total"},
+		FlapWindow:       15 * time.Minute,
+		MaxUpstreamPower: 54,
+
+		WatchdogThreshold: 5,
+		SnapshotMaxFiles:  100,
+
+		DownstreamBand: Band{MinHz: 54000000, MaxHz: 1218000000},
+		UpstreamBand:   Band{MinHz: 5000000, MaxHz: 65000000},
+
+		HealthWeights:    HealthWeights{Lock: 1, SNR: 1, Power: 1, Errors: 1},
+		StatusThresholds: StatusThresholds{PowerGood: 7, PowerWarn: 15, SNRGood: 33, SNRWarn: 30},
+	}, config.Prometheus)
+	assert.Equal(t, Loki{
+		Endpoint:     "http://loki:3100/loki/api/v1/push",
+		Labels:       map[string]string{"site": "home"},
+		PollInterval: time.Minute,
+		MaxAge:       168 * time.Hour,
+		Encoding:     "gzip",
+
+		FailoverEndpoints: []string{"http://loki-backup:3100/loki/api/v1/push"},
+	}, config.Loki)
+	assert.Equal(t, RemoteWrite{
+		URL:      "https://mimir:9009/api/v1/push",
+		Interval: time.Minute,
+		Tenant:   "home",
+	}, config.RemoteWrite)
+	assert.Equal(t, Default().VMImport, config.VMImport)
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	clearEnv(t)
+
+	config, err := Load(writeConfig(t, `{"modems": [{"type": "superhub3"}]}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, Default().Prometheus, config.Prometheus)
+	assert.Equal(t, Default().Loki, config.Loki)
+	assert.Equal(t, Default().RemoteWrite, config.RemoteWrite)
+	assert.Equal(t, Default().VMImport, config.VMImport)
+	assert.Equal(t, Default().LineOutput, config.LineOutput)
+}
+
+func TestLoad_EnvOverridesFile(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("PROMETHEUS_PORT", "9100")
+	t.Setenv("LOKI_POLL_INTERVAL", "30")
+	t.Setenv("ROUTER_IP", "192.168.0.1")
+
+	config, err := Load(writeConfig(t, `
+modems:
+  - type: superhub5
+    ip: 192.168.100.1
+prometheus:
+  port: 9000
+loki:
+  endpoint: http://loki:3100/loki/api/v1/push
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, 9100, config.Prometheus.Port)
+	assert.Equal(t, 30*time.Second, config.Loki.PollInterval)
+	assert.Equal(t, "192.168.0.1", config.Modems[0].IPAddress)
+	assert.Equal(t, "superhub5", config.Modems[0].Type)
+}
+
+func TestLoad_ExcludedChannels(t *testing.T) {
+	clearEnv(t)
+
+	config, err := Load(writeConfig(t, `
+modems:
+  - type: superhub5
+prometheus:
+  excluded_channels: [3, 17]
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []int{3, 17}, config.Prometheus.ExcludedChannels)
+
+	t.Setenv("EXCLUDED_CHANNELS", "5, 9")
+	config, err = Load(writeConfig(t, `{"modems": [{"type": "superhub5"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, []int{5, 9}, config.Prometheus.ExcludedChannels)
+
+	t.Setenv("EXCLUDED_CHANNELS", "5,nine")
+	_, err = Load(writeConfig(t, `{"modems": [{"type": "superhub5"}]}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "EXCLUDED_CHANNELS must be a list of channel IDs")
+}
+
+func TestLoad_Aggregate(t *testing.T) {
+	clearEnv(t)
+
+	config, err := Load(writeConfig(t, `
+prometheus:
+  port: 9000
+aggregate:
+  sources:
+    - name: upstairs
+      url: http://pi-upstairs:9000/metrics
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []AggregateSource{{Name: "upstairs", URL: "http://pi-upstairs:9000/metrics"}}, config.Aggregate.Sources)
+
+	t.Setenv("AGGREGATE_SOURCES", "upstairs=http://pi-upstairs:9000/metrics,office=http://pi-office:9000/metrics")
+	config, err = Load(writeConfig(t, `prometheus: {port: 9000}`))
+	require.NoError(t, err)
+	assert.Equal(t, []AggregateSource{
+		{Name: "upstairs", URL: "http://pi-upstairs:9000/metrics"},
+		{Name: "office", URL: "http://pi-office:9000/metrics"},
+	}, config.Aggregate.Sources)
+
+	t.Setenv("AGGREGATE_SOURCES", "upstairs=http://pi-upstairs:9000/metrics,upstairs=not a url")
+	_, err = Load(writeConfig(t, `{}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `aggregate.sources[1]: name "upstairs" is used more than once`)
+	assert.Contains(t, err.Error(), "aggregate.sources[1]: url is not a valid URL")
+	assert.Contains(t, err.Error(), "aggregate requires prometheus.port or prometheus.socket")
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	clearEnv(t)
+
+	_, err := Load(writeConfig(t, `
+modems:
+  - type: superhub9
+  - type: superhub5
+    ofdm_power_scale: millivolts
+    endpoints: [downstream, eventlog]
+    scheme: ftp
+  - type: jsonmap
+    mapping:
+      downstream:
+        fields: {channel_id: id, noise: noise}
+prometheus:
+  port: 70000
+  snapshot_dir: /var/lib/modem-stats/snapshots
+  snapshot_max_files: 0
+  health_weights: {lock: -1}
+  status_thresholds: {power_good_dbmv: 10, power_warn_dbmv: 7}
+remote_write:
+  url: not a url
+vm_import:
+  url: http://victoriametrics:8428/api/v1/import/prometheus
+  interval: 0s
+line_output:
+  sink: graphite:2003
+  template: "{{ .Channel.Power"
+log:
+  level: verbose
+  format: xml
+tls:
+  client_cert: /etc/modem-stats/client.crt
+proxy:
+  url: ftp://jumphost:21
+loki:
+  encoding: brotli
+`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `modems[0]: unknown type "superhub9"`)
+	assert.Contains(t, err.Error(), `modems[1]: unknown ofdm_power_scale "millivolts"`)
+	assert.Contains(t, err.Error(), `modems[1]: unknown endpoint "eventlog"`)
+	assert.Contains(t, err.Error(), `modems[1]: unknown scheme "ftp"`)
+	assert.Contains(t, err.Error(), "modems[2]: url is required for a jsonmap modem")
+	assert.Contains(t, err.Error(), "modems[2]: mapping needs the channels path of at least one direction")
+	assert.Contains(t, err.Error(), `modems[2]: mapping.downstream has unknown field "noise"`)
+	assert.Contains(t, err.Error(), "prometheus.port 70000 is out of range")
+	assert.Contains(t, err.Error(), "prometheus.snapshot_max_files must be positive")
+	assert.Contains(t, err.Error(), "prometheus.health_weights must not be negative")
+	assert.Contains(t, err.Error(), "prometheus.status_thresholds must have 0 <= power_good_dbmv <= power_warn_dbmv")
+	assert.Contains(t, err.Error(), "prometheus.snapshot_dir is only supported with a single modem")
+	assert.Contains(t, err.Error(), "remote_write.url is not a valid URL")
+	assert.Contains(t, err.Error(), "vm_import.interval must be positive")
+	assert.Contains(t, err.Error(), "tls.client_cert and tls.client_key must be set together")
+	assert.Contains(t, err.Error(), `proxy.url: invalid proxy "ftp://jumphost:21"`)
+	assert.Contains(t, err.Error(), `loki.encoding "brotli" is unknown`)
+	assert.Contains(t, err.Error(), `line_output.sink: sink "graphite:2003" must be one of tcp, udp, file`)
+	assert.Contains(t, err.Error(), "line_output.template: template: line:1: unclosed action")
+	assert.Contains(t, err.Error(), `unknown log level "verbose"`)
+	assert.Contains(t, err.Error(), `log.format "xml" is unknown`)
+
+	_, err = Load(writeConfig(t, `prometheus: {port: 9000}`))
+	assert.EqualError(t, err, "invalid config: no modems configured")
+
+	_, err = Load(writeConfig(t, `modems: [{type: superhub5, adress: 192.168.0.1}]`))
+	assert.Error(t, err, "unknown fields should be rejected")
+
+	t.Setenv("PROMETHEUS_PORT", "ninety")
+	_, err = Load(writeConfig(t, `modems: [{type: superhub5}]`))
+	assert.EqualError(t, err, `PROMETHEUS_PORT must be a number, got "ninety"`)
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/msh100/modem-stats/modems"
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultModemsDirRescanInterval is how often a modems directory is rescanned
+// when not configured
+const DefaultModemsDirRescanInterval = 30 * time.Second
+
+// modemFileExtensions are those of the files read from a modems directory,
+// others (such as editor backups) being ignored
+var modemFileExtensions = []string{".yaml", ".yml", ".json"}
+
+// ModemsDirWatcher reads a config file for each modem from a directory,
+// tracking the files added, changed and removed. Each modem is named by its
+// file name without the extension.
+type ModemsDirWatcher struct {
+	dir string
+
+	// configs are those committed as applied
+	configs map[string]modems.Config
+}
+
+// NewModemsDirWatcher creates a watcher for a directory, which is not read
+// until the first Reload
+func NewModemsDirWatcher(dir string) *ModemsDirWatcher {
+	return &ModemsDirWatcher{dir: dir, configs: make(map[string]modems.Config)}
+}
+
+// Reload rereads the directory, returning the configs of the modems whose
+// file differs from the config last committed, and the names of those whose
+// file was removed. A file which cannot be read or is invalid keeps its
+// previous config, so a half-written file does not drop its modem, and is
+// reported in the error.
+//
+// A config is reported by every reload until committed, so one which could
+// not be applied (such as for giving the labels of another modem) is retried.
+func (w *ModemsDirWatcher) Reload() (map[string]modems.Config, []string, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read modems directory: %w", err)
+	}
+
+	var errs []string
+	seen := make(map[string]bool)
+	changed := make(map[string]modems.Config)
+	for _, entry := range entries {
+		name, ok := modemFileName(entry)
+		if !ok {
+			continue
+		}
+		if seen[name] {
+			errs = append(errs, fmt.Sprintf("%s: modem %q is already configured by another file", entry.Name(), name))
+			continue
+		}
+		seen[name] = true
+
+		config, err := loadModemFile(filepath.Join(w.dir, entry.Name()))
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if previous, ok := w.configs[name]; !ok || !reflect.DeepEqual(previous, config) {
+			changed[name] = config
+		}
+	}
+
+	var removed []string
+	for name := range w.configs {
+		if !seen[name] {
+			delete(w.configs, name)
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+
+	if len(errs) > 0 {
+		return changed, removed, fmt.Errorf("invalid modem config: %s", strings.Join(errs, "; "))
+	}
+	return changed, removed, nil
+}
+
+// Commit records the config of a modem as applied, so it is no longer
+// reported by Reload until its file changes
+func (w *ModemsDirWatcher) Commit(name string, config modems.Config) {
+	w.configs[name] = config
+}
+
+// Watch reloads the directory on an interval, passing any changes to apply
+// along with any error. apply is to commit each config it applies.
+func (w *ModemsDirWatcher) Watch(interval time.Duration, apply func(changed map[string]modems.Config, removed []string, err error)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			changed, removed, err := w.Reload()
+			if len(changed) > 0 || len(removed) > 0 || err != nil {
+				apply(changed, removed, err)
+			}
+		}
+	}()
+}
+
+// modemFileName returns the name of the modem configured by a directory
+// entry, false if it is not a modem config file
+func modemFileName(entry os.DirEntry) (string, bool) {
+	if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+		return "", false
+	}
+	ext := filepath.Ext(entry.Name())
+	for _, known := range modemFileExtensions {
+		if ext == known {
+			return strings.TrimSuffix(entry.Name(), ext), true
+		}
+	}
+	return "", false
+}
+
+// loadModemFile reads and validates the config of a single modem
+func loadModemFile(path string) (modems.Config, error) {
+	var config modems.Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return config, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	if errs := validateModem(filepath.Base(path), config); len(errs) > 0 {
+		return config, errors.New(strings.Join(errs, "; "))
+	}
+	return config, nil
+}
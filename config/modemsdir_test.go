@@ -0,0 +1,122 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/msh100/modem-stats/modems"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeModemFile(t *testing.T, dir, name, contents string) {
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644))
+}
+
+// commitAll commits every changed config, as when each is applied
+func commitAll(watcher *ModemsDirWatcher, changed map[string]modems.Config) {
+	for name, config := range changed {
+		watcher.Commit(name, config)
+	}
+}
+
+func TestModemsDirWatcher_Reload(t *testing.T) {
+	dir := t.TempDir()
+	writeModemFile(t, dir, "upstairs.yaml", "type: superhub5\nip: 192.168.100.1\n")
+	writeModemFile(t, dir, "office.yml", "type: tc4400\nip: 192.168.100.2\nusername: user\npassword: password\n")
+	writeModemFile(t, dir, "README.md", "Not a modem")
+
+	watcher := NewModemsDirWatcher(dir)
+	changed, removed, err := watcher.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]modems.Config{
+		"upstairs": {Type: "superhub5", IPAddress: "192.168.100.1"},
+		"office":   {Type: "tc4400", IPAddress: "192.168.100.2", Username: "user", Password: "password"},
+	}, changed)
+	assert.Empty(t, removed)
+	commitAll(watcher, changed)
+
+	// Nothing has changed
+	changed, removed, err = watcher.Reload()
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+	assert.Empty(t, removed)
+
+	writeModemFile(t, dir, "garage.json", `{"type": "s33", "ip": "192.168.100.3", "labels": {"site": "garage"}}`)
+	changed, removed, err = watcher.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]modems.Config{
+		"garage": {Type: "s33", IPAddress: "192.168.100.3", Labels: map[string]string{"site": "garage"}},
+	}, changed)
+	assert.Empty(t, removed)
+	commitAll(watcher, changed)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "office.yml")))
+	writeModemFile(t, dir, "upstairs.yaml", "type: superhub5\nip: 192.168.0.1\n")
+	changed, removed, err = watcher.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]modems.Config{
+		"upstairs": {Type: "superhub5", IPAddress: "192.168.0.1"},
+	}, changed)
+	assert.Equal(t, []string{"office"}, removed)
+}
+
+func TestModemsDirWatcher_InvalidFileKeepsModem(t *testing.T) {
+	dir := t.TempDir()
+	writeModemFile(t, dir, "upstairs.yaml", "type: superhub5\n")
+
+	watcher := NewModemsDirWatcher(dir)
+	changed, _, err := watcher.Reload()
+	require.NoError(t, err)
+	commitAll(watcher, changed)
+
+	writeModemFile(t, dir, "upstairs.yaml", "type: superhub9\n")
+	changed, removed, err := watcher.Reload()
+	assert.EqualError(t, err, `invalid modem config: upstairs.yaml: unknown type "superhub9" (expected one of superhub3, superhub4, superhub5, ubee, comhemc2, tc4400, s33, cgnv4, jsonmap, auto)`)
+	assert.Empty(t, changed)
+	assert.Empty(t, removed)
+}
+
+func TestModemsDirWatcher_UncommittedRetried(t *testing.T) {
+	dir := t.TempDir()
+	writeModemFile(t, dir, "upstairs.yaml", "type: superhub5\nlabels:\n  modem: home\n")
+	writeModemFile(t, dir, "office.yaml", "type: tc4400\nlabels:\n  modem: home\n")
+
+	// Only the first is applied, the second giving the same labels
+	watcher := NewModemsDirWatcher(dir)
+	changed, _, err := watcher.Reload()
+	require.NoError(t, err)
+	watcher.Commit("upstairs", changed["upstairs"])
+
+	changed, removed, err := watcher.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]modems.Config{
+		"office": {Type: "tc4400", Labels: map[string]string{"modem": "home"}},
+	}, changed, "a config not applied should be reported again")
+	assert.Empty(t, removed)
+
+	// Once the conflicting file is removed, the retried config applies
+	require.NoError(t, os.Remove(filepath.Join(dir, "upstairs.yaml")))
+	changed, removed, err = watcher.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]modems.Config{
+		"office": {Type: "tc4400", Labels: map[string]string{"modem": "home"}},
+	}, changed)
+	assert.Equal(t, []string{"upstairs"}, removed)
+	commitAll(watcher, changed)
+
+	changed, removed, err = watcher.Reload()
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+	assert.Empty(t, removed)
+}
+
+func TestLoad_ModemsDir(t *testing.T) {
+	clearEnv(t)
+
+	config, err := Load(writeConfig(t, "modems_dir:\n  path: /etc/modem-stats/modems\n"))
+	require.NoError(t, err)
+	assert.Empty(t, config.Modems)
+	assert.Equal(t, ModemsDir{Path: "/etc/modem-stats/modems", RescanInterval: DefaultModemsDirRescanInterval}, config.ModemsDir)
+}
@@ -4,10 +4,14 @@ go 1.15
 
 require (
 	github.com/Jeffail/gabs/v2 v2.6.0
-	github.com/PuerkitoBio/goquery v1.7.1 // indirect
-	github.com/evanphx/json-patch v0.5.2 // indirect
-	github.com/evanphx/json-patch/v5 v5.6.0 // indirect
+	github.com/PuerkitoBio/goquery v1.7.1
+	github.com/evanphx/json-patch v0.5.2
+	github.com/golang/snappy v0.0.4
 	github.com/jessevdk/go-flags v1.5.0
-	github.com/prometheus/client_golang v1.11.0
-	github.com/stretchr/testify v1.4.0
+	github.com/prometheus/client_golang v1.18.0
+	github.com/prometheus/client_model v0.5.0
+	github.com/prometheus/common v0.45.0
+	github.com/stretchr/testify v1.8.2
+	google.golang.org/protobuf v1.31.0
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -2,69 +2,418 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"net/http"
 	"os"
-	"strconv"
+	"strings"
 	"time"
 
 	flags "github.com/jessevdk/go-flags"
-	"github.com/msh100/modem-stats/modems/comhemc2"
-	"github.com/msh100/modem-stats/modems/superhub3"
-	"github.com/msh100/modem-stats/modems/superhub4"
-	"github.com/msh100/modem-stats/modems/superhub5"
-	"github.com/msh100/modem-stats/modems/tc4400"
-	"github.com/msh100/modem-stats/modems/ubee"
+	"github.com/msh100/modem-stats/config"
+	"github.com/msh100/modem-stats/modems"
 	"github.com/msh100/modem-stats/outputs"
 	"github.com/msh100/modem-stats/utils"
+	"github.com/msh100/modem-stats/utils/httprecord"
+	"github.com/msh100/modem-stats/utils/logging"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 var commandLineOpts struct {
-	Daemon         bool   `short:"d" long:"daemon" description:"Gather statistics on new line to STDIN"`
-	PrometheusPort int    `short:"p" long:"port" description:"Prometheus exporter port (disabled if not defined)"`
-	Modem          string `short:"m" long:"modem" description:"Which modem to use" default:"superhub3"`
-	ModemIP        string `long:"ip" description:"The modem's IP address"`
-	Username       string `long:"username" description:"The modem's username (if applicable)"`
-	Password       string `long:"password" description:"The modem's password (if applicable)"`
+	Daemon         bool          `short:"d" long:"daemon" description:"Gather statistics on new line to STDIN"`
+	ChangedOnly    bool          `long:"changed-only" description:"With --daemon, leave out values which have not changed since last printed (counters are always printed)"`
+	ChangedEpsilon float64       `long:"changed-epsilon" description:"How far a value must move to be printed again with --changed-only"`
+	PrometheusPort int           `short:"p" long:"port" description:"Prometheus exporter port (disabled if not defined)"`
+	PrometheusSock string        `long:"socket" description:"Serve the Prometheus exporter on this Unix socket instead of a port"`
+	Modem          string        `short:"m" long:"modem" description:"Which modem to use" default:"superhub3"`
+	ModemIP        string        `long:"ip" description:"The modem's IP address"`
+	Username       string        `long:"username" description:"The modem's username (if applicable)"`
+	Password       string        `long:"password" description:"The modem's password (if applicable)"`
+	OFDMPowerScale string        `long:"ofdm-power-scale" description:"Unit of OFDM channel power reported by a superhub5 (auto, tenths or dbmv)" default:"auto"`
+	Endpoints      []string      `long:"endpoint" description:"Statistics endpoint a superhub5 fetches (can be repeated, defaults to all)"`
+	Scheme         string        `long:"scheme" description:"Scheme a superhub5 serves its REST API over (https, http or auto)" default:"https"`
+	ModemsDir      string        `long:"modems-dir" description:"Directory of modem config files, one per modem, rescanned for changes (replaces the modem flags)"`
+	ModemsRescan   time.Duration `long:"modems-dir-rescan-interval" description:"Interval on which the modems directory is rescanned" default:"30s"`
+	DisableMetrics []string      `long:"disable-metric" description:"Prometheus metric to disable (can be repeated)"`
+	FlapWindow     time.Duration `long:"flap-window" description:"Window over which recent channel lock flaps are counted" default:"1h"`
+	MaxUpPower     float64       `long:"max-upstream-power" description:"Maximum upstream transmit power in dBmV, for power headroom" default:"51"`
+	ChannelIDLabel bool          `long:"channel-id-labels" description:"Label channels by their ID only, without their position in the modem's list"`
+	WatchdogLimit  int           `long:"watchdog-threshold" description:"Consecutive failed scrapes before the watchdog resets the modem's connections (0 disables)" default:"5"`
+	WatchdogReboot bool          `long:"watchdog-reboot" description:"Also reboot the modem when the watchdog triggers (only for modems which support it)"`
+	ClockOffset    bool          `long:"clock-offset" description:"Report the offset of the modem's clock, fetching its event log along with the statistics"`
+	EventCounts    bool          `long:"event-counts" description:"Count the modem's event log entries by priority and event code, fetching its event log along with the statistics"`
+	CounterDeltas  bool          `long:"counter-deltas" description:"Report how far each channel's error and timeout counters have grown since the last scrape"`
+	ErrorHistogram bool          `long:"error-histogram" description:"Report the growth of each channel's error counters between scrapes as a native histogram"`
+	SkipCounters   bool          `long:"skip-first-counters" description:"Withhold the modem's counters from the first scrape, so rate() starts clean"`
+	MinInterval    time.Duration `long:"min-scrape-interval" description:"Minimum interval between fetches from the modem, quicker scrapes are served the previous result (0 disables)"`
+	CollectTimeout time.Duration `long:"collect-timeout" description:"How long a scrape waits for the modem before being served the previous result (0 waits indefinitely)"`
+	FetchInterval  time.Duration `long:"fetch-interval" description:"Fetch from the modem in the background on this interval, serving scrapes the last result (0 fetches on each scrape)"`
+	FetchStamps    bool          `long:"fetch-timestamps" description:"Stamp metrics with the time they were fetched from the modem rather than the time of the scrape"`
+	DownBandMinHz  int           `long:"downstream-band-min-hz" description:"Lowest expected downstream channel frequency in Hz" default:"54000000"`
+	DownBandMaxHz  int           `long:"downstream-band-max-hz" description:"Highest expected downstream channel frequency in Hz" default:"1218000000"`
+	UpBandMinHz    int           `long:"upstream-band-min-hz" description:"Lowest expected upstream channel frequency in Hz" default:"5000000"`
+	UpBandMaxHz    int           `long:"upstream-band-max-hz" description:"Highest expected upstream channel frequency in Hz" default:"204000000"`
+	HealthLock     float64       `long:"health-weight-lock" description:"Weight of channel lock in the health score" default:"1"`
+	HealthSNR      float64       `long:"health-weight-snr" description:"Weight of SNR margin in the health score" default:"1"`
+	HealthPower    float64       `long:"health-weight-power" description:"Weight of power in range in the health score" default:"1"`
+	HealthErrors   float64       `long:"health-weight-errors" description:"Weight of uncorrectable errors in the health score" default:"1"`
+	PowerGood      float64       `long:"power-status-good" description:"Downstream power within this many dBmV of 0 is graded good" default:"7"`
+	PowerWarn      float64       `long:"power-status-warn" description:"Downstream power within this many dBmV of 0 is graded a warning, beyond is bad" default:"15"`
+	SNRGood        float64       `long:"snr-status-good" description:"Downstream SNR from this many dB is graded good" default:"33"`
+	SNRWarn        float64       `long:"snr-status-warn" description:"Downstream SNR from this many dB is graded a warning, below is bad" default:"30"`
+	ExpectedDown   int           `long:"expected-downstream-channels" description:"Number of downstream channels the modem should bond, for the bonding ratio (0 disables)"`
+	ExpectedUp     int           `long:"expected-upstream-channels" description:"Number of upstream channels the modem should bond, for the bonding ratio (0 disables)"`
+	ExcludeChannel []int         `long:"exclude-channel" description:"ID of a channel to leave out of the metrics (can be repeated)"`
+	DebugEndpoints bool          `long:"debug-endpoints" description:"Serve pages under /debug for inspecting what was scraped, such as /debug/channels"`
+	ProbeEndpoint  bool          `long:"probe-endpoint" description:"Serve /probe, scraping the modem of the type and address given by each request"`
+	MACLabel       bool          `long:"mac-label" description:"Label every metric with the modem's MAC address (if reported)"`
+	SnapshotDir    string        `long:"snapshot-dir" description:"Directory to archive each fetch from the modem in, for later analysis (disabled if not defined)"`
+	SnapshotMax    int           `long:"snapshot-max-files" description:"Number of fetches kept in the snapshot directory" default:"100"`
+	AggregateFrom  []string      `long:"aggregate-source" description:"Remote exporter to aggregate instead of scraping modems, as name=url (can be repeated)"`
+	LogLevel       string        `long:"log-level" description:"Minimum level of log messages (debug, info, warn or error)" default:"info"`
+	LogFormat      string        `long:"log-format" description:"Format of log messages (text or json)" default:"text"`
+	ClientCert     string        `long:"client-cert" description:"Client certificate (PEM file) presented to modems which require mutual TLS"`
+	ClientKey      string        `long:"client-key" description:"Key (PEM file) of the client certificate"`
+	Proxy          string        `long:"proxy" description:"Proxy to reach modems through, such as socks5://localhost:1080 for an SSH tunnel"`
+	Capabilities   bool          `long:"capabilities" description:"Print the statistics the modem populates as JSON and exit"`
+	Spectrum       bool          `long:"spectrum" description:"Print the modem's downstream spectrum as JSON and exit (if supported)"`
+	ConfigFile     string        `short:"c" long:"config" description:"YAML or JSON config file (replaces the other settings flags)"`
 }
 
-func startLokiExporter(modem utils.DocsisModem) {
-	lokiEndpoint := utils.Getenv("LOKI_ENDPOINT", "")
-	if lokiEndpoint == "" {
-		return
+func startLokiExporter(modem utils.DocsisModem, settings config.Loki, modemLabels map[string]string) (*outputs.LokiExporter, error) {
+	if settings.Endpoint == "" {
+		return nil, nil
 	}
 
 	logProvider, ok := modem.(utils.EventLogProvider)
 	if !ok {
-		log.Printf("Loki endpoint configured but modem %T does not support event logs", modem)
-		return
+		logging.Warnf("Loki endpoint configured but modem %T does not support event logs", modem)
+		return nil, nil
 	}
 
 	labels := map[string]string{
 		"job":    "modem-stats",
 		"source": "cablemodem",
 	}
+	for k, v := range settings.Labels {
+		labels[k] = v
+	}
+	for k, v := range modemLabels {
+		labels[k] = v
+	}
+
+	endpoints := append([]string{settings.Endpoint}, settings.FailoverEndpoints...)
+	lokiExporter := outputs.NewLokiExporter(endpoints, logProvider, labels)
+	lokiExporter.SetMaxAge(settings.MaxAge)
+	lokiExporter.SetEncoding(settings.Encoding)
+
+	// Labelled by modem, as each modem has its own exporter
+	if err := prometheus.WrapRegistererWith(modemLabels, prometheus.DefaultRegisterer).Register(lokiExporter); err != nil {
+		return nil, fmt.Errorf("failed to register Loki exporter metrics: %w", err)
+	}
+
+	logging.Infof("Starting Loki exporter to %s (poll interval: %v)", strings.Join(endpoints, ", "), settings.PollInterval)
+	lokiExporter.StartPolling(settings.PollInterval)
+	return lokiExporter, nil
+}
+
+func startRemoteWriter(settings config.RemoteWrite, newRemoteWriter func(endpoint string) (*outputs.RemoteWriter, error)) {
+	if settings.URL == "" {
+		return
+	}
+
+	remoteWriter, err := newRemoteWriter(settings.URL)
+	if err != nil {
+		logging.Fatalf("%v", err)
+	}
+	remoteWriter.SetBasicAuth(settings.Username, settings.Password)
+	remoteWriter.SetTenantID(settings.Tenant)
+
+	logging.Infof("Starting remote-write to %s (push interval: %v)", settings.URL, settings.Interval)
+	remoteWriter.StartPushing(settings.Interval)
+}
+
+func startVMImporter(settings config.VMImport, newVMImporter func(endpoint string) (*outputs.VMImporter, error)) {
+	if settings.URL == "" {
+		return
+	}
+
+	importer, err := newVMImporter(settings.URL)
+	if err != nil {
+		logging.Fatalf("%v", err)
+	}
+	importer.SetBasicAuth(settings.Username, settings.Password)
+
+	logging.Infof("Starting VictoriaMetrics import to %s (push interval: %v)", settings.URL, settings.Interval)
+	importer.StartPushing(settings.Interval)
+}
+
+func startLineWriter(exporter *outputs.PrometheusExporter, settings config.LineOutput, modemLabels map[string]string) (*outputs.LineWriter, error) {
+	if settings.Sink == "" {
+		return nil, nil
+	}
+
+	tmpl, err := outputs.ParseLineTemplate(settings.Template)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := outputs.NewLineWriter(exporter, modemLabels, tmpl, settings.Sink)
+	if err != nil {
+		return nil, err
+	}
+	if settings.ChangedOnly {
+		writer.SetChangedOnly(settings.ChangedEpsilon)
+	}
+
+	logging.Infof("Starting line output to %s (push interval: %v)", settings.Sink, settings.Interval)
+	writer.StartPushing(settings.Interval)
+	return writer, nil
+}
+
+// modemOutputs are the Loki and line outputs of a modem, nil for those not
+// configured
+type modemOutputs struct {
+	labels map[string]string
+	loki   *outputs.LokiExporter
+	lines  *outputs.LineWriter
+}
+
+// startModemOutputs starts the Loki and line outputs of a modem, labelled
+// with its labels
+func startModemOutputs(cfg *config.Config, modem utils.DocsisModem, exporter *outputs.PrometheusExporter, labels map[string]string) (modemOutputs, error) {
+	started := modemOutputs{labels: labels}
+	var err error
+	if started.loki, err = startLokiExporter(modem, cfg.Loki, labels); err != nil {
+		return started, err
+	}
+	started.lines, err = startLineWriter(exporter, cfg.LineOutput, labels)
+	return started, err
+}
+
+// stop stops the outputs, so those of a modem replaced or removed neither
+// push for it nor collide with those of its replacement
+func (o modemOutputs) stop() {
+	if o.loki != nil {
+		o.loki.Stop()
+		prometheus.WrapRegistererWith(o.labels, prometheus.DefaultRegisterer).Unregister(o.loki)
+	}
+	if o.lines != nil {
+		o.lines.Stop()
+	}
+}
+
+// newModem builds a modem's driver, refusing a modem the watchdog is to reboot
+// which cannot be rebooted
+func newModem(cfg *config.Config, modemConfig modems.Config) (utils.DocsisModem, error) {
+	modem, err := modems.New(modemConfig)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := modem.(utils.Rebooter); cfg.Prometheus.WatchdogReboot && !ok {
+		return nil, fmt.Errorf("--watchdog-reboot is not supported by %s modems", modemConfig.Type)
+	}
+	return modem, nil
+}
+
+// loadConfig reads the config file if one is given, otherwise the config is
+// built from the command line. Environment variables override either.
+func loadConfig() (*config.Config, error) {
+	if path := utils.Getenv("CONFIG_FILE", commandLineOpts.ConfigFile); path != "" {
+		return config.Load(path)
+	}
 
-	lokiExporter := outputs.NewLokiExporter(lokiEndpoint, logProvider, labels)
+	cfg := config.Default()
+	if commandLineOpts.ModemsDir == "" {
+		cfg.Modems = []modems.Config{{
+			Type:      commandLineOpts.Modem,
+			IPAddress: commandLineOpts.ModemIP,
+			Username:  commandLineOpts.Username,
+			Password:  commandLineOpts.Password,
 
-	// Poll interval from env, default 60 seconds
-	pollInterval := 60 * time.Second
-	if intervalStr := utils.Getenv("LOKI_POLL_INTERVAL", ""); intervalStr != "" {
-		if secs, err := strconv.Atoi(intervalStr); err == nil && secs > 0 {
-			pollInterval = time.Duration(secs) * time.Second
+			OFDMPowerScale: commandLineOpts.OFDMPowerScale,
+			Endpoints:      commandLineOpts.Endpoints,
+			Scheme:         commandLineOpts.Scheme,
+		}}
+	}
+	cfg.ModemsDir = config.ModemsDir{Path: commandLineOpts.ModemsDir, RescanInterval: commandLineOpts.ModemsRescan}
+	cfg.Prometheus.Port = commandLineOpts.PrometheusPort
+	cfg.Prometheus.Socket = commandLineOpts.PrometheusSock
+	cfg.Prometheus.DisabledMetrics = commandLineOpts.DisableMetrics
+	cfg.Prometheus.FlapWindow = commandLineOpts.FlapWindow
+	cfg.Prometheus.MaxUpstreamPower = commandLineOpts.MaxUpPower
+	cfg.Prometheus.ChannelIDLabels = commandLineOpts.ChannelIDLabel
+	cfg.Prometheus.WatchdogThreshold = commandLineOpts.WatchdogLimit
+	cfg.Prometheus.WatchdogReboot = commandLineOpts.WatchdogReboot
+	cfg.Prometheus.ClockOffset = commandLineOpts.ClockOffset
+	cfg.Prometheus.EventCounts = commandLineOpts.EventCounts
+	cfg.Prometheus.CounterDeltas = commandLineOpts.CounterDeltas
+	cfg.Prometheus.ErrorHistogram = commandLineOpts.ErrorHistogram
+	cfg.Prometheus.SkipFirstCounters = commandLineOpts.SkipCounters
+	cfg.Prometheus.MinScrapeInterval = commandLineOpts.MinInterval
+	cfg.Prometheus.CollectTimeout = commandLineOpts.CollectTimeout
+	cfg.Prometheus.FetchInterval = commandLineOpts.FetchInterval
+	cfg.Prometheus.FetchTimestamps = commandLineOpts.FetchStamps
+	cfg.Prometheus.DownstreamBand = config.Band{MinHz: commandLineOpts.DownBandMinHz, MaxHz: commandLineOpts.DownBandMaxHz}
+	cfg.Prometheus.UpstreamBand = config.Band{MinHz: commandLineOpts.UpBandMinHz, MaxHz: commandLineOpts.UpBandMaxHz}
+	cfg.Prometheus.HealthWeights = config.HealthWeights{
+		Lock:   commandLineOpts.HealthLock,
+		SNR:    commandLineOpts.HealthSNR,
+		Power:  commandLineOpts.HealthPower,
+		Errors: commandLineOpts.HealthErrors,
+	}
+	cfg.Prometheus.StatusThresholds = config.StatusThresholds{
+		PowerGood: commandLineOpts.PowerGood,
+		PowerWarn: commandLineOpts.PowerWarn,
+		SNRGood:   commandLineOpts.SNRGood,
+		SNRWarn:   commandLineOpts.SNRWarn,
+	}
+	cfg.Prometheus.ExpectedDownstreamChannels = commandLineOpts.ExpectedDown
+	cfg.Prometheus.ExpectedUpstreamChannels = commandLineOpts.ExpectedUp
+	cfg.Prometheus.ExcludedChannels = commandLineOpts.ExcludeChannel
+	cfg.Prometheus.MACLabel = commandLineOpts.MACLabel
+	cfg.Prometheus.DebugEndpoints = commandLineOpts.DebugEndpoints
+	cfg.Prometheus.ProbeEndpoint = commandLineOpts.ProbeEndpoint
+	cfg.Prometheus.SnapshotDir = commandLineOpts.SnapshotDir
+	cfg.Prometheus.SnapshotMaxFiles = commandLineOpts.SnapshotMax
+	cfg.Log.Level = commandLineOpts.LogLevel
+	cfg.Log.Format = commandLineOpts.LogFormat
+	cfg.TLS.ClientCert = commandLineOpts.ClientCert
+	cfg.TLS.ClientKey = commandLineOpts.ClientKey
+	cfg.Proxy.URL = commandLineOpts.Proxy
+	for _, raw := range commandLineOpts.AggregateFrom {
+		source, err := config.ParseAggregateSource(raw)
+		if err != nil {
+			return nil, err
 		}
+		cfg.Aggregate.Sources = append(cfg.Aggregate.Sources, source)
 	}
 
-	log.Printf("Starting Loki exporter to %s (poll interval: %v)", lokiEndpoint, pollInterval)
-	lokiExporter.StartPolling(pollInterval)
+	return cfg, cfg.Finalize()
+}
+
+// modemsDir sets the modems configured in the modems directory, each with
+// the outputs a modem listed in the config has
+type modemsDir struct {
+	cfg     *config.Config
+	multi   *outputs.MultiModem
+	watcher *config.ModemsDirWatcher
+	outputs map[string]modemOutputs
+}
+
+// set builds the modem configured by a file and sets it under the file's name
+// along with its outputs, replacing any modem set under it. A modem which
+// cannot be set keeps any it replaces, and its config is left uncommitted to
+// be retried on the next rescan.
+func (d *modemsDir) set(name string, modemConfig modems.Config) error {
+	modem, err := newModem(d.cfg, modemConfig)
+	if err != nil {
+		return err
+	}
+	exporter, labels, err := d.multi.Set(name, modem, modemConfig.Labels)
+	if err != nil {
+		return err
+	}
+	d.watcher.Commit(name, modemConfig)
+
+	// The replaced modem's outputs are stopped first, as its Loki metrics
+	// would collide with the new modem's
+	d.outputs[name].stop()
+	started, err := startModemOutputs(d.cfg, modem, exporter, labels)
+	d.outputs[name] = started
+	return err
+}
+
+// remove removes the modem set under a name along with its outputs
+func (d *modemsDir) remove(name string) {
+	d.multi.Remove(name)
+	d.outputs[name].stop()
+	delete(d.outputs, name)
+}
+
+// apply removes the modems whose file was removed, and sets those whose file
+// was added or changed. Removing first frees the labels of a modem whose file
+// was renamed for the file's new name.
+func (d *modemsDir) apply(changed map[string]modems.Config, removed []string, err error) {
+	if err != nil {
+		logging.Errorf("%v", err)
+	}
+	for _, name := range removed {
+		d.remove(name)
+		logging.Infof("Removed modem %s", name)
+	}
+	for name, modemConfig := range changed {
+		if err := d.set(name, modemConfig); err != nil {
+			logging.Errorf("failed to set modem %s: %v", name, err)
+			continue
+		}
+		logging.Infof("Set modem %s (%s at %s)", name, modemConfig.Type, modemConfig.IPAddress)
+	}
+}
+
+// setupHTTPRecording records every exchange with the modem to HTTP_RECORD_DIR,
+// or replays the exchanges recorded in HTTP_REPLAY_DIR without a network
+func setupHTTPRecording() error {
+	if dir := utils.Getenv("HTTP_REPLAY_DIR", ""); dir != "" {
+		utils.SetHTTPTransport(&httprecord.Replayer{Dir: dir})
+		return nil
+	}
+	if dir := utils.Getenv("HTTP_RECORD_DIR", ""); dir != "" {
+		recorder, err := httprecord.NewRecorder(dir, utils.NewInsecureTransport())
+		if err != nil {
+			return err
+		}
+		utils.SetHTTPTransport(recorder)
+	}
+	return nil
+}
+
+// probeModem builds the driver for a modem scraped through /probe. The
+// credentials of a configured modem of the same type at the same address are
+// used, so a probed modem can log in. Credentials are never sent to any other
+// address, as anyone able to reach the exporter can choose the target.
+func probeModem(configs []modems.Config) outputs.ModemFactory {
+	return func(modemType, target string) (utils.DocsisModem, error) {
+		// Detection would hold the request for as long as the modem takes to
+		// answer, and again on every probe
+		if modemType == modems.TypeAuto {
+			return nil, fmt.Errorf("type %s is not supported by /probe", modems.TypeAuto)
+		}
+		probeConfig := modems.Config{Type: modemType, IPAddress: target}
+		for _, modemConfig := range configs {
+			if modemConfig.Type == modemType && modemConfig.IPAddress == target {
+				probeConfig.Username = modemConfig.Username
+				probeConfig.Password = modemConfig.Password
+				break
+			}
+		}
+		return modems.New(probeConfig)
+	}
+}
+
+// printCapabilities writes the statistics populated by a modem as JSON
+func printCapabilities(routerType string, modem utils.DocsisModem) {
+	var capabilities []utils.Capability
+	if provider, ok := modem.(utils.CapabilityProvider); ok {
+		capabilities = provider.Capabilities()
+	}
+
+	output, err := json.MarshalIndent(struct {
+		Modem        string             `json:"modem"`
+		Type         string             `json:"type"`
+		Capabilities []utils.Capability `json:"capabilities"`
+	}{routerType, modem.Type(), capabilities}, "", "  ")
+	if err != nil {
+		logging.Fatalf("failed to encode capabilities: %v", err)
+	}
+	fmt.Println(string(output))
 }
 
 func main() {
 	_, err := flags.ParseArgs(&commandLineOpts, os.Args)
 	if err != nil {
-		log.Fatal("error parsing command line arguments")
-		os.Exit(1)
+		logging.Fatalf("error parsing command line arguments")
 	}
 
 	var body []byte
@@ -77,81 +426,186 @@ func main() {
 		fetchTime = time.Now().UnixMilli() - timeStart
 	}
 
-	var routerType string
-	superhubType := utils.Getenv("SH_VERSION", "")
-	if superhubType != "" {
-		routerType = fmt.Sprintf("superhub%s", superhubType)
-	} else {
-		routerType = utils.Getenv("ROUTER_TYPE", commandLineOpts.Modem)
+	cfg, err := loadConfig()
+	if err != nil {
+		logging.Fatalf("%v", err)
+	}
+	logging.SetDefault(cfg.Logger(os.Stderr))
+
+	// The client certificate and proxy must be set before the recorder wraps
+	// the transport
+	if cfg.TLS.ClientCert != "" {
+		if err := utils.SetClientCertificate(cfg.TLS.ClientCert, cfg.TLS.ClientKey); err != nil {
+			logging.Fatalf("%v", err)
+		}
+	}
+	if cfg.Proxy.URL != "" {
+		if err := utils.SetProxy(cfg.Proxy.URL); err != nil {
+			logging.Fatalf("%v", err)
+		}
+	}
+	if err := setupHTTPRecording(); err != nil {
+		logging.Fatalf("%v", err)
+	}
+
+	if sources := cfg.AggregateSources(); len(sources) > 0 {
+		aggregator := outputs.NewAggregator(sources)
+		if cfg.Prometheus.Socket != "" {
+			logging.Fatalf("%v", outputs.PrometheusAggregateUnixSocket(aggregator, cfg.Prometheus.Socket))
+		}
+		logging.Fatalf("%v", outputs.PrometheusAggregate(aggregator, cfg.Prometheus.Port))
+	}
+	configs := cfg.Modems
+	if len(configs) == 1 {
+		configs[0].Stats = body
+		configs[0].FetchTime = fetchTime
 	}
 
+	prometheusPort := cfg.Prometheus.Port
+	prometheusSocket := cfg.Prometheus.Socket
+	serving := prometheusSocket != "" || prometheusPort > 0
+	// Push outputs run in the background, so without a server the process is
+	// kept running for them rather than printing the statistics once
+	pushing := cfg.RemoteWrite.URL != "" || cfg.VMImport.URL != "" || cfg.LineOutput.Sink != "" || cfg.Loki.Endpoint != ""
+
+	// Each modem has one exporter, which every output reads it through
+	exporterOpts := cfg.ExporterOptions()
+	multi := outputs.NewMultiModem(exporterOpts...)
 	var modem utils.DocsisModem
+	var exporter *outputs.PrometheusExporter
+	for _, modemConfig := range configs {
+		configModem, err := newModem(cfg, modemConfig)
+		if err != nil {
+			logging.Fatalf("%v", err)
+		}
+		if modem == nil {
+			modem = configModem
+		}
+
+		if commandLineOpts.Capabilities {
+			printCapabilities(modemConfig.Type, configModem)
+			continue
+		}
+		// The spectrum and the statistics printed for InfluxDB are fetched
+		// from the modem directly, so it has no exporter to fetch alongside
+		if commandLineOpts.Spectrum || (!serving && !pushing) {
+			continue
+		}
+
+		// Several modems' logs and lines are labelled as their metrics are,
+		// so those of modems without labels do not collide
+		configExporter, labels := multi.Add(configModem, modemConfig.Labels)
+		if len(configs) == 1 {
+			labels = modemConfig.Labels
+		}
+		if exporter == nil {
+			exporter = configExporter
+		}
 
-	switch routerType {
-	case "superhub4":
-		modem = &superhub4.Modem{
-			IPAddress: utils.Getenv("ROUTER_IP", commandLineOpts.ModemIP),
-			Stats:     body,
-			FetchTime: fetchTime,
-		}
-	case "comhemc2":
-		modem = &comhemc2.Modem{
-			IPAddress: utils.Getenv("ROUTER_IP", commandLineOpts.ModemIP),
-			Stats:     body,
-			FetchTime: fetchTime,
-			Username:  utils.Getenv("ROUTER_USER", commandLineOpts.Username),
-			Password:  utils.Getenv("ROUTER_PASS", commandLineOpts.Password),
-		}
-	case "superhub3":
-		modem = &superhub3.Modem{
-			IPAddress: utils.Getenv("ROUTER_IP", commandLineOpts.ModemIP),
-			Stats:     body,
-			FetchTime: fetchTime,
-		}
-	case "ubee":
-		modem = &ubee.Modem{
-			IPAddress: utils.Getenv("ROUTER_IP", commandLineOpts.ModemIP),
-			Stats:     body,
-			FetchTime: fetchTime,
-		}
-	case "superhub5":
-		modem = &superhub5.Modem{
-			IPAddress: utils.Getenv("ROUTER_IP", commandLineOpts.ModemIP),
-			Stats:     body,
-			FetchTime: fetchTime,
-		}
-	case "tc4400":
-		modem = &tc4400.Modem{
-			IPAddress: utils.Getenv("ROUTER_IP", commandLineOpts.ModemIP),
-			Stats:     body,
-			FetchTime: fetchTime,
-			Username:  utils.Getenv("ROUTER_USER", commandLineOpts.Username),
-			Password:  utils.Getenv("ROUTER_PASS", commandLineOpts.Password),
-		}
-	default:
-		log.Fatalf("unknown modem: %s", routerType)
-	}
-
-	// Start Loki exporter if configured
-	startLokiExporter(modem)
-
-	prometheusPort := commandLineOpts.PrometheusPort
-	if envPort := utils.Getenv("PROMETHEUS_PORT", ""); envPort != "" {
-		if p, err := strconv.Atoi(envPort); err == nil {
-			prometheusPort = p
-		}
-	}
-
-	if prometheusPort > 0 {
-		outputs.Prometheus(modem, prometheusPort)
+		// Start the Loki exporter and line output if configured
+		if _, err := startModemOutputs(cfg, configModem, configExporter, labels); err != nil {
+			logging.Fatalf("%v", err)
+		}
+	}
+	var watcher *config.ModemsDirWatcher
+	var dir *modemsDir
+	if cfg.ModemsDir.Path != "" {
+		watcher = config.NewModemsDirWatcher(cfg.ModemsDir.Path)
+		changed, _, err := watcher.Reload()
+		if err != nil {
+			logging.Fatalf("%v", err)
+		}
+		dir = &modemsDir{cfg: cfg, multi: multi, watcher: watcher, outputs: make(map[string]modemOutputs)}
+		for name, modemConfig := range changed {
+			if commandLineOpts.Capabilities || commandLineOpts.Spectrum || (!serving && !pushing) {
+				dirModem, err := newModem(cfg, modemConfig)
+				if err != nil {
+					logging.Fatalf("%v", err)
+				}
+				if modem == nil {
+					modem = dirModem
+				}
+				if commandLineOpts.Capabilities {
+					printCapabilities(modemConfig.Type, dirModem)
+				}
+				continue
+			}
+			if err := dir.set(name, modemConfig); err != nil {
+				logging.Fatalf("failed to set modem %s: %v", name, err)
+			}
+		}
+	}
+	if commandLineOpts.Capabilities {
+		return
+	}
+	if commandLineOpts.Spectrum {
+		if err := outputs.WriteSpectrum(os.Stdout, modem); err != nil {
+			logging.Fatalf("%v", err)
+		}
+		return
+	}
+
+	if cfg.Prometheus.ProbeEndpoint && serving {
+		http.Handle("/probe", outputs.ProbeHandler(probeModem(cfg.Modems), exporterOpts...))
+	}
+
+	if len(configs) > 1 || watcher != nil {
+		if watcher != nil {
+			logging.Infof("Watching %s for modem config changes (rescan interval: %v)", cfg.ModemsDir.Path, cfg.ModemsDir.RescanInterval)
+			watcher.Watch(cfg.ModemsDir.RescanInterval, func(changed map[string]modems.Config, removed []string, err error) {
+				dir.apply(changed, removed, err)
+			})
+		}
+
+		// Start remote-write if configured
+		startRemoteWriter(cfg.RemoteWrite, func(endpoint string) (*outputs.RemoteWriter, error) {
+			return outputs.NewMultiRemoteWriter(endpoint, multi, exporterOpts...)
+		})
+		startVMImporter(cfg.VMImport, func(endpoint string) (*outputs.VMImporter, error) {
+			return outputs.NewMultiVMImporter(endpoint, multi, exporterOpts...)
+		})
+
+		if prometheusSocket != "" {
+			err = outputs.PrometheusMultiUnixSocket(multi, prometheusSocket, exporterOpts...)
+		} else if prometheusPort > 0 {
+			err = outputs.PrometheusMulti(multi, prometheusPort, exporterOpts...)
+		} else if pushing {
+			select {}
+		} else {
+			err = errors.New("multiple modems are only supported by the Prometheus exporter and push outputs")
+		}
+		logging.Fatalf("%v", err)
+	}
+
+	// Start remote-write if configured
+	startRemoteWriter(cfg.RemoteWrite, func(endpoint string) (*outputs.RemoteWriter, error) {
+		return outputs.NewRemoteWriter(endpoint, exporter, exporterOpts...), nil
+	})
+	startVMImporter(cfg.VMImport, func(endpoint string) (*outputs.VMImporter, error) {
+		return outputs.NewVMImporter(endpoint, exporter, exporterOpts...), nil
+	})
+
+	if serving {
+		http.Handle("/spectrum", outputs.SpectrumHandler(modem))
+	}
+	if prometheusSocket != "" {
+		logging.Fatalf("%v", outputs.PrometheusUnixSocket(exporter, prometheusSocket, exporterOpts...))
+	} else if prometheusPort > 0 {
+		logging.Fatalf("%v", outputs.Prometheus(exporter, prometheusPort, exporterOpts...))
+	} else if pushing {
+		select {}
 	} else {
+		var changes *outputs.ChangeFilter
+		if commandLineOpts.ChangedOnly {
+			changes = outputs.NewChangeFilter(commandLineOpts.ChangedEpsilon)
+		}
 		for {
 			modemStats, err := utils.FetchStats(modem)
 
 			if err != nil {
-				log.Printf("Error returned by parser: %v", err)
+				logging.Errorf("Error returned by parser: %v", err)
 			} else {
-				outputs.PrintForInflux(modemStats)
+				outputs.PrintForInflux(modemStats, changes)
 			}
 
 			if commandLineOpts.Daemon {
@@ -112,8 +112,7 @@ func (sagemClient *sagemClient) apiRequest(actions string) ([]byte, error) {
 	jsonPayload := []byte(fmt.Sprintf("req=%s", payloadObj.String()))
 
 	req, _ := http.NewRequest("POST", APIAddress, bytes.NewBuffer(jsonPayload))
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := utils.InsecureHTTPClient().Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -162,10 +161,32 @@ func (comhemc2 *Modem) ClearStats() {
 	comhemc2.Stats = nil
 }
 
+// RawStats returns the statistics as last fetched from the modem
+func (comhemc2 *Modem) RawStats() []byte {
+	return comhemc2.Stats
+}
+
 func (comhemc2 *Modem) Type() string {
 	return utils.TypeDocsis
 }
 
+// Host returns the host the modem's requests are made to
+func (comhemc2 *Modem) Host() string {
+	if comhemc2.IPAddress == "" {
+		return "192.168.10.1"
+	}
+	return comhemc2.IPAddress
+}
+
+// Capabilities lists the statistics populated by this modem
+func (comhemc2 *Modem) Capabilities() []utils.Capability {
+	return []utils.Capability{
+		utils.CapDownstreamChannels,
+		utils.CapUpstreamChannels,
+		utils.CapCodewords,
+	}
+}
+
 func (comhemc2 *Modem) ParseStats() (utils.ModemStats, error) {
 	if comhemc2.Stats == nil {
 		timeStart := time.Now().UnixMilli()
@@ -221,7 +242,7 @@ func (comhemc2 *Modem) ParseStats() (utils.ModemStats, error) {
 					ChannelID: utils.GabsInt(channelData, "ChannelID"),
 					Channel:   utils.GabsInt(channelData, "uid"),
 					Frequency: utils.GabsInt(channelData, "Frequency"),
-					Power:     int(utils.GabsFloat(channelData, "PowerLevel") * 10),
+					Power:     utils.Tenths(utils.GabsFloat(channelData, "PowerLevel")),
 				})
 			}
 
@@ -238,11 +259,11 @@ func (comhemc2 *Modem) ParseStats() (utils.ModemStats, error) {
 					ChannelID:  utils.GabsInt(channelData, "ChannelID"),
 					Channel:    utils.GabsInt(channelData, "uid"),
 					Frequency:  utils.GabsInt(channelData, "Frequency"),
-					Snr:        int(utils.GabsFloat(channelData, "SNR") * 10),
-					Power:      int(utils.GabsFloat(channelData, "PowerLevel") * 10),
+					Snr:        utils.Tenths(utils.GabsFloat(channelData, "SNR")),
+					Power:      utils.Tenths(utils.GabsFloat(channelData, "PowerLevel")),
 					Prerserr:   utils.GabsInt(channelData, "CorrectableCodewords"),
 					Postrserr:  utils.GabsInt(channelData, "UncorrectableCodewords"),
-					Modulation: modulation,
+					Modulation: utils.NormalizeModulation(modulation),
 					Scheme:     scheme,
 				})
 			}
@@ -254,5 +275,7 @@ func (comhemc2 *Modem) ParseStats() (utils.ModemStats, error) {
 		UpChannels:   upChannels,
 		DownChannels: downChannels,
 		FetchTime:    comhemc2.FetchTime,
+
+		DocsisCapability: utils.Docsis31,
 	}, nil
 }
@@ -0,0 +1,142 @@
+package modems
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/msh100/modem-stats/utils"
+	"github.com/msh100/modem-stats/utils/logging"
+)
+
+// TypeAuto detects the modem's type from the pages it serves
+const TypeAuto = "auto"
+
+// DefaultDetectTimeout caps how long detecting a modem's type takes
+const DefaultDetectTimeout = 10 * time.Second
+
+// detectRetryInterval and detectPatience are how long to wait before
+// detecting a modem's type again when nothing matched, and for how long to
+// keep trying, so a modem which is rebooting as modem-stats starts is waited
+// for. They are replaced in tests.
+var (
+	detectRetryInterval = 15 * time.Second
+	detectPatience      = 5 * time.Minute
+)
+
+// maxSignatureBody is how much of a page is read to match a signature
+const maxSignatureBody = 64 * 1024
+
+// signature identifies a modem type by a page only it serves
+type signature struct {
+	modemType string
+	url       string // Formatted with the modem's address
+	matches   func(res *http.Response, body []byte) bool
+}
+
+// signatures are tried together, but the first to match wins, so those most
+// particular to a modem come first
+var signatures = []signature{
+	{"superhub5", "https://%s/rest/v1/cablemodem/state_", func(res *http.Response, body []byte) bool {
+		var state map[string]json.RawMessage
+		return res.StatusCode == http.StatusOK && json.Unmarshal(body, &state) == nil && state["cablemodem"] != nil
+	}},
+	{"superhub3", "http://%s/getRouterStatus", func(res *http.Response, body []byte) bool {
+		return res.StatusCode == http.StatusOK && bytes.Contains(body, []byte(`"1.3.6.1.`))
+	}},
+	{"superhub4", "http://%s/php/ajaxGet_device_networkstatus_data.php", func(res *http.Response, body []byte) bool {
+		return res.StatusCode == http.StatusOK && bytes.HasPrefix(bytes.TrimSpace(body), []byte("["))
+	}},
+	{"ubee", "http://%s/htdocs/cm_info_connection.php", func(res *http.Response, body []byte) bool {
+		return res.StatusCode == http.StatusOK && bytes.Contains(body, []byte("cm_conn_ds_gourpObj"))
+	}},
+	{"s33", "https://%s/Login.html", func(res *http.Response, body []byte) bool {
+		return res.StatusCode == http.StatusOK && bytes.Contains(body, []byte("HNAP1"))
+	}},
+	{"cgnv4", "https://%s/login.asp", func(res *http.Response, body []byte) bool {
+		return res.StatusCode == http.StatusOK && bytes.Contains(body, []byte("Hitron"))
+	}},
+	{"comhemc2", "http://%s/", func(res *http.Response, body []byte) bool {
+		return res.StatusCode == http.StatusOK && bytes.Contains(bytes.ToLower(body), []byte("sagemcom"))
+	}},
+	// The status page needs a login, so is recognised by its challenge
+	{"tc4400", "http://%s/cmconnectionstatus.html", func(res *http.Response, body []byte) bool {
+		return res.StatusCode == http.StatusUnauthorized && strings.HasPrefix(res.Header.Get("WWW-Authenticate"), "Basic")
+	}},
+}
+
+// Detect probes the address for the page each supported modem is known by,
+// returning the modem's type. The probes run together and are cut off after
+// the timeout.
+func Detect(ip string, timeout time.Duration) (string, error) {
+	if ip == "" {
+		ip = "192.168.100.1"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	matched := make([]bool, len(signatures))
+	var wg sync.WaitGroup
+	for i, sig := range signatures {
+		wg.Add(1)
+		go func(i int, sig signature) {
+			defer wg.Done()
+			matched[i] = probeSignature(ctx, fmt.Sprintf(sig.url, ip), sig.matches)
+		}(i, sig)
+	}
+	wg.Wait()
+
+	for i, sig := range signatures {
+		if matched[i] {
+			return sig.modemType, nil
+		}
+	}
+
+	var types []string
+	for _, sig := range signatures {
+		types = append(types, sig.modemType)
+	}
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("no supported modem detected at %s within %v (tried %s)", ip, timeout, strings.Join(types, ", "))
+	}
+	return "", fmt.Errorf("no supported modem detected at %s (tried %s)", ip, strings.Join(types, ", "))
+}
+
+// detect detects the modem's type as Detect does, trying again until
+// detectPatience has passed while nothing matches
+func detect(ip string) (string, error) {
+	deadline := time.Now().Add(detectPatience)
+	for {
+		detected, err := Detect(ip, DefaultDetectTimeout)
+		if err == nil || time.Now().Add(detectRetryInterval).After(deadline) {
+			return detected, err
+		}
+		logging.Warnf("%v, trying again in %v", err, detectRetryInterval)
+		time.Sleep(detectRetryInterval)
+	}
+}
+
+// probeSignature reports whether the page at a URL matches a signature
+func probeSignature(ctx context.Context, url string, matches func(*http.Response, []byte) bool) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+	res, err := utils.InsecureHTTPClient().Do(req)
+	if err != nil {
+		return false
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxSignatureBody))
+	if err != nil {
+		return false
+	}
+	return matches(res, body)
+}
@@ -0,0 +1,142 @@
+package modems
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/msh100/modem-stats/modems/superhub5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadFixture(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+// emulate serves a modem's signature page, and 404 for everything else
+func emulate(tls bool, path string, handler http.HandlerFunc) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		handler(w, r)
+	})
+	if tls {
+		return httptest.NewTLSServer(mux)
+	}
+	return httptest.NewServer(mux)
+}
+
+func serve(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}
+}
+
+func TestDetect(t *testing.T) {
+	for modemType, server := range map[string]*httptest.Server{
+		"superhub5": emulate(true, "/rest/v1/cablemodem/state_", serve(loadFixture(t, "superhub5/test_state/state.json"))),
+		"superhub3": emulate(false, "/getRouterStatus", serve(loadFixture(t, "superhub3/test_state/chm.json"))),
+		"superhub4": emulate(false, "/php/ajaxGet_device_networkstatus_data.php", serve(loadFixture(t, "superhub4/test_state/cg0.json"))),
+		"ubee":      emulate(false, "/htdocs/cm_info_connection.php", serve(`<script>var cm_conn_json = '{"cm_conn_ds_gourpObj":[]}';</script>`)),
+		"s33":       emulate(true, "/Login.html", serve(`<script>$.ajax({url: "/HNAP1/"});</script>`)),
+		"cgnv4":     emulate(true, "/login.asp", serve(loadFixture(t, "hitron/test_state/login.html"))),
+		"comhemc2":  emulate(false, "/", serve(`<script src="/js/sagemcom.min.js"></script>`)),
+		"tc4400": emulate(false, "/cmconnectionstatus.html", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="TC4400"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		}),
+	} {
+		t.Run(modemType, func(t *testing.T) {
+			defer server.Close()
+			address := strings.TrimPrefix(strings.TrimPrefix(server.URL, "https://"), "http://")
+
+			detected, err := Detect(address, 5*time.Second)
+			require.NoError(t, err)
+			assert.Equal(t, modemType, detected)
+		})
+	}
+}
+
+func TestDetect_NoMatch(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	_, err := Detect(address, 5*time.Second)
+	assert.EqualError(t, err, "no supported modem detected at "+address+" (tried superhub5, superhub3, superhub4, ubee, s33, cgnv4, comhemc2, tc4400)")
+}
+
+func TestDetect_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	start := time.Now()
+	_, err := Detect(address, 200*time.Millisecond)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "within 200ms")
+	assert.Less(t, time.Since(start), 2*time.Second, "probing should be cut off at the timeout")
+}
+
+func TestNew_Auto(t *testing.T) {
+	server := emulate(true, "/rest/v1/cablemodem/state_", serve(loadFixture(t, "superhub5/test_state/state.json")))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "https://")
+
+	modem, err := New(Config{Type: TypeAuto, IPAddress: address, Scheme: "https"})
+	require.NoError(t, err)
+	require.IsType(t, &superhub5.Modem{}, modem)
+	assert.Equal(t, address, modem.(*superhub5.Modem).IPAddress)
+}
+
+func TestNew_AutoWaitsForModem(t *testing.T) {
+	defer func(interval, patience time.Duration) {
+		detectRetryInterval, detectPatience = interval, patience
+	}(detectRetryInterval, detectPatience)
+	detectRetryInterval, detectPatience = 10*time.Millisecond, time.Minute
+
+	// The modem is rebooting, so only serves its pages from the third try
+	var tries int32
+	state := loadFixture(t, "superhub5/test_state/state.json")
+	server := emulate(true, "/rest/v1/cablemodem/state_", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&tries, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(state))
+	})
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "https://")
+
+	modem, err := New(Config{Type: TypeAuto, IPAddress: address})
+	require.NoError(t, err)
+	assert.IsType(t, &superhub5.Modem{}, modem)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&tries))
+}
+
+func TestNew_AutoGivesUp(t *testing.T) {
+	defer func(interval, patience time.Duration) {
+		detectRetryInterval, detectPatience = interval, patience
+	}(detectRetryInterval, detectPatience)
+	detectRetryInterval, detectPatience = 10*time.Millisecond, 50*time.Millisecond
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := New(Config{Type: TypeAuto, IPAddress: strings.TrimPrefix(server.URL, "http://")})
+	assert.ErrorContains(t, err, "no supported modem detected")
+}
@@ -0,0 +1,178 @@
+// Package fake provides a configurable DocsisModem for testing outputs and
+// wrappers without a real modem or fixture files.
+package fake
+
+import (
+	"sync"
+	"time"
+
+	"github.com/msh100/modem-stats/utils"
+)
+
+// Modem is a fake modem which returns the configured statistics and event
+// log, and counts how often it is called. It is safe for concurrent use.
+type Modem struct {
+	Stats    utils.ModemStats
+	EventLog []utils.EventLogEntry
+	Uptime   int64
+	Spectrum []utils.SpectrumPoint
+	Raw      []byte
+
+	// Errors returned instead of the configured results
+	StatsErr    error
+	EventLogErr error
+	UptimeErr   error
+	SpectrumErr error
+	RebootErr   error
+
+	// StatsDelay is how long ParseStats takes, to act as a slow modem
+	StatsDelay time.Duration
+
+	// StatsPanic, if set, is what ParseStats panics with, to act as a
+	// driver choking on malformed data
+	StatsPanic interface{}
+
+	// ModemType is returned by Type, defaulting to utils.TypeDocsis
+	ModemType string
+
+	// CapabilityList is returned by Capabilities, nil meaning unknown
+	CapabilityList []utils.Capability
+
+	mu            sync.Mutex
+	parseCalls    int
+	clearCalls    int
+	eventLogCalls int
+	uptimeCalls   int
+	rebootCalls   int
+}
+
+func (f *Modem) ParseStats() (utils.ModemStats, error) {
+	f.mu.Lock()
+	f.parseCalls++
+	delay := f.StatsDelay
+	f.mu.Unlock()
+	time.Sleep(delay)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.StatsPanic != nil {
+		panic(f.StatsPanic)
+	}
+	if f.StatsErr != nil {
+		return utils.ModemStats{}, f.StatsErr
+	}
+	return f.Stats, nil
+}
+
+func (f *Modem) ClearStats() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.clearCalls++
+}
+
+func (f *Modem) Type() string {
+	if f.ModemType == "" {
+		return utils.TypeDocsis
+	}
+	return f.ModemType
+}
+
+// Capabilities returns the configured capabilities
+func (f *Modem) Capabilities() []utils.Capability {
+	return f.CapabilityList
+}
+
+// FetchEventLog returns the configured event log
+func (f *Modem) FetchEventLog() ([]utils.EventLogEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.eventLogCalls++
+	if f.EventLogErr != nil {
+		return nil, f.EventLogErr
+	}
+	return f.EventLog, nil
+}
+
+// FetchUptime returns the configured uptime
+func (f *Modem) FetchUptime() (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.uptimeCalls++
+	if f.UptimeErr != nil {
+		return 0, f.UptimeErr
+	}
+	return f.Uptime, nil
+}
+
+// FetchSpectrum returns the configured spectrum
+func (f *Modem) FetchSpectrum() ([]utils.SpectrumPoint, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.SpectrumErr != nil {
+		return nil, f.SpectrumErr
+	}
+	return f.Spectrum, nil
+}
+
+// RawStats returns the configured raw statistics
+func (f *Modem) RawStats() []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Raw
+}
+
+// Reboot records the reboot request
+func (f *Modem) Reboot() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.rebootCalls++
+	return f.RebootErr
+}
+
+// SetStats replaces the configured statistics, for changing them while the
+// modem may be in use
+func (f *Modem) SetStats(stats utils.ModemStats) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Stats = stats
+}
+
+// ParseCalls returns how many times ParseStats has been called
+func (f *Modem) ParseCalls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.parseCalls
+}
+
+// ClearCalls returns how many times ClearStats has been called
+func (f *Modem) ClearCalls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.clearCalls
+}
+
+// EventLogCalls returns how many times FetchEventLog has been called
+func (f *Modem) EventLogCalls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.eventLogCalls
+}
+
+// UptimeCalls returns how many times FetchUptime has been called
+func (f *Modem) UptimeCalls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.uptimeCalls
+}
+
+// RebootCalls returns how many times Reboot has been called
+func (f *Modem) RebootCalls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rebootCalls
+}
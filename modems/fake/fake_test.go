@@ -0,0 +1,91 @@
+package fake
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/msh100/modem-stats/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ utils.DocsisModem        = (*Modem)(nil)
+	_ utils.EventLogProvider   = (*Modem)(nil)
+	_ utils.UptimeProvider     = (*Modem)(nil)
+	_ utils.CapabilityProvider = (*Modem)(nil)
+	_ utils.SpectrumProvider   = (*Modem)(nil)
+	_ utils.Rebooter           = (*Modem)(nil)
+)
+
+func TestModem_ParseStats(t *testing.T) {
+	modem := &Modem{
+		Stats: utils.ModemStats{
+			DownChannels: []utils.ModemChannel{{ChannelID: 5, Channel: 1, Frequency: 171000000}},
+			FetchTime:    100,
+		},
+	}
+
+	stats, err := utils.FetchStats(modem)
+	require.NoError(t, err)
+	assert.Equal(t, modem.Stats, stats)
+
+	utils.ResetStats(modem)
+	_, err = utils.FetchStats(modem)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, modem.ParseCalls())
+	assert.Equal(t, 1, modem.ClearCalls())
+}
+
+func TestModem_ErrorInjection(t *testing.T) {
+	statsErr := errors.New("modem unreachable")
+	eventLogErr := errors.New("eventlog unavailable")
+	modem := &Modem{
+		Stats:       utils.ModemStats{FetchTime: 100},
+		EventLog:    []utils.EventLogEntry{{Priority: "notice", Message: "Honor MDD; IP provisioning mode = IPv4"}},
+		StatsErr:    statsErr,
+		EventLogErr: eventLogErr,
+	}
+
+	stats, err := modem.ParseStats()
+	assert.ErrorIs(t, err, statsErr)
+	assert.Equal(t, utils.ModemStats{}, stats)
+
+	entries, err := modem.FetchEventLog()
+	assert.ErrorIs(t, err, eventLogErr)
+	assert.Nil(t, entries)
+
+	// Errors can be cleared to simulate the modem recovering
+	modem.StatsErr = nil
+	modem.EventLogErr = nil
+
+	stats, err = modem.ParseStats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), stats.FetchTime)
+
+	entries, err = modem.FetchEventLog()
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	assert.Equal(t, 2, modem.ParseCalls())
+	assert.Equal(t, 2, modem.EventLogCalls())
+}
+
+func TestModem_Uptime(t *testing.T) {
+	modem := &Modem{Uptime: 5000}
+
+	uptime, err := modem.FetchUptime()
+	require.NoError(t, err)
+	assert.Equal(t, int64(5000), uptime)
+
+	modem.UptimeErr = errors.New("state unavailable")
+	_, err = modem.FetchUptime()
+	assert.Error(t, err)
+	assert.Equal(t, 2, modem.UptimeCalls())
+}
+
+func TestModem_Type(t *testing.T) {
+	assert.Equal(t, utils.TypeDocsis, (&Modem{}).Type())
+	assert.Equal(t, utils.TypeVDSL, (&Modem{ModemType: utils.TypeVDSL}).Type())
+}
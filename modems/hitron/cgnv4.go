@@ -0,0 +1,217 @@
+package hitron
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/msh100/modem-stats/utils"
+)
+
+// CGNV4 reads the channel statistics of a Hitron CGNV4 (and similar Hitron
+// modems serving /data/dsinfo.asp)
+type CGNV4 struct {
+	IPAddress string
+	Stats     []byte
+	FetchTime int64
+	Username  string
+	Password  string
+
+	session *Session
+}
+
+// cgnv4Stats combines the downstream and upstream documents, which the modem
+// serves separately, so they can be stored (and read from LOCAL_FILE) as one
+type cgnv4Stats struct {
+	Downstream []cgnv4DownChannel `json:"downstream"`
+	Upstream   []cgnv4UpChannel   `json:"upstream"`
+}
+
+type cgnv4DownChannel struct {
+	PortID         string `json:"portId"`
+	Frequency      string `json:"frequency"`
+	Modulation     string `json:"modulation"`
+	SignalStrength string `json:"signalStrength"`
+	SNR            string `json:"snr"`
+	ChannelID      string `json:"channelId"`
+	Corrected      string `json:"correcteds"`
+	Uncorrected    string `json:"uncorrect"`
+}
+
+type cgnv4UpChannel struct {
+	PortID         string `json:"portId"`
+	Frequency      string `json:"frequency"`
+	Bandwidth      string `json:"bandwidth"`
+	ModType        string `json:"modtype"`
+	ScdmaMode      string `json:"scdmaMode"`
+	SignalStrength string `json:"signalStrength"`
+	ChannelID      string `json:"channelId"`
+}
+
+// cgnv4Modulations maps the modulation codes of dsinfo.asp, as decoded by the
+// modem's own status page
+var cgnv4Modulations = map[string]string{
+	"0": "QAM16",
+	"1": "QAM64",
+	"2": "QAM256",
+	"3": "QAM1024",
+	"4": "QAM32",
+	"5": "QAM128",
+	"6": "QPSK",
+}
+
+func (h *CGNV4) ClearStats() {
+	h.Stats = nil
+}
+
+// RawStats returns the statistics as last fetched from the modem
+func (h *CGNV4) RawStats() []byte {
+	return h.Stats
+}
+
+func (h *CGNV4) Type() string {
+	return utils.TypeDocsis
+}
+
+// Host returns the host the modem's requests are made to
+func (h *CGNV4) Host() string {
+	return utils.URLHost(h.baseAddress())
+}
+
+// Capabilities lists the statistics populated by this modem
+func (h *CGNV4) Capabilities() []utils.Capability {
+	return []utils.Capability{
+		utils.CapDownstreamChannels,
+		utils.CapUpstreamChannels,
+		utils.CapCodewords,
+		utils.CapChannelWidth,
+	}
+}
+
+func (h *CGNV4) baseAddress() string {
+	if h.IPAddress == "" {
+		h.IPAddress = "192.168.100.1"
+	}
+	return fmt.Sprintf("https://%s", h.IPAddress)
+}
+
+// getSession returns the modem's session, creating it on first use
+func (h *CGNV4) getSession() *Session {
+	if h.session == nil {
+		username, password := h.Username, h.Password
+		if username == "" {
+			username = "cusadmin"
+		}
+		if password == "" {
+			password = "password"
+		}
+		h.session = &Session{
+			BaseURL:  h.baseAddress(),
+			Username: username,
+			Password: password,
+		}
+	}
+	return h.session
+}
+
+func (h *CGNV4) getStats() ([]byte, error) {
+	if h.Stats == nil {
+		timeStart := time.Now().UnixMilli()
+		session := h.getSession()
+
+		var stats cgnv4Stats
+		downstream, err := session.Get("/data/dsinfo.asp")
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(downstream, &stats.Downstream); err != nil {
+			return nil, fmt.Errorf("failed to parse dsinfo.asp: %w", err)
+		}
+		upstream, err := session.Get("/data/usinfo.asp")
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(upstream, &stats.Upstream); err != nil {
+			return nil, fmt.Errorf("failed to parse usinfo.asp: %w", err)
+		}
+
+		combined, err := json.Marshal(stats)
+		if err != nil {
+			return nil, err
+		}
+		h.Stats = combined
+		h.FetchTime = time.Now().UnixMilli() - timeStart
+	}
+
+	return h.Stats, nil
+}
+
+// atoi parses an integer field, which the modem reports as a string
+func atoi(value string) int {
+	i, _ := strconv.Atoi(strings.TrimSpace(value))
+	return i
+}
+
+// tenths parses a decimal field as tenths, as used for power and SNR
+func tenths(value string) int {
+	f, _ := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	return utils.Tenths(f)
+}
+
+func (h *CGNV4) ParseStats() (utils.ModemStats, error) {
+	raw, err := h.getStats()
+	if err != nil {
+		return utils.ModemStats{}, err
+	}
+
+	var stats cgnv4Stats
+	if err := json.Unmarshal(raw, &stats); err != nil {
+		return utils.ModemStats{}, fmt.Errorf("failed to parse stats JSON: %w", err)
+	}
+
+	var downChannels []utils.ModemChannel
+	for _, downstream := range stats.Downstream {
+		modulation, ok := cgnv4Modulations[downstream.Modulation]
+		if !ok {
+			modulation = utils.NormalizeModulation(downstream.Modulation)
+		}
+		downChannels = append(downChannels, utils.ModemChannel{
+			ChannelID:  atoi(downstream.ChannelID),
+			Channel:    atoi(downstream.PortID),
+			Frequency:  atoi(downstream.Frequency),
+			Power:      tenths(downstream.SignalStrength),
+			Snr:        tenths(downstream.SNR),
+			Prerserr:   atoi(downstream.Corrected),
+			Postrserr:  atoi(downstream.Uncorrected),
+			Modulation: modulation,
+			Scheme:     "SC-QAM",
+		})
+	}
+
+	var upChannels []utils.ModemChannel
+	for _, upstream := range stats.Upstream {
+		scheme := strings.TrimSpace(upstream.ScdmaMode)
+		if scheme == "" {
+			scheme = "ATDMA"
+		}
+		upChannels = append(upChannels, utils.ModemChannel{
+			ChannelID:    atoi(upstream.ChannelID),
+			Channel:      atoi(upstream.PortID),
+			Frequency:    atoi(upstream.Frequency),
+			Power:        tenths(upstream.SignalStrength),
+			ChannelWidth: atoi(upstream.Bandwidth),
+			Modulation:   utils.NormalizeModulation(upstream.ModType),
+			Scheme:       scheme,
+		})
+	}
+
+	return utils.ModemStats{
+		DownChannels: downChannels,
+		UpChannels:   upChannels,
+		FetchTime:    h.FetchTime,
+
+		DocsisCapability: utils.Docsis30,
+	}, nil
+}
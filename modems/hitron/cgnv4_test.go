@@ -0,0 +1,101 @@
+package hitron
+
+import (
+	"testing"
+
+	"github.com/msh100/modem-stats/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCGNV4_Type(t *testing.T) {
+	modem := CGNV4{}
+	assert.Equal(t, utils.TypeDocsis, modem.Type())
+}
+
+func TestCGNV4_BaseAddress(t *testing.T) {
+	modem := CGNV4{}
+	assert.Equal(t, "https://192.168.100.1", modem.baseAddress())
+
+	modem = CGNV4{IPAddress: "10.0.0.1"}
+	assert.Equal(t, "https://10.0.0.1", modem.baseAddress())
+}
+
+func TestCGNV4_ParseStats_FromModem(t *testing.T) {
+	server, address := newHitronServer(t)
+	modem := &CGNV4{IPAddress: address}
+
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+	assert.Len(t, stats.DownChannels, 4)
+	assert.Len(t, stats.UpChannels, 3)
+	assert.Equal(t, 1, server.loginCount())
+
+	// The session is reused between scrapes
+	modem.ClearStats()
+	_, err = modem.ParseStats()
+	require.NoError(t, err)
+	assert.Equal(t, 1, server.loginCount())
+
+	// An expired session logs in again
+	server.expire()
+	modem.ClearStats()
+	stats, err = modem.ParseStats()
+	require.NoError(t, err)
+	assert.Len(t, stats.DownChannels, 4)
+	assert.Equal(t, 2, server.loginCount())
+}
+
+func TestCGNV4_ParseStats_WrongPassword(t *testing.T) {
+	_, address := newHitronServer(t)
+	modem := &CGNV4{IPAddress: address, Password: "wrong"}
+
+	_, err := modem.ParseStats()
+	assert.ErrorIs(t, err, errLoginFailed)
+}
+
+func TestCGNV4_ParseStats_DownstreamChannels(t *testing.T) {
+	modem := CGNV4{Stats: []byte(`{"downstream": ` + string(loadTestData(t, "dsinfo.json")) + `}`)}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+
+	require.Len(t, stats.DownChannels, 4)
+	assert.Equal(t, utils.ModemChannel{
+		ChannelID:  10,
+		Channel:    2,
+		Frequency:  610000000,
+		Power:      51,
+		Snr:        409,
+		Prerserr:   17,
+		Postrserr:  3,
+		Modulation: "QAM256",
+		Scheme:     "SC-QAM",
+	}, stats.DownChannels[1])
+	assert.Equal(t, "QAM64", stats.DownChannels[3].Modulation)
+	assert.Equal(t, -12, stats.DownChannels[3].Power)
+	assert.Empty(t, stats.UpChannels)
+}
+
+func TestCGNV4_ParseStats_UpstreamChannels(t *testing.T) {
+	modem := CGNV4{Stats: []byte(`{"upstream": ` + string(loadTestData(t, "usinfo.json")) + `}`)}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+
+	require.Len(t, stats.UpChannels, 3)
+	assert.Equal(t, utils.ModemChannel{
+		ChannelID:    1,
+		Channel:      1,
+		Frequency:    49600000,
+		Power:        433,
+		ChannelWidth: 6400000,
+		Modulation:   "QAM64",
+		Scheme:       "ATDMA",
+	}, stats.UpChannels[0])
+	assert.Equal(t, "QAM16", stats.UpChannels[2].Modulation)
+}
+
+func TestCGNV4_ParseStats_InvalidJSON(t *testing.T) {
+	modem := CGNV4{Stats: []byte("invalid json")}
+	_, err := modem.ParseStats()
+	assert.ErrorContains(t, err, "failed to parse stats JSON")
+}
@@ -0,0 +1,162 @@
+package hitron
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/msh100/modem-stats/utils"
+)
+
+const (
+	loginPage     = "/login.asp"
+	loginEndpoint = "/goform/login"
+	csrfField     = "csrf_token"
+)
+
+var (
+	// errLoginFailed is returned when the modem rejects the credentials
+	errLoginFailed = errors.New("Hitron login failed")
+
+	// errNoCSRFToken is returned when the login page has no CSRF token to
+	// submit with the credentials
+	errNoCSRFToken = errors.New("no CSRF token on the Hitron login page")
+)
+
+// Session is a logged in session with a Hitron modem's web interface, shared
+// by the Hitron drivers. The login page gives a CSRF token which is posted
+// with the credentials, and the modem then tracks the session with cookies.
+// The session is established on first use and reused until the modem sends
+// the browser back to the login page.
+type Session struct {
+	BaseURL  string
+	Username string
+	Password string
+
+	jar      http.CookieJar
+	loggedIn bool
+}
+
+// client shares the transport of the insecure HTTP client, so the watchdog
+// can reset its connections, with the session's own cookie jar
+func (s *Session) client() *http.Client {
+	shared := utils.InsecureHTTPClient()
+	return &http.Client{
+		Transport: shared.Transport,
+		Timeout:   shared.Timeout,
+		Jar:       s.jar,
+	}
+}
+
+// isLoginPage reports whether a request ended on the login page, which is
+// where the modem redirects a session which has expired
+func isLoginPage(resp *http.Response) bool {
+	return resp.Request != nil && resp.Request.URL.Path == loginPage
+}
+
+// csrfToken returns the CSRF token from the login form's hidden field
+func csrfToken(page []byte) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+	if err != nil {
+		return "", err
+	}
+	token, ok := doc.Find(fmt.Sprintf("input[name=%q]", csrfField)).Attr("value")
+	if !ok || token == "" {
+		return "", errNoCSRFToken
+	}
+	return token, nil
+}
+
+// Login starts a new session, discarding the cookies of any previous one
+func (s *Session) Login() error {
+	s.loggedIn = false
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+	s.jar = jar
+	client := s.client()
+
+	resp, err := client.Get(s.BaseURL + loginPage)
+	if err != nil {
+		return err
+	}
+	page, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("login page request failed with status: %s", resp.Status)
+	}
+	token, err := csrfToken(page)
+	if err != nil {
+		return err
+	}
+
+	resp, err = client.PostForm(s.BaseURL+loginEndpoint, url.Values{
+		"usr":     {s.Username},
+		"pwd":     {s.Password},
+		csrfField: {token},
+	})
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	// A rejected login is sent back to the login page
+	if resp.StatusCode != http.StatusOK || isLoginPage(resp) || strings.TrimSpace(string(body)) == "failed" {
+		return fmt.Errorf("%w: %s", errLoginFailed, resp.Status)
+	}
+
+	s.loggedIn = true
+	return nil
+}
+
+func (s *Session) get(path string) (*http.Response, error) {
+	return s.client().Get(s.BaseURL + path)
+}
+
+// Get fetches a page which is only served to a logged in session, logging in
+// first if needed and again if the session has expired
+func (s *Session) Get(path string) ([]byte, error) {
+	if !s.loggedIn {
+		if err := s.Login(); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := s.get(path)
+	if err != nil {
+		return nil, err
+	}
+	// The session may have expired, log in again and retry once
+	if resp.StatusCode == http.StatusUnauthorized || isLoginPage(resp) {
+		resp.Body.Close()
+		if err := s.Login(); err != nil {
+			return nil, err
+		}
+		if resp, err = s.get(path); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+
+	if isLoginPage(resp) {
+		s.loggedIn = false
+		return nil, fmt.Errorf("%w: %s redirected to the login page", errLoginFailed, path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Request failed with status: %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,186 @@
+package hitron
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadTestData(t *testing.T, filename string) []byte {
+	data, err := os.ReadFile("test_state/" + filename)
+	require.NoError(t, err, "failed to load test data: %s", filename)
+	return data
+}
+
+// hitronServer imitates a Hitron modem's login and data pages
+type hitronServer struct {
+	t         *testing.T
+	loginPage []byte
+	pages     map[string][]byte
+
+	mu      sync.Mutex
+	logins  []url.Values
+	session string
+	// expireWith is the status served to an expired session, a redirect to
+	// the login page unless set
+	expireWith int
+}
+
+func (s *hitronServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.URL.Path {
+	case loginPage:
+		http.SetCookie(w, &http.Cookie{Name: "preSession", Value: "c0ffee", Path: "/"})
+		w.Write(s.loginPage)
+	case loginEndpoint:
+		require.NoError(s.t, r.ParseForm())
+		s.logins = append(s.logins, r.PostForm)
+
+		preSession, err := r.Cookie("preSession")
+		if err != nil || preSession.Value != "c0ffee" ||
+			r.PostForm.Get(csrfField) != "9c1f4e27b8a35d60" ||
+			r.PostForm.Get("usr") != "cusadmin" || r.PostForm.Get("pwd") != "password" {
+			http.Redirect(w, r, loginPage, http.StatusFound)
+			return
+		}
+		s.session = fmt.Sprintf("session%d", len(s.logins))
+		http.SetCookie(w, &http.Cookie{Name: "userid", Value: s.session, Path: "/"})
+		http.Redirect(w, r, "/index.asp", http.StatusFound)
+	case "/index.asp":
+		w.Write([]byte("<html><body>Status</body></html>"))
+	default:
+		page, ok := s.pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		userid, err := r.Cookie("userid")
+		if s.session == "" || err != nil || userid.Value != s.session {
+			if s.expireWith != 0 {
+				w.WriteHeader(s.expireWith)
+				return
+			}
+			http.Redirect(w, r, loginPage, http.StatusFound)
+			return
+		}
+		w.Write(page)
+	}
+}
+
+// expire ends the current session, as the modem does after a while
+func (s *hitronServer) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.session = ""
+}
+
+func (s *hitronServer) loginCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.logins)
+}
+
+func newHitronServer(t *testing.T) (*hitronServer, string) {
+	handler := &hitronServer{
+		t:         t,
+		loginPage: loadTestData(t, "login.html"),
+		pages: map[string][]byte{
+			"/data/dsinfo.asp": loadTestData(t, "dsinfo.json"),
+			"/data/usinfo.asp": loadTestData(t, "usinfo.json"),
+		},
+	}
+	server := httptest.NewTLSServer(handler)
+	t.Cleanup(server.Close)
+	return handler, strings.TrimPrefix(server.URL, "https://")
+}
+
+func TestCSRFToken(t *testing.T) {
+	token, err := csrfToken(loadTestData(t, "login.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "9c1f4e27b8a35d60", token)
+
+	_, err = csrfToken([]byte(`<form><input type="hidden" name="preSession" value=""></form>`))
+	assert.ErrorIs(t, err, errNoCSRFToken)
+}
+
+func TestSession_Login(t *testing.T) {
+	server, address := newHitronServer(t)
+	session := &Session{BaseURL: "https://" + address, Username: "cusadmin", Password: "password"}
+
+	require.NoError(t, session.Login())
+	require.Len(t, server.logins, 1)
+	assert.Equal(t, "cusadmin", server.logins[0].Get("usr"))
+	assert.Equal(t, "password", server.logins[0].Get("pwd"))
+	assert.Equal(t, "9c1f4e27b8a35d60", server.logins[0].Get(csrfField))
+
+	page, err := session.Get("/data/dsinfo.asp")
+	require.NoError(t, err)
+	assert.Equal(t, loadTestData(t, "dsinfo.json"), page)
+}
+
+func TestSession_Login_WrongPassword(t *testing.T) {
+	_, address := newHitronServer(t)
+	session := &Session{BaseURL: "https://" + address, Username: "cusadmin", Password: "wrong"}
+
+	assert.ErrorIs(t, session.Login(), errLoginFailed)
+	_, err := session.Get("/data/dsinfo.asp")
+	assert.ErrorIs(t, err, errLoginFailed)
+}
+
+func TestSession_Login_NoCSRFToken(t *testing.T) {
+	server, address := newHitronServer(t)
+	server.loginPage = []byte("<html><body>Maintenance</body></html>")
+	session := &Session{BaseURL: "https://" + address, Username: "cusadmin", Password: "password"}
+
+	assert.ErrorIs(t, session.Login(), errNoCSRFToken)
+	assert.Empty(t, server.logins, "credentials should not be posted without a token")
+}
+
+func TestSession_Get_ReusesSession(t *testing.T) {
+	server, address := newHitronServer(t)
+	session := &Session{BaseURL: "https://" + address, Username: "cusadmin", Password: "password"}
+
+	for i := 0; i < 3; i++ {
+		_, err := session.Get("/data/dsinfo.asp")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, server.loginCount())
+}
+
+func TestSession_Get_RedirectToLogin(t *testing.T) {
+	server, address := newHitronServer(t)
+	session := &Session{BaseURL: "https://" + address, Username: "cusadmin", Password: "password"}
+
+	_, err := session.Get("/data/dsinfo.asp")
+	require.NoError(t, err)
+
+	server.expire()
+	page, err := session.Get("/data/dsinfo.asp")
+	require.NoError(t, err)
+	assert.Equal(t, loadTestData(t, "dsinfo.json"), page)
+	assert.Equal(t, 2, server.loginCount())
+}
+
+func TestSession_Get_Unauthorized(t *testing.T) {
+	server, address := newHitronServer(t)
+	server.expireWith = http.StatusUnauthorized
+	session := &Session{BaseURL: "https://" + address, Username: "cusadmin", Password: "password"}
+
+	_, err := session.Get("/data/dsinfo.asp")
+	require.NoError(t, err)
+
+	server.expire()
+	_, err = session.Get("/data/dsinfo.asp")
+	require.NoError(t, err)
+	assert.Equal(t, 2, server.loginCount())
+}
@@ -0,0 +1,286 @@
+// Package jsonmap reads a modem's channels from a JSON document by a mapping
+// of channel fields to paths, for the many ISP rebrands of a modem which serve
+// the same statistics under different field names.
+package jsonmap
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	gabs "github.com/Jeffail/gabs/v2"
+	"github.com/msh100/modem-stats/utils"
+)
+
+// Fields of a channel which can be mapped, and how each is read. Power is in
+// dBmV and SNR in dB, as shown by most modems, and frequency and channel width
+// in Hz.
+const (
+	FieldChannelID    = "channel_id"
+	FieldFrequency    = "frequency"
+	FieldPower        = "power"
+	FieldSNR          = "snr"
+	FieldPreRS        = "prerserr"
+	FieldPostRS       = "postrserr"
+	FieldModulation   = "modulation"
+	FieldScheme       = "scheme"
+	FieldLocked       = "locked"
+	FieldChannelWidth = "channel_width"
+	FieldSymbolRate   = "symbol_rate"
+	FieldT1Timeout    = "t1_timeout"
+	FieldT2Timeout    = "t2_timeout"
+	FieldT3Timeout    = "t3_timeout"
+	FieldT4Timeout    = "t4_timeout"
+)
+
+// Fields lists the fields which can be mapped
+var Fields = []string{
+	FieldChannelID,
+	FieldFrequency,
+	FieldPower,
+	FieldSNR,
+	FieldPreRS,
+	FieldPostRS,
+	FieldModulation,
+	FieldScheme,
+	FieldLocked,
+	FieldChannelWidth,
+	FieldSymbolRate,
+	FieldT1Timeout,
+	FieldT2Timeout,
+	FieldT3Timeout,
+	FieldT4Timeout,
+}
+
+// IsKnownField reports whether a channel field can be mapped
+func IsKnownField(field string) bool {
+	for _, f := range Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Mapping locates the downstream and upstream channels in the document
+type Mapping struct {
+	Downstream ChannelMapping `yaml:"downstream"`
+	Upstream   ChannelMapping `yaml:"upstream"`
+}
+
+// ChannelMapping locates the channels of one direction. Paths are in gabs'
+// dotted syntax, such as "downstream.channels", with Channels from the root
+// of the document and Fields from each channel.
+type ChannelMapping struct {
+	Channels string            `yaml:"channels"`
+	Fields   map[string]string `yaml:"fields"`
+
+	// Scheme of channels without a mapped scheme, SC-QAM downstream and
+	// ATDMA upstream when empty
+	Scheme string `yaml:"scheme"`
+}
+
+// Validate returns what is wrong with a mapping, nil if it is valid
+func (m Mapping) Validate() []string {
+	var errs []string
+	if m.Downstream.Channels == "" && m.Upstream.Channels == "" {
+		errs = append(errs, "mapping needs the channels path of at least one direction")
+	}
+	for _, direction := range []struct {
+		name    string
+		mapping ChannelMapping
+	}{{"downstream", m.Downstream}, {"upstream", m.Upstream}} {
+		if direction.mapping.Channels == "" && len(direction.mapping.Fields) > 0 {
+			errs = append(errs, fmt.Sprintf("mapping.%s has fields but no channels path", direction.name))
+		}
+		var fields []string
+		for field := range direction.mapping.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			if !IsKnownField(field) {
+				errs = append(errs, fmt.Sprintf("mapping.%s has unknown field %q (expected one of %s)", direction.name, field, strings.Join(Fields, ", ")))
+			}
+		}
+	}
+	return errs
+}
+
+// mapsAny reports whether any of the fields are mapped in either direction
+func (m Mapping) mapsAny(fields ...string) bool {
+	for _, field := range fields {
+		if m.Downstream.Fields[field] != "" || m.Upstream.Fields[field] != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Modem fetches a JSON document from a URL and reads its channels by the
+// mapping
+type Modem struct {
+	IPAddress string
+	Stats     []byte
+	FetchTime int64
+
+	// URL the document is fetched from. A path (starting with "/") is
+	// fetched from the modem's address over HTTP.
+	URL     string
+	Mapping Mapping
+}
+
+func (m *Modem) ClearStats() {
+	m.Stats = nil
+}
+
+// RawStats returns the statistics as last fetched from the modem
+func (m *Modem) RawStats() []byte {
+	return m.Stats
+}
+
+func (m *Modem) Type() string {
+	return utils.TypeDocsis
+}
+
+// Host returns the host the modem's requests are made to
+func (m *Modem) Host() string {
+	return utils.URLHost(m.fetchURL())
+}
+
+// Capabilities lists the statistics populated by this modem, which are those
+// the mapping reads
+func (m *Modem) Capabilities() []utils.Capability {
+	var capabilities []utils.Capability
+	if m.Mapping.Downstream.Channels != "" {
+		capabilities = append(capabilities, utils.CapDownstreamChannels)
+	}
+	if m.Mapping.Upstream.Channels != "" {
+		capabilities = append(capabilities, utils.CapUpstreamChannels)
+	}
+	for _, mapped := range []struct {
+		capability utils.Capability
+		fields     []string
+	}{
+		{utils.CapCodewords, []string{FieldPreRS, FieldPostRS}},
+		{utils.CapLockStatus, []string{FieldLocked}},
+		{utils.CapChannelWidth, []string{FieldChannelWidth}},
+		{utils.CapSymbolRate, []string{FieldSymbolRate}},
+		{utils.CapTimeouts, []string{FieldT1Timeout, FieldT2Timeout, FieldT3Timeout, FieldT4Timeout}},
+	} {
+		if m.Mapping.mapsAny(mapped.fields...) {
+			capabilities = append(capabilities, mapped.capability)
+		}
+	}
+	return capabilities
+}
+
+func (m *Modem) fetchURL() string {
+	if m.IPAddress == "" {
+		m.IPAddress = "192.168.100.1"
+	}
+	if strings.HasPrefix(m.URL, "/") {
+		return fmt.Sprintf("http://%s%s", m.IPAddress, m.URL)
+	}
+	return m.URL
+}
+
+// value reads a mapped field of a channel as a string, whether the document
+// holds it as a string or a number. An unmapped or missing field is empty.
+func value(channel *gabs.Container, fields map[string]string, field string) string {
+	path, ok := fields[field]
+	if !ok || !channel.ExistsP(path) {
+		return ""
+	}
+	return utils.GabsString(channel, path)
+}
+
+// number reads a mapped field of a channel as a number, 0 if it is not one
+func number(channel *gabs.Container, fields map[string]string, field string) float64 {
+	n, _ := strconv.ParseFloat(strings.TrimSpace(value(channel, fields, field)), 64)
+	return n
+}
+
+// parseChannels reads the channels of one direction from the document
+func parseChannels(doc *gabs.Container, mapping ChannelMapping, defaultScheme string) ([]utils.ModemChannel, error) {
+	if mapping.Channels == "" {
+		return nil, nil
+	}
+	if !doc.ExistsP(mapping.Channels) {
+		return nil, fmt.Errorf("no channels at %q", mapping.Channels)
+	}
+	children := doc.Path(mapping.Channels).Children()
+	if children == nil {
+		return nil, fmt.Errorf("channels at %q are not an array", mapping.Channels)
+	}
+
+	scheme := mapping.Scheme
+	if scheme == "" {
+		scheme = defaultScheme
+	}
+
+	channels := make([]utils.ModemChannel, 0, len(children))
+	for index, channel := range children {
+		fields := mapping.Fields
+		c := utils.ModemChannel{
+			ChannelID:    int(number(channel, fields, FieldChannelID)),
+			Channel:      index + 1,
+			Frequency:    int(number(channel, fields, FieldFrequency)),
+			Power:        utils.Tenths(number(channel, fields, FieldPower)),
+			Snr:          utils.Tenths(number(channel, fields, FieldSNR)),
+			Prerserr:     int(number(channel, fields, FieldPreRS)),
+			Postrserr:    int(number(channel, fields, FieldPostRS)),
+			Modulation:   utils.NormalizeModulation(value(channel, fields, FieldModulation)),
+			Scheme:       scheme,
+			Locked:       utils.ParseLockStatus(value(channel, fields, FieldLocked)),
+			ChannelWidth: int(number(channel, fields, FieldChannelWidth)),
+			SymbolRate:   int(number(channel, fields, FieldSymbolRate)),
+			T1Timeout:    int(number(channel, fields, FieldT1Timeout)),
+			T2Timeout:    int(number(channel, fields, FieldT2Timeout)),
+			T3Timeout:    int(number(channel, fields, FieldT3Timeout)),
+			T4Timeout:    int(number(channel, fields, FieldT4Timeout)),
+		}
+		if s := value(channel, fields, FieldScheme); s != "" {
+			c.Scheme = strings.ToUpper(strings.ReplaceAll(s, "_", "-"))
+		}
+		channels = append(channels, c)
+	}
+	return channels, nil
+}
+
+func (m *Modem) ParseStats() (utils.ModemStats, error) {
+	if m.Stats == nil {
+		stats, fetchTime, err := utils.SimpleHTTPFetch(m.fetchURL())
+		if err != nil {
+			return utils.ModemStats{}, err
+		}
+		m.Stats = stats
+		m.FetchTime = fetchTime
+	}
+
+	doc, err := gabs.ParseJSON(m.Stats)
+	if err != nil {
+		return utils.ModemStats{}, fmt.Errorf("failed to parse stats JSON: %w", err)
+	}
+
+	var errs []string
+	downChannels, err := parseChannels(doc, m.Mapping.Downstream, "SC-QAM")
+	if err != nil {
+		errs = append(errs, "downstream: "+err.Error())
+	}
+	upChannels, err := parseChannels(doc, m.Mapping.Upstream, "ATDMA")
+	if err != nil {
+		errs = append(errs, "upstream: "+err.Error())
+	}
+	if len(errs) > 0 {
+		return utils.ModemStats{}, errors.New(strings.Join(errs, "; "))
+	}
+
+	return utils.ModemStats{
+		DownChannels: downChannels,
+		UpChannels:   upChannels,
+		FetchTime:    m.FetchTime,
+	}, nil
+}
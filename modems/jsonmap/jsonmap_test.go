@@ -0,0 +1,119 @@
+package jsonmap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/msh100/modem-stats/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadTestData(t *testing.T, filename string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("test_state", filename))
+	require.NoError(t, err)
+	return data
+}
+
+// rebrandMapping maps the field names of test_state/rebrand.json
+var rebrandMapping = Mapping{
+	Downstream: ChannelMapping{
+		Channels: "status.docsis.dsTable",
+		Fields: map[string]string{
+			FieldChannelID:  "chId",
+			FieldFrequency:  "freqHz",
+			FieldPower:      "rxPowerDbmv",
+			FieldSNR:        "snrDb",
+			FieldModulation: "qam",
+			FieldScheme:     "type",
+			FieldLocked:     "lock",
+			FieldPreRS:      "corrected",
+			FieldPostRS:     "uncorrectable",
+		},
+	},
+	Upstream: ChannelMapping{
+		Channels: "status.docsis.usTable",
+		Fields: map[string]string{
+			FieldChannelID:  "chId",
+			FieldFrequency:  "freqHz",
+			FieldPower:      "txPowerDbmv",
+			FieldLocked:     "lock",
+			FieldSymbolRate: "symbolRate",
+			FieldT3Timeout:  "t3",
+		},
+	},
+}
+
+func TestModem_ParseStats(t *testing.T) {
+	modem := Modem{Stats: loadTestData(t, "rebrand.json"), Mapping: rebrandMapping}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+
+	// Fields are read whether the document holds strings or numbers, and a
+	// channel without a mapped scheme gets the direction's default
+	assert.Equal(t, []utils.ModemChannel{
+		{ChannelID: 25, Channel: 1, Frequency: 331000000, Power: 39, Snr: 412, Prerserr: 18, Postrserr: 2, Modulation: "QAM256", Scheme: "SC-QAM", Locked: true},
+		{ChannelID: 26, Channel: 2, Frequency: 339000000, Power: -12, Snr: 376, Prerserr: 90211, Postrserr: 4411, Modulation: "QAM256", Scheme: "SC-QAM"},
+		{ChannelID: 33, Channel: 3, Frequency: 750000000, Power: 41, Snr: 430, Prerserr: 1840, Modulation: "QAM4096", Scheme: "OFDM", Locked: true},
+	}, stats.DownChannels)
+	assert.Equal(t, []utils.ModemChannel{
+		{ChannelID: 1, Channel: 1, Frequency: 49600000, Power: 445, Scheme: "ATDMA", Locked: true, SymbolRate: 5120, T3Timeout: 2},
+	}, stats.UpChannels)
+}
+
+func TestModem_ParseStats_MissingChannels(t *testing.T) {
+	mapping := rebrandMapping
+	mapping.Upstream.Channels = "status.docsis.upTable"
+	modem := Modem{Stats: loadTestData(t, "rebrand.json"), Mapping: mapping}
+
+	_, err := modem.ParseStats()
+	assert.EqualError(t, err, `upstream: no channels at "status.docsis.upTable"`)
+}
+
+func TestModem_ParseStats_Fetch(t *testing.T) {
+	document := loadTestData(t, "rebrand.json")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/status" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(document)
+	}))
+	defer server.Close()
+
+	modem := Modem{
+		IPAddress: strings.TrimPrefix(server.URL, "http://"),
+		URL:       "/api/status",
+		Mapping:   rebrandMapping,
+	}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+	assert.Len(t, stats.DownChannels, 3)
+	assert.Len(t, stats.UpChannels, 1)
+}
+
+func TestModem_Capabilities(t *testing.T) {
+	modem := Modem{Mapping: rebrandMapping}
+	assert.ElementsMatch(t, []utils.Capability{
+		utils.CapDownstreamChannels,
+		utils.CapUpstreamChannels,
+		utils.CapCodewords,
+		utils.CapLockStatus,
+		utils.CapSymbolRate,
+		utils.CapTimeouts,
+	}, modem.Capabilities())
+}
+
+func TestMapping_Validate(t *testing.T) {
+	assert.Empty(t, rebrandMapping.Validate())
+	assert.Equal(t, []string{
+		"mapping needs the channels path of at least one direction",
+		"mapping.downstream has fields but no channels path",
+		`mapping.downstream has unknown field "noise" (expected one of ` + strings.Join(Fields, ", ") + ")",
+	}, Mapping{Downstream: ChannelMapping{Fields: map[string]string{"noise": "n"}}}.Validate())
+}
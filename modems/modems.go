@@ -0,0 +1,245 @@
+// Package modems builds modem drivers from their configuration.
+package modems
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/msh100/modem-stats/modems/comhemc2"
+	"github.com/msh100/modem-stats/modems/hitron"
+	"github.com/msh100/modem-stats/modems/jsonmap"
+	"github.com/msh100/modem-stats/modems/s33"
+	"github.com/msh100/modem-stats/modems/superhub3"
+	"github.com/msh100/modem-stats/modems/superhub4"
+	"github.com/msh100/modem-stats/modems/superhub5"
+	"github.com/msh100/modem-stats/modems/tc4400"
+	"github.com/msh100/modem-stats/modems/ubee"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/msh100/modem-stats/utils/logging"
+)
+
+// Types lists the supported modem types
+var Types = []string{
+	"superhub3",
+	"superhub4",
+	"superhub5",
+	"ubee",
+	"comhemc2",
+	"tc4400",
+	"s33",
+	"cgnv4",
+	TypeJSONMap,
+	TypeAuto,
+}
+
+// TypeJSONMap reads a modem's channels from a JSON document by the mapping in
+// its configuration
+const TypeJSONMap = "jsonmap"
+
+// IsKnownType reports whether a modem type is supported
+func IsKnownType(modemType string) bool {
+	for _, t := range Types {
+		if t == modemType {
+			return true
+		}
+	}
+	return false
+}
+
+// Config describes a single modem to scrape
+type Config struct {
+	Type      string `yaml:"type"`
+	IPAddress string `yaml:"ip"`
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
+
+	// OFDMPowerScale is the unit of OFDM channel power reported by a
+	// superhub5 (detected when empty)
+	OFDMPowerScale string `yaml:"ofdm_power_scale"`
+
+	// Endpoints limits the statistics a superhub5 fetches to the named
+	// endpoints (all are fetched when empty)
+	Endpoints []string `yaml:"endpoints"`
+
+	// Scheme is how a superhub5's REST API is reached, https, http or auto
+	// (https when empty)
+	Scheme string `yaml:"scheme"`
+
+	// URL and Mapping configure a jsonmap modem: the URL of its JSON
+	// statistics (a path being fetched from the modem's address) and where
+	// in them its channels are
+	URL     string          `yaml:"url"`
+	Mapping jsonmap.Mapping `yaml:"mapping"`
+
+	// Labels identify the modem's metrics when several are scraped
+	Labels map[string]string `yaml:"labels"`
+
+	// Statistics read ahead of time (such as from LOCAL_FILE)
+	Stats     []byte `yaml:"-"`
+	FetchTime int64  `yaml:"-"`
+}
+
+// New builds the driver for a modem configuration, detecting the modem's
+// type if it is TypeAuto (waiting for a modem which does not yet answer)
+func New(config Config) (utils.DocsisModem, error) {
+	switch config.Type {
+	case TypeAuto:
+		detected, err := detect(config.IPAddress)
+		if err != nil {
+			return nil, err
+		}
+		logging.Infof("Detected a %s modem at %s", detected, config.IPAddress)
+		config.Type = detected
+		return New(config)
+	case "superhub3":
+		return &superhub3.Modem{
+			IPAddress: config.IPAddress,
+			Stats:     config.Stats,
+			FetchTime: config.FetchTime,
+		}, nil
+	case "superhub4":
+		return &superhub4.Modem{
+			IPAddress: config.IPAddress,
+			Stats:     config.Stats,
+			FetchTime: config.FetchTime,
+		}, nil
+	case "superhub5":
+		return &superhub5.Modem{
+			IPAddress:      config.IPAddress,
+			Stats:          config.Stats,
+			FetchTime:      config.FetchTime,
+			OFDMPowerScale: config.OFDMPowerScale,
+			Endpoints:      config.Endpoints,
+			Scheme:         config.Scheme,
+		}, nil
+	case "ubee":
+		return &ubee.Modem{
+			IPAddress: config.IPAddress,
+			Stats:     config.Stats,
+			FetchTime: config.FetchTime,
+		}, nil
+	case "comhemc2":
+		return &comhemc2.Modem{
+			IPAddress: config.IPAddress,
+			Stats:     config.Stats,
+			FetchTime: config.FetchTime,
+			Username:  config.Username,
+			Password:  config.Password,
+		}, nil
+	case "tc4400":
+		return &tc4400.Modem{
+			IPAddress: config.IPAddress,
+			Stats:     config.Stats,
+			FetchTime: config.FetchTime,
+			Username:  config.Username,
+			Password:  config.Password,
+		}, nil
+	case "s33":
+		return &s33.Modem{
+			IPAddress: config.IPAddress,
+			Stats:     config.Stats,
+			FetchTime: config.FetchTime,
+			Username:  config.Username,
+			Password:  config.Password,
+		}, nil
+	case "cgnv4":
+		return &hitron.CGNV4{
+			IPAddress: config.IPAddress,
+			Stats:     config.Stats,
+			FetchTime: config.FetchTime,
+			Username:  config.Username,
+			Password:  config.Password,
+		}, nil
+	case TypeJSONMap:
+		return &jsonmap.Modem{
+			IPAddress: config.IPAddress,
+			Stats:     config.Stats,
+			FetchTime: config.FetchTime,
+			URL:       config.URL,
+			Mapping:   config.Mapping,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown modem: %s", config.Type)
+	}
+}
+
+// FromEnv reads the modems to scrape from the environment. Several modems
+// can be configured with MODEM_1_TYPE, MODEM_1_IP, MODEM_1_USER, MODEM_1_PASS,
+// MODEM_1_LABELS (as "key=value,key=value"), MODEM_1_OFDM_POWER_SCALE,
+// MODEM_1_ENDPOINTS (as "name,name") and MODEM_1_SCHEME, then MODEM_2_TYPE and
+// so on. Otherwise a single modem is read from ROUTER_TYPE (or the older
+// SH_VERSION), ROUTER_IP, ROUTER_USER, ROUTER_PASS, ROUTER_OFDM_POWER_SCALE,
+// ROUTER_ENDPOINTS and ROUTER_SCHEME, falling back to the given defaults.
+func FromEnv(defaults Config) ([]Config, error) {
+	var configs []Config
+	for i := 1; ; i++ {
+		prefix := fmt.Sprintf("MODEM_%d_", i)
+		modemType := os.Getenv(prefix + "TYPE")
+		if modemType == "" {
+			break
+		}
+
+		labels, err := parseLabels(os.Getenv(prefix + "LABELS"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %sLABELS: %w", prefix, err)
+		}
+		configs = append(configs, Config{
+			Type:      modemType,
+			IPAddress: os.Getenv(prefix + "IP"),
+			Username:  os.Getenv(prefix + "USER"),
+			Password:  os.Getenv(prefix + "PASS"),
+			Labels:    labels,
+
+			OFDMPowerScale: os.Getenv(prefix + "OFDM_POWER_SCALE"),
+			Endpoints:      parseList(os.Getenv(prefix + "ENDPOINTS")),
+			Scheme:         os.Getenv(prefix + "SCHEME"),
+		})
+	}
+	if len(configs) > 0 {
+		return configs, nil
+	}
+
+	config := defaults
+	config.Type = utils.Getenv("ROUTER_TYPE", defaults.Type)
+	if superhubType := os.Getenv("SH_VERSION"); superhubType != "" {
+		config.Type = fmt.Sprintf("superhub%s", superhubType)
+	}
+	config.IPAddress = utils.Getenv("ROUTER_IP", defaults.IPAddress)
+	config.Username = utils.Getenv("ROUTER_USER", defaults.Username)
+	config.Password = utils.Getenv("ROUTER_PASS", defaults.Password)
+	config.OFDMPowerScale = utils.Getenv("ROUTER_OFDM_POWER_SCALE", defaults.OFDMPowerScale)
+	config.Scheme = utils.Getenv("ROUTER_SCHEME", defaults.Scheme)
+	if raw := os.Getenv("ROUTER_ENDPOINTS"); raw != "" {
+		config.Endpoints = parseList(raw)
+	}
+	return []Config{config}, nil
+}
+
+// parseList parses a list given as "item,item", nil when it is empty
+func parseList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseLabels parses labels given as "key=value,key=value"
+func parseLabels(raw string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("label %q is not key=value", pair)
+		}
+		labels[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return labels, nil
+}
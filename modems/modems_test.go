@@ -0,0 +1,86 @@
+package modems
+
+import (
+	"testing"
+
+	"github.com/msh100/modem-stats/modems/tc4400"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_UsesEachModemsCredentials(t *testing.T) {
+	first, err := New(Config{Type: "tc4400", IPAddress: "192.168.100.1", Username: "admin", Password: "first"})
+	require.NoError(t, err)
+	second, err := New(Config{Type: "tc4400", IPAddress: "192.168.100.2", Username: "user", Password: "second"})
+	require.NoError(t, err)
+
+	require.IsType(t, &tc4400.Modem{}, first)
+	require.IsType(t, &tc4400.Modem{}, second)
+	assert.Equal(t, "192.168.100.1", first.(*tc4400.Modem).IPAddress)
+	assert.Equal(t, "admin", first.(*tc4400.Modem).Username)
+	assert.Equal(t, "first", first.(*tc4400.Modem).Password)
+	assert.Equal(t, "192.168.100.2", second.(*tc4400.Modem).IPAddress)
+	assert.Equal(t, "user", second.(*tc4400.Modem).Username)
+	assert.Equal(t, "second", second.(*tc4400.Modem).Password)
+}
+
+func TestNew_UnknownModem(t *testing.T) {
+	_, err := New(Config{Type: "superhub9"})
+	assert.EqualError(t, err, "unknown modem: superhub9")
+}
+
+func TestFromEnv_MultipleModems(t *testing.T) {
+	t.Setenv("ROUTER_TYPE", "superhub3")
+	t.Setenv("MODEM_1_TYPE", "tc4400")
+	t.Setenv("MODEM_1_IP", "192.168.100.1")
+	t.Setenv("MODEM_1_USER", "admin")
+	t.Setenv("MODEM_1_PASS", "first")
+	t.Setenv("MODEM_1_LABELS", "modem=upstairs, isp=virgin")
+	t.Setenv("MODEM_2_TYPE", "comhemc2")
+	t.Setenv("MODEM_2_IP", "192.168.0.1")
+	t.Setenv("MODEM_2_USER", "user")
+	t.Setenv("MODEM_2_PASS", "second")
+	t.Setenv("MODEM_2_LABELS", "modem=downstairs")
+
+	configs, err := FromEnv(Config{Type: "superhub5"})
+	require.NoError(t, err)
+	assert.Equal(t, []Config{
+		{
+			Type:      "tc4400",
+			IPAddress: "192.168.100.1",
+			Username:  "admin",
+			Password:  "first",
+			Labels:    map[string]string{"modem": "upstairs", "isp": "virgin"},
+		},
+		{
+			Type:      "comhemc2",
+			IPAddress: "192.168.0.1",
+			Username:  "user",
+			Password:  "second",
+			Labels:    map[string]string{"modem": "downstairs"},
+		},
+	}, configs)
+}
+
+func TestFromEnv_SingleModem(t *testing.T) {
+	t.Setenv("ROUTER_TYPE", "")
+	t.Setenv("ROUTER_USER", "")
+	t.Setenv("ROUTER_IP", "192.168.0.1")
+	t.Setenv("ROUTER_PASS", "secret")
+	t.Setenv("ROUTER_ENDPOINTS", "downstream, upstream")
+	t.Setenv("ROUTER_SCHEME", "http")
+
+	configs, err := FromEnv(Config{Type: "superhub5", IPAddress: "192.168.100.1", Username: "admin"})
+	require.NoError(t, err)
+	assert.Equal(t, []Config{
+		{Type: "superhub5", IPAddress: "192.168.0.1", Username: "admin", Password: "secret", Endpoints: []string{"downstream", "upstream"}, Scheme: "http"},
+	}, configs)
+}
+
+func TestFromEnv_InvalidLabels(t *testing.T) {
+	t.Setenv("MODEM_1_TYPE", "superhub5")
+	t.Setenv("MODEM_1_LABELS", "upstairs")
+
+	_, err := FromEnv(Config{})
+	assert.Error(t, err)
+}
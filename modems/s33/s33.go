@@ -0,0 +1,357 @@
+package s33
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/msh100/modem-stats/utils"
+)
+
+type Modem struct {
+	IPAddress string
+	Stats     []byte
+	FetchTime int64
+	Username  string
+	Password  string
+
+	// HNAP session, established by login
+	privateKey string
+	uid        string
+
+	// now is replaced in tests to give a predictable HNAP_AUTH timestamp
+	now func() time.Time
+}
+
+func (s33 *Modem) ClearStats() {
+	s33.Stats = nil
+}
+
+// RawStats returns the statistics as last fetched from the modem
+func (s33 *Modem) RawStats() []byte {
+	return s33.Stats
+}
+
+func (s33 *Modem) Type() string {
+	return utils.TypeDocsis
+}
+
+// Host returns the host the modem's requests are made to
+func (s33 *Modem) Host() string {
+	return utils.URLHost(s33.baseAddress())
+}
+
+// Capabilities lists the statistics populated by this modem
+func (s33 *Modem) Capabilities() []utils.Capability {
+	return []utils.Capability{
+		utils.CapDownstreamChannels,
+		utils.CapUpstreamChannels,
+		utils.CapCodewords,
+		utils.CapLockStatus,
+		utils.CapSymbolRate,
+		utils.CapChannelWidth,
+	}
+}
+
+func (s33 *Modem) baseAddress() string {
+	if s33.IPAddress == "" {
+		s33.IPAddress = "192.168.100.1"
+	}
+	return fmt.Sprintf("https://%s", s33.IPAddress)
+}
+
+func (s33 *Modem) credentials() (string, string) {
+	username, password := s33.Username, s33.Password
+	if username == "" {
+		username = "admin"
+	}
+	if password == "" {
+		password = "password"
+	}
+	return username, password
+}
+
+const hnapLoginAction = `"http://purenetworks.com/HNAP1/Login"`
+
+// errLoginFailed is returned when the modem rejects the credentials
+var errLoginFailed = errors.New("HNAP login failed")
+
+type loginRequest struct {
+	Login struct {
+		Action        string
+		Username      string
+		LoginPassword string
+		Captcha       string
+		PrivateLogin  string
+	}
+}
+
+type loginResponse struct {
+	LoginResponse struct {
+		Challenge   string
+		Cookie      string
+		PublicKey   string
+		LoginResult string
+	}
+}
+
+// hmacMD5 returns the upper case hex HMAC-MD5 of a message, as used
+// throughout the HNAP handshake
+func hmacMD5(key, message string) string {
+	mac := hmac.New(md5.New, []byte(key))
+	mac.Write([]byte(message))
+	return strings.ToUpper(fmt.Sprintf("%x", mac.Sum(nil)))
+}
+
+// hnapAuth builds the HNAP_AUTH header which signs each request with the
+// session's private key
+func (s33 *Modem) hnapAuth(action string) string {
+	now := time.Now
+	if s33.now != nil {
+		now = s33.now
+	}
+	timestamp := fmt.Sprintf("%d", now().UnixMilli()%2000000000000)
+	return hmacMD5(s33.privateKey, timestamp+action) + " " + timestamp
+}
+
+func (s33 *Modem) setSessionCookies(req *http.Request) {
+	req.AddCookie(&http.Cookie{Name: "uid", Value: s33.uid})
+	req.AddCookie(&http.Cookie{Name: "PrivateKey", Value: s33.privateKey})
+}
+
+func (s33 *Modem) hnapLogin(action, username, loginPassword string) (loginResponse, error) {
+	var payload loginRequest
+	payload.Login.Action = action
+	payload.Login.Username = username
+	payload.Login.LoginPassword = loginPassword
+	payload.Login.PrivateLogin = "LoginPassword"
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return loginResponse{}, err
+	}
+
+	req, err := http.NewRequest("POST", s33.baseAddress()+"/HNAP1/", bytes.NewReader(body))
+	if err != nil {
+		return loginResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("SOAPAction", hnapLoginAction)
+	if s33.privateKey != "" {
+		req.Header.Set("HNAP_AUTH", s33.hnapAuth(hnapLoginAction))
+		s33.setSessionCookies(req)
+	}
+
+	resp, err := utils.InsecureHTTPClient().Do(req)
+	if err != nil {
+		return loginResponse{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return loginResponse{}, fmt.Errorf("HNAP login request failed with status: %s", resp.Status)
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return loginResponse{}, err
+	}
+	var response loginResponse
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return loginResponse{}, fmt.Errorf("failed to parse HNAP login response: %w", err)
+	}
+	return response, nil
+}
+
+// login performs the HNAP handshake. The modem replies to a login request
+// with a challenge and public key, from which the private key and the
+// password proof are derived.
+func (s33 *Modem) login() error {
+	s33.privateKey, s33.uid = "", ""
+	username, password := s33.credentials()
+
+	challenge, err := s33.hnapLogin("request", username, "")
+	if err != nil {
+		return err
+	}
+	c := challenge.LoginResponse
+	if c.Challenge == "" || c.PublicKey == "" {
+		return fmt.Errorf("%w: no challenge in response", errLoginFailed)
+	}
+
+	s33.privateKey = hmacMD5(c.PublicKey+password, c.Challenge)
+	s33.uid = c.Cookie
+
+	result, err := s33.hnapLogin("login", username, hmacMD5(s33.privateKey, c.Challenge))
+	if err != nil {
+		s33.privateKey, s33.uid = "", ""
+		return err
+	}
+	if result.LoginResponse.LoginResult != "OK" && result.LoginResponse.LoginResult != "OK_CHANGED" {
+		s33.privateKey, s33.uid = "", ""
+		return fmt.Errorf("%w: %s", errLoginFailed, result.LoginResponse.LoginResult)
+	}
+	return nil
+}
+
+// fetchStatusPage retrieves the connection status page, which the modem only
+// serves to a logged in session
+func (s33 *Modem) fetchStatusPage() (*http.Response, error) {
+	req, err := http.NewRequest("GET", s33.baseAddress()+"/cmconnectionstatus.html", nil)
+	if err != nil {
+		return nil, err
+	}
+	s33.setSessionCookies(req)
+	return utils.InsecureHTTPClient().Do(req)
+}
+
+func (s33 *Modem) getStats() ([]byte, error) {
+	if s33.Stats == nil {
+		timeStart := time.Now().UnixMilli()
+
+		if s33.privateKey == "" {
+			if err := s33.login(); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := s33.fetchStatusPage()
+		if err != nil {
+			return nil, err
+		}
+		// The session may have expired, log in again and retry once
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			resp.Body.Close()
+			if err := s33.login(); err != nil {
+				return nil, err
+			}
+			if resp, err = s33.fetchStatusPage(); err != nil {
+				return nil, err
+			}
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Request failed with status: %s", resp.Status)
+		}
+		bodyBytes, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		s33.Stats = bodyBytes
+		s33.FetchTime = time.Now().UnixMilli() - timeStart
+	}
+
+	return s33.Stats, nil
+}
+
+// findTable returns the rows of the table whose title contains the given text
+func findTable(doc *goquery.Document, title string) *goquery.Selection {
+	return doc.Find("table").FilterFunction(func(i int, table *goquery.Selection) bool {
+		return strings.Contains(table.Find("tr").First().Text(), title)
+	}).First().Find("tr")
+}
+
+// eachChannelRow calls fn with the cells and lock status of each channel in a
+// table, skipping the title and column header rows
+func eachChannelRow(doc *goquery.Document, title string, fn func(cells []string, locked bool)) {
+	findTable(doc, title).Each(func(i int, rowHtml *goquery.Selection) {
+		if i <= 1 {
+			return
+		}
+
+		var cells []string
+		rowHtml.Find("td").Each(func(j int, cellHtml *goquery.Selection) {
+			cells = append(cells, strings.TrimSpace(cellHtml.Text()))
+		})
+		if len(cells) < 2 {
+			return
+		}
+		fn(cells, utils.ParseLockStatus(cells[1]))
+	})
+}
+
+// cell returns a table cell, or an empty string if the row is short
+func cell(cells []string, index int) string {
+	if index < len(cells) {
+		return cells[index]
+	}
+	return ""
+}
+
+func (s33 *Modem) ParseStats() (utils.ModemStats, error) {
+	modemStats, err := s33.getStats()
+	if err != nil {
+		return utils.ModemStats{}, err
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(modemStats))
+	if err != nil {
+		return utils.ModemStats{}, err
+	}
+
+	var downChannels []utils.ModemChannel
+	var upChannels []utils.ModemChannel
+
+	eachChannelRow(doc, "Downstream Bonded Channels", func(cells []string, locked bool) {
+		downChannels = append(downChannels, utils.ModemChannel{
+			ChannelID:  utils.ExtractIntValue(cell(cells, 0)),
+			Channel:    len(downChannels) + 1,
+			Modulation: utils.NormalizeModulation(cell(cells, 2)),
+			Scheme:     "SC-QAM",
+			Frequency:  utils.ExtractIntValue(cell(cells, 3)),
+			Power:      utils.Tenths(utils.ExtractFloatValue(cell(cells, 4))),
+			Snr:        utils.Tenths(utils.ExtractFloatValue(cell(cells, 5))),
+			Prerserr:   utils.ExtractIntValue(cell(cells, 6)),
+			Postrserr:  utils.ExtractIntValue(cell(cells, 7)),
+			Locked:     locked,
+		})
+	})
+
+	eachChannelRow(doc, "Downstream OFDM Channels", func(cells []string, locked bool) {
+		downChannels = append(downChannels, utils.ModemChannel{
+			ChannelID:    utils.ExtractIntValue(cell(cells, 0)),
+			Channel:      len(downChannels) + 1,
+			Scheme:       "OFDM",
+			ChannelWidth: utils.ExtractIntValue(cell(cells, 2)),
+			Frequency:    utils.ExtractIntValue(cell(cells, 3)),
+			Power:        utils.Tenths(utils.ExtractFloatValue(cell(cells, 4))),
+			Snr:          utils.Tenths(utils.ExtractFloatValue(cell(cells, 5))),
+			Prerserr:     utils.ExtractIntValue(cell(cells, 6)),
+			Postrserr:    utils.ExtractIntValue(cell(cells, 7)),
+			Locked:       locked,
+		})
+	})
+
+	eachChannelRow(doc, "Upstream Bonded Channels", func(cells []string, locked bool) {
+		channel := utils.ModemChannel{
+			ChannelID:    utils.ExtractIntValue(cell(cells, 0)),
+			Channel:      len(upChannels) + 1,
+			Scheme:       "ATDMA",
+			Frequency:    utils.ExtractIntValue(cell(cells, 3)),
+			ChannelWidth: utils.ExtractIntValue(cell(cells, 4)),
+			Power:        utils.Tenths(utils.ExtractFloatValue(cell(cells, 5))),
+			Locked:       locked,
+		}
+		if strings.HasPrefix(cell(cells, 2), "OFDM") {
+			channel.Scheme = "OFDMA"
+		} else {
+			channel.SymbolRate = utils.ExtractIntValue(cell(cells, 6))
+		}
+		upChannels = append(upChannels, channel)
+	})
+
+	return utils.ModemStats{
+		DownChannels: downChannels,
+		UpChannels:   upChannels,
+		FetchTime:    s33.FetchTime,
+
+		DocsisCapability: utils.Docsis31,
+	}, nil
+}
@@ -0,0 +1,250 @@
+package s33
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/msh100/modem-stats/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadTestData(t *testing.T, filename string) []byte {
+	data, err := os.ReadFile("test_state/" + filename)
+	require.NoError(t, err, "failed to load test data: %s", filename)
+	return data
+}
+
+// Values for test_state/login_challenge.json with the password "password"
+const (
+	expectedPrivateKey    = "D2842190744F8DB67389FAC53BF6BF12"
+	expectedLoginPassword = "DC68889AC2AA46D205B74FF6097359E8"
+	expectedHNAPAuth      = "24BB3E776EEEFBCF6C169B2324C8E8D3 1700000000000"
+)
+
+// hnapServer imitates the S33's HNAP login and status page
+type hnapServer struct {
+	t         *testing.T
+	challenge []byte
+	status    []byte
+
+	mu       sync.Mutex
+	logins   []loginRequest
+	authed   bool
+	sessions int
+}
+
+func (s *hnapServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/HNAP1/":
+		assert.Equal(s.t, hnapLoginAction, r.Header.Get("SOAPAction"))
+
+		var request loginRequest
+		body, _ := io.ReadAll(r.Body)
+		require.NoError(s.t, json.Unmarshal(body, &request))
+		s.logins = append(s.logins, request)
+
+		if request.Login.Action == "request" {
+			w.Write(s.challenge)
+			return
+		}
+
+		// A wrong password also gives a wrong private key, and so a wrong
+		// HNAP_AUTH signature
+		uid, err := r.Cookie("uid")
+		require.NoError(s.t, err)
+		assert.Equal(s.t, "741928365", uid.Value)
+		if request.Login.LoginPassword != expectedLoginPassword || r.Header.Get("HNAP_AUTH") != expectedHNAPAuth {
+			w.Write([]byte(`{"LoginResponse": {"LoginResult": "FAILED"}}`))
+			return
+		}
+		s.authed = true
+		s.sessions++
+		w.Write([]byte(`{"LoginResponse": {"LoginResult": "OK"}}`))
+	case "/cmconnectionstatus.html":
+		privateKey, err := r.Cookie("PrivateKey")
+		if !s.authed || err != nil || privateKey.Value != expectedPrivateKey {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write(s.status)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newHNAPServer(t *testing.T) (*hnapServer, *Modem) {
+	handler := &hnapServer{
+		t:         t,
+		challenge: loadTestData(t, "login_challenge.json"),
+		status:    loadTestData(t, "cmconnectionstatus.html"),
+	}
+	server := httptest.NewTLSServer(handler)
+	t.Cleanup(server.Close)
+
+	modem := &Modem{
+		IPAddress: strings.TrimPrefix(server.URL, "https://"),
+		now:       func() time.Time { return time.UnixMilli(1700000000000) },
+	}
+	return handler, modem
+}
+
+func TestModem_Type(t *testing.T) {
+	modem := Modem{}
+	assert.Equal(t, utils.TypeDocsis, modem.Type())
+}
+
+func TestModem_BaseAddress(t *testing.T) {
+	modem := Modem{}
+	assert.Equal(t, "https://192.168.100.1", modem.baseAddress())
+
+	modem = Modem{IPAddress: "10.0.0.1"}
+	assert.Equal(t, "https://10.0.0.1", modem.baseAddress())
+}
+
+func TestHmacMD5(t *testing.T) {
+	// RFC 2104 test vector
+	assert.Equal(t, "750C783E6AB0B503EAA86E310A5DB738", hmacMD5("Jefe", "what do ya want for nothing?"))
+}
+
+func TestModem_Login(t *testing.T) {
+	server, modem := newHNAPServer(t)
+
+	require.NoError(t, modem.login())
+	assert.Equal(t, expectedPrivateKey, modem.privateKey)
+	assert.Equal(t, "741928365", modem.uid)
+
+	require.Len(t, server.logins, 2)
+	assert.Equal(t, "request", server.logins[0].Login.Action)
+	assert.Equal(t, "admin", server.logins[0].Login.Username)
+	assert.Equal(t, "", server.logins[0].Login.LoginPassword)
+	assert.Equal(t, "login", server.logins[1].Login.Action)
+	assert.Equal(t, expectedLoginPassword, server.logins[1].Login.LoginPassword)
+}
+
+func TestModem_Login_WrongPassword(t *testing.T) {
+	_, modem := newHNAPServer(t)
+	modem.Password = "wrong"
+
+	err := modem.login()
+	assert.ErrorIs(t, err, errLoginFailed)
+	assert.Empty(t, modem.privateKey, "a failed login should not leave a session behind")
+
+	_, err = modem.ParseStats()
+	assert.ErrorIs(t, err, errLoginFailed)
+}
+
+func TestModem_ParseStats_FromModem(t *testing.T) {
+	server, modem := newHNAPServer(t)
+
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+	assert.Len(t, stats.DownChannels, 4)
+	assert.Len(t, stats.UpChannels, 3)
+	assert.Equal(t, 1, server.sessions)
+
+	// The session is reused between scrapes
+	modem.ClearStats()
+	_, err = modem.ParseStats()
+	require.NoError(t, err)
+	assert.Equal(t, 1, server.sessions)
+
+	// An expired session logs in again
+	server.authed = false
+	modem.ClearStats()
+	_, err = modem.ParseStats()
+	require.NoError(t, err)
+	assert.Equal(t, 2, server.sessions)
+}
+
+func TestModem_ParseStats_DownstreamChannels(t *testing.T) {
+	modem := Modem{Stats: loadTestData(t, "cmconnectionstatus.html")}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+
+	require.Len(t, stats.DownChannels, 4)
+	assert.Equal(t, utils.ModemChannel{
+		ChannelID:  21,
+		Channel:    2,
+		Frequency:  597000000,
+		Snr:        386,
+		Power:      -21,
+		Prerserr:   1041,
+		Postrserr:  37,
+		Modulation: "QAM256",
+		Scheme:     "SC-QAM",
+		Locked:     true,
+	}, stats.DownChannels[1])
+	assert.Equal(t, 22, stats.DownChannels[2].ChannelID)
+	assert.False(t, stats.DownChannels[2].Locked)
+}
+
+func TestModem_ParseStats_NegativeValues(t *testing.T) {
+	// Units separated by a non-breaking space, and a minus sign rather than a
+	// hyphen
+	page := `<table>
+<tr><th colspan="8"><strong>Downstream Bonded Channels</strong></th></tr>
+<tr><td>Channel ID</td><td>Lock Status</td><td>Modulation</td><td>Frequency</td><td>Power</td><td>SNR/MER</td><td>Corrected</td><td>Uncorrectables</td></tr>
+<tr><td>20</td><td>Locked</td><td>QAM 256</td><td>591000000&nbsp;Hz</td><td>-7.2&nbsp;dBmV</td><td>38.6 dB</td><td>0</td><td>0</td></tr>
+<tr><td>21</td><td>Locked</td><td>QAM 256</td><td>597000000&nbsp;Hz</td><td>&minus;15 dBmV</td><td>36 dB</td><td>0</td><td>0</td></tr>
+</table>`
+	modem := Modem{Stats: []byte(page)}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+
+	require.Len(t, stats.DownChannels, 2)
+	assert.Equal(t, 591000000, stats.DownChannels[0].Frequency)
+	assert.Equal(t, -72, stats.DownChannels[0].Power)
+	assert.Equal(t, -150, stats.DownChannels[1].Power)
+}
+
+func TestModem_ParseStats_OFDMChannels(t *testing.T) {
+	modem := Modem{Stats: loadTestData(t, "cmconnectionstatus.html")}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+
+	assert.Equal(t, utils.ModemChannel{
+		ChannelID:    33,
+		Channel:      4,
+		Frequency:    722000000,
+		Snr:          410,
+		Power:        14,
+		Prerserr:     803224,
+		Postrserr:    0,
+		Scheme:       "OFDM",
+		Locked:       true,
+		ChannelWidth: 94000000,
+	}, stats.DownChannels[3])
+	assert.Equal(t, utils.Docsis31, utils.NegotiatedDocsisVersion(stats))
+}
+
+func TestModem_ParseStats_UpstreamChannels(t *testing.T) {
+	modem := Modem{Stats: loadTestData(t, "cmconnectionstatus.html")}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+
+	require.Len(t, stats.UpChannels, 3)
+	assert.Equal(t, utils.ModemChannel{
+		ChannelID:    1,
+		Channel:      1,
+		Frequency:    16400000,
+		Power:        440,
+		Scheme:       "ATDMA",
+		Locked:       true,
+		SymbolRate:   5120,
+		ChannelWidth: 6400000,
+	}, stats.UpChannels[0])
+	assert.Equal(t, "OFDMA", stats.UpChannels[2].Scheme)
+	assert.Equal(t, 392, stats.UpChannels[2].Power)
+	assert.Equal(t, 0, stats.UpChannels[2].SymbolRate)
+}
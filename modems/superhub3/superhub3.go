@@ -27,10 +27,30 @@ func (sh3 *Modem) ClearStats() {
 	sh3.Stats = nil
 }
 
+// RawStats returns the statistics as last fetched from the modem
+func (sh3 *Modem) RawStats() []byte {
+	return sh3.Stats
+}
+
 func (sh3 *Modem) Type() string {
 	return utils.TypeDocsis
 }
 
+// Host returns the host the modem's requests are made to
+func (sh3 *Modem) Host() string {
+	return utils.URLHost(sh3.fetchURL())
+}
+
+// Capabilities lists the statistics populated by this modem
+func (sh3 *Modem) Capabilities() []utils.Capability {
+	return []utils.Capability{
+		utils.CapDownstreamChannels,
+		utils.CapUpstreamChannels,
+		utils.CapCodewords,
+		utils.CapServiceFlows,
+	}
+}
+
 func (sh3 *Modem) fetchURL() string {
 	if sh3.IPAddress == "" {
 		sh3.IPAddress = "192.168.100.1"
@@ -187,5 +207,7 @@ func (sh3 *Modem) ParseStats() (utils.ModemStats, error) {
 		DownChannels: downChannels,
 		FetchTime:    sh3.FetchTime,
 		ModemType:    utils.TypeDocsis,
+
+		DocsisCapability: utils.Docsis30,
 	}, nil
 }
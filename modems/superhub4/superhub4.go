@@ -20,10 +20,31 @@ func (sh4 *Modem) ClearStats() {
 	sh4.Stats = nil
 }
 
+// RawStats returns the statistics as last fetched from the modem
+func (sh4 *Modem) RawStats() []byte {
+	return sh4.Stats
+}
+
 func (sh4 *Modem) Type() string {
 	return utils.TypeDocsis
 }
 
+// Host returns the host the modem's requests are made to
+func (sh4 *Modem) Host() string {
+	return utils.URLHost(sh4.fetchURL())
+}
+
+// Capabilities lists the statistics populated by this modem
+func (sh4 *Modem) Capabilities() []utils.Capability {
+	return []utils.Capability{
+		utils.CapDownstreamChannels,
+		utils.CapUpstreamChannels,
+		utils.CapCodewords,
+		utils.CapServiceFlows,
+		utils.CapConfigFile,
+	}
+}
+
 func (sh4 *Modem) fetchURL() string {
 	if sh4.IPAddress == "" {
 		sh4.IPAddress = "192.168.100.1"
@@ -68,9 +89,9 @@ func (sh4 *Modem) ParseStats() (utils.ModemStats, error) {
 		channelID, _ := strconv.Atoi(downChannelData[0])
 		frequency, _ := strconv.Atoi(downChannelData[1])
 		snr, _ := strconv.ParseFloat(downChannelData[3], 64)
-		snrint := int(snr * 10)
+		snrint := utils.Tenths(snr)
 		power, _ := strconv.ParseFloat(downChannelData[2], 64)
-		powerint := int(power * 10)
+		powerint := utils.Tenths(power)
 		prerserr, _ := strconv.Atoi(downChannelData[7])
 		postrserr, _ := strconv.Atoi(downChannelData[8])
 
@@ -93,7 +114,7 @@ func (sh4 *Modem) ParseStats() (utils.ModemStats, error) {
 			Power:      powerint,
 			Prerserr:   prerserr,
 			Postrserr:  postrserr,
-			Modulation: downChannelData[4],
+			Modulation: utils.NormalizeModulation(downChannelData[4]),
 			Scheme:     "SC-QAM",
 		})
 	}
@@ -110,9 +131,9 @@ func (sh4 *Modem) ParseStats() (utils.ModemStats, error) {
 		channelID, _ := strconv.Atoi(down31ChannelData[0])
 		frequency, _ := strconv.Atoi(down31ChannelData[1] + "000000")
 		snr, _ := strconv.ParseFloat(down31ChannelData[7], 64)
-		snrint := int(snr * 10)
+		snrint := utils.Tenths(snr)
 		power, _ := strconv.ParseFloat(down31ChannelData[8], 64)
-		powerint := int(power * 10)
+		powerint := utils.Tenths(power)
 		prerserr, _ := strconv.Atoi(down31ChannelData[9])
 		postrserr, _ := strconv.Atoi(down31ChannelData[10])
 
@@ -135,7 +156,7 @@ func (sh4 *Modem) ParseStats() (utils.ModemStats, error) {
 			Power:      powerint,
 			Prerserr:   prerserr,
 			Postrserr:  postrserr,
-			Modulation: down31ChannelData[4],
+			Modulation: utils.NormalizeModulation(down31ChannelData[4]),
 			Scheme:     "OFDM",
 		})
 	}
@@ -153,7 +174,7 @@ func (sh4 *Modem) ParseStats() (utils.ModemStats, error) {
 		channelID, _ := strconv.Atoi(upChannelData[0])
 		frequency, _ := strconv.Atoi(upChannelData[1])
 		power, _ := strconv.ParseFloat(upChannelData[2], 64)
-		powerint := int(power * 10)
+		powerint := utils.Tenths(power)
 
 		if channelID < 1 || channelID > 1024 {
 			error := fmt.Errorf("abnormal channel ID, got %d", channelID)
@@ -188,7 +209,7 @@ func (sh4 *Modem) ParseStats() (utils.ModemStats, error) {
 		frequency, _ := strconv.ParseFloat(up31ChannelData[7], 64)
 		frequencyInt := int(frequency * 1000000)
 		power, _ := strconv.ParseFloat(up31ChannelData[2], 64)
-		powerint := int(power * 10)
+		powerint := utils.Tenths(power)
 
 		if channelID < 1 || channelID > 1024 {
 			error := fmt.Errorf("abnormal 3.1 channel ID, got %d", channelID)
@@ -231,5 +252,8 @@ func (sh4 *Modem) ParseStats() (utils.ModemStats, error) {
 		UpChannels:   upChannels,
 		DownChannels: downChannels,
 		FetchTime:    sh4.FetchTime,
+
+		DocsisCapability: utils.Docsis31,
+		ConfigFile:       arr[9],
 	}, returnerr
 }
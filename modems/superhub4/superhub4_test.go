@@ -0,0 +1,107 @@
+package superhub4
+
+import (
+	"os"
+	"testing"
+
+	"github.com/msh100/modem-stats/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadTestData(t *testing.T, filename string) []byte {
+	data, err := os.ReadFile("test_state/" + filename)
+	require.NoError(t, err, "failed to load test data: %s", filename)
+	return data
+}
+
+func TestModem_Type(t *testing.T) {
+	modem := Modem{}
+	assert.Equal(t, utils.TypeDocsis, modem.Type())
+}
+
+func TestModem_FetchURL(t *testing.T) {
+	modem := Modem{}
+	assert.Equal(t, "http://192.168.100.1/php/ajaxGet_device_networkstatus_data.php", modem.fetchURL())
+}
+
+func TestModem_ParseStats_ChannelCounts(t *testing.T) {
+	for _, fixture := range []string{"cg0.json", "sno.json"} {
+		t.Run(fixture, func(t *testing.T) {
+			modem := Modem{Stats: loadTestData(t, fixture)}
+			stats, err := modem.ParseStats()
+			require.NoError(t, err)
+
+			// 31 SC-QAM and 1 OFDM downstream, 5 ATDMA and 1 OFDMA upstream
+			assert.Len(t, stats.DownChannels, 32)
+			assert.Len(t, stats.UpChannels, 6)
+			assert.Equal(t, utils.Docsis31, utils.NegotiatedDocsisVersion(stats))
+
+			require.Len(t, stats.Configs, 2)
+			assert.Equal(t, utils.ModemConfig{Config: "downstream", Maxrate: 1200000450, Maxburst: 42600}, stats.Configs[0])
+			assert.Equal(t, utils.ModemConfig{Config: "upstream", Maxrate: 55000270, Maxburst: 42600}, stats.Configs[1])
+			assert.Equal(t, "wrkldJKDHSUBsgvca69834ncx", stats.ConfigFile)
+		})
+	}
+}
+
+func TestModem_ParseStats_DownstreamChannels(t *testing.T) {
+	modem := Modem{Stats: loadTestData(t, "cg0.json")}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+
+	assert.Equal(t, utils.ModemChannel{
+		ChannelID:  30,
+		Channel:    1,
+		Frequency:  371000000,
+		Snr:        390,
+		Power:      77,
+		Modulation: "QAM256",
+		Scheme:     "SC-QAM",
+	}, stats.DownChannels[0])
+
+	// The OFDM channel reports its frequency in MHz
+	assert.Equal(t, utils.ModemChannel{
+		ChannelID:  159,
+		Channel:    1,
+		Frequency:  96000000,
+		Snr:        410,
+		Power:      69,
+		Prerserr:   1399128308,
+		Modulation: "QAM4096",
+		Scheme:     "OFDM",
+	}, stats.DownChannels[31])
+}
+
+func TestModem_ParseStats_UpstreamChannels(t *testing.T) {
+	modem := Modem{Stats: loadTestData(t, "cg0.json")}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+
+	assert.Equal(t, utils.ModemChannel{
+		ChannelID: 9,
+		Channel:   1,
+		Frequency: 49600000,
+		Power:     425,
+	}, stats.UpChannels[0])
+
+	// OFDMA channels are numbered after the SC-QAM channels
+	assert.Equal(t, utils.ModemChannel{
+		ChannelID: 14,
+		Channel:   6,
+		Frequency: 53900000,
+		Power:     370,
+	}, stats.UpChannels[5])
+}
+
+func TestModem_ParseStats_BrokenStats(t *testing.T) {
+	// The empty document served by a Superhub 4 in a bad state, see
+	// sh4-testcase.sh
+	modem := Modem{Stats: []byte(`["","","","",null,"","","","","","","","","","","","","","","","[[\"\",\"\",\"\",\"\",\"\",\"\",\"\",\"\",\"\"]]","[[\"\",\"\",\"\",\"\",\"\",\"\",\"\",\"\",\"\",\"\"]]","[]","[[\"\",\"\",\"\",\"\",\"\",\"\",\"\",\"\",\"\",\"\",\"\"]]","[[\"\",\"\",\"\",\"\",\"\",\"\",\"\",\"\",\"\",\"\"]]","","","","",""]`)}
+	stats, err := modem.ParseStats()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "got nil values for speed config")
+	assert.Contains(t, err.Error(), "abnormal channel ID")
+	assert.Empty(t, stats.DownChannels)
+	assert.Empty(t, stats.UpChannels)
+}
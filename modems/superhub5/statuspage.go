@@ -0,0 +1,212 @@
+package superhub5
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/msh100/modem-stats/utils"
+)
+
+// statusPagePath is the HTML status page of the web interface, which still
+// lists the channels on firmware with the REST API disabled
+const statusPagePath = "/status.html"
+
+// Sources of the statistics, the status page only being used when the REST
+// API is unavailable
+const (
+	sourceREST = "rest"
+	sourceHTML = "html"
+)
+
+// errNoChannelTables is returned for a status page without any channel table
+// to fall back to, such as a login page
+var errNoChannelTables = errors.New("no channel tables in the status page")
+
+// Fields of a channel filled from the columns of the status page
+const (
+	columnChannelID   = "id"
+	columnType        = "type"
+	columnFrequency   = "frequency"
+	columnLocked      = "locked"
+	columnModulation  = "modulation"
+	columnPower       = "power"
+	columnSNR         = "snr"
+	columnCorrected   = "corrected"
+	columnUncorrected = "uncorrected"
+)
+
+// columnField returns the field filled by a column of a channel table from
+// its heading, false for a column which is not used. Headings vary between
+// firmware versions, so are matched loosely.
+func columnField(heading string) (string, bool) {
+	heading = strings.ToLower(heading)
+	switch {
+	case strings.Contains(heading, "channel id"):
+		return columnChannelID, true
+	case strings.Contains(heading, "type"):
+		return columnType, true
+	case strings.Contains(heading, "frequency"):
+		return columnFrequency, true
+	case strings.Contains(heading, "lock"):
+		return columnLocked, true
+	case strings.Contains(heading, "modulation"):
+		return columnModulation, true
+	case strings.Contains(heading, "power"):
+		return columnPower, true
+	case strings.Contains(heading, "snr"), strings.Contains(heading, "mer"):
+		return columnSNR, true
+	// Checked first as "uncorrected" contains "corrected"
+	case strings.Contains(heading, "uncorrect"):
+		return columnUncorrected, true
+	case strings.Contains(heading, "corrected"):
+		return columnCorrected, true
+	}
+	return "", false
+}
+
+// channelScheme normalises the channel type shown by the status page, such as
+// "sc_qam" or "OFDM", falling back to the direction's usual scheme
+func channelScheme(channelType, fallback string) string {
+	switch strings.ToLower(strings.NewReplacer("-", "", "_", "", " ", "").Replace(channelType)) {
+	case "scqam":
+		return "SC-QAM"
+	case "ofdm":
+		return "OFDM"
+	case "atdma":
+		return "ATDMA"
+	case "ofdma":
+		return "OFDMA"
+	}
+	return fallback
+}
+
+// channelTable returns the direction of a channel table from its caption or
+// title row, false if it is not a channel table
+func channelTable(table *goquery.Selection) (string, bool) {
+	title := table.Find("caption").Text()
+	if title == "" {
+		title = table.Find("tr").First().Text()
+	}
+	title = strings.ToLower(title)
+	switch {
+	case strings.Contains(title, "downstream"):
+		return "downstream", true
+	case strings.Contains(title, "upstream"):
+		return "upstream", true
+	}
+	return "", false
+}
+
+// parseChannelTable reads the channels of a table, whose columns are named by
+// the first row of headings
+func parseChannelTable(table *goquery.Selection, fallbackScheme string) []utils.ModemChannel {
+	var fields []string
+	var channels []utils.ModemChannel
+	table.Find("tr").Each(func(i int, row *goquery.Selection) {
+		if headings := row.Find("th"); fields == nil && headings.Length() > 1 {
+			headings.Each(func(j int, heading *goquery.Selection) {
+				field, _ := columnField(strings.TrimSpace(heading.Text()))
+				fields = append(fields, field)
+			})
+			return
+		}
+
+		cells := make(map[string]string)
+		row.Find("td").Each(func(j int, cell *goquery.Selection) {
+			if j < len(fields) && fields[j] != "" {
+				cells[fields[j]] = strings.TrimSpace(cell.Text())
+			}
+		})
+		if cells[columnChannelID] == "" {
+			return
+		}
+
+		uncorrected := utils.ExtractIntValue(cells[columnUncorrected])
+		channels = append(channels, utils.ModemChannel{
+			ChannelID:  utils.ExtractIntValue(cells[columnChannelID]),
+			Channel:    len(channels) + 1,
+			Frequency:  normalizeFrequency(utils.ExtractFloatValue(cells[columnFrequency])),
+			Snr:        utils.Tenths(utils.ExtractFloatValue(cells[columnSNR])),
+			Power:      utils.Tenths(utils.ExtractFloatValue(cells[columnPower])),
+			Prerserr:   utils.ExtractIntValue(cells[columnCorrected]) + uncorrected,
+			Postrserr:  uncorrected,
+			Modulation: utils.NormalizeModulation(cells[columnModulation]),
+			Scheme:     channelScheme(cells[columnType], fallbackScheme),
+			Locked:     utils.ParseLockStatus(cells[columnLocked]),
+		})
+	})
+	return channels
+}
+
+// parseStatusPageChannels reads the downstream and upstream channels from the
+// status page
+func parseStatusPageChannels(page []byte) ([]utils.ModemChannel, []utils.ModemChannel, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var downChannels, upChannels []utils.ModemChannel
+	found := false
+	doc.Find("table").Each(func(i int, table *goquery.Selection) {
+		direction, ok := channelTable(table)
+		if !ok {
+			return
+		}
+		if direction == "downstream" {
+			downChannels = append(downChannels, parseChannelTable(table, "SC-QAM")...)
+		} else {
+			upChannels = append(upChannels, parseChannelTable(table, "ATDMA")...)
+		}
+		found = true
+	})
+	if !found {
+		return nil, nil, errNoChannelTables
+	}
+
+	// Channels are numbered across tables, as on the REST API
+	for i := range downChannels {
+		downChannels[i].Channel = i + 1
+	}
+	for i := range upChannels {
+		upChannels[i].Channel = i + 1
+	}
+	return downChannels, upChannels, nil
+}
+
+// fetchStatusPage fetches the HTML status page into StatusPage, as a fallback
+// for when the REST API is unavailable, failing if it has no channel tables
+func (sh5 *Modem) fetchStatusPage() error {
+	url := fmt.Sprintf("%s://%s%s", sh5.scheme(), sh5.IPAddress, statusPagePath)
+	page, fetchTime, err := utils.SimpleHTTPFetch(url)
+	if err != nil {
+		return err
+	}
+	if _, _, err := parseStatusPageChannels(page); err != nil {
+		return err
+	}
+	sh5.StatusPage = page
+	sh5.FetchTime += fetchTime
+	return nil
+}
+
+// parseStatusPage reads the statistics from the HTML status page. It only
+// lists the channels, so everything else the REST API reports is missing.
+func (sh5 *Modem) parseStatusPage() (utils.ModemStats, error) {
+	downChannels, upChannels, err := parseStatusPageChannels(sh5.StatusPage)
+	if err != nil {
+		return utils.ModemStats{}, err
+	}
+	return utils.ModemStats{
+		DownChannels:      downChannels,
+		UpChannels:        upChannels,
+		FetchTime:         sh5.FetchTime,
+		DocsisCapability:  utils.Docsis31,
+		EndpointUp:        sh5.endpointUp,
+		EndpointDurations: sh5.endpointDurations,
+		Source:            sourceHTML,
+	}, nil
+}
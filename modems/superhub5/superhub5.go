@@ -1,62 +1,289 @@
 package superhub5
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"regexp"
+	"math"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
 	"time"
 
 	jsonpatch "github.com/evanphx/json-patch"
 	"github.com/msh100/modem-stats/utils"
+	"github.com/msh100/modem-stats/utils/logging"
 )
 
 type Modem struct {
 	IPAddress string
 	Stats     []byte
 	FetchTime int64
+
+	// StatusPage is the HTML status page, fetched in place of Stats when
+	// the REST API is unavailable
+	StatusPage []byte
+
+	// OFDMPowerScale is the unit of downstream OFDM channel power reported by
+	// the firmware, one of OFDMPowerScales (detected when empty)
+	OFDMPowerScale string
+
+	// Endpoints limits the statistics fetched to the named Endpoints, such as
+	// to skip a slow serviceflows endpoint (all are fetched when empty)
+	Endpoints []string
+
+	// Scheme is how the REST API is reached, one of Schemes (HTTPS when
+	// empty)
+	Scheme string
+
+	// endpointUp is whether each endpoint responded to the last fetch
+	endpointUp map[string]bool
+
+	// endpointDurations is how long each endpoint took to respond to the
+	// last fetch
+	endpointDurations map[string]time.Duration
+
+	// detectedScheme is the scheme found to reach the REST API with
+	// SchemeAuto, empty until detected
+	schemeMu       sync.Mutex
+	detectedScheme string
+}
+
+// Schemes the REST API is reached over. Most firmware serves it over HTTPS,
+// but some (and some modem mode variants) only over plain HTTP.
+const (
+	SchemeHTTPS = "https"
+	SchemeHTTP  = "http"
+	SchemeAuto  = "auto"
+)
+
+// Schemes lists the supported schemes
+var Schemes = []string{SchemeHTTPS, SchemeHTTP, SchemeAuto}
+
+// IsKnownScheme reports whether a scheme is supported, an empty scheme being
+// SchemeHTTPS
+func IsKnownScheme(scheme string) bool {
+	if scheme == "" {
+		return true
+	}
+	for _, s := range Schemes {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// Units of downstream OFDM channel power. Some firmware reports OFDM power in
+// tenths of a dBmV, unlike the dBmV of SC-QAM channels, while other firmware
+// reports dBmV for both.
+const (
+	OFDMPowerAuto   = "auto"
+	OFDMPowerTenths = "tenths"
+	OFDMPowerDBmV   = "dbmv"
+)
+
+// OFDMPowerScales lists the supported OFDM power scales
+var OFDMPowerScales = []string{OFDMPowerAuto, OFDMPowerTenths, OFDMPowerDBmV}
+
+// IsKnownOFDMPowerScale reports whether an OFDM power scale is supported, an
+// empty scale being detected like OFDMPowerAuto
+func IsKnownOFDMPowerScale(scale string) bool {
+	if scale == "" {
+		return true
+	}
+	for _, s := range OFDMPowerScales {
+		if s == scale {
+			return true
+		}
+	}
+	return false
 }
 
 func (sh5 *Modem) ClearStats() {
 	sh5.Stats = nil
+	sh5.StatusPage = nil
+	sh5.endpointUp = nil
+	sh5.endpointDurations = nil
+}
+
+// RawStats returns the statistics as last fetched from the modem, the HTML
+// status page when fallen back to
+func (sh5 *Modem) RawStats() []byte {
+	if sh5.StatusPage != nil {
+		return sh5.StatusPage
+	}
+	return sh5.Stats
 }
 
 func (sh5 *Modem) Type() string {
 	return utils.TypeDocsis
 }
 
-func (sh5 *Modem) apiAddress() string {
+// Host returns the host the modem's requests are made to
+func (sh5 *Modem) Host() string {
+	return utils.URLHost(sh5.restAddress())
+}
+
+// Capabilities lists the statistics populated by this modem, leaving out
+// those only fetched from endpoints which are not queried
+func (sh5 *Modem) Capabilities() []utils.Capability {
+	skipped := make(map[utils.Capability]bool)
+	for name, capabilities := range endpointCapabilities {
+		if !sh5.queries(name) {
+			for _, capability := range capabilities {
+				skipped[capability] = true
+			}
+		}
+	}
+
+	var capabilities []utils.Capability
+	for _, capability := range allCapabilities {
+		if !skipped[capability] {
+			capabilities = append(capabilities, capability)
+		}
+	}
+	return capabilities
+}
+
+// allCapabilities are populated when every endpoint is queried
+var allCapabilities = []utils.Capability{
+	utils.CapDownstreamChannels,
+	utils.CapUpstreamChannels,
+	utils.CapCodewords,
+	utils.CapTimeouts,
+	utils.CapLockStatus,
+	utils.CapPartialService,
+	utils.CapSymbolRate,
+	utils.CapChannelWidth,
+	utils.CapServiceFlows,
+	utils.CapProvisioning,
+	utils.CapOptics,
+	utils.CapOperatingMode,
+	utils.CapUptime,
+	utils.CapConnectivityUptime,
+	utils.CapInterleaver,
+	utils.CapRangingStatus,
+	utils.CapDocsisState,
+	utils.CapSubcarrierPower,
+	utils.CapEndpointHealth,
+	utils.CapEndpointTiming,
+	utils.CapMACAddress,
+}
+
+func (sh5 *Modem) restAddress() string {
+	return sh5.restAddressOver(sh5.scheme())
+}
+
+func (sh5 *Modem) restAddressOver(scheme string) string {
 	if sh5.IPAddress == "" {
 		sh5.IPAddress = "192.168.100.1" // TODO: Is this a reasonable default?
 	}
-	return fmt.Sprintf("https://%s/rest/v1/cablemodem", sh5.IPAddress)
+	return fmt.Sprintf("%s://%s/rest/v1", scheme, sh5.IPAddress)
+}
+
+// scheme returns the scheme the REST API is reached over, HTTPS for
+// SchemeAuto until another has been detected
+func (sh5 *Modem) scheme() string {
+	switch sh5.Scheme {
+	case SchemeHTTP:
+		return SchemeHTTP
+	case SchemeAuto:
+		sh5.schemeMu.Lock()
+		defer sh5.schemeMu.Unlock()
+		if sh5.detectedScheme != "" {
+			return sh5.detectedScheme
+		}
+	}
+	return SchemeHTTPS
+}
+
+// detectScheme finds the scheme the REST API is served over for SchemeAuto,
+// trying HTTPS and then falling back to HTTP. Neither responding successfully
+// leaves it to be detected on the next fetch.
+func (sh5 *Modem) detectScheme() {
+	sh5.schemeMu.Lock()
+	detected := sh5.detectedScheme != ""
+	sh5.schemeMu.Unlock()
+	if detected {
+		return
+	}
+
+	for _, scheme := range []string{SchemeHTTPS, SchemeHTTP} {
+		url := sh5.restAddressOver(scheme) + "/cablemodem/state_"
+		res, err := utils.InsecureHTTPClient().Get(url)
+		if err != nil {
+			logging.Debugf("REST API not reachable over %s: %v", scheme, err)
+			continue
+		}
+		res.Body.Close()
+		if res.StatusCode >= http.StatusBadRequest {
+			logging.Debugf("REST API not served over %s: status %d", scheme, res.StatusCode)
+			continue
+		}
+
+		logging.Infof("Reaching the REST API at %s over %s", sh5.IPAddress, scheme)
+		sh5.schemeMu.Lock()
+		sh5.detectedScheme = scheme
+		sh5.schemeMu.Unlock()
+		return
+	}
+}
+
+func (sh5 *Modem) apiAddress() string {
+	return sh5.restAddress() + "/cablemodem"
 }
 
 type dsChannel struct {
-	ID          int     `json:"channelId"`
-	Frequency   int     `json:"frequency"`
-	Power       float32 `json:"power"`
-	Modulation  string  `json:"modulation"`
-	SNR         int     `json:"snr"`
-	PreRS       int     `json:"correctedErrors"`
-	PostRS      int     `json:"uncorrectedErrors"`
-	ChannelType string  `json:"channelType"`
-	RxMer       int     `json:"rxMer"`
-	LockStatus  bool    `json:"lockStatus"`
+	ID           int     `json:"channelId"`
+	Frequency    float64 `json:"frequency"`
+	Power        float32 `json:"power"`
+	Modulation   string  `json:"modulation"`
+	SNR          *int    `json:"snr"`
+	PreRS        int     `json:"correctedErrors"`
+	PostRS       int     `json:"uncorrectedErrors"`
+	ChannelType  string  `json:"channelType"`
+	RxMer        int     `json:"rxMer"`
+	LockStatus   bool    `json:"lockStatus"`
+	ChannelWidth int     `json:"channelWidth"`
+	PartialSvc   bool    `json:"partialService"`
+	// Only reported by some firmware versions
+	CorrectedRatio *float64 `json:"correctedRatio"`
+	// Reported by some firmware versions in place of snr, as a percentage
+	LinkQuality *float64 `json:"linkQuality"`
+	// Only reported by some firmware versions, in dB
+	SNRMargin *float64 `json:"snrMargin"`
+	// OFDM channels only, and only reported by some firmware versions
+	PLCLockStatus *bool `json:"plcLockStatus"`
+	// SC-QAM channels only
+	InterleaverDepth int    `json:"interleaverDepth"`
+	Annex            string `json:"annex"`
 }
 
 type usChannel struct {
-	ID          int     `json:"channelId"`
-	Frequency   int     `json:"frequency"`
-	Power       float32 `json:"power"`
-	Modulation  string  `json:"modulation"`
-	ChannelType string  `json:"channelType"`
-	LockStatus  bool    `json:"lockStatus"`
-	SymbolRate  int     `json:"symbolRate"`
-	T1Timeout   int     `json:"t1Timeout"`
-	T2Timeout   int     `json:"t2Timeout"`
-	T3Timeout   int     `json:"t3Timeout"`
-	T4Timeout   int     `json:"t4Timeout"`
+	ID           int     `json:"channelId"`
+	Frequency    float64 `json:"frequency"`
+	Power        float32 `json:"power"`
+	Modulation   string  `json:"modulation"`
+	ChannelType  string  `json:"channelType"`
+	LockStatus   bool    `json:"lockStatus"`
+	SymbolRate   int     `json:"symbolRate"`
+	T1Timeout    int     `json:"t1Timeout"`
+	T2Timeout    int     `json:"t2Timeout"`
+	T3Timeout    int     `json:"t3Timeout"`
+	T4Timeout    int     `json:"t4Timeout"`
+	ChannelWidth int     `json:"channelWidth"`
+	Ranging      string  `json:"rangingStatus"`
+
+	// Transmit power by range of subcarriers, OFDMA channels only
+	SubcarrierPower []struct {
+		First int     `json:"firstSubcarrier"`
+		Last  int     `json:"lastSubcarrier"`
+		Power float32 `json:"power"`
+	} `json:"subcarrierPower"`
 }
 
 type serviceFlow struct {
@@ -65,6 +292,7 @@ type serviceFlow struct {
 		Direction string `json:"direction"`
 		MaxRate   int    `json:"maxTrafficRate"`
 		MaxBurst  int    `json:"maxTrafficBurst"`
+		State     string `json:"state"`
 	} `json:"serviceFlow"`
 }
 
@@ -74,11 +302,37 @@ type eventLogEntry struct {
 	Message  string `json:"message"`
 }
 
+type spectrumResponse struct {
+	Spectrum struct {
+		Points []struct {
+			Frequency float64 `json:"frequency"`
+			Power     float32 `json:"power"`
+		} `json:"points"`
+	} `json:"spectrum"`
+}
+
 type eventLogResponse struct {
 	EventLog []eventLogEntry `json:"eventlog"`
 }
 
+type cableModemState struct {
+	Status    string `json:"status"`
+	IPAddress string `json:"ipAddress"`
+	MAC       string `json:"macAddress"`
+	UpTime    int64  `json:"upTime"`
+	// Seconds since the last registration with the CMTS, only reported by
+	// some firmware versions
+	ConnectivityUpTime *int64 `json:"connectivityUpTime"`
+	// Stage of DOCSIS registration, only reported by some firmware versions
+	CmStatus string `json:"cmStatus"`
+}
+
+type stateResponse struct {
+	CableModem cableModemState `json:"cablemodem"`
+}
+
 type resultsStruct struct {
+	CableModem cableModemState `json:"cablemodem"`
 	Downstream struct {
 		Channels []dsChannel `json:"channels"`
 	} `json:"downstream"`
@@ -86,39 +340,318 @@ type resultsStruct struct {
 		Channels []usChannel `json:"channels"`
 	} `json:"upstream"`
 	ServiceFlows []serviceFlow `json:"serviceFlows"`
+	Optics       *struct {
+		RxPower float32 `json:"rxPower"`
+		TxPower float32 `json:"txPower"`
+	} `json:"optics"`
+	ModemMode *struct {
+		Enable bool `json:"enable"`
+	} `json:"modemMode"`
 }
 
-var modulationRegex = regexp.MustCompile("[0-9]+")
+// normalizeFrequency converts a channel frequency to Hz. Most firmware
+// reports Hz, but some reports kHz or MHz, which is told apart by magnitude:
+// DOCSIS channels lie between 5 MHz and 1.8 GHz, so the ranges of the three
+// units do not overlap.
+func normalizeFrequency(frequency float64) int {
+	switch {
+	case frequency < 5000:
+		frequency *= 1000000
+	case frequency < 5000000:
+		frequency *= 1000
+	}
+	return int(math.Round(frequency))
+}
 
-func (sh5 *Modem) ParseStats() (utils.ModemStats, error) {
-	if sh5.Stats == nil {
-		sh5.Stats = []byte("{}")
-		queries := []string{
-			sh5.apiAddress() + "/downstream",
-			sh5.apiAddress() + "/upstream",
-			sh5.apiAddress() + "/serviceflows",
+// Downstream power (in tenths of a dBmV) outside this range is implausible,
+// and most likely the OFDM power scale is wrong
+const (
+	minPlausibleDownPower = -200
+	maxPlausibleDownPower = 250
+)
+
+func plausibleDownPower(power int) bool {
+	return power >= minPlausibleDownPower && power <= maxPlausibleDownPower
+}
+
+// ofdmPower converts the power of a downstream OFDM channel to tenths of a
+// dBmV. When the scale is detected, a fractional value can only be dBmV,
+// otherwise the reading closest to the mean power of the SC-QAM channels
+// (given in tenths of a dBmV) is taken. With no SC-QAM channels to compare
+// against, tenths are assumed as on the firmware first supported.
+func ofdmPower(power float32, scale string, scQAMPowers []int) int {
+	tenths := int(math.Round(float64(power)))
+	dBmV := utils.Tenths(float64(power))
+
+	switch scale {
+	case OFDMPowerTenths:
+		return tenths
+	case OFDMPowerDBmV:
+		return dBmV
+	}
+
+	if float64(power) != math.Trunc(float64(power)) {
+		return dBmV
+	}
+	if len(scQAMPowers) == 0 {
+		return tenths
+	}
+	mean := 0
+	for _, p := range scQAMPowers {
+		mean += p
+	}
+	mean /= len(scQAMPowers)
+	if math.Abs(float64(dBmV-mean)) < math.Abs(float64(tenths-mean)) {
+		return dBmV
+	}
+	return tenths
+}
+
+// statsEndpoints (relative to /rest/v1) are fetched and merged to build the
+// modem's statistics
+var statsEndpoints = []string{
+	"/cablemodem/downstream",
+	"/cablemodem/upstream",
+	"/cablemodem/serviceflows",
+	"/cablemodem/state_",
+	"/cablemodem/optics",
+	"/system/modemmode",
+}
+
+// Endpoints are the names of the statistics endpoints a Modem can be limited to
+var Endpoints = []string{"downstream", "upstream", "serviceflows", "state", "optics", "modemmode"}
+
+// endpointPaths are the statsEndpoints by name
+var endpointPaths = map[string]string{
+	"downstream":   "/cablemodem/downstream",
+	"upstream":     "/cablemodem/upstream",
+	"serviceflows": "/cablemodem/serviceflows",
+	"state":        "/cablemodem/state_",
+	"optics":       "/cablemodem/optics",
+	"modemmode":    "/system/modemmode",
+}
+
+// endpointCapabilities are the capabilities only populated from one endpoint
+var endpointCapabilities = map[string][]utils.Capability{
+	"downstream":   {utils.CapDownstreamChannels, utils.CapCodewords, utils.CapPartialService, utils.CapInterleaver},
+	"upstream":     {utils.CapUpstreamChannels, utils.CapTimeouts, utils.CapSymbolRate, utils.CapRangingStatus, utils.CapSubcarrierPower},
+	"serviceflows": {utils.CapServiceFlows},
+	"state":        {utils.CapProvisioning, utils.CapUptime, utils.CapConnectivityUptime, utils.CapDocsisState, utils.CapMACAddress},
+	"optics":       {utils.CapOptics},
+	"modemmode":    {utils.CapOperatingMode},
+}
+
+// IsKnownEndpoint reports whether an endpoint can be selected by name
+func IsKnownEndpoint(name string) bool {
+	_, ok := endpointPaths[name]
+	return ok
+}
+
+// queries reports whether the named endpoint is fetched
+func (sh5 *Modem) queries(name string) bool {
+	if len(sh5.Endpoints) == 0 {
+		return true
+	}
+	for _, endpoint := range sh5.Endpoints {
+		if endpoint == name {
+			return true
 		}
+	}
+	return false
+}
+
+// statsEndpoints returns the statsEndpoints which are fetched
+func (sh5 *Modem) statsEndpoints() []string {
+	if len(sh5.Endpoints) == 0 {
+		return statsEndpoints
+	}
+	var endpoints []string
+	for _, name := range Endpoints {
+		if sh5.queries(name) {
+			endpoints = append(endpoints, endpointPaths[name])
+		}
+	}
+	return endpoints
+}
+
+// endpointName names a statsEndpoint as in Endpoints, after the last element
+// of its path
+func endpointName(endpoint string) string {
+	return strings.TrimSuffix(path.Base(endpoint), "_")
+}
+
+// anyEndpointUp reports whether any endpoint responded
+func anyEndpointUp(endpointUp map[string]bool) bool {
+	for _, up := range endpointUp {
+		if up {
+			return true
+		}
+	}
+	return false
+}
+
+// optionalEndpoints are not available on all SuperHub 5 variants or firmware
+// versions and are skipped when the modem returns a 404
+var optionalEndpoints = map[string]bool{
+	"/cablemodem/optics": true,
+	"/system/modemmode":  true,
+}
+
+// errHTMLResponse is returned when the REST API serves an HTML page instead of
+// JSON, which happens in router mode or while the modem is rebooting.
+var errHTMLResponse = errors.New("modem not in bridge mode / unexpected HTML response")
+
+// errAPIResponse is returned when the REST API serves an error object, such as
+// {"error":"unauthorized"}, with a 200 status instead of the statistics
+var errAPIResponse = errors.New("modem returned an error instead of statistics")
+
+// apiError returns the message of an error object served by the REST API,
+// false if the statistics have no top-level error. The error is a string on
+// most firmware, or an object with a message on some.
+func apiError(body []byte) (string, bool) {
+	var response struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &response) != nil || len(response.Error) == 0 || string(response.Error) == "null" {
+		return "", false
+	}
+
+	var message string
+	if json.Unmarshal(response.Error, &message) == nil {
+		return message, true
+	}
+	var object struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(response.Error, &object) == nil && object.Message != "" {
+		return object.Message, true
+	}
+	return string(response.Error), true
+}
+
+// isHTMLResponse reports whether a response looks like an HTML page rather
+// than the JSON document the REST API normally returns.
+func isHTMLResponse(contentType string, body []byte) bool {
+	if strings.Contains(strings.ToLower(contentType), "text/html") {
+		return true
+	}
+	return bytes.HasPrefix(bytes.TrimSpace(body), []byte("<"))
+}
+
+// isJSONObject reports whether a response body is a JSON object, the only
+// kind of document which can be merged with the other endpoints
+func isJSONObject(body []byte) bool {
+	var object map[string]json.RawMessage
+	return json.Unmarshal(body, &object) == nil && object != nil
+}
 
-		timeStart := time.Now().UnixMilli()
-		statsData := utils.BoundedParallelGet(queries, 3)
-		sh5.FetchTime = time.Now().UnixMilli() - timeStart
+// fetchREST fetches the statistics endpoints of the REST API and merges
+// them into Stats
+func (sh5 *Modem) fetchREST() error {
+	if sh5.Scheme == SchemeAuto {
+		sh5.detectScheme()
+	}
+	merged := []byte("{}")
+	endpoints := sh5.statsEndpoints()
+	queries := make([]string, len(endpoints))
+	for i, endpoint := range endpoints {
+		queries[i] = sh5.restAddress() + endpoint
+	}
+
+	timeStart := time.Now().UnixMilli()
+	statsData := utils.BoundedParallelGet(queries, len(queries))
+	sh5.FetchTime = time.Now().UnixMilli() - timeStart
+
+	// A bad endpoint should not lose the statistics from the others, so
+	// the scrape only fails when no endpoint could be reached
+	endpointUp := make(map[string]bool, len(endpoints))
+	endpointDurations := make(map[string]time.Duration, len(endpoints))
+	var fetchErr error
+	for _, query := range statsData {
+		endpoint := endpoints[query.Index]
+		name := endpointName(endpoint)
+		endpointDurations[name] = query.Duration
+		skip := func(format string, args ...interface{}) {
+			logging.Warnf("Skipping %s: "+format, append([]interface{}{endpoint}, args...)...)
+			endpointUp[name] = false
+		}
 
-		for _, query := range statsData {
-			if query.Err != nil {
-				return utils.ModemStats{}, query.Err
+		if query.Err != nil {
+			skip("%v", query.Err)
+			if fetchErr == nil {
+				fetchErr = query.Err
 			}
-			stats, err := io.ReadAll(query.Res.Body)
+			continue
+		}
+		if query.Res.StatusCode == http.StatusNotFound && optionalEndpoints[endpoint] {
 			query.Res.Body.Close()
-			if err != nil {
-				return utils.ModemStats{}, err
+			continue
+		}
+		stats, err := io.ReadAll(query.Res.Body)
+		query.Res.Body.Close()
+		if err != nil {
+			skip("%v", err)
+			if fetchErr == nil {
+				fetchErr = err
 			}
+			continue
+		}
+		if len(bytes.TrimSpace(stats)) == 0 {
+			skip("empty response")
+			continue
+		}
+		if isHTMLResponse(query.Res.Header.Get("Content-Type"), stats) {
+			return fmt.Errorf("%w from %s", errHTMLResponse, queries[query.Index])
+		}
+		if query.Res.StatusCode >= http.StatusBadRequest {
+			skip("status %d", query.Res.StatusCode)
+			continue
+		}
+		if !isJSONObject(stats) {
+			skip("response is not a JSON object")
+			continue
+		}
+		patched, err := jsonpatch.MergeMergePatches(merged, stats)
+		if err != nil {
+			skip("failed to merge response: %v", err)
+			continue
+		}
+		merged = patched
+		endpointUp[name] = true
+	}
+	if fetchErr != nil && !anyEndpointUp(endpointUp) {
+		return fetchErr
+	}
+	sh5.Stats = merged
+	sh5.endpointUp = endpointUp
+	sh5.endpointDurations = endpointDurations
+	return nil
+}
 
-			sh5.Stats, err = jsonpatch.MergeMergePatches(sh5.Stats, stats)
-			if err != nil {
-				return utils.ModemStats{}, err
+func (sh5 *Modem) ParseStats() (utils.ModemStats, error) {
+	if sh5.Stats == nil && sh5.StatusPage == nil {
+		if err := sh5.fetchREST(); err != nil || !anyEndpointUp(sh5.endpointUp) {
+			if fallbackErr := sh5.fetchStatusPage(); fallbackErr != nil {
+				logging.Debugf("HTML status page not available: %v", fallbackErr)
+				if err != nil {
+					return utils.ModemStats{}, err
+				}
+			} else {
+				logging.Warnf("REST API unavailable, falling back to the HTML status page")
 			}
 		}
 	}
+	if sh5.StatusPage != nil {
+		return sh5.parseStatusPage()
+	}
+
+	if isHTMLResponse("", sh5.Stats) {
+		return utils.ModemStats{}, errHTMLResponse
+	}
+	// An error object parses as statistics without channels
+	if message, ok := apiError(sh5.Stats); ok {
+		return utils.ModemStats{}, fmt.Errorf("%w: %s", errAPIResponse, message)
+	}
 
 	var upChannels []utils.ModemChannel
 	var downChannels []utils.ModemChannel
@@ -129,64 +662,112 @@ func (sh5 *Modem) ParseStats() (utils.ModemStats, error) {
 		return utils.ModemStats{}, fmt.Errorf("failed to parse stats JSON: %w", err)
 	}
 
-	for index, downstream := range results.Downstream.Channels {
-		qamSize := modulationRegex.FindString(downstream.Modulation)
+	// SC-QAM power is always dBmV, so is the reference for OFDM power
+	var scQAMPowers []int
+	for _, downstream := range results.Downstream.Channels {
+		if downstream.ChannelType == "sc_qam" {
+			scQAMPowers = append(scQAMPowers, utils.Tenths(float64(downstream.Power)))
+		}
+	}
 
-		powerInt := int(downstream.Power * 10)
-		snr := downstream.SNR * 10
+	for index, downstream := range results.Downstream.Channels {
+		powerInt := utils.Tenths(float64(downstream.Power))
+		var snr int
+		if downstream.SNR != nil {
+			snr = *downstream.SNR * 10
+		}
 
 		var scheme string
 		if downstream.ChannelType == "sc_qam" {
 			scheme = "SC-QAM"
 		} else if downstream.ChannelType == "ofdm" {
 			scheme = "OFDM"
-			powerInt = int(downstream.Power)
-			snr = downstream.RxMer
+			powerInt = ofdmPower(downstream.Power, sh5.OFDMPowerScale, scQAMPowers)
+			if !plausibleDownPower(powerInt) {
+				logging.Warnf("OFDM channel %d power %.1f dBmV is implausible, the OFDM power scale may be wrong", downstream.ID, float64(powerInt)/10)
+			}
+			snr = downstream.RxMer * 10
 		} else {
-			fmt.Println("Unknown channel scheme:", downstream.ChannelType)
+			logging.Warnf("Unknown channel scheme: %s", downstream.ChannelType)
 			continue
 		}
 
-		downChannels = append(downChannels, utils.ModemChannel{
-			ChannelID:  downstream.ID,
-			Channel:    index + 1,
-			Frequency:  downstream.Frequency,
-			Snr:        snr,
-			Power:      powerInt,
-			Prerserr:   downstream.PreRS + downstream.PostRS,
-			Postrserr:  downstream.PostRS,
-			Modulation: "QAM" + qamSize,
-			Scheme:     scheme,
-			Locked:     downstream.LockStatus,
-		})
+		channel := utils.ModemChannel{
+			ChannelID:      downstream.ID,
+			Channel:        index + 1,
+			Frequency:      normalizeFrequency(downstream.Frequency),
+			Snr:            snr,
+			Power:          powerInt,
+			Prerserr:       downstream.PreRS + downstream.PostRS,
+			Postrserr:      downstream.PostRS,
+			Modulation:     utils.NormalizeModulation(downstream.Modulation),
+			Scheme:         scheme,
+			Locked:         downstream.LockStatus,
+			PartialService: downstream.PartialSvc,
+			ChannelWidth:   downstream.ChannelWidth,
+		}
+		if scheme == "SC-QAM" {
+			channel.InterleaverDepth = downstream.InterleaverDepth
+			channel.Annex = strings.ToUpper(downstream.Annex)
+		}
+		if downstream.CorrectedRatio != nil {
+			channel.HasCorrectedRatio = true
+			channel.CorrectedRatio = *downstream.CorrectedRatio
+		}
+		if scheme == "SC-QAM" && downstream.SNR == nil && downstream.LinkQuality != nil {
+			channel.HasQualityPercent = true
+			channel.QualityPercent = *downstream.LinkQuality
+		}
+		if downstream.SNRMargin != nil {
+			channel.HasSNRMargin = true
+			channel.SNRMargin = utils.Tenths(*downstream.SNRMargin)
+		}
+		if scheme == "OFDM" && downstream.PLCLockStatus != nil {
+			channel.HasPLCLock = true
+			channel.PLCLocked = *downstream.PLCLockStatus
+		}
+		downChannels = append(downChannels, channel)
 	}
 
 	for index, upstream := range results.Upstream.Channels {
-		powerInt := int(upstream.Power * 10)
+		powerInt := utils.Tenths(float64(upstream.Power))
 
 		var scheme string
+		var subcarrierPowers []utils.SubcarrierPower
 		if upstream.ChannelType == "atdma" {
 			scheme = "ATDMA"
 		} else if upstream.ChannelType == "ofdma" {
 			scheme = "OFDMA"
-			powerInt = int(upstream.Power)
+			powerInt = int(math.Round(float64(upstream.Power)))
+			// Subcarrier power is in tenths of a dBmV like the channel's
+			for _, subcarriers := range upstream.SubcarrierPower {
+				subcarrierPowers = append(subcarrierPowers, utils.SubcarrierPower{
+					FirstSubcarrier: subcarriers.First,
+					LastSubcarrier:  subcarriers.Last,
+					Power:           int(math.Round(float64(subcarriers.Power))),
+				})
+			}
 		} else {
-			fmt.Println("Unknown channel scheme:", upstream.ChannelType)
+			logging.Warnf("Unknown channel scheme: %s", upstream.ChannelType)
 			continue
 		}
 
 		upChannels = append(upChannels, utils.ModemChannel{
-			ChannelID:  upstream.ID,
-			Channel:    index + 1,
-			Frequency:  upstream.Frequency,
-			Power:      powerInt,
-			Scheme:     scheme,
-			Locked:     upstream.LockStatus,
-			SymbolRate: upstream.SymbolRate,
-			T1Timeout:  upstream.T1Timeout,
-			T2Timeout:  upstream.T2Timeout,
-			T3Timeout:  upstream.T3Timeout,
-			T4Timeout:  upstream.T4Timeout,
+			ChannelID:    upstream.ID,
+			Channel:      index + 1,
+			Frequency:    normalizeFrequency(upstream.Frequency),
+			Power:        powerInt,
+			Scheme:       scheme,
+			Locked:       upstream.LockStatus,
+			SymbolRate:   upstream.SymbolRate,
+			T1Timeout:    upstream.T1Timeout,
+			T2Timeout:    upstream.T2Timeout,
+			T3Timeout:    upstream.T3Timeout,
+			T4Timeout:    upstream.T4Timeout,
+			ChannelWidth: upstream.ChannelWidth,
+
+			RangingStatus:    strings.ToLower(upstream.Ranging),
+			SubcarrierPowers: subcarrierPowers,
 		})
 	}
 
@@ -196,15 +777,46 @@ func (sh5 *Modem) ParseStats() (utils.ModemStats, error) {
 			Maxrate:       modemConfig.ServiceFlow.MaxRate,
 			Maxburst:      modemConfig.ServiceFlow.MaxBurst,
 			ServiceFlowId: modemConfig.ServiceFlow.ID,
+			State:         strings.ToLower(modemConfig.ServiceFlow.State),
 		})
 	}
 
-	return utils.ModemStats{
-		Configs:      modemConfigs,
-		UpChannels:   upChannels,
-		DownChannels: downChannels,
-		FetchTime:    sh5.FetchTime,
-	}, nil
+	modemStats := utils.ModemStats{
+		Configs:            modemConfigs,
+		UpChannels:         upChannels,
+		DownChannels:       downChannels,
+		FetchTime:          sh5.FetchTime,
+		ProvisioningStatus: results.CableModem.Status,
+		DocsisState:        results.CableModem.CmStatus,
+		WanIP:              results.CableModem.IPAddress,
+		MACAddress:         utils.NormalizeMAC(results.CableModem.MAC),
+		DocsisCapability:   utils.Docsis31,
+		EndpointUp:         sh5.endpointUp,
+		EndpointDurations:  sh5.endpointDurations,
+		Source:             sourceREST,
+	}
+
+	if results.CableModem.UpTime > 0 {
+		modemStats.HasUptime = true
+		modemStats.Uptime = results.CableModem.UpTime
+	}
+	if results.CableModem.ConnectivityUpTime != nil {
+		modemStats.HasConnectivityUptime = true
+		modemStats.ConnectivityUptime = *results.CableModem.ConnectivityUpTime
+	}
+
+	if results.ModemMode != nil {
+		modemStats.HasOperatingMode = true
+		modemStats.BridgeMode = results.ModemMode.Enable
+	}
+
+	if results.Optics != nil {
+		modemStats.HasOptics = true
+		modemStats.OpticalRxPower = utils.Tenths(float64(results.Optics.RxPower))
+		modemStats.OpticalTxPower = utils.Tenths(float64(results.Optics.TxPower))
+	}
+
+	return modemStats, nil
 }
 
 // FetchEventLog retrieves the event log from the modem
@@ -232,9 +844,70 @@ func (sh5 *Modem) FetchEventLog() ([]utils.EventLogEntry, error) {
 		entries[i] = utils.EventLogEntry{
 			Priority:  e.Priority,
 			Timestamp: e.Time,
-			Message:   e.Message,
+			Message:   utils.DecodeLogMessage(e.Message),
 		}
 	}
 
 	return entries, nil
 }
+
+// FetchUptime retrieves the number of seconds since the modem last booted
+func (sh5 *Modem) FetchUptime() (int64, error) {
+	url := sh5.apiAddress() + "/state_"
+
+	res, err := utils.InsecureHTTPClient().Get(url)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch state: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read state response: %w", err)
+	}
+
+	var response stateResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return 0, fmt.Errorf("failed to parse state JSON: %w", err)
+	}
+
+	return response.CableModem.UpTime, nil
+}
+
+// FetchSpectrum retrieves a downstream spectrum sweep from the modem's debug
+// endpoint, which is not available on all firmware versions
+func (sh5 *Modem) FetchSpectrum() ([]utils.SpectrumPoint, error) {
+	url := sh5.apiAddress() + "/spectrum"
+
+	res, err := utils.InsecureHTTPClient().Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch spectrum: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, utils.ErrSpectrumUnsupported
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spectrum response: %w", err)
+	}
+	if isHTMLResponse(res.Header.Get("Content-Type"), body) {
+		return nil, fmt.Errorf("%w from %s", errHTMLResponse, url)
+	}
+
+	var response spectrumResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse spectrum JSON: %w", err)
+	}
+
+	points := make([]utils.SpectrumPoint, len(response.Spectrum.Points))
+	for i, p := range response.Spectrum.Points {
+		points[i] = utils.SpectrumPoint{
+			Frequency: normalizeFrequency(p.Frequency),
+			Power:     utils.Tenths(float64(p.Power)),
+		}
+	}
+
+	return points, nil
+}
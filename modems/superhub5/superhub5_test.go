@@ -1,16 +1,28 @@
 package superhub5
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/golang/snappy"
 	"github.com/msh100/modem-stats/outputs"
 	"github.com/msh100/modem-stats/utils"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/expfmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
 )
 
 func loadTestData(t *testing.T, filename string) []byte {
@@ -59,6 +71,7 @@ func TestModem_ApiAddress(t *testing.T) {
 	tests := []struct {
 		name      string
 		ipAddress string
+		scheme    string
 		expected  string
 	}{
 		{
@@ -71,16 +84,129 @@ func TestModem_ApiAddress(t *testing.T) {
 			ipAddress: "10.0.0.1",
 			expected:  "https://10.0.0.1/rest/v1/cablemodem",
 		},
+		{
+			name:      "HTTP",
+			ipAddress: "10.0.0.1",
+			scheme:    SchemeHTTP,
+			expected:  "http://10.0.0.1/rest/v1/cablemodem",
+		},
+		{
+			name:      "HTTPS",
+			ipAddress: "10.0.0.1",
+			scheme:    SchemeHTTPS,
+			expected:  "https://10.0.0.1/rest/v1/cablemodem",
+		},
+		{
+			name:      "auto before detection",
+			ipAddress: "10.0.0.1",
+			scheme:    SchemeAuto,
+			expected:  "https://10.0.0.1/rest/v1/cablemodem",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			modem := Modem{IPAddress: tt.ipAddress}
+			modem := Modem{IPAddress: tt.ipAddress, Scheme: tt.scheme}
 			assert.Equal(t, tt.expected, modem.apiAddress())
 		})
 	}
 }
 
+func TestModem_ParseStats_HTTPScheme(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(loadTestData(t, "state.json"))
+	}))
+	defer server.Close()
+
+	modem := &Modem{IPAddress: strings.TrimPrefix(server.URL, "http://"), Scheme: SchemeHTTP}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+	assert.Equal(t, "operational", stats.ProvisioningStatus)
+}
+
+func TestModem_ParseStats_AutoSchemeFallsBackToHTTP(t *testing.T) {
+	// A plain HTTP server fails the TLS handshake of an HTTPS request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(loadTestData(t, "state.json"))
+	}))
+	defer server.Close()
+
+	modem := &Modem{IPAddress: strings.TrimPrefix(server.URL, "http://"), Scheme: SchemeAuto}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err, "the fetch should fall back to HTTP")
+	assert.Equal(t, "operational", stats.ProvisioningStatus)
+	assert.Equal(t, "http://"+modem.IPAddress+"/rest/v1/cablemodem", modem.apiAddress())
+
+	// HTTPS is preferred where it is served
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(loadTestData(t, "state.json"))
+	}))
+	defer tlsServer.Close()
+
+	modem = &Modem{IPAddress: strings.TrimPrefix(tlsServer.URL, "https://"), Scheme: SchemeAuto}
+	_, err = modem.ParseStats()
+	require.NoError(t, err)
+	assert.Equal(t, "https://"+modem.IPAddress+"/rest/v1/cablemodem", modem.apiAddress())
+}
+
+// roundTripFunc serves requests with a function in place of a modem
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestModem_ParseStats_AutoSchemeFallsBackOnNotFound(t *testing.T) {
+	var mu sync.Mutex
+	var requested []string
+	httpsServed := false
+	utils.SetHTTPTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		mu.Lock()
+		requested = append(requested, r.URL.String())
+		served := r.URL.Scheme == "http" || httpsServed
+		mu.Unlock()
+
+		if !served {
+			return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader("")), Request: r}, nil
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(bytes.NewReader(loadTestData(t, "state.json"))),
+			Request:    r,
+		}, nil
+	}))
+	t.Cleanup(func() { utils.SetHTTPTransport(nil) })
+
+	modem := &Modem{IPAddress: "10.0.0.1", Scheme: SchemeAuto, Endpoints: []string{"state"}}
+	_, err := modem.ParseStats()
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"https://10.0.0.1/rest/v1/cablemodem/state_",
+		"http://10.0.0.1/rest/v1/cablemodem/state_",
+		"http://10.0.0.1/rest/v1/cablemodem/state_",
+	}, requested)
+
+	// The detected scheme is kept for later fetches
+	mu.Lock()
+	httpsServed = true
+	requested = nil
+	mu.Unlock()
+	modem.ClearStats()
+	_, err = modem.ParseStats()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://10.0.0.1/rest/v1/cablemodem/state_"}, requested)
+}
+
+func TestIsKnownScheme(t *testing.T) {
+	assert.True(t, IsKnownScheme(""))
+	assert.True(t, IsKnownScheme(SchemeAuto))
+	assert.False(t, IsKnownScheme("ftp"))
+}
+
 func TestModem_ParseStats_DownstreamChannels(t *testing.T) {
 	modem := Modem{
 		Stats:     loadTestData(t, "full_stats.json"),
@@ -143,6 +269,19 @@ func TestModem_ParseStats_UpstreamChannels(t *testing.T) {
 	assert.Equal(t, "OFDMA", ofdmaChannel.Scheme)
 }
 
+func TestModem_ParseStats_PartialService(t *testing.T) {
+	modem := Modem{
+		Stats: loadTestData(t, "partial_service.json"),
+	}
+
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+	require.Len(t, stats.DownChannels, 3)
+	assert.False(t, stats.DownChannels[0].PartialService)
+	assert.True(t, stats.DownChannels[1].PartialService)
+	assert.False(t, stats.DownChannels[2].PartialService)
+}
+
 func TestModem_ParseStats_ServiceFlows(t *testing.T) {
 	modem := Modem{
 		Stats:     loadTestData(t, "full_stats.json"),
@@ -192,6 +331,218 @@ func TestModem_ParseStats_ServiceFlows(t *testing.T) {
 	assert.True(t, foundPrimaryUp, "primary upstream service flow not found")
 }
 
+func TestModem_ParseStats_ProvisioningStatus(t *testing.T) {
+	modem := Modem{
+		Stats: loadTestData(t, "state.json"),
+	}
+
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+	assert.Equal(t, "operational", stats.ProvisioningStatus)
+	assert.Equal(t, "10.53.120.17", stats.WanIP)
+}
+
+func TestModem_ParseStats_Optics(t *testing.T) {
+	modem := Modem{
+		Stats: loadTestData(t, "optics.json"),
+	}
+
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+	assert.True(t, stats.HasOptics)
+	assert.Equal(t, -142, stats.OpticalRxPower)
+	assert.Equal(t, 23, stats.OpticalTxPower)
+
+	modem = Modem{
+		Stats: loadTestData(t, "full_stats.json"),
+	}
+	stats, err = modem.ParseStats()
+	require.NoError(t, err)
+	assert.False(t, stats.HasOptics)
+}
+
+func TestModem_ParseStats_MissingOpticsEndpoint(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/optics") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	modem := Modem{
+		IPAddress: strings.TrimPrefix(server.URL, "https://"),
+	}
+
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+	assert.False(t, stats.HasOptics)
+}
+
+func TestModem_ParseStats_EmptyEndpoint(t *testing.T) {
+	downstream := loadTestData(t, "interleaver.json")
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/rest/v1/cablemodem/downstream":
+			w.Write(downstream)
+		case "/rest/v1/cablemodem/state_":
+			w.Write([]byte(`{"cablemodem": {"status": "operational"}}`))
+		case "/rest/v1/cablemodem/upstream":
+			// A 200 with nothing in it
+		default:
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer server.Close()
+
+	modem := Modem{
+		IPAddress: strings.TrimPrefix(server.URL, "https://"),
+	}
+
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+	assert.Len(t, stats.DownChannels, 3)
+	assert.Empty(t, stats.UpChannels)
+	assert.Equal(t, "operational", stats.ProvisioningStatus)
+}
+
+func TestModem_ParseStats_SelectedEndpoints(t *testing.T) {
+	var full map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(loadTestData(t, "full_stats.json"), &full))
+
+	var mu sync.Mutex
+	requested := make(map[string]bool)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path] = true
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/rest/v1/cablemodem/downstream":
+			fmt.Fprintf(w, `{"downstream": %s}`, full["downstream"])
+		case "/rest/v1/cablemodem/upstream":
+			fmt.Fprintf(w, `{"upstream": %s}`, full["upstream"])
+		case "/rest/v1/cablemodem/serviceflows":
+			fmt.Fprintf(w, `{"serviceFlows": %s}`, full["serviceFlows"])
+		default:
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer server.Close()
+
+	modem := &Modem{
+		IPAddress: strings.TrimPrefix(server.URL, "https://"),
+		Endpoints: []string{"downstream", "upstream"},
+	}
+
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+	assert.NotEmpty(t, stats.DownChannels)
+	assert.NotEmpty(t, stats.UpChannels)
+	assert.Empty(t, stats.Configs)
+	assert.Equal(t, map[string]bool{
+		"/rest/v1/cablemodem/downstream": true,
+		"/rest/v1/cablemodem/upstream":   true,
+	}, requested, "only the selected endpoints should be fetched")
+
+	assert.NotContains(t, modem.Capabilities(), utils.CapServiceFlows)
+	assert.NotContains(t, modem.Capabilities(), utils.CapProvisioning)
+	assert.Contains(t, modem.Capabilities(), utils.CapDownstreamChannels)
+
+	modem.ClearStats()
+	exporter := outputs.ProExporter(modem)
+	assert.Equal(t, 0, testutil.CollectAndCount(exporter, "modemstats_config_maxrate", "modemstats_config_maxburst"))
+	assert.NotZero(t, testutil.CollectAndCount(exporter, "modemstats_downstream_power"))
+}
+
+func TestModem_ParseStats_EndpointFailure(t *testing.T) {
+	var full map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(loadTestData(t, "full_stats.json"), &full))
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/rest/v1/cablemodem/downstream":
+			fmt.Fprintf(w, `{"downstream": %s}`, full["downstream"])
+		case "/rest/v1/cablemodem/upstream":
+			fmt.Fprintf(w, `{"upstream": %s}`, full["upstream"])
+		case "/rest/v1/cablemodem/serviceflows":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error": "internal error"}`))
+		case "/rest/v1/cablemodem/optics":
+			http.NotFound(w, r)
+		default:
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer server.Close()
+
+	modem := &Modem{IPAddress: strings.TrimPrefix(server.URL, "https://")}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err, "the other endpoints should still be reported")
+	assert.NotEmpty(t, stats.DownChannels)
+	assert.Empty(t, stats.Configs)
+
+	// The optics endpoint is optional, so its 404 is not a failure
+	modem.ClearStats()
+	expected := `
+		# HELP modemstats_endpoint_up Whether each of the modem's statistics endpoints responded on the last fetch (1=success, 0=failure)
+		# TYPE modemstats_endpoint_up gauge
+		modemstats_endpoint_up{endpoint="downstream"} 1
+		modemstats_endpoint_up{endpoint="modemmode"} 1
+		modemstats_endpoint_up{endpoint="serviceflows"} 0
+		modemstats_endpoint_up{endpoint="state"} 1
+		modemstats_endpoint_up{endpoint="upstream"} 1
+	`
+	err = testutil.CollectAndCompare(outputs.ProExporter(modem), strings.NewReader(expected), "modemstats_endpoint_up")
+	assert.NoError(t, err)
+}
+
+func TestModem_ParseStats_EndpointDurations(t *testing.T) {
+	delays := map[string]time.Duration{
+		"/rest/v1/cablemodem/downstream":   50 * time.Millisecond,
+		"/rest/v1/cablemodem/serviceflows": 250 * time.Millisecond,
+	}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delays[r.URL.Path])
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	modem := &Modem{IPAddress: strings.TrimPrefix(server.URL, "https://")}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+	assert.Len(t, stats.EndpointDurations, len(Endpoints))
+	assert.GreaterOrEqual(t, int64(stats.EndpointDurations["serviceflows"]), int64(250*time.Millisecond))
+	assert.GreaterOrEqual(t, int64(stats.EndpointDurations["downstream"]), int64(50*time.Millisecond))
+	assert.Less(t, int64(stats.EndpointDurations["state"]), int64(stats.EndpointDurations["serviceflows"]))
+
+	modem.ClearStats()
+	exporter := outputs.ProExporter(modem)
+	expected := `
+		# HELP modemstats_fetch_endpoint_slowest The modem's statistics endpoint which was slowest to respond on the last fetch (always 1)
+		# TYPE modemstats_fetch_endpoint_slowest gauge
+		modemstats_fetch_endpoint_slowest{endpoint="serviceflows"} 1
+	`
+	assert.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(expected), "modemstats_fetch_endpoint_slowest"))
+	assert.Equal(t, len(Endpoints), testutil.CollectAndCount(exporter, "modemstats_fetch_endpoint_duration_seconds"))
+}
+
+func TestModem_ParseStats_AllEndpointsFail(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	address := strings.TrimPrefix(server.URL, "https://")
+	server.Close()
+
+	modem := &Modem{IPAddress: address}
+	_, err := modem.ParseStats()
+	assert.Error(t, err)
+}
+
 func TestModem_ParseStats_FetchTime(t *testing.T) {
 	modem := Modem{
 		Stats:     loadTestData(t, "full_stats.json"),
@@ -213,6 +564,65 @@ func TestModem_ParseStats_InvalidJSON(t *testing.T) {
 	assert.Contains(t, err.Error(), "failed to parse stats JSON")
 }
 
+func TestModem_ParseStats_HTMLResponse(t *testing.T) {
+	modem := Modem{
+		Stats: []byte("\n<!DOCTYPE html>\n<html><head><title>Login</title></head></html>"),
+	}
+
+	_, err := modem.ParseStats()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unexpected HTML response")
+	assert.NotContains(t, err.Error(), "failed to parse stats JSON")
+}
+
+func TestModem_ParseStats_HTMLResponseFromModem(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html><body>Please log in</body></html>"))
+	}))
+	defer server.Close()
+
+	modem := Modem{
+		IPAddress: strings.TrimPrefix(server.URL, "https://"),
+	}
+
+	_, err := modem.ParseStats()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "modem not in bridge mode / unexpected HTML response")
+	assert.Nil(t, modem.Stats, "stats should not be populated from an HTML response")
+}
+
+func TestModem_ParseStats_ErrorResponse(t *testing.T) {
+	modem := Modem{Stats: loadTestData(t, "error_response.json")}
+
+	_, err := modem.ParseStats()
+	assert.ErrorIs(t, err, errAPIResponse)
+	assert.EqualError(t, err, "modem returned an error instead of statistics: unauthorized")
+
+	// Some firmware serves an object with a message
+	modem = Modem{Stats: []byte(`{"error": {"code": 401, "message": "session expired"}}`)}
+	_, err = modem.ParseStats()
+	assert.EqualError(t, err, "modem returned an error instead of statistics: session expired")
+}
+
+func TestModem_ParseStats_ErrorResponseFromModem(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(loadTestData(t, "error_response.json"))
+	}))
+	defer server.Close()
+
+	modem := &Modem{IPAddress: strings.TrimPrefix(server.URL, "https://")}
+
+	expected := `
+		# HELP modemstats_up Whether the last scrape of the modem succeeded (1=success, 0=failure)
+		# TYPE modemstats_up gauge
+		modemstats_up 0
+	`
+	err := testutil.CollectAndCompare(outputs.ProExporter(modem), strings.NewReader(expected), "modemstats_up")
+	assert.NoError(t, err)
+}
+
 func TestModem_ParseStats_EmptyJSON(t *testing.T) {
 	modem := Modem{
 		Stats: []byte("{}"),
@@ -239,8 +649,8 @@ func TestPrometheusExporter_FullStats(t *testing.T) {
 		"modemstats_downstream_frequency",
 		"modemstats_downstream_power",
 		"modemstats_downstream_snr",
-		"modemstats_downstream_prerserr",
-		"modemstats_downstream_postrserr",
+		"modemstats_downstream_prerserr_total",
+		"modemstats_downstream_postrserr_total",
 	)
 	require.NoError(t, err)
 	// 32 channels * 5 metrics = 160
@@ -328,3 +738,1235 @@ func TestPrometheusExporter_FetchTimeMetric(t *testing.T) {
 	err := testutil.CollectAndCompare(exporter, strings.NewReader(expected), "modemstats_shstatsinfo_timems")
 	assert.NoError(t, err)
 }
+
+func TestPrometheusExporter_DisabledMetrics(t *testing.T) {
+	modem := newTestModem(loadTestData(t, "full_stats.json"), 100)
+
+	registry := prometheus.NewRegistry()
+	exporter := outputs.ProExporter(modem, outputs.WithDisabledMetrics(
+		"upstream_t1_timeout_total",
+		"upstream_t2_timeout_total",
+		"modemstats_upstream_t3_timeout_total",
+		"modemstats_upstream_t4_timeout_total",
+	))
+	registry.MustRegister(exporter)
+
+	metricCount, err := testutil.GatherAndCount(registry,
+		"modemstats_upstream_t1_timeout_total",
+		"modemstats_upstream_t2_timeout_total",
+		"modemstats_upstream_t3_timeout_total",
+		"modemstats_upstream_t4_timeout_total",
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 0, metricCount)
+
+	// Other upstream and downstream metrics are unaffected
+	metricCount, err = testutil.GatherAndCount(registry,
+		"modemstats_upstream_frequency",
+		"modemstats_upstream_power",
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 12, metricCount)
+
+	metricCount, err = testutil.GatherAndCount(registry, "modemstats_downstream_snr")
+	require.NoError(t, err)
+	assert.Equal(t, 32, metricCount)
+}
+
+func TestPrometheusExporter_DocsisState(t *testing.T) {
+	modem := newTestModem(loadTestData(t, "cm_status.json"), 100)
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+	assert.Equal(t, "Configuration File", stats.DocsisState)
+
+	expected := `
+		# HELP modemstats_docsis_state Stage of DOCSIS registration the modem has reached, from 1 (not synchronized) to 9 (operational), 0 if unknown
+		# TYPE modemstats_docsis_state gauge
+		modemstats_docsis_state{state="configuration_file"} 6
+	`
+	err = testutil.CollectAndCompare(outputs.ProExporter(modem), strings.NewReader(expected), "modemstats_docsis_state")
+	assert.NoError(t, err)
+
+	// Firmware which does not report the state has no series
+	modem = newTestModem(loadTestData(t, "state.json"), 100)
+	assert.Equal(t, 0, testutil.CollectAndCount(outputs.ProExporter(modem), "modemstats_docsis_state"))
+}
+
+func TestPrometheusExporter_ServiceFlowState(t *testing.T) {
+	modem := newTestModem(loadTestData(t, "service_flow_state.json"), 100)
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+	require.Len(t, stats.Configs, 4)
+	assert.Equal(t, utils.ServiceFlowActive, stats.Configs[0].State)
+	assert.Equal(t, utils.ServiceFlowAdmitted, stats.Configs[1].State)
+
+	expected := `
+		# HELP modemstats_config_active Whether each service flow is active (1=active, 0=admitted or only provisioned)
+		# TYPE modemstats_config_active gauge
+		modemstats_config_active{config="downstream",serviceflow_id="412832"} 1
+		modemstats_config_active{config="downstream",serviceflow_id="412834"} 0
+		modemstats_config_active{config="upstream",serviceflow_id="412831"} 1
+		modemstats_config_active{config="upstream",serviceflow_id="412833"} 0
+	`
+	err = testutil.CollectAndCompare(outputs.ProExporter(modem), strings.NewReader(expected), "modemstats_config_active")
+	assert.NoError(t, err)
+
+	// Firmware which does not report the state goes without the metric
+	modem = newTestModem(loadTestData(t, "full_stats.json"), 100)
+	assert.Equal(t, 0, testutil.CollectAndCount(outputs.ProExporter(modem), "modemstats_config_active"))
+}
+
+func TestPrometheusExporter_HealthScore(t *testing.T) {
+	score := func(fixture string) float64 {
+		t.Helper()
+		registry := prometheus.NewPedanticRegistry()
+		registry.MustRegister(outputs.ProExporter(newTestModem(loadTestData(t, fixture), 100)))
+		families, err := registry.Gather()
+		require.NoError(t, err)
+		for _, family := range families {
+			if family.GetName() == "modemstats_health_score" {
+				return family.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+		t.Fatalf("no health score for %s", fixture)
+		return 0
+	}
+
+	// A single scrape has no error rate, which is left out of the score
+	healthy := score("full_stats.json")
+	assert.Equal(t, float64(100), healthy)
+
+	// Unlocked channels, poor SNR and power out of range all cost points
+	degraded := score("degraded_stats.json")
+	assert.Less(t, degraded, float64(90))
+	assert.Greater(t, degraded, float64(50))
+}
+
+func TestPrometheusExporter_MACLabel(t *testing.T) {
+	modem := newTestModem(loadTestData(t, "mac_address.json"), 100)
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+	assert.Equal(t, "a4:91:b1:0c:3e:7f", stats.MACAddress)
+
+	expected := `
+		# HELP modemstats_uptime_seconds Seconds since the modem booted
+		# TYPE modemstats_uptime_seconds gauge
+		modemstats_uptime_seconds{mac="a4:91:b1:0c:3e:7f"} 1.036816e+06
+	`
+	err = testutil.CollectAndCompare(outputs.ProExporter(modem, outputs.WithMACLabel()), strings.NewReader(expected), "modemstats_uptime_seconds")
+	assert.NoError(t, err)
+
+	// Without the option the label is not added
+	expected = `
+		# HELP modemstats_uptime_seconds Seconds since the modem booted
+		# TYPE modemstats_uptime_seconds gauge
+		modemstats_uptime_seconds 1.036816e+06
+	`
+	err = testutil.CollectAndCompare(outputs.ProExporter(modem), strings.NewReader(expected), "modemstats_uptime_seconds")
+	assert.NoError(t, err)
+
+	// Firmware which does not report the MAC address goes without the label
+	modem = newTestModem(loadTestData(t, "state.json"), 100)
+	err = testutil.CollectAndCompare(outputs.ProExporter(modem, outputs.WithMACLabel()), strings.NewReader(expected), "modemstats_uptime_seconds")
+	assert.NoError(t, err)
+}
+
+func TestPrometheusExporter_ProvisioningStatus(t *testing.T) {
+	modem := newTestModem(loadTestData(t, "state.json"), 100)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(outputs.ProExporter(modem))
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	var activeStates []string
+	seriesCount := 0
+	for _, family := range families {
+		if family.GetName() != "modemstats_provisioning_status" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			seriesCount++
+			if metric.GetGauge().GetValue() == 1 {
+				activeStates = append(activeStates, metric.GetLabel()[0].GetValue())
+			}
+		}
+	}
+	assert.Greater(t, seriesCount, 1)
+	assert.Equal(t, []string{"operational"}, activeStates)
+
+	expected := `
+		# HELP modemstats_info Modem information, value is always 1
+		# TYPE modemstats_info gauge
+		modemstats_info{annex="",wan_ip="10.53.120.17"} 1
+	`
+	err = testutil.GatherAndCompare(registry, strings.NewReader(expected), "modemstats_info")
+	assert.NoError(t, err)
+}
+
+type decodedSeries struct {
+	labels map[string]string
+	value  float64
+}
+
+// decodeWriteRequest decodes a prompb.WriteRequest into its series
+func decodeWriteRequest(t *testing.T, data []byte) []decodedSeries {
+	var result []decodedSeries
+
+	for len(data) > 0 {
+		_, _, n := protowire.ConsumeTag(data)
+		require.GreaterOrEqual(t, n, 0)
+		data = data[n:]
+		timeSeries, n := protowire.ConsumeBytes(data)
+		require.GreaterOrEqual(t, n, 0)
+		data = data[n:]
+
+		series := decodedSeries{labels: make(map[string]string)}
+		for len(timeSeries) > 0 {
+			field, _, n := protowire.ConsumeTag(timeSeries)
+			require.GreaterOrEqual(t, n, 0)
+			timeSeries = timeSeries[n:]
+			message, n := protowire.ConsumeBytes(timeSeries)
+			require.GreaterOrEqual(t, n, 0)
+			timeSeries = timeSeries[n:]
+
+			switch field {
+			case 1: // Label
+				var name, value string
+				for len(message) > 0 {
+					labelField, _, n := protowire.ConsumeTag(message)
+					message = message[n:]
+					str, n := protowire.ConsumeString(message)
+					require.GreaterOrEqual(t, n, 0)
+					message = message[n:]
+					if labelField == 1 {
+						name = str
+					} else {
+						value = str
+					}
+				}
+				series.labels[name] = value
+			case 2: // Sample
+				for len(message) > 0 {
+					sampleField, fieldType, n := protowire.ConsumeTag(message)
+					message = message[n:]
+					if sampleField == 1 && fieldType == protowire.Fixed64Type {
+						bits, n := protowire.ConsumeFixed64(message)
+						series.value = math.Float64frombits(bits)
+						message = message[n:]
+						continue
+					}
+					n = protowire.ConsumeFieldValue(sampleField, fieldType, message)
+					require.GreaterOrEqual(t, n, 0)
+					message = message[n:]
+				}
+			}
+		}
+		result = append(result, series)
+	}
+
+	return result
+}
+
+func TestRemoteWriter_Push(t *testing.T) {
+	var body []byte
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		compressed, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		body, err = snappy.Decode(nil, compressed)
+		require.NoError(t, err)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	modem := newTestModem(loadTestData(t, "full_stats.json"), 100)
+	writer := outputs.NewRemoteWriter(server.URL, outputs.ProExporter(modem))
+	writer.SetBasicAuth("user", "secret")
+	writer.SetTenantID("home")
+	require.NoError(t, writer.Push())
+
+	assert.Equal(t, "snappy", headers.Get("Content-Encoding"))
+	assert.Equal(t, "application/x-protobuf", headers.Get("Content-Type"))
+	assert.Equal(t, "home", headers.Get("X-Scope-OrgID"))
+	assert.NotEmpty(t, headers.Get("Authorization"))
+
+	snrByChannelID := make(map[string]float64)
+	for _, series := range decodeWriteRequest(t, body) {
+		if series.labels["__name__"] == "modemstats_downstream_snr" {
+			snrByChannelID[series.labels["id"]] = series.value
+		}
+	}
+
+	// One SNR sample per downstream channel in the fixture
+	assert.Len(t, snrByChannelID, 32)
+	assert.Equal(t, 410.0, snrByChannelID["37"])
+	assert.Equal(t, 0.0, snrByChannelID["33"])
+}
+
+func TestRemoteWriter_SharesExporter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	// Pushing while scraped fetches through the exporter's throttle, so the
+	// driver is never fetched from twice at once
+	modem := newTestModem(loadTestData(t, "full_stats.json"), 100)
+	exporter := outputs.ProExporter(modem)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	writer := outputs.NewRemoteWriter(server.URL, exporter)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := registry.Gather()
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, writer.Push())
+		}()
+	}
+	wg.Wait()
+}
+
+func TestVMImporter_Push(t *testing.T) {
+	var body []byte
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/import/prometheus", r.URL.Path)
+		headers = r.Header.Clone()
+		var err error
+		body, err = io.ReadAll(r.Body)
+		require.NoError(t, err)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	modem := newTestModem(loadTestData(t, "full_stats.json"), 100)
+	importer := outputs.NewVMImporter(server.URL+"/api/v1/import/prometheus", outputs.ProExporter(modem))
+	importer.SetBasicAuth("user", "secret")
+	require.NoError(t, importer.Push())
+
+	assert.Equal(t, "text/plain; version=0.0.4", headers.Get("Content-Type"))
+	assert.NotEmpty(t, headers.Get("Authorization"))
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(body))
+	require.NoError(t, err, "the pushed body should be Prometheus text")
+
+	// One SNR sample per downstream channel in the fixture
+	require.Contains(t, families, "modemstats_downstream_snr")
+	snrByChannelID := make(map[string]float64)
+	for _, metric := range families["modemstats_downstream_snr"].GetMetric() {
+		for _, label := range metric.GetLabel() {
+			if label.GetName() == "id" {
+				snrByChannelID[label.GetValue()] = metric.GetGauge().GetValue()
+			}
+		}
+	}
+	assert.Len(t, snrByChannelID, 32)
+	assert.Equal(t, 410.0, snrByChannelID["37"])
+	assert.Contains(t, families, "modemstats_upstream_power")
+}
+
+func TestVMImporter_SharesExporter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	modem := newTestModem(loadTestData(t, "full_stats.json"), 100)
+	exporter := outputs.ProExporter(modem)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	importer := outputs.NewVMImporter(server.URL, exporter)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := registry.Gather()
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, importer.Push())
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPrometheusExporter_FrequencyCoverage(t *testing.T) {
+	modem := newTestModem(loadTestData(t, "full_stats.json"), 100)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(outputs.ProExporter(modem))
+
+	// 31 SC-QAM channels at the 8MHz default plus a 94MHz OFDM channel
+	expected := `
+		# HELP modemstats_downstream_freq_max_hz Highest downstream channel frequency in HZ
+		# TYPE modemstats_downstream_freq_max_hz gauge
+		modemstats_downstream_freq_max_hz 4.19e+08
+		# HELP modemstats_downstream_freq_min_hz Lowest downstream channel frequency in HZ
+		# TYPE modemstats_downstream_freq_min_hz gauge
+		modemstats_downstream_freq_min_hz 1.39e+08
+		# HELP modemstats_downstream_total_bandwidth_hz Total bonded downstream bandwidth in HZ
+		# TYPE modemstats_downstream_total_bandwidth_hz gauge
+		modemstats_downstream_total_bandwidth_hz 3.42e+08
+	`
+	err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"modemstats_downstream_freq_min_hz",
+		"modemstats_downstream_freq_max_hz",
+		"modemstats_downstream_total_bandwidth_hz",
+	)
+	assert.NoError(t, err)
+}
+
+func TestPrometheusExporter_OpticalMetrics(t *testing.T) {
+	opticalMetrics := []string{
+		"modemstats_optical_rx_power_dbm",
+		"modemstats_optical_tx_power_dbm",
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(outputs.ProExporter(newTestModem(loadTestData(t, "full_stats.json"), 100)))
+	metricCount, err := testutil.GatherAndCount(registry, opticalMetrics...)
+	require.NoError(t, err)
+	assert.Equal(t, 0, metricCount)
+
+	registry = prometheus.NewRegistry()
+	registry.MustRegister(outputs.ProExporter(newTestModem(loadTestData(t, "optics.json"), 100)))
+	expected := `
+		# HELP modemstats_optical_rx_power_dbm Optical receive power in dBm
+		# TYPE modemstats_optical_rx_power_dbm gauge
+		modemstats_optical_rx_power_dbm -14.2
+		# HELP modemstats_optical_tx_power_dbm Optical transmit power in dBm
+		# TYPE modemstats_optical_tx_power_dbm gauge
+		modemstats_optical_tx_power_dbm 2.3
+	`
+	err = testutil.GatherAndCompare(registry, strings.NewReader(expected), opticalMetrics...)
+	assert.NoError(t, err)
+}
+
+func TestPrometheusExporter_PartialService(t *testing.T) {
+	modem := newTestModem(loadTestData(t, "partial_service.json"), 100)
+	exporter := outputs.ProExporter(modem)
+
+	expected := `
+		# HELP modemstats_downstream_partial_service Downstream channel partial service status (1=partial service, 0=normal)
+		# TYPE modemstats_downstream_partial_service gauge
+		modemstats_downstream_partial_service{channel="1",id="25",modulation="QAM256",scheme="SC-QAM"} 0
+		modemstats_downstream_partial_service{channel="2",id="26",modulation="QAM256",scheme="SC-QAM"} 1
+		modemstats_downstream_partial_service{channel="3",id="27",modulation="QAM256",scheme="SC-QAM"} 0
+	`
+	err := testutil.CollectAndCompare(exporter, strings.NewReader(expected), "modemstats_downstream_partial_service")
+	assert.NoError(t, err)
+}
+
+func TestPrometheusExporter_DocsisVersion(t *testing.T) {
+	// full_stats.json has OFDM and OFDMA channels
+	modem := newTestModem(loadTestData(t, "full_stats.json"), 100)
+	expected := `
+		# HELP modemstats_docsis_version DOCSIS version supported by the modem and negotiated with the CMTS, value is always 1
+		# TYPE modemstats_docsis_version gauge
+		modemstats_docsis_version{capability="3.1",negotiated="3.1"} 1
+	`
+	err := testutil.CollectAndCompare(outputs.ProExporter(modem), strings.NewReader(expected), "modemstats_docsis_version")
+	assert.NoError(t, err)
+
+	// partial_service.json only has SC-QAM channels
+	modem = newTestModem(loadTestData(t, "partial_service.json"), 100)
+	expected = `
+		# HELP modemstats_docsis_version DOCSIS version supported by the modem and negotiated with the CMTS, value is always 1
+		# TYPE modemstats_docsis_version gauge
+		modemstats_docsis_version{capability="3.1",negotiated="3.0"} 1
+	`
+	err = testutil.CollectAndCompare(outputs.ProExporter(modem), strings.NewReader(expected), "modemstats_docsis_version")
+	assert.NoError(t, err)
+}
+
+func TestModem_FetchEventLog_DecodesMessages(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"eventlog": [
+			{"priority": "critical", "time": "2026-02-09T10:14:14.000Z", "message": "No Ranging Response received - T3 time-out&#44; CM-MAC=aa:bb:cc:dd:ee:ff&#59;CMTS-MAC=00:01:5c:00:00:01&#59;"},
+			{"priority": "warning", "time": "2026-02-09T10:15:00.000Z", "message": "Dynamic%20Range%20Window%20violation"},
+			{"priority": "notice", "time": "2026-02-09T10:16:00.000Z", "message": "Honor MDD; IP provisioning mode = IPv4"}
+		]}`))
+	}))
+	defer server.Close()
+
+	modem := Modem{
+		IPAddress: strings.TrimPrefix(server.URL, "https://"),
+	}
+
+	entries, err := modem.FetchEventLog()
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "No Ranging Response received - T3 time-out, CM-MAC=aa:bb:cc:dd:ee:ff;CMTS-MAC=00:01:5c:00:00:01;", entries[0].Message)
+	assert.Equal(t, "Dynamic Range Window violation", entries[1].Message)
+	assert.Equal(t, "Honor MDD; IP provisioning mode = IPv4", entries[2].Message)
+}
+
+func TestPrometheusExporter_UpstreamPowerHeadroom(t *testing.T) {
+	modem := newTestModem(loadTestData(t, "full_stats.json"), 100)
+	exporter := outputs.ProExporter(modem, outputs.WithMaxUpstreamPower(54))
+
+	expected := `
+		# HELP modemstats_upstream_power_headroom_db Difference between the maximum and current upstream transmit power in dB
+		# TYPE modemstats_upstream_power_headroom_db gauge
+		modemstats_upstream_power_headroom_db{channel="1",id="1"} 9.2
+		modemstats_upstream_power_headroom_db{channel="2",id="2"} 9
+		modemstats_upstream_power_headroom_db{channel="3",id="3"} 9.5
+		modemstats_upstream_power_headroom_db{channel="4",id="4"} 9.7
+		modemstats_upstream_power_headroom_db{channel="5",id="9"} 9.5
+		modemstats_upstream_power_headroom_db{channel="6",id="11"} 13.8
+	`
+	err := testutil.CollectAndCompare(exporter, strings.NewReader(expected), "modemstats_upstream_power_headroom_db")
+	assert.NoError(t, err)
+}
+
+func TestPrometheusExporter_ModemRequests(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	modem := &Modem{
+		IPAddress: strings.TrimPrefix(server.URL, "https://"),
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(outputs.ProExporter(modem))
+
+	before := utils.RequestCounts()
+	for i := 0; i < 2; i++ {
+		_, err := registry.Gather()
+		require.NoError(t, err)
+	}
+	after := utils.RequestCounts()
+
+	// Every stats endpoint is fetched once per scrape
+	for _, endpoint := range statsEndpoints {
+		key := utils.RequestKey{Host: modem.IPAddress, Endpoint: "/rest/v1" + endpoint, Result: utils.RequestSuccess}
+		assert.Equal(t, 2, after[key]-before[key], "requests to %s", endpoint)
+	}
+
+	metricCount, err := testutil.GatherAndCount(registry, "modemstats_modem_requests_total")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, metricCount, len(statsEndpoints))
+}
+
+func TestPrometheusExporter_ModemRequestsPerModem(t *testing.T) {
+	newModem := func() *Modem {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte("{}"))
+		}))
+		t.Cleanup(server.Close)
+		return &Modem{IPAddress: strings.TrimPrefix(server.URL, "https://")}
+	}
+	first, second := outputs.ProExporter(newModem()), outputs.ProExporter(newModem())
+
+	testutil.CollectAndCount(first)
+	testutil.CollectAndCount(first)
+
+	// The second modem's exporter reports only the requests made to it
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(second)
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	var counted int
+	for _, family := range families {
+		if family.GetName() != "modemstats_modem_requests_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			assert.Equal(t, 1.0, metric.GetCounter().GetValue(), "requests counted for %v", metric.GetLabel())
+			counted++
+		}
+	}
+	assert.Equal(t, len(statsEndpoints), counted)
+}
+
+func TestModem_Capabilities(t *testing.T) {
+	modem := &Modem{}
+	for _, capability := range []utils.Capability{
+		utils.CapDownstreamChannels,
+		utils.CapUpstreamChannels,
+		utils.CapCodewords,
+		utils.CapTimeouts,
+	} {
+		assert.True(t, utils.HasCapability(modem, capability), "should support %s", capability)
+	}
+	for _, capability := range []utils.Capability{
+		utils.CapNoise,
+		utils.CapAttenuation,
+	} {
+		assert.False(t, utils.HasCapability(modem, capability), "should not support %s", capability)
+	}
+}
+
+func TestPrometheusExporter_DescribesOnlySupportedMetrics(t *testing.T) {
+	exporter := outputs.ProExporter(newTestModem(loadTestData(t, "full_stats.json"), 100))
+
+	ch := make(chan *prometheus.Desc, 100)
+	exporter.Describe(ch)
+	close(ch)
+
+	var described []string
+	for desc := range ch {
+		described = append(described, desc.String())
+	}
+	joined := strings.Join(described, "\n")
+	assert.Contains(t, joined, `"modemstats_downstream_snr"`)
+	assert.Contains(t, joined, `"modemstats_upstream_t3_timeout_total"`)
+	assert.NotContains(t, joined, `"modemstats_downstream_noise"`)
+	assert.NotContains(t, joined, `"modemstats_downstream_attenuation"`)
+}
+
+func TestPrometheusExporter_SNRMargin(t *testing.T) {
+	modem := newTestModem(loadTestData(t, "partial_service.json"), 100)
+	exporter := outputs.ProExporter(modem)
+
+	// QAM256 needs around 30 dB
+	expected := `
+		# HELP modemstats_downstream_snr_margin_db Downstream SNR above the minimum required for the channel's modulation in dB
+		# TYPE modemstats_downstream_snr_margin_db gauge
+		modemstats_downstream_snr_margin_db{channel="1",id="25",modulation="QAM256",scheme="SC-QAM"} 11
+		modemstats_downstream_snr_margin_db{channel="2",id="26",modulation="QAM256",scheme="SC-QAM"} 3
+		modemstats_downstream_snr_margin_db{channel="3",id="27",modulation="QAM256",scheme="SC-QAM"} 11
+	`
+	err := testutil.CollectAndCompare(exporter, strings.NewReader(expected), "modemstats_downstream_snr_margin_db")
+	assert.NoError(t, err)
+}
+
+func TestModem_ParseStats_SNRMargin(t *testing.T) {
+	modem := Modem{Stats: loadTestData(t, "snr_margin.json")}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+
+	require.Len(t, stats.DownChannels, 3)
+	assert.True(t, stats.DownChannels[0].HasSNRMargin)
+	assert.Equal(t, 95, stats.DownChannels[0].SNRMargin)
+	assert.False(t, stats.DownChannels[1].HasSNRMargin)
+	assert.True(t, stats.DownChannels[2].HasSNRMargin)
+	assert.Equal(t, 24, stats.DownChannels[2].SNRMargin)
+}
+
+func TestPrometheusExporter_ReportedSNRMargin(t *testing.T) {
+	// Channel 25's margin is the modem's rather than the 11 dB estimated from
+	// its SNR, channel 26 falls back to the estimate, and OFDM channel 33
+	// only has a margin as the modem reports one
+	modem := newTestModem(loadTestData(t, "snr_margin.json"), 100)
+	expected := `
+		# HELP modemstats_downstream_snr_margin_db Downstream SNR above the minimum required for the channel's modulation in dB
+		# TYPE modemstats_downstream_snr_margin_db gauge
+		modemstats_downstream_snr_margin_db{channel="1",id="25",modulation="QAM256",scheme="SC-QAM"} 9.5
+		modemstats_downstream_snr_margin_db{channel="2",id="26",modulation="QAM256",scheme="SC-QAM"} 3
+		modemstats_downstream_snr_margin_db{channel="3",id="33",modulation="QAM4096",scheme="OFDM"} 2.4
+	`
+	err := testutil.CollectAndCompare(outputs.ProExporter(modem), strings.NewReader(expected), "modemstats_downstream_snr_margin_db")
+	assert.NoError(t, err)
+}
+
+func TestModem_ParseStats_OperatingMode(t *testing.T) {
+	modem := Modem{Stats: loadTestData(t, "full_stats.json")}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+	assert.False(t, stats.HasOperatingMode)
+
+	modem = Modem{Stats: loadTestData(t, "modem_mode.json")}
+	stats, err = modem.ParseStats()
+	require.NoError(t, err)
+	assert.True(t, stats.HasOperatingMode)
+	assert.True(t, stats.BridgeMode)
+
+	modem = Modem{Stats: []byte(`{"modemMode": {"enable": false}}`)}
+	stats, err = modem.ParseStats()
+	require.NoError(t, err)
+	assert.True(t, stats.HasOperatingMode)
+	assert.False(t, stats.BridgeMode)
+}
+
+func TestPrometheusExporter_BridgeMode(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(outputs.ProExporter(newTestModem(loadTestData(t, "full_stats.json"), 100)))
+	metricCount, err := testutil.GatherAndCount(registry, "modemstats_modem_bridge_mode")
+	require.NoError(t, err)
+	assert.Equal(t, 0, metricCount)
+
+	modem := newTestModem(loadTestData(t, "modem_mode.json"), 100)
+	expected := `
+		# HELP modemstats_modem_bridge_mode Modem operating mode (1=modem/bridge mode, 0=router mode)
+		# TYPE modemstats_modem_bridge_mode gauge
+		modemstats_modem_bridge_mode 1
+	`
+	err = testutil.CollectAndCompare(outputs.ProExporter(modem), strings.NewReader(expected), "modemstats_modem_bridge_mode")
+	assert.NoError(t, err)
+}
+
+func TestModem_ParseStats_SkipsNonObjectResponse(t *testing.T) {
+	downstream := loadTestData(t, "partial_service.json")
+	state := loadTestData(t, "state.json")
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/downstream"):
+			w.Write(downstream)
+		case strings.HasSuffix(r.URL.Path, "/upstream"):
+			w.Write([]byte(`[{"channelId": 1}]`))
+		case strings.HasSuffix(r.URL.Path, "/serviceflows"):
+			w.Write([]byte("null"))
+		case strings.HasSuffix(r.URL.Path, "/state_"):
+			w.Write(state)
+		default:
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer server.Close()
+
+	modem := Modem{
+		IPAddress: strings.TrimPrefix(server.URL, "https://"),
+	}
+
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+	assert.Len(t, stats.DownChannels, 3)
+	assert.Empty(t, stats.UpChannels)
+	assert.Empty(t, stats.Configs)
+	assert.Equal(t, "operational", stats.ProvisioningStatus)
+}
+
+func TestModem_ParseStats_Uptime(t *testing.T) {
+	modem := Modem{Stats: loadTestData(t, "state.json")}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+	assert.True(t, stats.HasUptime)
+	assert.Equal(t, int64(1036816), stats.Uptime)
+	assert.False(t, stats.HasConnectivityUptime)
+
+	modem = Modem{Stats: loadTestData(t, "connectivity_uptime.json")}
+	stats, err = modem.ParseStats()
+	require.NoError(t, err)
+	assert.True(t, stats.HasUptime)
+	assert.Equal(t, int64(1036816), stats.Uptime)
+	assert.True(t, stats.HasConnectivityUptime)
+	assert.Equal(t, int64(5423), stats.ConnectivityUptime)
+}
+
+func TestPrometheusExporter_ConnectivityUptime(t *testing.T) {
+	uptimeMetrics := []string{
+		"modemstats_uptime_seconds",
+		"modemstats_connectivity_uptime_seconds",
+	}
+
+	// Without a connectivity uptime only the modem uptime is reported
+	modem := newTestModem(loadTestData(t, "state.json"), 100)
+	expected := `
+		# HELP modemstats_uptime_seconds Seconds since the modem booted
+		# TYPE modemstats_uptime_seconds gauge
+		modemstats_uptime_seconds 1.036816e+06
+	`
+	err := testutil.CollectAndCompare(outputs.ProExporter(modem), strings.NewReader(expected), uptimeMetrics...)
+	assert.NoError(t, err)
+
+	modem = newTestModem(loadTestData(t, "connectivity_uptime.json"), 100)
+	expected = `
+		# HELP modemstats_connectivity_uptime_seconds Seconds since the modem last registered with the CMTS
+		# TYPE modemstats_connectivity_uptime_seconds gauge
+		modemstats_connectivity_uptime_seconds 5423
+		# HELP modemstats_uptime_seconds Seconds since the modem booted
+		# TYPE modemstats_uptime_seconds gauge
+		modemstats_uptime_seconds 1.036816e+06
+	`
+	err = testutil.CollectAndCompare(outputs.ProExporter(modem), strings.NewReader(expected), uptimeMetrics...)
+	assert.NoError(t, err)
+}
+
+func TestModem_ParseStats_CorrectedRatio(t *testing.T) {
+	modem := Modem{Stats: loadTestData(t, "corrected_ratio.json")}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+
+	require.Len(t, stats.DownChannels, 3)
+	assert.True(t, stats.DownChannels[0].HasCorrectedRatio)
+	assert.Equal(t, 0.4375, stats.DownChannels[0].CorrectedRatio)
+	assert.False(t, stats.DownChannels[2].HasCorrectedRatio)
+}
+
+func TestModem_ParseStats_LinkQuality(t *testing.T) {
+	modem := Modem{Stats: loadTestData(t, "link_quality.json")}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+
+	require.Len(t, stats.DownChannels, 2)
+	assert.True(t, stats.DownChannels[0].HasQualityPercent)
+	assert.Equal(t, 92.0, stats.DownChannels[0].QualityPercent)
+	assert.Equal(t, 0, stats.DownChannels[0].Snr)
+
+	// Firmware which reports the SNR in dB has no quality
+	modem = Modem{Stats: loadTestData(t, "corrected_ratio.json")}
+	stats, err = modem.ParseStats()
+	require.NoError(t, err)
+	assert.False(t, stats.DownChannels[0].HasQualityPercent)
+}
+
+func TestPrometheusExporter_LinkQuality(t *testing.T) {
+	modem := newTestModem(loadTestData(t, "link_quality.json"), 100)
+	expected := `
+		# HELP modemstats_downstream_quality_percent Downstream link quality as a percentage, where reported in place of SNR
+		# TYPE modemstats_downstream_quality_percent gauge
+		modemstats_downstream_quality_percent{channel="1",id="25",modulation="QAM256",scheme="SC-QAM"} 92
+		modemstats_downstream_quality_percent{channel="2",id="26",modulation="QAM256",scheme="SC-QAM"} 67.5
+	`
+	exporter := outputs.ProExporter(modem)
+	err := testutil.CollectAndCompare(exporter, strings.NewReader(expected),
+		"modemstats_downstream_quality_percent", "modemstats_downstream_snr", "modemstats_downstream_snr_margin_db")
+	assert.NoError(t, err)
+}
+
+func TestPrometheusExporter_CorrectedRatio(t *testing.T) {
+	// Firmware which reports the ratio has it used as is, and channel 27
+	// (without it) falls back to the codeword counts
+	modem := newTestModem(loadTestData(t, "corrected_ratio.json"), 100)
+	expected := `
+		# HELP modemstats_downstream_corrected_ratio Fraction of errored downstream codewords which were corrected
+		# TYPE modemstats_downstream_corrected_ratio gauge
+		modemstats_downstream_corrected_ratio{channel="1",id="25",modulation="QAM256",scheme="SC-QAM"} 0.4375
+		modemstats_downstream_corrected_ratio{channel="2",id="26",modulation="QAM256",scheme="SC-QAM"} 0.9512
+		modemstats_downstream_corrected_ratio{channel="3",id="27",modulation="QAM256",scheme="SC-QAM"} 1
+	`
+	err := testutil.CollectAndCompare(outputs.ProExporter(modem), strings.NewReader(expected), "modemstats_downstream_corrected_ratio")
+	assert.NoError(t, err)
+
+	// Older firmware has it calculated from the codeword counts
+	modem = newTestModem(loadTestData(t, "partial_service.json"), 100)
+	expected = `
+		# HELP modemstats_downstream_corrected_ratio Fraction of errored downstream codewords which were corrected
+		# TYPE modemstats_downstream_corrected_ratio gauge
+		modemstats_downstream_corrected_ratio{channel="1",id="25",modulation="QAM256",scheme="SC-QAM"} 0.45
+		modemstats_downstream_corrected_ratio{channel="2",id="26",modulation="QAM256",scheme="SC-QAM"} 0.9533829342013486
+		modemstats_downstream_corrected_ratio{channel="3",id="27",modulation="QAM256",scheme="SC-QAM"} 1
+	`
+	err = testutil.CollectAndCompare(outputs.ProExporter(modem), strings.NewReader(expected), "modemstats_downstream_corrected_ratio")
+	assert.NoError(t, err)
+}
+
+func TestModem_ParseStats_Interleaver(t *testing.T) {
+	modem := Modem{Stats: loadTestData(t, "interleaver.json")}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+
+	require.Len(t, stats.DownChannels, 3)
+	assert.Equal(t, 16, stats.DownChannels[0].InterleaverDepth)
+	assert.Equal(t, "A", stats.DownChannels[0].Annex)
+	assert.Equal(t, 32, stats.DownChannels[1].InterleaverDepth)
+	assert.Equal(t, "A", stats.DownChannels[1].Annex)
+
+	// OFDM channels have no interleaver
+	assert.Equal(t, "OFDM", stats.DownChannels[2].Scheme)
+	assert.Equal(t, 0, stats.DownChannels[2].InterleaverDepth)
+	assert.Equal(t, "", stats.DownChannels[2].Annex)
+}
+
+func TestPrometheusExporter_Interleaver(t *testing.T) {
+	modem := newTestModem(loadTestData(t, "interleaver.json"), 100)
+	expected := `
+		# HELP modemstats_downstream_interleaver_depth Downstream SC-QAM channel interleaver depth (I)
+		# TYPE modemstats_downstream_interleaver_depth gauge
+		modemstats_downstream_interleaver_depth{channel="1",id="25",modulation="QAM256",scheme="SC-QAM"} 16
+		modemstats_downstream_interleaver_depth{channel="2",id="26",modulation="QAM256",scheme="SC-QAM"} 32
+		# HELP modemstats_info Modem information, value is always 1
+		# TYPE modemstats_info gauge
+		modemstats_info{annex="A",wan_ip=""} 1
+	`
+	err := testutil.CollectAndCompare(outputs.ProExporter(modem), strings.NewReader(expected),
+		"modemstats_downstream_interleaver_depth",
+		"modemstats_info",
+	)
+	assert.NoError(t, err)
+}
+
+func TestPrometheusExporter_ClockOffset(t *testing.T) {
+	// The modem never received the time of day from the CMTS
+	eventLog := loadTestData(t, "eventlog_1970.json")
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(eventLog)
+	}))
+	defer server.Close()
+
+	modem := newTestModem(loadTestData(t, "full_stats.json"), 100)
+	modem.IPAddress = strings.TrimPrefix(server.URL, "https://")
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(outputs.ProExporter(modem))
+	metricCount, err := testutil.GatherAndCount(registry, "modemstats_modem_clock_offset_seconds")
+	require.NoError(t, err)
+	assert.Equal(t, 0, metricCount, "the clock offset should be opt in")
+
+	registry = prometheus.NewRegistry()
+	registry.MustRegister(outputs.ProExporter(modem, outputs.WithClockOffset()))
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	var offset *float64
+	for _, family := range families {
+		if family.GetName() == "modemstats_modem_clock_offset_seconds" {
+			offset = family.GetMetric()[0].GetGauge().Value
+		}
+	}
+	require.NotNil(t, offset, "clock offset should be reported")
+	expected := time.Date(1970, 1, 1, 0, 1, 5, 0, time.UTC).Sub(time.Now()).Seconds()
+	assert.InDelta(t, expected, *offset, 60)
+	assert.Less(t, *offset, -50*365*24*time.Hour.Seconds())
+}
+
+func TestModem_ParseStats_RangingStatus(t *testing.T) {
+	modem := Modem{Stats: loadTestData(t, "ranging.json")}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+
+	require.Len(t, stats.UpChannels, 4)
+	assert.Equal(t, "success", stats.UpChannels[0].RangingStatus)
+	assert.Equal(t, "continue", stats.UpChannels[1].RangingStatus)
+	assert.Equal(t, "abort", stats.UpChannels[2].RangingStatus)
+	assert.Equal(t, "", stats.UpChannels[3].RangingStatus)
+}
+
+func TestPrometheusExporter_RangingStatus(t *testing.T) {
+	modem := newTestModem(loadTestData(t, "ranging.json"), 100)
+	expected := `
+		# HELP modemstats_upstream_ranging_status Upstream channel ranging status (1 for the current status)
+		# TYPE modemstats_upstream_ranging_status gauge
+		modemstats_upstream_ranging_status{channel="1",id="1",status="abort"} 0
+		modemstats_upstream_ranging_status{channel="1",id="1",status="continue"} 0
+		modemstats_upstream_ranging_status{channel="1",id="1",status="success"} 1
+		modemstats_upstream_ranging_status{channel="2",id="2",status="abort"} 0
+		modemstats_upstream_ranging_status{channel="2",id="2",status="continue"} 1
+		modemstats_upstream_ranging_status{channel="2",id="2",status="success"} 0
+		modemstats_upstream_ranging_status{channel="3",id="3",status="abort"} 1
+		modemstats_upstream_ranging_status{channel="3",id="3",status="continue"} 0
+		modemstats_upstream_ranging_status{channel="3",id="3",status="success"} 0
+	`
+	err := testutil.CollectAndCompare(outputs.ProExporter(modem), strings.NewReader(expected),
+		"modemstats_upstream_ranging_status",
+	)
+	assert.NoError(t, err)
+}
+
+func TestModem_ParseStats_PowerRounding(t *testing.T) {
+	modem := Modem{Stats: loadTestData(t, "power_rounding.json")}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+
+	require.Len(t, stats.DownChannels, 2)
+	assert.Equal(t, 22, stats.DownChannels[0].Power, "2.19 dBmV should round to 2.2, not truncate to 2.1")
+	assert.Equal(t, -13, stats.DownChannels[1].Power)
+	require.Len(t, stats.UpChannels, 1)
+	assert.Equal(t, 444, stats.UpChannels[0].Power)
+}
+
+func TestModem_ParseStats_OFDMASubcarrierPower(t *testing.T) {
+	modem := Modem{Stats: loadTestData(t, "ofdma_subcarriers.json")}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+
+	require.Len(t, stats.UpChannels, 2)
+	assert.Empty(t, stats.UpChannels[0].SubcarrierPowers, "ATDMA channels have no subcarriers")
+	assert.Equal(t, 402, stats.UpChannels[1].Power, "the aggregate power should be kept")
+	assert.Equal(t, []utils.SubcarrierPower{
+		{FirstSubcarrier: 74, LastSubcarrier: 125, Power: 398},
+		{FirstSubcarrier: 126, LastSubcarrier: 177, Power: 401},
+		{FirstSubcarrier: 178, LastSubcarrier: 229, Power: 404},
+		{FirstSubcarrier: 230, LastSubcarrier: 281, Power: 412},
+	}, stats.UpChannels[1].SubcarrierPowers)
+}
+
+func TestPrometheusExporter_OFDMASubcarrierPower(t *testing.T) {
+	modem := newTestModem(loadTestData(t, "ofdma_subcarriers.json"), 100)
+	expected := `
+		# HELP modemstats_upstream_ofdma_tx_power OFDMA upstream transmit power across a range of subcarriers in dBmV
+		# TYPE modemstats_upstream_ofdma_tx_power gauge
+		modemstats_upstream_ofdma_tx_power{channel="2",id="11",subcarriers="126-177"} 40.1
+		modemstats_upstream_ofdma_tx_power{channel="2",id="11",subcarriers="178-229"} 40.4
+		modemstats_upstream_ofdma_tx_power{channel="2",id="11",subcarriers="230-281"} 41.2
+		modemstats_upstream_ofdma_tx_power{channel="2",id="11",subcarriers="74-125"} 39.8
+	`
+	err := testutil.CollectAndCompare(outputs.ProExporter(modem), strings.NewReader(expected),
+		"modemstats_upstream_ofdma_tx_power",
+	)
+	assert.NoError(t, err)
+}
+
+func TestPrometheusExporter_EmptyChannels(t *testing.T) {
+	// The modem is up but has no channels, as while it reboots
+	modem := newTestModem(loadTestData(t, "empty_channels.json"), 100)
+	expected := `
+		# HELP modemstats_downstream_channels Number of downstream channels reported by the modem
+		# TYPE modemstats_downstream_channels gauge
+		modemstats_downstream_channels 0
+		# HELP modemstats_shstatsinfo_timems Time to fetch statistics from the modem in milliseconds
+		# TYPE modemstats_shstatsinfo_timems gauge
+		modemstats_shstatsinfo_timems 100
+		# HELP modemstats_upstream_channels Number of upstream channels reported by the modem
+		# TYPE modemstats_upstream_channels gauge
+		modemstats_upstream_channels 0
+	`
+	err := testutil.CollectAndCompare(outputs.ProExporter(modem), strings.NewReader(expected),
+		"modemstats_downstream_channels",
+		"modemstats_upstream_channels",
+		"modemstats_shstatsinfo_timems",
+		"modemstats_downstream_snr",
+	)
+	assert.NoError(t, err)
+}
+
+func TestNormalizeFrequency(t *testing.T) {
+	tests := []struct {
+		name      string
+		frequency float64
+		want      int
+	}{
+		{"Hz", 419000000, 419000000},
+		{"kHz", 419000, 419000000},
+		{"MHz", 419, 419000000},
+		{"fractional MHz", 36.6, 36600000},
+		{"lowest upstream in Hz", 5000000, 5000000},
+		{"lowest upstream in kHz", 5000, 5000000},
+		{"lowest upstream in MHz", 5, 5000000},
+		{"highest downstream in Hz", 1794000000, 1794000000},
+		{"highest downstream in kHz", 1794000, 1794000000},
+		{"highest downstream in MHz", 1794, 1794000000},
+		{"not reported", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, normalizeFrequency(tt.frequency))
+		})
+	}
+}
+
+func TestModem_ParseStats_FrequencyUnits(t *testing.T) {
+	for _, frequency := range []string{"419000000", "419000", "419"} {
+		modem := Modem{Stats: []byte(`{
+			"downstream": {"channels": [{"channelType": "sc_qam", "channelId": 37, "frequency": ` + frequency + `, "modulation": "qam_256"}]},
+			"upstream": {"channels": [{"channelType": "atdma", "channelId": 1, "frequency": ` + frequency + `}]}
+		}`)}
+		stats, err := modem.ParseStats()
+		require.NoError(t, err)
+		assert.Equal(t, 419000000, stats.DownChannels[0].Frequency, "frequency %s", frequency)
+		assert.Equal(t, 419000000, stats.UpChannels[0].Frequency, "frequency %s", frequency)
+	}
+}
+
+func TestModem_ParseStats_OFDMPowerScale(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  string
+		scale    string
+		expected []int
+	}{
+		// Firmware reporting OFDM power in tenths of a dBmV
+		{name: "tenths detected", fixture: "ofdm_power_tenths.json", expected: []int{41}},
+		{name: "tenths configured", fixture: "ofdm_power_tenths.json", scale: OFDMPowerTenths, expected: []int{41}},
+		// Firmware reporting OFDM power in dBmV, like SC-QAM channels
+		{name: "dBmV detected", fixture: "ofdm_power_dbmv.json", scale: OFDMPowerAuto, expected: []int{40, 36}},
+		{name: "dBmV configured", fixture: "ofdm_power_dbmv.json", scale: OFDMPowerDBmV, expected: []int{40, 36}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modem := Modem{Stats: loadTestData(t, tt.fixture), OFDMPowerScale: tt.scale}
+			stats, err := modem.ParseStats()
+			require.NoError(t, err)
+
+			var powers []int
+			for _, channel := range stats.DownChannels {
+				if channel.Scheme == "OFDM" {
+					assert.True(t, plausibleDownPower(channel.Power), "OFDM power %d is implausible", channel.Power)
+					powers = append(powers, channel.Power)
+				}
+			}
+			assert.Equal(t, tt.expected, powers)
+		})
+	}
+}
+
+func TestOFDMPower(t *testing.T) {
+	// A configured scale is used even when the result is implausible
+	assert.Equal(t, 410, ofdmPower(41, OFDMPowerDBmV, []int{39, 42}))
+	assert.Equal(t, 4, ofdmPower(4, OFDMPowerTenths, []int{39, 42}))
+
+	// Without SC-QAM channels whole numbers are assumed to be tenths, but a
+	// fraction can only be dBmV
+	assert.Equal(t, 41, ofdmPower(41, "", nil))
+	assert.Equal(t, -98, ofdmPower(-98, "", nil))
+	assert.Equal(t, 36, ofdmPower(3.6, "", nil))
+}
+
+func TestIsKnownOFDMPowerScale(t *testing.T) {
+	assert.True(t, IsKnownOFDMPowerScale(""))
+	assert.True(t, IsKnownOFDMPowerScale(OFDMPowerTenths))
+	assert.False(t, IsKnownOFDMPowerScale("millivolts"))
+}
+
+func TestModem_FetchSpectrum(t *testing.T) {
+	spectrum := loadTestData(t, "spectrum.json")
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/v1/cablemodem/spectrum" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spectrum)
+	}))
+	defer server.Close()
+
+	modem := Modem{IPAddress: strings.TrimPrefix(server.URL, "https://")}
+	points, err := modem.FetchSpectrum()
+	require.NoError(t, err)
+
+	// A sweep from 258MHz to 1002MHz in 6MHz steps
+	require.Len(t, points, 125)
+	assert.Equal(t, utils.SpectrumPoint{Frequency: 258000000, Power: 40}, points[0])
+	assert.Equal(t, 1002000000, points[124].Frequency)
+}
+
+func TestModem_FetchSpectrum_Unsupported(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+
+	modem := Modem{IPAddress: strings.TrimPrefix(server.URL, "https://")}
+	_, err := modem.FetchSpectrum()
+	assert.ErrorIs(t, err, utils.ErrSpectrumUnsupported)
+}
+
+func TestModem_ParseStats_OFDMRxMer(t *testing.T) {
+	modem := Modem{Stats: loadTestData(t, "ofdm_rxmer.json")}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+
+	// SC-QAM SNR and OFDM MER are both in tenths of a dB
+	require.Len(t, stats.DownChannels, 2)
+	assert.Equal(t, "SC-QAM", stats.DownChannels[0].Scheme)
+	assert.Equal(t, 410, stats.DownChannels[0].Snr)
+	assert.Equal(t, "OFDM", stats.DownChannels[1].Scheme)
+	assert.Equal(t, 430, stats.DownChannels[1].Snr)
+}
+
+func TestPrometheusExporter_OFDMRxMer(t *testing.T) {
+	modem := newTestModem(loadTestData(t, "ofdm_rxmer.json"), 100)
+	expected := `
+		# HELP modemstats_downstream_snr Downstream SNR in dB
+		# TYPE modemstats_downstream_snr gauge
+		modemstats_downstream_snr{channel="1",id="25",modulation="QAM256",scheme="SC-QAM"} 410
+		modemstats_downstream_snr{channel="2",id="33",modulation="QAM4096",scheme="OFDM"} 430
+	`
+	err := testutil.CollectAndCompare(outputs.ProExporter(modem), strings.NewReader(expected), "modemstats_downstream_snr")
+	assert.NoError(t, err)
+}
+
+func TestModem_ParseStats_PLCLock(t *testing.T) {
+	modem := Modem{Stats: loadTestData(t, "plc_lock.json")}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+
+	require.Len(t, stats.DownChannels, 3)
+	assert.False(t, stats.DownChannels[0].HasPLCLock)
+	assert.True(t, stats.DownChannels[1].HasPLCLock)
+	assert.True(t, stats.DownChannels[1].PLCLocked)
+	assert.True(t, stats.DownChannels[2].HasPLCLock)
+	assert.False(t, stats.DownChannels[2].PLCLocked)
+
+	// Firmware which does not report it has no PLC lock status
+	modem = Modem{Stats: loadTestData(t, "ofdm_rxmer.json")}
+	stats, err = modem.ParseStats()
+	require.NoError(t, err)
+	assert.False(t, stats.DownChannels[1].HasPLCLock)
+}
+
+func TestPrometheusExporter_PLCLock(t *testing.T) {
+	// Channel 34 is locked but has lost its PLC, and the SC-QAM channel
+	// has no PLC
+	modem := newTestModem(loadTestData(t, "plc_lock.json"), 100)
+	expected := `
+		# HELP modemstats_downstream_plc_locked OFDM downstream channel PLC lock status (1=locked, 0=unlocked)
+		# TYPE modemstats_downstream_plc_locked gauge
+		modemstats_downstream_plc_locked{channel="2",id="33",modulation="QAM4096",scheme="OFDM"} 1
+		modemstats_downstream_plc_locked{channel="3",id="34",modulation="QAM4096",scheme="OFDM"} 0
+	`
+	err := testutil.CollectAndCompare(outputs.ProExporter(modem), strings.NewReader(expected), "modemstats_downstream_plc_locked")
+	assert.NoError(t, err)
+}
+
+func TestModem_ParseStats_StatusPageFallback(t *testing.T) {
+	page := loadTestData(t, "status_page.html")
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The REST API is disabled, but the web interface still works
+		if r.URL.Path != "/status.html" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page)
+	}))
+	defer server.Close()
+
+	modem := &Modem{IPAddress: strings.TrimPrefix(server.URL, "https://")}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+	assert.Equal(t, "html", stats.Source)
+	assert.False(t, stats.EndpointUp["downstream"])
+
+	assert.Equal(t, []utils.ModemChannel{
+		{ChannelID: 25, Channel: 1, Frequency: 331000000, Snr: 410, Power: 39, Prerserr: 12, Modulation: "QAM256", Scheme: "SC-QAM", Locked: true},
+		{ChannelID: 26, Channel: 2, Frequency: 339000000, Snr: 376, Power: -12, Prerserr: 94622, Postrserr: 4411, Modulation: "QAM256", Scheme: "SC-QAM", Locked: true},
+		{ChannelID: 33, Channel: 3, Frequency: 750000000, Snr: 430, Power: 41, Prerserr: 1840, Modulation: "QAM4096", Scheme: "OFDM"},
+	}, stats.DownChannels)
+	assert.Equal(t, []utils.ModemChannel{
+		{ChannelID: 1, Channel: 1, Frequency: 49600000, Power: 445, Modulation: "QAM64", Scheme: "ATDMA", Locked: true},
+	}, stats.UpChannels)
+
+	// The metrics are marked as coming from the fallback
+	modem.ClearStats()
+	expected := `
+		# HELP modemstats_stats_source Where the modem's statistics were read from, for modems which fall back to another source when the usual one is unavailable
+		# TYPE modemstats_stats_source gauge
+		modemstats_stats_source{source="html"} 1
+		# HELP modemstats_up Whether the last scrape of the modem succeeded (1=success, 0=failure)
+		# TYPE modemstats_up gauge
+		modemstats_up 1
+	`
+	err = testutil.CollectAndCompare(outputs.ProExporter(modem), strings.NewReader(expected), "modemstats_stats_source", "modemstats_up")
+	assert.NoError(t, err)
+}
+
+func TestModem_ParseStats_StatusPageOnlyOnRESTFailure(t *testing.T) {
+	var mu sync.Mutex
+	requested := make(map[string]bool)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path] = true
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"cablemodem": {"status": "operational"}}`))
+	}))
+	defer server.Close()
+
+	modem := &Modem{IPAddress: strings.TrimPrefix(server.URL, "https://")}
+	stats, err := modem.ParseStats()
+	require.NoError(t, err)
+	assert.Equal(t, "rest", stats.Source)
+	assert.False(t, requested["/status.html"], "the status page should not be fetched while the REST API works")
+}
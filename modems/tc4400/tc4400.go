@@ -24,10 +24,29 @@ func (tc4400 *Modem) ClearStats() {
 	tc4400.Stats = nil
 }
 
+// RawStats returns the statistics as last fetched from the modem
+func (tc4400 *Modem) RawStats() []byte {
+	return tc4400.Stats
+}
+
 func (tc4400 *Modem) Type() string {
 	return utils.TypeDocsis
 }
 
+// Host returns the host the modem's requests are made to
+func (tc4400 *Modem) Host() string {
+	return utils.URLHost(tc4400.apiAddress())
+}
+
+// Capabilities lists the statistics populated by this modem
+func (tc4400 *Modem) Capabilities() []utils.Capability {
+	return []utils.Capability{
+		utils.CapDownstreamChannels,
+		utils.CapUpstreamChannels,
+		utils.CapCodewords,
+	}
+}
+
 func (tc4400 *Modem) apiAddress() string {
 	if tc4400.IPAddress == "" {
 		tc4400.IPAddress = "192.168.100.1"
@@ -45,8 +64,7 @@ func (tc4400 *Modem) getStats() ([]byte, error) {
 
 		timeStart := time.Now().UnixMilli()
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
+		resp, err := utils.InsecureHTTPClient().Do(req)
 		if err != nil {
 			return nil, err
 		}
@@ -106,9 +124,9 @@ func (tc4400 *Modem) ParseStats() (utils.ModemStats, error) {
 			case 5:
 				thisChannel.Frequency = utils.ExtractIntValue(cellText)
 			case 7:
-				thisChannel.Snr = int(utils.ExtractFloatValue(cellText) * 10)
+				thisChannel.Snr = utils.Tenths(utils.ExtractFloatValue(cellText))
 			case 8:
-				thisChannel.Power = int(utils.ExtractFloatValue(cellText) * 10)
+				thisChannel.Power = utils.Tenths(utils.ExtractFloatValue(cellText))
 			// case 9: // TODO: This is broken on OFDM channels
 			// 	thisChannel.Modulation = cellText
 			case 11:
@@ -118,7 +136,7 @@ func (tc4400 *Modem) ParseStats() (utils.ModemStats, error) {
 			}
 		})
 
-		if lockStatus == "Locked" {
+		if utils.ParseLockStatus(lockStatus) {
 			downChannels = append(downChannels, thisChannel)
 		}
 	})
@@ -146,13 +164,13 @@ func (tc4400 *Modem) ParseStats() (utils.ModemStats, error) {
 			case 5:
 				thisChannel.Frequency = utils.ExtractIntValue(cellText)
 			case 7:
-				thisChannel.Power = int(utils.ExtractFloatValue(cellText) * 10)
+				thisChannel.Power = utils.Tenths(utils.ExtractFloatValue(cellText))
 				// case 8: // TODO: This is broken on OFDM channels
 				// 	thisChannel.Modulation = cellText
 			}
 		})
 
-		if lockStatus == "Locked" {
+		if utils.ParseLockStatus(lockStatus) {
 			upChannels = append(upChannels, thisChannel)
 		}
 	})
@@ -160,5 +178,7 @@ func (tc4400 *Modem) ParseStats() (utils.ModemStats, error) {
 	return utils.ModemStats{
 		DownChannels: downChannels,
 		UpChannels:   upChannels,
+
+		DocsisCapability: utils.Docsis31,
 	}, nil
 }
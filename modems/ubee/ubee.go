@@ -20,10 +20,29 @@ func (ubee *Modem) ClearStats() {
 	ubee.Stats = nil
 }
 
+// RawStats returns the statistics as last fetched from the modem
+func (ubee *Modem) RawStats() []byte {
+	return ubee.Stats
+}
+
 func (ubee *Modem) Type() string {
 	return utils.TypeDocsis
 }
 
+// Host returns the host the modem's requests are made to
+func (ubee *Modem) Host() string {
+	return utils.URLHost(ubee.fetchURL())
+}
+
+// Capabilities lists the statistics populated by this modem
+func (ubee *Modem) Capabilities() []utils.Capability {
+	return []utils.Capability{
+		utils.CapDownstreamChannels,
+		utils.CapUpstreamChannels,
+		utils.CapCodewords,
+	}
+}
+
 func (ubee *Modem) fetchURL() string {
 	if ubee.IPAddress == "" {
 		ubee.IPAddress = "192.168.100.1"
@@ -140,5 +159,7 @@ func (ubee *Modem) ParseStats() (utils.ModemStats, error) {
 		DownChannels: downChannels,
 		FetchTime:    ubee.FetchTime,
 		ModemType:    utils.TypeDocsis,
+
+		DocsisCapability: utils.Docsis31,
 	}, nil
 }
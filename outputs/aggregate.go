@@ -0,0 +1,185 @@
+package outputs
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/msh100/modem-stats/utils/logging"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// aggregateSourceLabel identifies the exporter a series was aggregated from
+const aggregateSourceLabel = "source"
+
+// AggregateSource is a remote exporter whose metrics are aggregated
+type AggregateSource struct {
+	Name string
+	URL  string
+}
+
+// Aggregator scrapes the /metrics endpoints of several remote exporters, such
+// as ones running beside each modem, and merges their metrics with a source
+// label. Unlike MultiModem the sources are other exporters rather than
+// modems. It is a prometheus.Gatherer, so is served with promhttp.HandlerFor.
+type Aggregator struct {
+	sources []AggregateSource
+	client  *http.Client
+}
+
+// NewAggregator creates an aggregator for the given sources
+func NewAggregator(sources []AggregateSource) *Aggregator {
+	return &Aggregator{
+		sources: sources,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// scrape fetches and parses the metrics of a source
+func (a *Aggregator) scrape(source AggregateSource) (map[string]*dto.MetricFamily, error) {
+	req, err := http.NewRequest(http.MethodGet, source.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/plain; version=0.0.4")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("returned status %d", resp.StatusCode)
+	}
+
+	var parser expfmt.TextParser
+	return parser.TextToMetricFamilies(resp.Body)
+}
+
+// Gather scrapes every source concurrently and returns their merged metrics.
+// A source which cannot be scraped is left out rather than failing the whole
+// scrape, and is shown by modemstats_aggregate_source_up.
+func (a *Aggregator) Gather() ([]*dto.MetricFamily, error) {
+	results := make([]map[string]*dto.MetricFamily, len(a.sources))
+	var wg sync.WaitGroup
+	for i, source := range a.sources {
+		wg.Add(1)
+		go func(i int, source AggregateSource) {
+			defer wg.Done()
+			families, err := a.scrape(source)
+			if err != nil {
+				logging.Warnf("Failed to scrape aggregate source %s (%s): %v", source.Name, source.URL, err)
+				return
+			}
+			results[i] = families
+		}(i, source)
+	}
+	wg.Wait()
+
+	merged := make(map[string]*dto.MetricFamily)
+	up := newGaugeFamily("modemstats_aggregate_source_up", "Whether the last scrape of the aggregated exporter succeeded (1=success, 0=failure)")
+	for i, source := range a.sources {
+		upVal := 0.0
+		if results[i] != nil {
+			upVal = 1.0
+		}
+		up.Metric = append(up.Metric, &dto.Metric{
+			Label: []*dto.LabelPair{labelPair(aggregateSourceLabel, source.Name)},
+			Gauge: &dto.Gauge{Value: &upVal},
+		})
+
+		for name, family := range results[i] {
+			for _, metric := range family.Metric {
+				addSourceLabel(metric, source.Name)
+			}
+
+			existing, ok := merged[name]
+			if !ok {
+				merged[name] = family
+				continue
+			}
+			if existing.GetType() != family.GetType() {
+				logging.Warnf("Skipping %s from aggregate source %s: it is a %s elsewhere", name, source.Name, existing.GetType())
+				continue
+			}
+			existing.Metric = append(existing.Metric, family.Metric...)
+		}
+	}
+	merged[up.GetName()] = up
+
+	families := make([]*dto.MetricFamily, 0, len(merged))
+	for _, family := range merged {
+		sort.Slice(family.Metric, func(i, j int) bool {
+			return labelString(family.Metric[i]) < labelString(family.Metric[j])
+		})
+		families = append(families, family)
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].GetName() < families[j].GetName()
+	})
+	return families, nil
+}
+
+// addSourceLabel labels a metric with its source. A source label already on
+// the metric is kept as exported_source, as Prometheus does for conflicting
+// target labels.
+func addSourceLabel(metric *dto.Metric, source string) {
+	for _, label := range metric.Label {
+		if label.GetName() == aggregateSourceLabel {
+			exported := "exported_" + aggregateSourceLabel
+			label.Name = &exported
+		}
+	}
+	metric.Label = append(metric.Label, labelPair(aggregateSourceLabel, source))
+	sort.Slice(metric.Label, func(i, j int) bool {
+		return metric.Label[i].GetName() < metric.Label[j].GetName()
+	})
+}
+
+// labelString renders a metric's label values for sorting, as a registry
+// sorts the metrics of a family
+func labelString(metric *dto.Metric) string {
+	var b strings.Builder
+	for _, label := range metric.Label {
+		b.WriteString(label.GetValue())
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+func labelPair(name, value string) *dto.LabelPair {
+	return &dto.LabelPair{Name: &name, Value: &value}
+}
+
+func newGaugeFamily(name, help string) *dto.MetricFamily {
+	metricType := dto.MetricType_GAUGE
+	return &dto.MetricFamily{Name: &name, Help: &help, Type: &metricType}
+}
+
+// PrometheusAggregate serves the metrics of the aggregated exporters on one
+// port, returning once the server fails
+func PrometheusAggregate(aggregator *Aggregator, port int) error {
+	http.Handle("/metrics", promhttp.HandlerFor(aggregator, promhttp.HandlerOpts{}))
+
+	logging.Infof("Starting Prometheus aggregator for %d exporters on port %d", len(aggregator.sources), port)
+	return http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
+}
+
+// PrometheusAggregateUnixSocket serves the metrics of the aggregated exporters
+// over a Unix domain socket, returning once the server fails
+func PrometheusAggregateUnixSocket(aggregator *Aggregator, path string) error {
+	http.Handle("/metrics", promhttp.HandlerFor(aggregator, promhttp.HandlerOpts{}))
+
+	listener, err := listenUnixSocket(path)
+	if err != nil {
+		return err
+	}
+	logging.Infof("Starting Prometheus aggregator for %d exporters on socket %s", len(aggregator.sources), path)
+	return http.Serve(listener, nil)
+}
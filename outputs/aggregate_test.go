@@ -0,0 +1,86 @@
+package outputs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// newMetricsServer serves a fixed /metrics page
+func newMetricsServer(page string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte(page))
+	}))
+}
+
+func TestAggregator_MergesSources(t *testing.T) {
+	upstairs := newMetricsServer(`
+# HELP modemstats_downstream_snr Downstream SNR in dB
+# TYPE modemstats_downstream_snr gauge
+modemstats_downstream_snr{channel="1",id="5",modulation="QAM256",scheme="SC-QAM"} 410
+# HELP modemstats_upstream_t3_timeout_total Upstream T3 timeout count
+# TYPE modemstats_upstream_t3_timeout_total counter
+modemstats_upstream_t3_timeout_total{channel="1",id="1"} 3
+`)
+	defer upstairs.Close()
+	office := newMetricsServer(`
+# HELP modemstats_downstream_snr Downstream SNR in dB
+# TYPE modemstats_downstream_snr gauge
+modemstats_downstream_snr{channel="1",id="9",modulation="QAM256",scheme="SC-QAM",source="cable"} 380
+`)
+	defer office.Close()
+
+	aggregator := NewAggregator([]AggregateSource{
+		{Name: "upstairs", URL: upstairs.URL + "/metrics"},
+		{Name: "office", URL: office.URL + "/metrics"},
+	})
+
+	expected := `
+		# HELP modemstats_aggregate_source_up Whether the last scrape of the aggregated exporter succeeded (1=success, 0=failure)
+		# TYPE modemstats_aggregate_source_up gauge
+		modemstats_aggregate_source_up{source="office"} 1
+		modemstats_aggregate_source_up{source="upstairs"} 1
+		# HELP modemstats_downstream_snr Downstream SNR in dB
+		# TYPE modemstats_downstream_snr gauge
+		modemstats_downstream_snr{channel="1",exported_source="cable",id="9",modulation="QAM256",scheme="SC-QAM",source="office"} 380
+		modemstats_downstream_snr{channel="1",id="5",modulation="QAM256",scheme="SC-QAM",source="upstairs"} 410
+		# HELP modemstats_upstream_t3_timeout_total Upstream T3 timeout count
+		# TYPE modemstats_upstream_t3_timeout_total counter
+		modemstats_upstream_t3_timeout_total{channel="1",id="1",source="upstairs"} 3
+	`
+	assert.NoError(t, testutil.GatherAndCompare(aggregator, strings.NewReader(expected)))
+}
+
+func TestAggregator_SourceDown(t *testing.T) {
+	upstairs := newMetricsServer(`
+# HELP modemstats_shstatsinfo_timems Time to fetch statistics from the modem in milliseconds
+# TYPE modemstats_shstatsinfo_timems gauge
+modemstats_shstatsinfo_timems 120
+`)
+	defer upstairs.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "exporter restarting", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	aggregator := NewAggregator([]AggregateSource{
+		{Name: "upstairs", URL: upstairs.URL},
+		{Name: "office", URL: down.URL},
+	})
+
+	expected := `
+		# HELP modemstats_aggregate_source_up Whether the last scrape of the aggregated exporter succeeded (1=success, 0=failure)
+		# TYPE modemstats_aggregate_source_up gauge
+		modemstats_aggregate_source_up{source="office"} 0
+		modemstats_aggregate_source_up{source="upstairs"} 1
+		# HELP modemstats_shstatsinfo_timems Time to fetch statistics from the modem in milliseconds
+		# TYPE modemstats_shstatsinfo_timems gauge
+		modemstats_shstatsinfo_timems{source="upstairs"} 120
+	`
+	assert.NoError(t, testutil.GatherAndCompare(aggregator, strings.NewReader(expected)))
+}
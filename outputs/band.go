@@ -0,0 +1,69 @@
+package outputs
+
+import (
+	"sync"
+
+	"github.com/msh100/modem-stats/utils"
+)
+
+// FrequencyBand is a range of channel frequencies in Hz, inclusive
+type FrequencyBand struct {
+	Min int
+	Max int
+}
+
+// DefaultDownstreamBand and DefaultUpstreamBand span the DOCSIS 3.1
+// downstream and high split upstream spectrum
+var (
+	DefaultDownstreamBand = FrequencyBand{Min: 54000000, Max: 1218000000}
+	DefaultUpstreamBand   = FrequencyBand{Min: 5000000, Max: 204000000}
+)
+
+func (b FrequencyBand) valid() bool {
+	return b.Min >= 0 && b.Max > b.Min
+}
+
+func (b FrequencyBand) contains(frequency int) bool {
+	return frequency >= b.Min && frequency <= b.Max
+}
+
+// bandChecker counts channels reported outside their direction's frequency
+// band, which points to a misconfigured frequency plan or a driver parsing
+// frequencies in the wrong unit
+type bandChecker struct {
+	mu     sync.Mutex
+	bands  map[string]FrequencyBand
+	counts map[string]int
+}
+
+func newBandChecker(downstream, upstream FrequencyBand) *bandChecker {
+	return &bandChecker{
+		bands: map[string]FrequencyBand{
+			"downstream": downstream,
+			"upstream":   upstream,
+		},
+		counts: make(map[string]int),
+	}
+}
+
+// observe counts the channels outside the band for the direction and returns
+// the total counted so far. Channels without a frequency are not counted.
+func (b *bandChecker) observe(direction string, channels []utils.ModemChannel) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	band := b.bands[direction]
+	for _, c := range channels {
+		if c.Frequency > 0 && !band.contains(c.Frequency) {
+			b.counts[direction]++
+		}
+	}
+	return b.counts[direction]
+}
+
+// count returns the total counted so far for the direction
+func (b *bandChecker) count(direction string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.counts[direction]
+}
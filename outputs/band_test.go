@@ -0,0 +1,67 @@
+package outputs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/msh100/modem-stats/modems/fake"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// outOfBandModem has a downstream channel whose frequency was parsed in MHz
+// rather than Hz, and an OFDM channel without a frequency
+func outOfBandModem() *fake.Modem {
+	return &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			{ChannelID: 1, Channel: 1, Frequency: 139000000, Modulation: "QAM256", Scheme: "SC-QAM"},
+			{ChannelID: 2, Channel: 2, Frequency: 147, Modulation: "QAM256", Scheme: "SC-QAM"},
+			{ChannelID: 33, Channel: 3, Modulation: "QAM4096", Scheme: "OFDM"},
+		},
+		UpChannels: []utils.ModemChannel{
+			{ChannelID: 1, Channel: 1, Frequency: 49600000},
+			{ChannelID: 2, Channel: 2, Frequency: 60300000},
+		},
+	}}
+}
+
+func expectOutOfBand(t *testing.T, exporter *PrometheusExporter, downstream, upstream int) {
+	t.Helper()
+	expected := fmt.Sprintf(`
+		# HELP modemstats_channel_out_of_band_total Number of times a channel has been reported outside the expected frequency band, by direction
+		# TYPE modemstats_channel_out_of_band_total counter
+		modemstats_channel_out_of_band_total{direction="downstream"} %d
+		modemstats_channel_out_of_band_total{direction="upstream"} %d
+	`, downstream, upstream)
+	err := testutil.CollectAndCompare(exporter, strings.NewReader(expected), "modemstats_channel_out_of_band_total")
+	assert.NoError(t, err)
+}
+
+func TestPrometheusExporter_OutOfBandChannels(t *testing.T) {
+	exporter := ProExporter(outOfBandModem())
+
+	expectOutOfBand(t, exporter, 1, 0)
+	// The channel is counted again on each scrape it is out of band
+	expectOutOfBand(t, exporter, 2, 0)
+}
+
+func TestPrometheusExporter_OutOfBandRegionalBands(t *testing.T) {
+	// A low split plan with the upstream ending at 42 MHz
+	exporter := ProExporter(outOfBandModem(), WithFrequencyBands(
+		FrequencyBand{Min: 100, Max: 1002000000},
+		FrequencyBand{Min: 5000000, Max: 42000000},
+	))
+
+	expectOutOfBand(t, exporter, 0, 2)
+}
+
+func TestPrometheusExporter_OutOfBandInvalidBandIgnored(t *testing.T) {
+	exporter := ProExporter(outOfBandModem(), WithFrequencyBands(
+		FrequencyBand{Min: 1002000000, Max: 100},
+		FrequencyBand{},
+	))
+
+	expectOutOfBand(t, exporter, 1, 0)
+}
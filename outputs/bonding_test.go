@@ -0,0 +1,62 @@
+package outputs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/msh100/modem-stats/modems/fake"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// numberedChannels returns n channels with consecutive IDs
+func numberedChannels(n int) []utils.ModemChannel {
+	var channels []utils.ModemChannel
+	for i := 1; i <= n; i++ {
+		channels = append(channels, utils.ModemChannel{ChannelID: i, Channel: i})
+	}
+	return channels
+}
+
+func TestPrometheusExporter_BondingRatio(t *testing.T) {
+	// The downstream is fully bonded but upstream has lost 4 of its 6 channels
+	modem := &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: numberedChannels(32),
+		UpChannels:   numberedChannels(2),
+	}}
+	exporter := ProExporter(modem, WithExpectedChannels(32, 6))
+
+	expected := `
+		# HELP modemstats_bonding_ratio Number of channels reported by the modem as a fraction of the number expected, by direction
+		# TYPE modemstats_bonding_ratio gauge
+		modemstats_bonding_ratio{direction="downstream"} 1
+		modemstats_bonding_ratio{direction="upstream"} 0.3333333333333333
+	`
+	assert.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(expected), "modemstats_bonding_ratio"))
+}
+
+func TestPrometheusExporter_BondingRatioOnlyWhereExpected(t *testing.T) {
+	modem := &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: numberedChannels(24),
+		UpChannels:   numberedChannels(4),
+	}}
+
+	assert.Equal(t, 0, testutil.CollectAndCount(ProExporter(modem), "modemstats_bonding_ratio"))
+
+	expected := `
+		# HELP modemstats_bonding_ratio Number of channels reported by the modem as a fraction of the number expected, by direction
+		# TYPE modemstats_bonding_ratio gauge
+		modemstats_bonding_ratio{direction="upstream"} 0.5
+	`
+	exporter := ProExporter(modem, WithExpectedChannels(0, 8))
+	assert.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(expected), "modemstats_bonding_ratio"))
+}
+
+func TestPrometheusExporter_BondingRatioNotReportedOnFailure(t *testing.T) {
+	modem := &fake.Modem{StatsErr: errors.New("modem unreachable")}
+	exporter := ProExporter(modem, WithExpectedChannels(32, 6))
+
+	assert.Equal(t, 0, testutil.CollectAndCount(exporter, "modemstats_bonding_ratio"))
+}
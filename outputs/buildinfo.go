@@ -0,0 +1,42 @@
+package outputs
+
+import (
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Version and Commit identify the build, and are set with
+// -ldflags "-X github.com/msh100/modem-stats/outputs.Version=... -X github.com/msh100/modem-stats/outputs.Commit=..."
+var (
+	Version = "dev"
+	Commit  = "unknown"
+)
+
+// newBuildInfo returns a gauge, always 1, labelled with the exporter's build
+// details. It returns nil if the metric is disabled.
+func newBuildInfo(opts []ExporterOption) prometheus.Collector {
+	fqName := prometheus.BuildFQName(namespace, "", "build_info")
+	if newExporterOptions(opts).disabledMetrics[fqName] {
+		return nil
+	}
+
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: fqName,
+		Help: "Build information about the exporter, value is always 1",
+		ConstLabels: prometheus.Labels{
+			"version":   Version,
+			"commit":    Commit,
+			"goversion": runtime.Version(),
+		},
+	}, func() float64 { return 1 })
+}
+
+// registerBuildInfo registers the build information metric once, separately
+// from the per-modem exporters
+func registerBuildInfo(registerer prometheus.Registerer, opts []ExporterOption) error {
+	if buildInfo := newBuildInfo(opts); buildInfo != nil {
+		return registerer.Register(buildInfo)
+	}
+	return nil
+}
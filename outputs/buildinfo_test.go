@@ -0,0 +1,35 @@
+package outputs
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildInfo(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registerBuildInfo(registry, nil))
+
+	expected := fmt.Sprintf(`
+		# HELP modemstats_build_info Build information about the exporter, value is always 1
+		# TYPE modemstats_build_info gauge
+		modemstats_build_info{commit="unknown",goversion=%q,version="dev"} 1
+	`, runtime.Version())
+	err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "modemstats_build_info")
+	assert.NoError(t, err)
+}
+
+func TestBuildInfo_Disabled(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registerBuildInfo(registry, []ExporterOption{WithDisabledMetrics("build_info")}))
+
+	count, err := testutil.GatherAndCount(registry, "modemstats_build_info")
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
@@ -0,0 +1,86 @@
+package outputs
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ChangeFilter remembers the last value sent of each gauge, so a push output
+// can leave out those which have not changed since, saving bandwidth over a
+// slow link. Counters are always sent, so rates stay continuous.
+type ChangeFilter struct {
+	mu      sync.Mutex
+	epsilon float64
+	last    map[string]float64
+}
+
+// NewChangeFilter creates a filter which sends a gauge again once it has moved
+// by more than epsilon from the value last sent
+func NewChangeFilter(epsilon float64) *ChangeFilter {
+	return &ChangeFilter{epsilon: epsilon, last: make(map[string]float64)}
+}
+
+// changed reports whether a gauge should be sent, which it should the first
+// time it is seen and whenever it has moved by more than the epsilon. The
+// value is remembered when it is to be sent, so a slow drift is sent once it
+// adds up rather than never.
+func (f *ChangeFilter) changed(series string, value float64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if last, ok := f.last[series]; ok && math.Abs(value-last) <= f.epsilon {
+		return false
+	}
+	f.last[series] = value
+	return true
+}
+
+// counterMarker is written by the counter template function ahead of a value,
+// marking its line as a counter's. It is removed before the line is sent.
+const counterMarker = "\x1f"
+
+// filterLines drops the lines of gauges which have not changed, and removes
+// the counter markers from those kept. Graphite ("path value [timestamp]")
+// and StatsD ("name:value|g") lines are gauges, unless marked by the counter
+// template function. Any other line is always sent. A nil filter keeps every
+// line.
+func (f *ChangeFilter) filterLines(lines []string) []string {
+	var kept []string
+	for _, line := range lines {
+		if strings.Contains(line, counterMarker) {
+			kept = append(kept, strings.Replace(line, counterMarker, "", -1))
+			continue
+		}
+		if f != nil {
+			if series, value, ok := lineGauge(line); ok && !f.changed(series, value) {
+				continue
+			}
+		}
+		kept = append(kept, line)
+	}
+	return kept
+}
+
+// lineGauge returns the series and value of a Graphite or StatsD gauge line,
+// false if the line is neither
+func lineGauge(line string) (string, float64, bool) {
+	if i := strings.Index(line, "|"); i >= 0 {
+		kind := strings.SplitN(line[i+1:], "|", 2)[0]
+		nameValue := strings.SplitN(line[:i], ":", 2)
+		// A signed StatsD gauge adjusts the last value rather than setting it
+		if kind != "g" || len(nameValue) != 2 || strings.HasPrefix(nameValue[1], "+") || strings.HasPrefix(nameValue[1], "-") {
+			return "", 0, false
+		}
+		value, err := strconv.ParseFloat(nameValue[1], 64)
+		return nameValue[0], value, err == nil
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) != 2 && len(fields) != 3 {
+		return "", 0, false
+	}
+	value, err := strconv.ParseFloat(fields[1], 64)
+	return fields[0], value, err == nil
+}
@@ -0,0 +1,96 @@
+package outputs
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/msh100/modem-stats/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeFilter_Influx(t *testing.T) {
+	stats := utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			{Channel: 1, ChannelID: 3, Frequency: 331000000, Snr: 403, Power: 41, Prerserr: 10, Postrserr: 2},
+		},
+		UpChannels: []utils.ModemChannel{{Channel: 1, ChannelID: 1, Frequency: 49600000, Power: 445}},
+		FetchTime:  120,
+	}
+	changes := NewChangeFilter(0.5)
+
+	var out bytes.Buffer
+	writeInflux(&out, stats, changes)
+	assert.Equal(t, "downstream,channel=1,id=3,modulation=,scheme= frequency=331000000,snr=403,power=41,prerserr=10,postrserr=2\n"+
+		"upstream,channel=1,id=1 frequency=49600000,power=445\n"+
+		"shstatsinfo timems=120\n", out.String(), "every value should be sent the first time")
+
+	out.Reset()
+	writeInflux(&out, stats, changes)
+	assert.Equal(t, "downstream,channel=1,id=3,modulation=,scheme= prerserr=10,postrserr=2\n"+
+		"shstatsinfo timems=120\n", out.String(), "only the counters should be sent when nothing changed")
+
+	stats.DownChannels[0].Power = 50
+	out.Reset()
+	writeInflux(&out, stats, changes)
+	assert.Equal(t, "downstream,channel=1,id=3,modulation=,scheme= power=50,prerserr=10,postrserr=2\n"+
+		"shstatsinfo timems=120\n", out.String(), "the changed gauge should be sent again")
+}
+
+func TestChangeFilter_Epsilon(t *testing.T) {
+	changes := NewChangeFilter(1)
+
+	assert.True(t, changes.changed("power", 4.1))
+	assert.False(t, changes.changed("power", 4.8), "a move within the epsilon should not be sent")
+	assert.True(t, changes.changed("power", 5.2), "a drift beyond the epsilon should be sent once it adds up")
+	assert.False(t, changes.changed("power", 4.5))
+	assert.True(t, changes.changed("snr", 4.5), "each series should be tracked separately")
+}
+
+func TestLineWriter_ChangedOnly(t *testing.T) {
+	tmpl, err := ParseLineTemplate(`{{ if eq .Kind "downstream" -}}
+down.{{ .Channel.ChannelID }}.power {{ tenths .Channel.Power }} {{ .Timestamp }}
+down.{{ .Channel.ChannelID }}.postrserr {{ counter .Channel.Postrserr }} {{ .Timestamp }}
+down.{{ .Channel.ChannelID }}.snr:{{ tenths .Channel.Snr }}|g
+down.{{ .Channel.ChannelID }}.errors:1|c
+{{- end }}`)
+	require.NoError(t, err)
+	modem := lineTestModem()
+	writer, err := NewLineWriter(ProExporter(modem), nil, tmpl, "tcp://graphite:2003")
+	require.NoError(t, err)
+	writer.SetChangedOnly(0)
+
+	send := func(stats utils.ModemStats, now time.Time) []string {
+		lines, err := writer.render(stats, now)
+		require.NoError(t, err)
+		return writer.changes.filterLines(lines)
+	}
+
+	assert.Equal(t, []string{
+		"down.3.power 4.1 1700000000",
+		"down.3.postrserr 0 1700000000",
+		"down.3.snr:40.3|g",
+		"down.3.errors:1|c",
+		"down.4.power -1.2 1700000000",
+		"down.4.postrserr 0 1700000000",
+		"down.4.snr:39.8|g",
+		"down.4.errors:1|c",
+	}, send(modem.Stats, time.Unix(1700000000, 0)))
+
+	assert.Equal(t, []string{
+		"down.3.postrserr 0 1700000060",
+		"down.3.errors:1|c",
+		"down.4.postrserr 0 1700000060",
+		"down.4.errors:1|c",
+	}, send(modem.Stats, time.Unix(1700000060, 0)), "only counters should be sent when nothing changed")
+
+	modem.Stats.DownChannels[1].Power = -15
+	assert.Equal(t, []string{
+		"down.3.postrserr 0 1700000120",
+		"down.3.errors:1|c",
+		"down.4.power -1.5 1700000120",
+		"down.4.postrserr 0 1700000120",
+		"down.4.errors:1|c",
+	}, send(modem.Stats, time.Unix(1700000120, 0)), "the changed gauge should be sent again")
+}
@@ -0,0 +1,25 @@
+package outputs
+
+import "github.com/msh100/modem-stats/utils"
+
+// maskChannels returns the statistics without the channels whose IDs are
+// excluded. The statistics can be the throttle's cached result, so the
+// channel lists are copied rather than filtered in place.
+func maskChannels(stats utils.ModemStats, excluded map[int]bool) utils.ModemStats {
+	if len(excluded) == 0 {
+		return stats
+	}
+	stats.DownChannels = withoutChannels(stats.DownChannels, excluded)
+	stats.UpChannels = withoutChannels(stats.UpChannels, excluded)
+	return stats
+}
+
+func withoutChannels(channels []utils.ModemChannel, excluded map[int]bool) []utils.ModemChannel {
+	var kept []utils.ModemChannel
+	for _, channel := range channels {
+		if !excluded[channel.ChannelID] {
+			kept = append(kept, channel)
+		}
+	}
+	return kept
+}
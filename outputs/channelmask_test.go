@@ -0,0 +1,43 @@
+package outputs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/msh100/modem-stats/modems/fake"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusExporter_ExcludedChannels(t *testing.T) {
+	modem := &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			{ChannelID: 1, Channel: 1, Power: 31, Modulation: "QAM256", Scheme: "SC-QAM"},
+			{ChannelID: 2, Channel: 2, Power: -87, Modulation: "QAM256", Scheme: "SC-QAM"},
+			{ChannelID: 3, Channel: 3, Power: 28, Modulation: "QAM256", Scheme: "SC-QAM"},
+		},
+		UpChannels: []utils.ModemChannel{
+			{ChannelID: 2, Channel: 1, Power: 445},
+			{ChannelID: 4, Channel: 2, Power: 452},
+		},
+	}}
+	exporter := ProExporter(modem, WithChannelIDLabels(), WithExcludedChannels(2))
+
+	expected := `
+		# HELP modemstats_downstream_power Downstream Power level in dBmv
+		# TYPE modemstats_downstream_power gauge
+		modemstats_downstream_power{id="1",modulation="QAM256",scheme="SC-QAM"} 31
+		modemstats_downstream_power{id="3",modulation="QAM256",scheme="SC-QAM"} 28
+		# HELP modemstats_upstream_power Upstream Power level in dBmv
+		# TYPE modemstats_upstream_power gauge
+		modemstats_upstream_power{id="4"} 452
+	`
+	assert.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(expected),
+		"modemstats_downstream_power", "modemstats_upstream_power"))
+
+	// The modem's statistics are left as they were
+	assert.Len(t, modem.Stats.DownChannels, 3)
+	assert.Equal(t, 2, modem.Stats.DownChannels[1].ChannelID)
+	assert.Equal(t, 2, modem.Stats.UpChannels[0].ChannelID)
+}
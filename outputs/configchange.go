@@ -0,0 +1,44 @@
+package outputs
+
+import "sync"
+
+// configTracker counts changes to the config file and firmware version the
+// modem reports. The ISP can push either at any time, changing provisioning,
+// so a change is worth recording against anything else seen at the time.
+type configTracker struct {
+	mu       sync.Mutex
+	config   string
+	firmware string
+	changes  int
+}
+
+// observe compares the config file and firmware version with those last
+// reported and returns the number of changes so far, and whether either has
+// been reported at all. A modem which briefly reports neither (such as while
+// it reboots) has not changed.
+func (c *configTracker) observe(config, firmware string) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	changed := false
+	if config != "" {
+		changed = c.config != "" && c.config != config
+		c.config = config
+	}
+	if firmware != "" {
+		changed = changed || (c.firmware != "" && c.firmware != firmware)
+		c.firmware = firmware
+	}
+	if changed {
+		c.changes++
+	}
+	return c.changes, c.config != "" || c.firmware != ""
+}
+
+// count returns the number of changes so far, and whether a config file or
+// firmware version has been reported at all
+func (c *configTracker) count() (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.changes, c.config != "" || c.firmware != ""
+}
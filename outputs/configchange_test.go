@@ -0,0 +1,64 @@
+package outputs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/msh100/modem-stats/modems/fake"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusExporter_ConfigChanges(t *testing.T) {
+	modem := &fake.Modem{Stats: utils.ModemStats{
+		ConfigFile:      "wrkldJKDHSUBsgvca69834ncx",
+		FirmwareVersion: "LG-RDK_6.7.4-2204",
+	}}
+	exporter := ProExporter(modem)
+
+	expected := `
+		# HELP modemstats_config_changes_total Number of times the modem's config file or firmware version has changed between scrapes
+		# TYPE modemstats_config_changes_total counter
+		modemstats_config_changes_total 0
+		# HELP modemstats_config_file_info Name of the config file the modem was provisioned with, value is always 1
+		# TYPE modemstats_config_file_info gauge
+		modemstats_config_file_info{name="wrkldJKDHSUBsgvca69834ncx"} 1
+		# HELP modemstats_firmware_info Firmware version the modem runs, value is always 1
+		# TYPE modemstats_firmware_info gauge
+		modemstats_firmware_info{version="LG-RDK_6.7.4-2204"} 1
+	`
+	assert.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(expected),
+		"modemstats_config_changes_total", "modemstats_config_file_info", "modemstats_firmware_info"))
+
+	// The ISP pushes a new config file
+	modem.Stats.ConfigFile = "pqmzZKDHSUBsgvca12875abc"
+	expected = `
+		# HELP modemstats_config_changes_total Number of times the modem's config file or firmware version has changed between scrapes
+		# TYPE modemstats_config_changes_total counter
+		modemstats_config_changes_total 1
+		# HELP modemstats_config_file_info Name of the config file the modem was provisioned with, value is always 1
+		# TYPE modemstats_config_file_info gauge
+		modemstats_config_file_info{name="pqmzZKDHSUBsgvca12875abc"} 1
+	`
+	assert.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(expected),
+		"modemstats_config_changes_total", "modemstats_config_file_info"))
+
+	// Neither being reported for a scrape is not a change
+	modem.Stats = utils.ModemStats{}
+	assert.Equal(t, 0, testutil.CollectAndCount(exporter, "modemstats_config_file_info"))
+	modem.Stats.ConfigFile = "pqmzZKDHSUBsgvca12875abc"
+	modem.Stats.FirmwareVersion = "LG-RDK_6.9.1-2301"
+	expected = `
+		# HELP modemstats_config_changes_total Number of times the modem's config file or firmware version has changed between scrapes
+		# TYPE modemstats_config_changes_total counter
+		modemstats_config_changes_total 2
+	`
+	assert.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(expected), "modemstats_config_changes_total"))
+}
+
+func TestPrometheusExporter_ConfigChangesNotReported(t *testing.T) {
+	modem := &fake.Modem{Stats: utils.ModemStats{}}
+	assert.Equal(t, 0, testutil.CollectAndCount(ProExporter(modem),
+		"modemstats_config_changes_total", "modemstats_config_file_info", "modemstats_firmware_info"))
+}
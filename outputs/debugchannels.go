@@ -0,0 +1,87 @@
+package outputs
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/msh100/modem-stats/utils"
+	"github.com/msh100/modem-stats/utils/logging"
+)
+
+// channelsPage renders a modem's channels and service flows as HTML tables
+var channelsPage = template.Must(template.New("channels").Funcs(template.FuncMap{
+	"tenths": func(value int) float64 {
+		return float64(value) / 10
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>modem-stats channels</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: right; }
+</style>
+</head>
+<body>
+{{- if not .Scraped }}
+<p>The modem has not been scraped yet.</p>
+{{- else }}
+<p>Last scraped {{ .Time.Format "2006-01-02 15:04:05 MST" }}{{ if .Err }}, which failed: {{ .Err }}{{ end }}</p>
+
+<h2>Downstream</h2>
+<table>
+<tr><th>Channel</th><th>ID</th><th>Frequency (Hz)</th><th>Power (dBmV)</th><th>SNR (dB)</th><th>Modulation</th><th>Scheme</th><th>Pre RS errors</th><th>Post RS errors</th><th>Locked</th></tr>
+{{- range .Stats.DownChannels }}
+<tr><td>{{ .Channel }}</td><td>{{ .ChannelID }}</td><td>{{ .Frequency }}</td><td>{{ tenths .Power }}</td><td>{{ tenths .Snr }}</td><td>{{ .Modulation }}</td><td>{{ .Scheme }}</td><td>{{ .Prerserr }}</td><td>{{ .Postrserr }}</td><td>{{ .Locked }}</td></tr>
+{{- end }}
+</table>
+
+<h2>Upstream</h2>
+<table>
+<tr><th>Channel</th><th>ID</th><th>Frequency (Hz)</th><th>Power (dBmV)</th><th>Modulation</th><th>Scheme</th><th>T1</th><th>T2</th><th>T3</th><th>T4</th><th>Locked</th></tr>
+{{- range .Stats.UpChannels }}
+<tr><td>{{ .Channel }}</td><td>{{ .ChannelID }}</td><td>{{ .Frequency }}</td><td>{{ tenths .Power }}</td><td>{{ .Modulation }}</td><td>{{ .Scheme }}</td><td>{{ .T1Timeout }}</td><td>{{ .T2Timeout }}</td><td>{{ .T3Timeout }}</td><td>{{ .T4Timeout }}</td><td>{{ .Locked }}</td></tr>
+{{- end }}
+</table>
+
+<h2>Service Flows</h2>
+<table>
+<tr><th>ID</th><th>Direction</th><th>Max rate</th><th>Max burst</th><th>State</th></tr>
+{{- range .Stats.Configs }}
+<tr><td>{{ .ServiceFlowId }}</td><td>{{ .Config }}</td><td>{{ .Maxrate }}</td><td>{{ .Maxburst }}</td><td>{{ .State }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+</body>
+</html>
+`))
+
+type channelsPageData struct {
+	Scraped bool
+	Time    time.Time
+	Err     error
+	Stats   utils.ModemStats
+}
+
+// ChannelsHandler serves the channels and service flows from the exporter's
+// last scrape of the modem as HTML tables, for a quick look without Grafana.
+// It does not fetch from the modem itself.
+func (p *PrometheusExporter) ChannelsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats, fetched, err := p.throttle.last()
+		data := channelsPageData{
+			Scraped: !fetched.IsZero(),
+			Time:    fetched,
+			Err:     err,
+			Stats:   maskChannels(stats, p.excludedIDs),
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := channelsPage.Execute(w, data); err != nil {
+			logging.Warnf("Failed to render channels page: %v", err)
+		}
+	})
+}
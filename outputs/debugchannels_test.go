@@ -0,0 +1,51 @@
+package outputs
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/msh100/modem-stats/modems/fake"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusExporter_ChannelsHandler(t *testing.T) {
+	modem := &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			{Channel: 1, ChannelID: 5, Frequency: 331000000, Power: 41, Snr: 403, Modulation: "QAM256", Scheme: "SC-QAM", Prerserr: 12, Postrserr: 3, Locked: true},
+		},
+		UpChannels: []utils.ModemChannel{
+			{Channel: 1, ChannelID: 2, Frequency: 49600000, Power: 445, Scheme: "ATDMA", T3Timeout: 7, Locked: true},
+		},
+		Configs: []utils.ModemConfig{
+			{Config: "downstream", Maxrate: 230000000, Maxburst: 42600, ServiceFlowId: 1, State: utils.ServiceFlowActive},
+		},
+	}}
+	exporter := ProExporter(modem)
+	server := httptest.NewServer(exporter.ChannelsHandler())
+	defer server.Close()
+
+	get := func() string {
+		t.Helper()
+		res, err := server.Client().Get(server.URL)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, "text/html; charset=utf-8", res.Header.Get("Content-Type"))
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	assert.Contains(t, get(), "The modem has not been scraped yet")
+
+	// The page shows the last scrape without fetching from the modem
+	testutil.CollectAndCount(exporter)
+	page := get()
+	assert.Equal(t, 1, modem.ParseCalls())
+	assert.Contains(t, page, "<tr><td>1</td><td>5</td><td>331000000</td><td>4.1</td><td>40.3</td><td>QAM256</td><td>SC-QAM</td><td>12</td><td>3</td><td>true</td></tr>")
+	assert.Contains(t, page, "<tr><td>1</td><td>2</td><td>49600000</td><td>44.5</td><td></td><td>ATDMA</td><td>0</td><td>0</td><td>7</td><td>0</td><td>true</td></tr>")
+	assert.Contains(t, page, "<tr><td>1</td><td>downstream</td><td>230000000</td><td>42600</td><td>active</td></tr>")
+}
@@ -0,0 +1,102 @@
+package outputs
+
+import (
+	"sync"
+
+	"github.com/msh100/modem-stats/utils"
+)
+
+// counterDeltas tracks a set of channel counters between scrapes, giving how
+// far each has grown since the last scrape for operators who want that rather
+// than the modem's cumulative counts
+type counterDeltas struct {
+	mu       sync.Mutex
+	counters func(utils.ModemStats) map[counterKey]int
+	scraped  bool
+	previous map[counterKey]int
+}
+
+// newCounterDeltas creates a tracker of the counters returned by the given
+// function, such as downstreamErrorCounters or channelCounters
+func newCounterDeltas(counters func(utils.ModemStats) map[counterKey]int) *counterDeltas {
+	return &counterDeltas{counters: counters}
+}
+
+// counterKey identifies one of a channel's counters
+type counterKey struct {
+	direction string
+	scheme    string
+	channelID int
+	counter   string
+}
+
+func channelCounterKey(direction string, c utils.ModemChannel, counter string) counterKey {
+	return counterKey{direction: direction, scheme: c.Scheme, channelID: c.ChannelID, counter: counter}
+}
+
+// downstreamErrorCounters returns the codeword error counters of each
+// downstream channel
+func downstreamErrorCounters(stats utils.ModemStats) map[counterKey]int {
+	counts := make(map[counterKey]int)
+	for _, c := range stats.DownChannels {
+		counts[channelCounterKey("downstream", c, "prerserr")] = c.Prerserr
+		counts[channelCounterKey("downstream", c, "postrserr")] = c.Postrserr
+	}
+	return counts
+}
+
+// channelCounters returns the codeword error counters of each downstream
+// channel and the timeout counters of each upstream channel
+func channelCounters(stats utils.ModemStats) map[counterKey]int {
+	counts := downstreamErrorCounters(stats)
+	for _, c := range stats.UpChannels {
+		counts[channelCounterKey("upstream", c, "t1")] = c.T1Timeout
+		counts[channelCounterKey("upstream", c, "t2")] = c.T2Timeout
+		counts[channelCounterKey("upstream", c, "t3")] = c.T3Timeout
+		counts[channelCounterKey("upstream", c, "t4")] = c.T4Timeout
+	}
+	return counts
+}
+
+// delta returns how far a count has grown. A count which has fallen has been
+// reset, such as by a modem reboot, and is not a negative number of errors.
+func delta(previous, current int) int {
+	if current < previous {
+		return 0
+	}
+	return current - previous
+}
+
+// observe records the counters and returns how far each has grown since the
+// last observation. Channels are tracked individually so one appearing or
+// disappearing does not change the totals, a counter which was not seen last
+// time having no delta. It returns false for the first observation, when
+// there is nothing to compare with.
+func (d *counterDeltas) observe(stats utils.ModemStats) (map[counterKey]int, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current := d.counters(stats)
+	deltas := make(map[counterKey]int)
+	for key, count := range current {
+		if previous, ok := d.previous[key]; ok {
+			deltas[key] = delta(previous, count)
+		}
+	}
+
+	first := !d.scraped
+	d.scraped = true
+	d.previous = current
+	return deltas, !first
+}
+
+// sumCounter returns the total growth of a counter across all channels
+func sumCounter(deltas map[counterKey]int, counter string) int {
+	total := 0
+	for key, d := range deltas {
+		if key.counter == counter {
+			total += d
+		}
+	}
+	return total
+}
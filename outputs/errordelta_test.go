@@ -0,0 +1,216 @@
+package outputs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/msh100/modem-stats/modems/fake"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounterDeltas_DownstreamErrors(t *testing.T) {
+	deltas := newCounterDeltas(downstreamErrorCounters)
+	observe := func(channels ...utils.ModemChannel) (int, int, bool) {
+		got, ok := deltas.observe(utils.ModemStats{DownChannels: channels})
+		return sumCounter(got, "prerserr"), sumCounter(got, "postrserr"), ok
+	}
+
+	_, _, ok := observe(
+		utils.ModemChannel{ChannelID: 1, Scheme: "SC-QAM", Prerserr: 100, Postrserr: 10},
+		utils.ModemChannel{ChannelID: 2, Scheme: "SC-QAM", Prerserr: 200, Postrserr: 20},
+	)
+	assert.False(t, ok, "the first observation has nothing to compare with")
+
+	prerserr, postrserr, ok := observe(
+		utils.ModemChannel{ChannelID: 1, Scheme: "SC-QAM", Prerserr: 150, Postrserr: 12},
+		utils.ModemChannel{ChannelID: 2, Scheme: "SC-QAM", Prerserr: 230, Postrserr: 20},
+	)
+	assert.True(t, ok)
+	assert.Equal(t, 80, prerserr)
+	assert.Equal(t, 2, postrserr)
+
+	// A modem reboot resets its counts, which is not a negative delta
+	prerserr, postrserr, _ = observe(
+		utils.ModemChannel{ChannelID: 1, Scheme: "SC-QAM", Prerserr: 3, Postrserr: 0},
+		utils.ModemChannel{ChannelID: 2, Scheme: "SC-QAM", Prerserr: 5, Postrserr: 1},
+	)
+	assert.Equal(t, 0, prerserr)
+	assert.Equal(t, 0, postrserr)
+
+	// A new channel starts counting from its first observation, and a
+	// channel which has gone is dropped
+	prerserr, postrserr, _ = observe(
+		utils.ModemChannel{ChannelID: 1, Scheme: "SC-QAM", Prerserr: 13, Postrserr: 1},
+		utils.ModemChannel{ChannelID: 3, Scheme: "SC-QAM", Prerserr: 9000, Postrserr: 900},
+	)
+	assert.Equal(t, 10, prerserr)
+	assert.Equal(t, 1, postrserr)
+}
+
+func TestPrometheusExporter_ErrorsInterval(t *testing.T) {
+	modem := &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			{ChannelID: 5, Channel: 1, Prerserr: 1000, Postrserr: 50, Modulation: "QAM256", Scheme: "SC-QAM"},
+		},
+	}}
+	exporter := ProExporter(modem)
+	metric := "modemstats_downstream_errors_interval"
+
+	assert.Equal(t, 0, testutil.CollectAndCount(exporter, metric))
+
+	modem.Stats.DownChannels = []utils.ModemChannel{
+		{ChannelID: 5, Channel: 1, Prerserr: 1250, Postrserr: 53, Modulation: "QAM256", Scheme: "SC-QAM"},
+	}
+	expected := `
+		# HELP modemstats_downstream_errors_interval Number of downstream codeword errors across all channels since the last scrape, by counter
+		# TYPE modemstats_downstream_errors_interval gauge
+		modemstats_downstream_errors_interval{counter="postrserr"} 3
+		modemstats_downstream_errors_interval{counter="prerserr"} 250
+	`
+	assert.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(expected), metric))
+
+	// The modem rebooted
+	modem.Stats.DownChannels = []utils.ModemChannel{
+		{ChannelID: 5, Channel: 1, Prerserr: 7, Postrserr: 0, Modulation: "QAM256", Scheme: "SC-QAM"},
+	}
+	expected = `
+		# HELP modemstats_downstream_errors_interval Number of downstream codeword errors across all channels since the last scrape, by counter
+		# TYPE modemstats_downstream_errors_interval gauge
+		modemstats_downstream_errors_interval{counter="postrserr"} 0
+		modemstats_downstream_errors_interval{counter="prerserr"} 0
+	`
+	assert.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(expected), metric))
+}
+
+func TestCounterDeltas(t *testing.T) {
+	deltas := newCounterDeltas(channelCounters)
+	down := utils.ModemChannel{ChannelID: 5, Scheme: "SC-QAM", Prerserr: 100, Postrserr: 10}
+	up := utils.ModemChannel{ChannelID: 1, Scheme: "SC-QAM", T3Timeout: 4}
+
+	got, ok := deltas.observe(utils.ModemStats{DownChannels: []utils.ModemChannel{down}})
+	assert.False(t, ok)
+	assert.Empty(t, got, "the first observation has nothing to compare with")
+
+	down.Prerserr, down.Postrserr = 150, 12
+	got, _ = deltas.observe(utils.ModemStats{
+		DownChannels: []utils.ModemChannel{down},
+		UpChannels:   []utils.ModemChannel{up},
+	})
+	assert.Equal(t, map[counterKey]int{
+		channelCounterKey("downstream", down, "prerserr"):  50,
+		channelCounterKey("downstream", down, "postrserr"): 2,
+	}, got, "a newly seen channel has no delta")
+
+	// The modem rebooted, resetting its counters
+	down.Prerserr, down.Postrserr = 3, 0
+	up.T3Timeout = 6
+	got, _ = deltas.observe(utils.ModemStats{
+		DownChannels: []utils.ModemChannel{down},
+		UpChannels:   []utils.ModemChannel{up},
+	})
+	assert.Equal(t, 0, got[channelCounterKey("downstream", down, "prerserr")])
+	assert.Equal(t, 2, got[channelCounterKey("upstream", up, "t3")])
+}
+
+func TestPrometheusExporter_CounterDeltas(t *testing.T) {
+	modem := &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			{ChannelID: 5, Channel: 1, Prerserr: 1000, Postrserr: 50, Modulation: "QAM256", Scheme: "SC-QAM"},
+		},
+		UpChannels: []utils.ModemChannel{
+			{ChannelID: 1, Channel: 1, T3Timeout: 4},
+		},
+	}}
+	exporter := ProExporter(modem, WithCounterDeltas())
+	metrics := []string{
+		"modemstats_downstream_prerserr_total",
+		"modemstats_downstream_errors_scrape",
+		"modemstats_upstream_timeouts_scrape",
+	}
+
+	expected := `
+		# HELP modemstats_downstream_prerserr_total Number of Errors per channel Pre RS
+		# TYPE modemstats_downstream_prerserr_total counter
+		modemstats_downstream_prerserr_total{channel="1",id="5",modulation="QAM256",scheme="SC-QAM"} 1000
+	`
+	assert.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(expected), metrics...))
+
+	modem.Stats.DownChannels[0].Prerserr = 1250
+	modem.Stats.DownChannels[0].Postrserr = 53
+	modem.Stats.UpChannels[0].T3Timeout = 5
+	expected = `
+		# HELP modemstats_downstream_errors_scrape Number of codeword errors per channel since the last scrape, by counter
+		# TYPE modemstats_downstream_errors_scrape gauge
+		modemstats_downstream_errors_scrape{channel="1",counter="postrserr",id="5",modulation="QAM256",scheme="SC-QAM"} 3
+		modemstats_downstream_errors_scrape{channel="1",counter="prerserr",id="5",modulation="QAM256",scheme="SC-QAM"} 250
+		# HELP modemstats_downstream_prerserr_total Number of Errors per channel Pre RS
+		# TYPE modemstats_downstream_prerserr_total counter
+		modemstats_downstream_prerserr_total{channel="1",id="5",modulation="QAM256",scheme="SC-QAM"} 1250
+		# HELP modemstats_upstream_timeouts_scrape Number of upstream timeouts per channel since the last scrape, by timeout
+		# TYPE modemstats_upstream_timeouts_scrape gauge
+		modemstats_upstream_timeouts_scrape{channel="1",id="1",timeout="t1"} 0
+		modemstats_upstream_timeouts_scrape{channel="1",id="1",timeout="t2"} 0
+		modemstats_upstream_timeouts_scrape{channel="1",id="1",timeout="t3"} 1
+		modemstats_upstream_timeouts_scrape{channel="1",id="1",timeout="t4"} 0
+	`
+	assert.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(expected), metrics...))
+
+	// The deltas are opt in
+	assert.Equal(t, 0, testutil.CollectAndCount(ProExporter(modem),
+		"modemstats_downstream_errors_scrape", "modemstats_upstream_timeouts_scrape"))
+}
+
+func TestPrometheusExporter_ErrorHistogram(t *testing.T) {
+	modem := &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			{ChannelID: 5, Channel: 1, Prerserr: 1000, Postrserr: 50, Modulation: "QAM256", Scheme: "SC-QAM"},
+		},
+	}}
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(ProExporter(modem, WithErrorHistogram()))
+
+	// The first scrape has nothing to compare with, so the next two give an
+	// observation each
+	for _, prerserr := range []int{1000, 1250, 1260} {
+		modem.Stats.DownChannels[0].Prerserr = prerserr
+		_, err := registry.Gather()
+		require.NoError(t, err)
+	}
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	observed := make(map[string]bool)
+	for _, family := range families {
+		if family.GetName() != "modemstats_downstream_errors_scrape_distribution" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			assert.Equal(t, "1", labels["channel"])
+			assert.Equal(t, "5", labels["id"])
+
+			h := metric.GetHistogram()
+			require.NotNil(t, h)
+			assert.Empty(t, h.GetBucket(), "there should be no classic buckets")
+			assert.NotNil(t, h.Schema, "it should be a native histogram")
+			assert.Equal(t, uint64(3), h.GetSampleCount())
+			observed[labels["counter"]] = true
+
+			if labels["counter"] == "prerserr" {
+				assert.Equal(t, float64(260), h.GetSampleSum())
+				assert.NotEmpty(t, h.GetPositiveSpan())
+			}
+		}
+	}
+	assert.Equal(t, map[string]bool{"prerserr": true, "postrserr": true}, observed)
+
+	// The histogram is opt in
+	assert.Equal(t, 0, testutil.CollectAndCount(ProExporter(modem), "modemstats_downstream_errors_scrape_distribution"))
+}
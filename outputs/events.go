@@ -0,0 +1,118 @@
+package outputs
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/msh100/modem-stats/utils"
+)
+
+// maxEventCodeLength bounds the length of an event code label, as a modem's
+// messages are free text
+const maxEventCodeLength = 100
+
+// docsisPriorities names the numeric event priorities of the DOCSIS event
+// log, which some modems report in place of (or alongside) the name
+var docsisPriorities = map[string]string{
+	"1": "emergency",
+	"2": "alert",
+	"3": "critical",
+	"4": "error",
+	"5": "warning",
+	"6": "notice",
+	"7": "information",
+	"8": "debug",
+}
+
+var (
+	// priorityNumber matches the number of a priority such as "3-Critical"
+	// or "Critical (3)"
+	priorityNumber = regexp.MustCompile(`^\d+\s*-\s*|\s*\(\d+\)$`)
+
+	// eventNumber matches the numbers in an event message, such as channel
+	// IDs, which would otherwise make a code of every occurrence
+	eventNumber = regexp.MustCompile(`\b\d+(\.\d+)*\b`)
+)
+
+// normalizePriority folds the ways modems write an event's priority into
+// one, such as "3-Critical", "Critical (3)" and "3" into "critical"
+func normalizePriority(priority string) string {
+	priority = strings.ToLower(strings.TrimSpace(priority))
+	if name, ok := docsisPriorities[priority]; ok {
+		return name
+	}
+	priority = priorityNumber.ReplaceAllString(priority, "")
+	if priority == "" {
+		return "unknown"
+	}
+	return priority
+}
+
+// eventCode returns the template of an event's message, without the MAC
+// addresses and versions DOCSIS appends and with any numbers replaced by N,
+// so occurrences of the same event share a code
+func eventCode(message string) string {
+	if i := strings.Index(message, ";"); i >= 0 {
+		message = message[:i]
+	}
+	if i := strings.Index(message, "CM-MAC="); i >= 0 {
+		message = message[:i]
+	}
+	message = eventNumber.ReplaceAllString(message, "N")
+	message = strings.Join(strings.Fields(message), " ")
+	message = strings.TrimRight(message, " .,:(-")
+	if len(message) > maxEventCodeLength {
+		message = message[:maxEventCodeLength]
+	}
+	return message
+}
+
+type eventType struct {
+	priority string
+	code     string
+}
+
+// eventCounter counts the entries of the modem's event log by priority and
+// code. The log is fetched whole each time, so an entry is only counted the
+// first time it is seen. Entries are remembered until they roll off the log.
+type eventCounter struct {
+	mu     sync.Mutex
+	seen   map[string]bool
+	counts map[eventType]int
+}
+
+func newEventCounter() *eventCounter {
+	return &eventCounter{
+		seen:   make(map[string]bool),
+		counts: make(map[eventType]int),
+	}
+}
+
+// observe counts the entries of the event log not seen in the previous fetch
+func (e *eventCounter) observe(entries []utils.EventLogEntry) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	current := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		key := logKey(entry)
+		if !e.seen[key] && !current[key] {
+			e.counts[eventType{normalizePriority(entry.Priority), eventCode(entry.Message)}]++
+		}
+		current[key] = true
+	}
+	e.seen = current
+}
+
+// totals returns the number of entries counted by priority and code
+func (e *eventCounter) totals() map[eventType]int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	totals := make(map[eventType]int, len(e.counts))
+	for t, count := range e.counts {
+		totals[t] = count
+	}
+	return totals
+}
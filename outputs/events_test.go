@@ -0,0 +1,96 @@
+package outputs
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/msh100/modem-stats/modems/fake"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizePriority(t *testing.T) {
+	for raw, expected := range map[string]string{
+		"critical":     "critical",
+		" Warning ":    "warning",
+		"3-Critical":   "critical",
+		"Critical (3)": "critical",
+		"6":            "notice",
+		"":             "unknown",
+	} {
+		assert.Equal(t, expected, normalizePriority(raw), raw)
+	}
+}
+
+func TestEventCode(t *testing.T) {
+	assert.Equal(t, "No Ranging Response received - T3 time-out",
+		eventCode("No Ranging Response received - T3 time-out;CM-MAC=aa:bb:cc:dd:ee:ff;CMTS-MAC=00:01:5c:00:00:01;CM-QOS=1.1;CM-VER=3.1;"))
+	assert.Equal(t, "SYNC Timing Synchronization failure - Loss of Sync",
+		eventCode("SYNC Timing Synchronization failure - Loss of Sync CM-MAC=aa:bb:cc:dd:ee:ff"))
+	assert.Equal(t, "US profile assignment change. US Chan ID: N",
+		eventCode("US profile assignment change. US Chan ID: 2; Previous Profile: 11; New Profile: 12."))
+}
+
+func TestPrometheusExporter_EventCounts(t *testing.T) {
+	t3 := "No Ranging Response received - T3 time-out;CM-MAC=aa:bb:cc:dd:ee:ff;CMTS-MAC=00:01:5c:00:00:01;CM-QOS=1.1;CM-VER=3.1;"
+	modem := &fake.Modem{EventLog: []utils.EventLogEntry{
+		{Priority: "critical", Timestamp: "2026-02-09T10:14:14.000Z", Message: t3},
+		{Priority: "critical", Timestamp: "2026-02-09T10:15:02.000Z", Message: t3},
+		{Priority: "notice", Timestamp: "2026-02-09T10:16:30.000Z", Message: "Honor MDD; IP provisioning mode = IPv4"},
+		{Priority: "3-Critical", Timestamp: "2026-02-09T10:17:45.000Z", Message: "SYNC Timing Synchronization failure - Loss of Sync"},
+	}}
+	exporter := ProExporter(modem, WithEventCounts())
+
+	expected := `
+		# HELP modemstats_events_total Number of entries in the modem's event log, by priority and event code
+		# TYPE modemstats_events_total counter
+		modemstats_events_total{code="Honor MDD",priority="notice"} 1
+		modemstats_events_total{code="No Ranging Response received - T3 time-out",priority="critical"} 2
+		modemstats_events_total{code="SYNC Timing Synchronization failure - Loss of Sync",priority="critical"} 1
+	`
+	err := testutil.CollectAndCompare(exporter, strings.NewReader(expected), "modemstats_events_total")
+	assert.NoError(t, err)
+
+	// Scraping the same log again counts nothing new
+	err = testutil.CollectAndCompare(exporter, strings.NewReader(expected), "modemstats_events_total")
+	assert.NoError(t, err)
+
+	// Only the entry added since is counted, with the oldest rolled off
+	modem.EventLog = append(modem.EventLog[1:], utils.EventLogEntry{Priority: "critical", Timestamp: "2026-02-09T10:20:00.000Z", Message: t3})
+	expected = `
+		# HELP modemstats_events_total Number of entries in the modem's event log, by priority and event code
+		# TYPE modemstats_events_total counter
+		modemstats_events_total{code="Honor MDD",priority="notice"} 1
+		modemstats_events_total{code="No Ranging Response received - T3 time-out",priority="critical"} 3
+		modemstats_events_total{code="SYNC Timing Synchronization failure - Loss of Sync",priority="critical"} 1
+	`
+	err = testutil.CollectAndCompare(exporter, strings.NewReader(expected), "modemstats_events_total")
+	assert.NoError(t, err)
+}
+
+func TestPrometheusExporter_EventCountsOptIn(t *testing.T) {
+	modem := &fake.Modem{EventLog: []utils.EventLogEntry{{Priority: "critical", Message: "T3 time-out"}}}
+
+	err := testutil.CollectAndCompare(ProExporter(modem), strings.NewReader(""), "modemstats_events_total")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, modem.EventLogCalls(), "the event log should only be fetched on request")
+}
+
+func TestPrometheusExporter_EventLogThrottled(t *testing.T) {
+	modem := &fake.Modem{EventLog: []utils.EventLogEntry{{Priority: "critical", Message: "T3 time-out"}}}
+	exporter := ProExporter(modem, WithEventCounts(), WithMinScrapeInterval(time.Hour))
+
+	expected := `
+		# HELP modemstats_events_total Number of entries in the modem's event log, by priority and event code
+		# TYPE modemstats_events_total counter
+		modemstats_events_total{code="T3 time-out",priority="critical"} 1
+	`
+	for i := 0; i < 3; i++ {
+		err := testutil.CollectAndCompare(exporter, strings.NewReader(expected), "modemstats_events_total")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, modem.EventLogCalls(), "the event log should be fetched with the statistics")
+	assert.Equal(t, 1, modem.ParseCalls())
+}
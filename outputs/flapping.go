@@ -0,0 +1,64 @@
+package outputs
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultFlapWindow is how far back lock-state transitions are counted
+// towards a channel's recent flaps
+const DefaultFlapWindow = time.Hour
+
+// flapDetector tracks lock-state transitions of channels between scrapes. A
+// channel which keeps locking and unlocking is worse than one cleanly down,
+// which the single-scrape locked gauge does not show.
+type flapDetector struct {
+	mu       sync.Mutex
+	window   time.Duration
+	now      func() time.Time
+	channels map[string]*channelFlaps
+}
+
+type channelFlaps struct {
+	locked      bool
+	transitions int
+	recent      []time.Time
+}
+
+func newFlapDetector(window time.Duration) *flapDetector {
+	return &flapDetector{
+		window:   window,
+		now:      time.Now,
+		channels: make(map[string]*channelFlaps),
+	}
+}
+
+// observe records a channel's lock state and returns its total number of
+// transitions along with the number that happened within the window
+func (f *flapDetector) observe(key string, locked bool) (int, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	channel, ok := f.channels[key]
+	if !ok {
+		channel = &channelFlaps{locked: locked}
+		f.channels[key] = channel
+	}
+
+	if channel.locked != locked {
+		channel.locked = locked
+		channel.transitions++
+		channel.recent = append(channel.recent, now)
+	}
+
+	// Drop transitions which have slid out of the window
+	cutoff := now.Add(-f.window)
+	expired := 0
+	for expired < len(channel.recent) && !channel.recent[expired].After(cutoff) {
+		expired++
+	}
+	channel.recent = channel.recent[expired:]
+
+	return channel.transitions, len(channel.recent)
+}
@@ -0,0 +1,218 @@
+package outputs
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/msh100/modem-stats/utils"
+)
+
+// HealthWeights weight the components of the health score. A component the
+// modem cannot report is left out of the score rather than counted against
+// it, the others' weights making up the whole.
+type HealthWeights struct {
+	Lock   float64
+	SNR    float64
+	Power  float64
+	Errors float64
+}
+
+// DefaultHealthWeights weight every component equally
+var DefaultHealthWeights = HealthWeights{Lock: 1, SNR: 1, Power: 1, Errors: 1}
+
+func (w HealthWeights) valid() bool {
+	return w.Lock >= 0 && w.SNR >= 0 && w.Power >= 0 && w.Errors >= 0 &&
+		w.Lock+w.SNR+w.Power+w.Errors > 0
+}
+
+const (
+	// healthySNRMargin is the SNR margin in dB above which a channel's SNR
+	// scores full marks
+	healthySNRMargin = 6.0
+
+	// healthyDownPower is the downstream power in tenths of a dBmV either
+	// side of 0 within which a channel's power is in range
+	healthyDownPower = 150
+
+	// unhealthyErrorRate is the number of uncorrectable codeword errors a
+	// minute, across all channels, at which the errors score nothing
+	unhealthyErrorRate = 100.0
+)
+
+// healthComponents are the components of the health score, each from 0
+// (unhealthy) to 1 (healthy), and whether each is available
+type healthComponents struct {
+	lock, snr, power, errors             float64
+	hasLock, hasSNR, hasPower, hasErrors bool
+}
+
+// score combines the components into a score from 0 to 100, weighting those
+// available. It returns false if none are.
+func (w HealthWeights) score(c healthComponents) (float64, bool) {
+	var total, weights float64
+	for _, component := range []struct {
+		available bool
+		value     float64
+		weight    float64
+	}{
+		{c.hasLock, c.lock, w.Lock},
+		{c.hasSNR, c.snr, w.SNR},
+		{c.hasPower, c.power, w.Power},
+		{c.hasErrors, c.errors, w.Errors},
+	} {
+		if component.available && component.weight > 0 {
+			total += component.value * component.weight
+			weights += component.weight
+		}
+	}
+	if weights == 0 {
+		return 0, false
+	}
+	return 100 * total / weights, true
+}
+
+// clamp limits a value to between 0 and 1
+func clamp(value float64) float64 {
+	return math.Max(0, math.Min(1, value))
+}
+
+// lockRatio returns the fraction of the channels which are locked, false if
+// there are none
+func lockRatio(stats utils.ModemStats) (float64, bool) {
+	channels := len(stats.DownChannels) + len(stats.UpChannels)
+	if channels == 0 {
+		return 0, false
+	}
+	locked := 0
+	for _, direction := range [][]utils.ModemChannel{stats.DownChannels, stats.UpChannels} {
+		for _, c := range direction {
+			if c.Locked {
+				locked++
+			}
+		}
+	}
+	return float64(locked) / float64(channels), true
+}
+
+// channelLockRatio returns the fraction of a direction's channels which are
+// locked, false if there are none
+func channelLockRatio(channels []utils.ModemChannel) (float64, bool) {
+	if len(channels) == 0 {
+		return 0, false
+	}
+	locked := 0
+	for _, c := range channels {
+		if c.Locked {
+			locked++
+		}
+	}
+	return float64(locked) / float64(len(channels)), true
+}
+
+// snrScore returns the mean over the downstream channels of their SNR margin
+// as a fraction of healthySNRMargin, false if no channel has a margin
+func snrScore(channels []utils.ModemChannel) (float64, bool) {
+	var total float64
+	var counted int
+	for _, c := range channels {
+		margin, ok := snrMargin(c)
+		if !ok {
+			continue
+		}
+		total += clamp(margin / healthySNRMargin)
+		counted++
+	}
+	if counted == 0 {
+		return 0, false
+	}
+	return total / float64(counted), true
+}
+
+// powerScore returns the fraction of the channels whose power is in range,
+// within healthyDownPower of 0 downstream and no more than the maximum
+// upstream, false if there are none
+func powerScore(stats utils.ModemStats, maxUpPower float64) (float64, bool) {
+	channels := len(stats.DownChannels) + len(stats.UpChannels)
+	if channels == 0 {
+		return 0, false
+	}
+	inRange := 0
+	for _, c := range stats.DownChannels {
+		if c.Power >= -healthyDownPower && c.Power <= healthyDownPower {
+			inRange++
+		}
+	}
+	for _, c := range stats.UpChannels {
+		if float64(c.Power) <= math.Round(maxUpPower*10) {
+			inRange++
+		}
+	}
+	return float64(inRange) / float64(channels), true
+}
+
+// healthScorer scores the modem's health on each scrape. The errors
+// component is the rate of uncorrectable errors since the previous fetch,
+// so is unavailable until the second.
+type healthScorer struct {
+	mu         sync.Mutex
+	weights    HealthWeights
+	maxUpPower float64
+	lock       bool
+	snr        bool
+	power      bool
+	codewords  bool
+
+	errors     *counterDeltas
+	lastFetch  time.Time
+	errorScore float64
+	hasErrors  bool
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+func newHealthScorer(modem utils.DocsisModem, weights HealthWeights, maxUpPower float64) *healthScorer {
+	return &healthScorer{
+		weights:    weights,
+		maxUpPower: maxUpPower,
+		lock:       utils.HasCapability(modem, utils.CapLockStatus),
+		snr:        utils.HasCapability(modem, utils.CapDownstreamChannels),
+		power:      utils.HasCapability(modem, utils.CapDownstreamChannels) || utils.HasCapability(modem, utils.CapUpstreamChannels),
+		codewords:  utils.HasCapability(modem, utils.CapCodewords),
+		errors:     newCounterDeltas(downstreamErrorCounters),
+		now:        time.Now,
+	}
+}
+
+// observe scores the modem's statistics, returning false if no component is
+// available. A throttled scrape repeats the last statistics, so keeps the
+// last errors component rather than reporting no errors.
+func (h *healthScorer) observe(stats utils.ModemStats, fetched bool) (float64, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var c healthComponents
+	if h.lock {
+		c.lock, c.hasLock = lockRatio(stats)
+	}
+	if h.snr {
+		c.snr, c.hasSNR = snrScore(stats.DownChannels)
+	}
+	if h.power {
+		c.power, c.hasPower = powerScore(stats, h.maxUpPower)
+	}
+	if h.codewords && fetched {
+		now := h.now()
+		deltas, ok := h.errors.observe(stats)
+		if elapsed := now.Sub(h.lastFetch).Minutes(); ok && elapsed > 0 {
+			postrserr := sumCounter(deltas, "postrserr")
+			h.errorScore = clamp(1 - float64(postrserr)/elapsed/unhealthyErrorRate)
+			h.hasErrors = true
+		}
+		h.lastFetch = now
+	}
+	c.errors, c.hasErrors = h.errorScore, h.hasErrors
+
+	return h.weights.score(c)
+}
@@ -0,0 +1,89 @@
+package outputs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/msh100/modem-stats/modems/fake"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthWeights_Score(t *testing.T) {
+	components := healthComponents{
+		lock: 1, hasLock: true,
+		snr: 0.5, hasSNR: true,
+		power: 0, hasPower: true,
+	}
+
+	// The errors are unavailable, so the others make up the whole
+	score, ok := DefaultHealthWeights.score(components)
+	assert.True(t, ok)
+	assert.InDelta(t, 50, score, 0.001)
+
+	score, ok = HealthWeights{Lock: 2, SNR: 1, Power: 1, Errors: 4}.score(components)
+	assert.True(t, ok)
+	assert.InDelta(t, 62.5, score, 0.001)
+
+	// A component weighted 0 is left out
+	score, ok = HealthWeights{Lock: 1, SNR: 1}.score(components)
+	assert.True(t, ok)
+	assert.InDelta(t, 75, score, 0.001)
+
+	_, ok = DefaultHealthWeights.score(healthComponents{})
+	assert.False(t, ok, "there should be no score without any component")
+}
+
+func TestHealthWeights_Valid(t *testing.T) {
+	assert.True(t, DefaultHealthWeights.valid())
+	assert.True(t, HealthWeights{Lock: 1}.valid())
+	assert.False(t, HealthWeights{}.valid())
+	assert.False(t, HealthWeights{Lock: 2, SNR: -1}.valid())
+}
+
+func TestHealthScorer(t *testing.T) {
+	stats := utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			// A 6dB margin scores full marks, 3dB half marks
+			{ChannelID: 1, Snr: 360, Power: 20, Modulation: "QAM256", Scheme: "SC-QAM", Locked: true},
+			{ChannelID: 2, Snr: 330, Power: 20, Modulation: "QAM256", Scheme: "SC-QAM", Locked: true},
+			// OFDM channels have no SNR margin, and are out of power range
+			{ChannelID: 3, Snr: 0, Power: 160, Modulation: "QAM4096", Scheme: "OFDM", Locked: false},
+		},
+		UpChannels: []utils.ModemChannel{
+			{ChannelID: 1, Power: 450, Locked: true},
+		},
+	}
+	modem := &fake.Modem{CapabilityList: []utils.Capability{
+		utils.CapDownstreamChannels, utils.CapUpstreamChannels, utils.CapLockStatus, utils.CapCodewords,
+	}}
+	scorer := newHealthScorer(modem, HealthWeights{Lock: 1, SNR: 1, Power: 1}, DefaultMaxUpstreamPower)
+	now := time.Date(2026, 2, 9, 10, 0, 0, 0, time.UTC)
+	scorer.now = func() time.Time { return now }
+
+	score, ok := scorer.observe(stats, true)
+	assert.True(t, ok)
+	assert.InDelta(t, 100*(0.75+0.75+0.75)/3, score, 0.001)
+
+	// 50 uncorrectable errors a minute costs half of the errors component
+	scorer.weights = HealthWeights{Errors: 1}
+	_, ok = scorer.observe(stats, true)
+	assert.False(t, ok, "the error rate should need a previous fetch")
+
+	now = now.Add(2 * time.Minute)
+	stats.DownChannels[0].Postrserr += 100
+	score, ok = scorer.observe(stats, true)
+	assert.True(t, ok)
+	assert.InDelta(t, 50, score, 0.001)
+
+	// A throttled scrape keeps the last error rate
+	now = now.Add(time.Second)
+	score, _ = scorer.observe(stats, false)
+	assert.InDelta(t, 50, score, 0.001)
+
+	// Components the modem cannot report are left out
+	scorer = newHealthScorer(&fake.Modem{CapabilityList: []utils.Capability{utils.CapDownstreamChannels}}, DefaultHealthWeights, DefaultMaxUpstreamPower)
+	score, ok = scorer.observe(stats, true)
+	assert.True(t, ok)
+	assert.InDelta(t, 100*(0.75+0.75)/2, score, 0.001)
+}
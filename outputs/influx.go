@@ -2,23 +2,28 @@ package outputs
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"strconv"
 	"strings"
 
 	"github.com/msh100/modem-stats/utils"
 )
 
-func PrintForInflux(routerStats utils.ModemStats) {
+// PrintForInflux prints the statistics in InfluxDB line protocol. Given a
+// change filter, gauge fields which have not changed are left out, and a line
+// left with no fields is not printed.
+func PrintForInflux(routerStats utils.ModemStats, changes *ChangeFilter) {
+	writeInflux(os.Stdout, routerStats, changes)
+}
+
+func writeInflux(w io.Writer, routerStats utils.ModemStats, changes *ChangeFilter) {
 	for _, downChannel := range routerStats.DownChannels {
 		var keys []string
 		var values []string
 
 		if routerStats.ModemType == utils.TypeVDSL {
 			keys = append(keys, fmt.Sprintf("id=%d", downChannel.ChannelID))
-			values = append(
-				values,
-				fmt.Sprintf("noise=%d", downChannel.Noise),
-				fmt.Sprintf("attenuation=%d", downChannel.Attenuation),
-			)
 		} else {
 			keys = append(
 				keys,
@@ -27,22 +32,28 @@ func PrintForInflux(routerStats utils.ModemStats) {
 				fmt.Sprintf("modulation=%s", downChannel.Modulation),
 				fmt.Sprintf("scheme=%s", downChannel.Scheme),
 			)
+		}
+		series := "downstream," + strings.Join(keys, ",")
+
+		if routerStats.ModemType == utils.TypeVDSL {
+			values = changes.gaugeField(values, series, "noise", float64(downChannel.Noise))
+			values = changes.gaugeField(values, series, "attenuation", float64(downChannel.Attenuation))
+		} else {
+			values = changes.gaugeField(values, series, "frequency", float64(downChannel.Frequency))
+			if downChannel.HasQualityPercent {
+				values = changes.gaugeField(values, series, "quality_percent", downChannel.QualityPercent)
+			} else {
+				values = changes.gaugeField(values, series, "snr", float64(downChannel.Snr))
+			}
+			values = changes.gaugeField(values, series, "power", float64(downChannel.Power))
 			values = append(
 				values,
-				fmt.Sprintf("frequency=%d", downChannel.Frequency),
-				fmt.Sprintf("snr=%d", downChannel.Snr),
-				fmt.Sprintf("power=%d", downChannel.Power),
 				fmt.Sprintf("prerserr=%d", downChannel.Prerserr),
 				fmt.Sprintf("postrserr=%d", downChannel.Postrserr),
 			)
 		}
 
-		output := fmt.Sprintf(
-			"downstream,%s %s",
-			strings.Join(keys, ","),
-			strings.Join(values, ","),
-		)
-		fmt.Println(output)
+		printInfluxLine(w, series, values)
 	}
 	for _, upChannel := range routerStats.UpChannels {
 		var keys []string
@@ -50,46 +61,51 @@ func PrintForInflux(routerStats utils.ModemStats) {
 
 		if routerStats.ModemType == utils.TypeVDSL {
 			keys = append(keys, fmt.Sprintf("id=%d", upChannel.ChannelID))
-			values = append(
-				values,
-				fmt.Sprintf("noise=%d", upChannel.Noise),
-				fmt.Sprintf("attenuation=%d", upChannel.Attenuation),
-			)
 		} else {
 			keys = append(
 				keys,
 				fmt.Sprintf("channel=%d", upChannel.Channel),
 				fmt.Sprintf("id=%d", upChannel.ChannelID),
 			)
-			values = append(
-				values,
-				fmt.Sprintf("frequency=%d", upChannel.Frequency),
-				fmt.Sprintf("power=%d", upChannel.Power),
-			)
 		}
+		series := "upstream," + strings.Join(keys, ",")
 
-		output := fmt.Sprintf(
-			"upstream,%s %s",
-			strings.Join(keys, ","),
-			strings.Join(values, ","),
-		)
-		fmt.Println(output)
+		if routerStats.ModemType == utils.TypeVDSL {
+			values = changes.gaugeField(values, series, "noise", float64(upChannel.Noise))
+			values = changes.gaugeField(values, series, "attenuation", float64(upChannel.Attenuation))
+		} else {
+			values = changes.gaugeField(values, series, "frequency", float64(upChannel.Frequency))
+			values = changes.gaugeField(values, series, "power", float64(upChannel.Power))
+		}
+
+		printInfluxLine(w, series, values)
 	}
 	for _, config := range routerStats.Configs {
-		values := []string{
-			fmt.Sprintf("maxrate=%d", config.Maxrate),
-		}
+		series := "config,config=" + config.Config
+		values := changes.gaugeField(nil, series, "maxrate", float64(config.Maxrate))
 		if config.Maxburst != 0 {
-			values = append(values, fmt.Sprintf("maxburst=%d", config.Maxburst))
+			values = changes.gaugeField(values, series, "maxburst", float64(config.Maxburst))
 		}
 
-		output := fmt.Sprintf(
-			"config,config=%s %s",
-			config.Config,
-			strings.Join(values, ","),
-		)
-		fmt.Println(output)
+		printInfluxLine(w, series, values)
 	}
 
-	fmt.Println(fmt.Sprintf("shstatsinfo timems=%d", routerStats.FetchTime))
+	fmt.Fprintf(w, "shstatsinfo timems=%d\n", routerStats.FetchTime)
+}
+
+// gaugeField appends a gauge field to a line's fields, unless it has not
+// changed since it was last sent. A nil filter appends every field.
+func (f *ChangeFilter) gaugeField(values []string, series, field string, value float64) []string {
+	if f != nil && !f.changed(series+" "+field, value) {
+		return values
+	}
+	return append(values, fmt.Sprintf("%s=%s", field, strconv.FormatFloat(value, 'f', -1, 64)))
+}
+
+// printInfluxLine prints a line of the series' fields, if it has any
+func printInfluxLine(w io.Writer, series string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s %s\n", series, strings.Join(values, ","))
 }
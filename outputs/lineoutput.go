@@ -0,0 +1,245 @@
+package outputs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/msh100/modem-stats/utils"
+	"github.com/msh100/modem-stats/utils/logging"
+)
+
+// LineRecord is what a line template is applied to: a downstream or upstream
+// channel, a service flow config, or (once per scrape) the modem's statistics
+// as a whole
+type LineRecord struct {
+	Kind    string // "downstream", "upstream", "config" or "stats"
+	Channel utils.ModemChannel
+	Config  utils.ModemConfig
+	Stats   utils.ModemStats
+
+	// Labels of the modem, as given for multiple modems
+	Labels map[string]string
+
+	// Time of the scrape, and the same in Unix seconds
+	Time      time.Time
+	Timestamp int64
+}
+
+// lineTemplateFuncs are available to line templates
+var lineTemplateFuncs = template.FuncMap{
+	// tenths converts a value in tenths (such as a channel's power) to units
+	"tenths": func(value int) float64 {
+		return float64(value) / 10
+	},
+	// counter marks a value as a counter's, whose line is always sent when
+	// only changed values are
+	"counter": func(value interface{}) string {
+		return counterMarker + fmt.Sprint(value)
+	},
+	// sanitize makes a value safe as a Graphite path or StatsD name segment
+	"sanitize": func(value string) string {
+		return strings.Map(func(r rune) rune {
+			if r == '.' || r == ' ' || r == ':' || r == '|' || r == '/' {
+				return '_'
+			}
+			return r
+		}, value)
+	},
+}
+
+// ParseLineTemplate parses a line template, which is applied to each
+// LineRecord of a scrape. Blank lines in its output are dropped, so a template
+// can produce nothing for the records it is not interested in.
+func ParseLineTemplate(text string) (*template.Template, error) {
+	return template.New("line").Funcs(lineTemplateFuncs).Parse(text)
+}
+
+// lineSinkSchemes are the supported sinks for rendered lines
+var lineSinkSchemes = []string{"tcp", "udp", "file"}
+
+// ParseLineSink checks a line sink, given as tcp://host:port,
+// udp://host:port or file:///path
+func ParseLineSink(sink string) (*url.URL, error) {
+	u, err := url.Parse(sink)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "tcp", "udp":
+		if u.Host == "" {
+			return nil, fmt.Errorf("%s sink %q has no host", u.Scheme, sink)
+		}
+	case "file":
+		if u.Path == "" {
+			return nil, fmt.Errorf("file sink %q has no path", sink)
+		}
+	default:
+		return nil, fmt.Errorf("sink %q must be one of %s", sink, strings.Join(lineSinkSchemes, ", "))
+	}
+	return u, nil
+}
+
+// LineWriter renders a modem's statistics through a template and writes the
+// lines to a TCP, UDP or file sink, which covers Graphite, StatsD and custom
+// formats with one output
+type LineWriter struct {
+	exporter *PrometheusExporter
+	labels   map[string]string
+	template *template.Template
+	sink     *url.URL
+
+	// Filters out unchanged gauges when only changed values are sent
+	changes *ChangeFilter
+
+	// stop is closed to stop pushing, nil until started
+	stop chan struct{}
+}
+
+// NewLineWriter creates a line writer for the modem, whose labels are passed
+// to the template. Its statistics are read through the modem's exporter, so
+// the modem is only fetched from through the exporter's throttle.
+func NewLineWriter(exporter *PrometheusExporter, labels map[string]string, tmpl *template.Template, sink string) (*LineWriter, error) {
+	u, err := ParseLineSink(sink)
+	if err != nil {
+		return nil, err
+	}
+	return &LineWriter{
+		exporter: exporter,
+		labels:   labels,
+		template: tmpl,
+		sink:     u,
+	}, nil
+}
+
+// SetChangedOnly sends each gauge only when it has moved by more than epsilon
+// since it was last sent. Counters, marked in the template with counter, are
+// always sent.
+func (w *LineWriter) SetChangedOnly(epsilon float64) {
+	w.changes = NewChangeFilter(epsilon)
+}
+
+// render applies the template to each record of a scrape and returns the
+// non-blank lines
+func (w *LineWriter) render(stats utils.ModemStats, now time.Time) ([]string, error) {
+	base := LineRecord{Stats: stats, Labels: w.labels, Time: now, Timestamp: now.Unix()}
+
+	var records []LineRecord
+	for _, channel := range stats.DownChannels {
+		record := base
+		record.Kind = "downstream"
+		record.Channel = channel
+		records = append(records, record)
+	}
+	for _, channel := range stats.UpChannels {
+		record := base
+		record.Kind = "upstream"
+		record.Channel = channel
+		records = append(records, record)
+	}
+	for _, config := range stats.Configs {
+		record := base
+		record.Kind = "config"
+		record.Config = config
+		records = append(records, record)
+	}
+	record := base
+	record.Kind = "stats"
+	records = append(records, record)
+
+	var lines []string
+	for _, record := range records {
+		var out bytes.Buffer
+		if err := w.template.Execute(&out, record); err != nil {
+			return nil, fmt.Errorf("failed to render %s line: %w", record.Kind, err)
+		}
+		for _, line := range strings.Split(out.String(), "\n") {
+			if strings.TrimSpace(line) != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+	return lines, nil
+}
+
+// openSink connects to (or opens) the sink for a push
+func (w *LineWriter) openSink() (io.WriteCloser, error) {
+	if w.sink.Scheme == "file" {
+		return os.OpenFile(w.sink.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	}
+	return net.DialTimeout(w.sink.Scheme, w.sink.Host, 10*time.Second)
+}
+
+// Push scrapes the modem and writes the rendered lines to the sink. Each line
+// is written separately, so each is its own UDP datagram.
+func (w *LineWriter) Push() error {
+	stats, _, err := w.exporter.throttle.peek()
+	if err != nil {
+		return fmt.Errorf("failed to fetch stats: %w", err)
+	}
+
+	lines, err := w.render(stats, time.Now())
+	if err != nil {
+		return err
+	}
+	lines = w.changes.filterLines(lines)
+	if len(lines) == 0 {
+		return nil
+	}
+
+	sink, err := w.openSink()
+	if err != nil {
+		return fmt.Errorf("failed to open sink: %w", err)
+	}
+	defer sink.Close()
+
+	for _, line := range lines {
+		if _, err := io.WriteString(sink, line+"\n"); err != nil {
+			return fmt.Errorf("failed to write to sink: %w", err)
+		}
+	}
+	return nil
+}
+
+// StartPushing starts a background goroutine that pushes lines at the given
+// interval, until stopped
+func (w *LineWriter) StartPushing(interval time.Duration) {
+	w.stop = make(chan struct{})
+	stop := w.stop
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// Initial push
+		if err := w.Push(); err != nil {
+			logging.Errorf("Error writing lines to %s: %v", w.sink, err)
+		}
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := w.Push(); err != nil {
+					logging.Errorf("Error writing lines to %s: %v", w.sink, err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops pushing started by StartPushing, such as when the modem is
+// removed
+func (w *LineWriter) Stop() {
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+}
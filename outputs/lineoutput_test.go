@@ -0,0 +1,126 @@
+package outputs
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/msh100/modem-stats/modems/fake"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const graphiteTemplate = `{{ if eq .Kind "downstream" -}}
+{{ .Labels.site }}.downstream.{{ .Channel.ChannelID }}.power {{ tenths .Channel.Power }} {{ .Timestamp }}
+{{ .Labels.site }}.downstream.{{ .Channel.ChannelID }}.snr {{ tenths .Channel.Snr }} {{ .Timestamp }}
+{{- else if eq .Kind "config" -}}
+{{ .Labels.site }}.config.{{ sanitize .Config.Config }}.maxrate {{ .Config.Maxrate }} {{ .Timestamp }}
+{{- end }}`
+
+func lineTestModem() *fake.Modem {
+	return &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			{ChannelID: 3, Frequency: 331000000, Power: 41, Snr: 403},
+			{ChannelID: 4, Frequency: 339000000, Power: -12, Snr: 398},
+		},
+		UpChannels: []utils.ModemChannel{{ChannelID: 1, Power: 445}},
+		Configs:    []utils.ModemConfig{{Config: "down stream", Maxrate: 1100000000}},
+	}}
+}
+
+func TestLineWriter_Render(t *testing.T) {
+	tmpl, err := ParseLineTemplate(graphiteTemplate)
+	require.NoError(t, err)
+	writer, err := NewLineWriter(ProExporter(lineTestModem()), map[string]string{"site": "home"}, tmpl, "tcp://graphite:2003")
+	require.NoError(t, err)
+
+	lines, err := writer.render(lineTestModem().Stats, time.Unix(1700000000, 0))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"home.downstream.3.power 4.1 1700000000",
+		"home.downstream.3.snr 40.3 1700000000",
+		"home.downstream.4.power -1.2 1700000000",
+		"home.downstream.4.snr 39.8 1700000000",
+		"home.config.down_stream.maxrate 1100000000 1700000000",
+	}, lines)
+}
+
+func TestLineWriter_PushFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "modem.log")
+	tmpl, err := ParseLineTemplate(`{{ if eq .Kind "upstream" }}up.{{ .Channel.ChannelID }} {{ tenths .Channel.Power }}{{ end }}`)
+	require.NoError(t, err)
+	writer, err := NewLineWriter(ProExporter(lineTestModem()), nil, tmpl, "file://"+path)
+	require.NoError(t, err)
+
+	require.NoError(t, writer.Push())
+	require.NoError(t, writer.Push())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "up.1 44.5\nup.1 44.5\n", string(data), "lines should be appended on each push")
+}
+
+func TestLineWriter_PushTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var lines []string
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		received <- lines
+	}()
+
+	tmpl, err := ParseLineTemplate(`{{ if eq .Kind "stats" }}modem.downstream_channels {{ len .Stats.DownChannels }}{{ end }}`)
+	require.NoError(t, err)
+	writer, err := NewLineWriter(ProExporter(lineTestModem()), nil, tmpl, "tcp://"+listener.Addr().String())
+	require.NoError(t, err)
+	require.NoError(t, writer.Push())
+
+	select {
+	case lines := <-received:
+		assert.Equal(t, []string{"modem.downstream_channels 2"}, lines)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for lines")
+	}
+}
+
+func TestLineWriter_SharesThrottle(t *testing.T) {
+	modem := lineTestModem()
+	exporter := ProExporter(modem, WithMinScrapeInterval(time.Minute))
+	tmpl, err := ParseLineTemplate(`{{ if eq .Kind "stats" }}modem.downstream_channels {{ len .Stats.DownChannels }}{{ end }}`)
+	require.NoError(t, err)
+	writer, err := NewLineWriter(exporter, nil, tmpl, "file://"+filepath.Join(t.TempDir(), "modem.log"))
+	require.NoError(t, err)
+
+	// Lines are read through the exporter's throttle, so a scrape within the
+	// interval of a push is served its fetch
+	require.NoError(t, writer.Push())
+	testutil.CollectAndCount(exporter)
+	assert.Equal(t, 1, modem.ParseCalls())
+}
+
+func TestParseLineSink(t *testing.T) {
+	for _, sink := range []string{"tcp://graphite:2003", "udp://statsd:8125", "file:///var/log/modem.log"} {
+		_, err := ParseLineSink(sink)
+		assert.NoError(t, err, sink)
+	}
+	for _, sink := range []string{"graphite:2003", "http://graphite:2003", "udp://", "file://"} {
+		_, err := ParseLineSink(sink)
+		assert.Error(t, err, sink)
+	}
+}
@@ -2,25 +2,115 @@ package outputs
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"unicode"
 
+	"github.com/golang/snappy"
 	"github.com/msh100/modem-stats/utils"
+	"github.com/msh100/modem-stats/utils/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
 )
 
-// LokiExporter pushes log entries to a Loki endpoint
+// DefaultLokiMaxAge matches Loki's common reject_old_samples_max_age of 1 week
+const DefaultLokiMaxAge = 7 * 24 * time.Hour
+
+// DefaultLokiMaxPending is how many entries which failed to push are kept to
+// be retried, a few days of a busy modem's event log
+const DefaultLokiMaxPending = 1000
+
+// Encodings of the body of a Loki push, sent as its Content-Encoding. Loki
+// only accepts snappy for protobuf pushes, so snappy pushes are sent as a
+// protobuf PushRequest rather than JSON.
+const (
+	LokiEncodingNone   = "none"
+	LokiEncodingGzip   = "gzip"
+	LokiEncodingSnappy = "snappy"
+)
+
+// LokiEncodings lists the supported encodings
+var LokiEncodings = []string{LokiEncodingNone, LokiEncodingGzip, LokiEncodingSnappy}
+
+// IsKnownLokiEncoding reports whether a push encoding is supported
+func IsKnownLokiEncoding(encoding string) bool {
+	for _, e := range LokiEncodings {
+		if e == encoding {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	lokiSeenEntries = prometheus.NewDesc(
+		"modemstats_loki_seen_entries",
+		"Number of event log entries remembered so they are not pushed to Loki twice",
+		nil, nil,
+	)
+	lokiPendingEntries = prometheus.NewDesc(
+		"modemstats_loki_pending_entries",
+		"Number of event log entries which failed to push to Loki and are waiting to be retried",
+		nil, nil,
+	)
+)
+
+// LabelSanitizer rewrites a stream label so that Loki will accept it
+type LabelSanitizer func(name, value string) (string, string)
+
+// lokiEndpointBackoff is how long a Loki endpoint which failed a push is
+// tried after the others
+const lokiEndpointBackoff = 5 * time.Minute
+
+// LokiExporter pushes log entries to a Loki endpoint, failing over to the next
+// endpoint when one is down
 type LokiExporter struct {
-	endpoint    string
+	endpoints   []*lokiEndpoint
+	endpointsMu sync.Mutex
 	client      *http.Client
 	seenLogs    map[string]bool
 	seenLogsMu  sync.RWMutex
 	labels      map[string]string
 	logProvider utils.EventLogProvider
+	maxAge      time.Duration
+	encoding    string
+
+	// Entries which failed to push, retried until Loki accepts them even if
+	// they have since rolled off the modem's event log
+	pending    []utils.EventLogEntry
+	maxPending int
+
+	sanitizeLabel   LabelSanitizer
+	rewrittenLabels map[string]bool
+
+	// Reboot handling; lastEntries is the most recently pushed event log
+	rebootDetector utils.RebootDetector
+	rebootPending  bool
+	lastEntries    []utils.EventLogEntry
+
+	// The size and duration of each push, to size batches and diagnose a
+	// slow Loki
+	pushBytes    prometheus.Histogram
+	pushDuration prometheus.Histogram
+
+	// cancel stops polling, nil until started
+	cancel context.CancelFunc
+}
+
+// lokiEndpoint is a Loki push API URL and, after a failed push, the time
+// until which it is passed over in favour of the other endpoints
+type lokiEndpoint struct {
+	url       string
+	downUntil time.Time
 }
 
 // lokiPushRequest represents the Loki push API request format
@@ -33,8 +123,9 @@ type lokiStream struct {
 	Values [][]string        `json:"values"`
 }
 
-// NewLokiExporter creates a new Loki exporter
-func NewLokiExporter(endpoint string, logProvider utils.EventLogProvider, labels map[string]string) *LokiExporter {
+// NewLokiExporter creates a new Loki exporter. Each push is sent to the first
+// of the endpoints to accept it, so later endpoints act as failovers.
+func NewLokiExporter(endpoints []string, logProvider utils.EventLogProvider, labels map[string]string) *LokiExporter {
 	if labels == nil {
 		labels = make(map[string]string)
 	}
@@ -42,37 +133,289 @@ func NewLokiExporter(endpoint string, logProvider utils.EventLogProvider, labels
 		labels["job"] = "modem-stats"
 	}
 
+	lokiEndpoints := make([]*lokiEndpoint, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		lokiEndpoints = append(lokiEndpoints, &lokiEndpoint{url: endpoint})
+	}
+
 	return &LokiExporter{
-		endpoint:    endpoint,
+		endpoints:   lokiEndpoints,
 		client:      &http.Client{Timeout: 10 * time.Second},
 		seenLogs:    make(map[string]bool),
 		labels:      labels,
 		logProvider: logProvider,
+		maxAge:      DefaultLokiMaxAge,
+		maxPending:  DefaultLokiMaxPending,
+		encoding:    LokiEncodingGzip,
+
+		sanitizeLabel:   SanitizeLokiLabel,
+		rewrittenLabels: make(map[string]bool),
+
+		pushBytes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "modemstats_loki_push_bytes",
+			Help:    "Size of the requests pushing event log entries to Loki in bytes",
+			Buckets: prometheus.ExponentialBuckets(256, 4, 8),
+		}),
+		pushDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "modemstats_loki_push_duration_seconds",
+			Help:    "Time taken pushing event log entries to Loki, including failing over between endpoints",
+			Buckets: prometheus.DefBuckets,
+		}),
 	}
 }
 
+// Describe implements prometheus.Collector, so the size of the exporter's
+// dedup cache and retry buffer, and its pushes, can be monitored
+func (l *LokiExporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lokiSeenEntries
+	ch <- lokiPendingEntries
+	l.pushBytes.Describe(ch)
+	l.pushDuration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (l *LokiExporter) Collect(ch chan<- prometheus.Metric) {
+	l.seenLogsMu.RLock()
+	seen, pending := len(l.seenLogs), len(l.pending)
+	l.seenLogsMu.RUnlock()
+
+	ch <- prometheus.MustNewConstMetric(lokiSeenEntries, prometheus.GaugeValue, float64(seen))
+	ch <- prometheus.MustNewConstMetric(lokiPendingEntries, prometheus.GaugeValue, float64(pending))
+	l.pushBytes.Collect(ch)
+	l.pushDuration.Collect(ch)
+}
+
+// SetLabelSanitizer replaces the function used to sanitize stream labels
+// before pushing. A nil sanitizer sends labels unmodified.
+func (l *LokiExporter) SetLabelSanitizer(sanitizer LabelSanitizer) {
+	l.sanitizeLabel = sanitizer
+}
+
+// SanitizeLokiLabel makes a label name valid for Loki by replacing characters
+// outside [a-zA-Z0-9_] with underscores and prefixing names that start with a
+// digit. Whitespace and control characters in the value are replaced too.
+func SanitizeLokiLabel(name, value string) (string, string) {
+	name = strings.Map(func(r rune) rune {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(value))
+
+	return name, value
+}
+
+// streamLabels builds the sanitized label set for a stream, logging each
+// label rewrite the first time it happens
+func (l *LokiExporter) streamLabels(priority string) map[string]string {
+	raw := make(map[string]string)
+	for k, v := range l.labels {
+		raw[k] = v
+	}
+	raw["level"] = priority
+
+	if l.sanitizeLabel == nil {
+		return raw
+	}
+
+	labels := make(map[string]string)
+	for k, v := range raw {
+		name, value := l.sanitizeLabel(k, v)
+		if name != k || value != v {
+			key := k + "=" + v
+			if !l.rewrittenLabels[key] {
+				l.rewrittenLabels[key] = true
+				logging.Infof("Rewrote Loki label %s=%q as %s=%q", k, v, name, value)
+			}
+		}
+		labels[name] = value
+	}
+	return labels
+}
+
+// SetMaxAge sets the age beyond which entries are not pushed, matching Loki's
+// reject_old_samples_max_age. A zero duration pushes entries of any age.
+func (l *LokiExporter) SetMaxAge(maxAge time.Duration) {
+	l.maxAge = maxAge
+}
+
+// SetEncoding sets how the body of each push is encoded, one of
+// LokiEncodings (gzip by default)
+func (l *LokiExporter) SetEncoding(encoding string) {
+	l.encoding = encoding
+}
+
+// SetMaxPending sets how many entries which failed to push are kept to be
+// retried. The oldest are dropped beyond this.
+func (l *LokiExporter) SetMaxPending(maxPending int) {
+	l.seenLogsMu.Lock()
+	defer l.seenLogsMu.Unlock()
+	l.maxPending = maxPending
+}
+
 // logKey generates a unique key for a log entry to track duplicates
-func (l *LokiExporter) logKey(entry utils.EventLogEntry) string {
+func logKey(entry utils.EventLogEntry) string {
 	return fmt.Sprintf("%s|%s|%s", entry.Timestamp, entry.Priority, entry.Message)
 }
 
+// NotifyReboot signals that the modem has rebooted. On the next push the
+// deduplication window is reset so that post-reboot events which reuse the
+// timestamps and messages of earlier events are not suppressed.
+func (l *LokiExporter) NotifyReboot() {
+	l.seenLogsMu.Lock()
+	l.rebootPending = true
+	l.seenLogsMu.Unlock()
+}
+
+// checkReboot uses the modem's uptime, where available, to detect reboots
+func (l *LokiExporter) checkReboot() {
+	uptimeProvider, ok := l.logProvider.(utils.UptimeProvider)
+	if !ok {
+		return
+	}
+
+	uptime, err := uptimeProvider.FetchUptime()
+	if err != nil {
+		logging.Warnf("Failed to fetch modem uptime: %v", err)
+		return
+	}
+
+	if l.rebootDetector.Observe(uptime) {
+		logging.Infof("Modem reboot detected, resetting Loki log deduplication")
+		l.NotifyReboot()
+	}
+}
+
+// retainedEntries returns how many leading entries of current are carried
+// over from previous, allowing for the oldest entries having rolled off
+func retainedEntries(previous, current []utils.EventLogEntry) int {
+	for start := range previous {
+		tail := previous[start:]
+		if len(tail) > len(current) {
+			continue
+		}
+
+		match := true
+		for i := range tail {
+			if tail[i] != current[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return len(tail)
+		}
+	}
+	return 0
+}
+
 // PushLogs fetches new logs and pushes them to Loki
 func (l *LokiExporter) PushLogs() error {
+	l.checkReboot()
+
 	entries, err := l.logProvider.FetchEventLog()
 	if err != nil {
 		return fmt.Errorf("failed to fetch event log: %w", err)
 	}
 
-	// Filter to only new entries
 	var newEntries []utils.EventLogEntry
-	l.seenLogsMu.RLock()
-	for _, entry := range entries {
-		key := l.logKey(entry)
-		if !l.seenLogs[key] {
-			newEntries = append(newEntries, entry)
+	l.seenLogsMu.Lock()
+	if l.rebootPending {
+		// Start a fresh deduplication window. Entries retained from before
+		// the reboot stay suppressed, everything after them is new even if
+		// its key was seen before the reboot.
+		retained := retainedEntries(l.lastEntries, entries)
+		l.seenLogs = make(map[string]bool)
+		for _, entry := range entries[:retained] {
+			l.seenLogs[logKey(entry)] = true
+		}
+		newEntries = append(newEntries, entries[retained:]...)
+	} else {
+		// Filter to only new entries
+		for _, entry := range entries {
+			key := logKey(entry)
+			if !l.seenLogs[key] {
+				newEntries = append(newEntries, entry)
+			}
 		}
 	}
-	l.seenLogsMu.RUnlock()
+	newEntries = l.withPending(newEntries)
+	l.seenLogsMu.Unlock()
+
+	if err := l.push(newEntries); err != nil {
+		l.addPending(newEntries)
+		return err
+	}
+
+	// Mark entries as seen after successful push
+	l.markPushed(entries, newEntries)
+	return nil
+}
+
+// withPending returns the entries which failed to push before followed by
+// those of newEntries which are not among them. The caller holds seenLogsMu.
+func (l *LokiExporter) withPending(newEntries []utils.EventLogEntry) []utils.EventLogEntry {
+	if len(l.pending) == 0 {
+		return newEntries
+	}
+
+	pending := make(map[string]bool, len(l.pending))
+	entries := append([]utils.EventLogEntry{}, l.pending...)
+	for _, entry := range l.pending {
+		pending[logKey(entry)] = true
+	}
+	for _, entry := range newEntries {
+		if !pending[logKey(entry)] {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// addPending keeps entries which failed to push to be retried, replacing
+// those already pending (which the entries include), dropping the oldest
+// beyond the maximum
+func (l *LokiExporter) addPending(entries []utils.EventLogEntry) {
+	l.seenLogsMu.Lock()
+	defer l.seenLogsMu.Unlock()
+
+	l.pending = l.withPending(entries)
+	if dropped := len(l.pending) - l.maxPending; dropped > 0 {
+		logging.Warnf("Dropped %d log entries which could not be pushed to Loki", dropped)
+		l.pending = append([]utils.EventLogEntry{}, l.pending[dropped:]...)
+	}
+}
+
+// push sends entries to Loki, dropping those older than the max age
+func (l *LokiExporter) push(newEntries []utils.EventLogEntry) error {
+	// Loki rejects the whole push if any entry is older than its max age, so
+	// expired entries are dropped here but still remembered as seen
+	if l.maxAge > 0 {
+		cutoff := time.Now().Add(-l.maxAge)
+		var recentEntries, expiredEntries []utils.EventLogEntry
+		for _, entry := range newEntries {
+			if entryTime(entry).Before(cutoff) {
+				expiredEntries = append(expiredEntries, entry)
+			} else {
+				recentEntries = append(recentEntries, entry)
+			}
+		}
+		if len(expiredEntries) > 0 {
+			l.markSeen(expiredEntries)
+			logging.Infof("Skipped %d log entries older than %v", len(expiredEntries), l.maxAge)
+		}
+		newEntries = recentEntries
+	}
 
 	if len(newEntries) == 0 {
 		return nil
@@ -81,11 +424,7 @@ func (l *LokiExporter) PushLogs() error {
 	// Group entries by priority (creates separate streams per priority level)
 	streams := make(map[string][][]string)
 	for _, entry := range newEntries {
-		ts, err := time.Parse(time.RFC3339, entry.Timestamp)
-		if err != nil {
-			// If parsing fails, use current time
-			ts = time.Now()
-		}
+		ts := entryTime(entry)
 
 		// Loki expects nanosecond timestamps as strings
 		tsNano := fmt.Sprintf("%d", ts.UnixNano())
@@ -95,11 +434,7 @@ func (l *LokiExporter) PushLogs() error {
 	// Build Loki push request
 	var lokiStreams []lokiStream
 	for priority, values := range streams {
-		labels := make(map[string]string)
-		for k, v := range l.labels {
-			labels[k] = v
-		}
-		labels["level"] = priority
+		labels := l.streamLabels(priority)
 
 		// Sort values by timestamp (oldest first)
 		sort.Slice(values, func(i, j int) bool {
@@ -113,12 +448,164 @@ func (l *LokiExporter) PushLogs() error {
 	}
 
 	req := lokiPushRequest{Streams: lokiStreams}
+	body, err := encodeLokiBody(l.encoding, req)
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	err = l.send(body)
+	l.pushBytes.Observe(float64(len(body)))
+	l.pushDuration.Observe(time.Since(started).Seconds())
+	if err != nil {
+		return err
+	}
+
+	logging.Infof("Pushed %d log entries to Loki", len(newEntries))
+	return nil
+}
+
+// send posts a push request to each endpoint in turn until one accepts it.
+// Endpoints which failed recently are tried last, so a dead primary is not
+// waited on for every push, and are tried first again once they recover.
+func (l *LokiExporter) send(body []byte) error {
+	l.endpointsMu.Lock()
+	defer l.endpointsMu.Unlock()
+
+	now := time.Now()
+	var healthy, down []*lokiEndpoint
+	for _, endpoint := range l.endpoints {
+		if now.Before(endpoint.downUntil) {
+			down = append(down, endpoint)
+		} else {
+			healthy = append(healthy, endpoint)
+		}
+	}
+
+	var errs []string
+	var lastErr error
+	for _, endpoint := range append(healthy, down...) {
+		lastErr = l.post(endpoint.url, body)
+		if lastErr == nil {
+			endpoint.downUntil = time.Time{}
+			return nil
+		}
+		if len(l.endpoints) > 1 {
+			logging.Warnf("Failed to push to Loki endpoint %s: %v", endpoint.url, lastErr)
+		}
+		endpoint.downUntil = now.Add(lokiEndpointBackoff)
+		errs = append(errs, fmt.Sprintf("%s: %v", endpoint.url, lastErr))
+	}
+
+	if len(errs) == 0 {
+		return errors.New("no loki endpoints configured")
+	}
+	if len(errs) == 1 {
+		return lastErr
+	}
+	return fmt.Errorf("all %d loki endpoints failed: %s", len(errs), strings.Join(errs, "; "))
+}
+
+// encodeLokiBody encodes the body of a push, as JSON unless it is snappy
+// compressed protobuf
+func encodeLokiBody(encoding string, req lokiPushRequest) ([]byte, error) {
+	if encoding == LokiEncodingSnappy {
+		body, err := encodeLokiProto(req)
+		if err != nil {
+			return nil, err
+		}
+		return snappy.Encode(nil, body), nil
+	}
+
 	body, err := json.Marshal(req)
 	if err != nil {
-		return fmt.Errorf("failed to marshal loki request: %w", err)
+		return nil, fmt.Errorf("failed to marshal loki request: %w", err)
+	}
+	switch encoding {
+	case LokiEncodingGzip:
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(body); err != nil {
+			return nil, fmt.Errorf("failed to gzip loki request: %w", err)
+		}
+		if err := writer.Close(); err != nil {
+			return nil, fmt.Errorf("failed to gzip loki request: %w", err)
+		}
+		return buf.Bytes(), nil
+	default:
+		return body, nil
+	}
+}
+
+// encodeLokiProto serializes a push request as a logproto.PushRequest message
+func encodeLokiProto(req lokiPushRequest) ([]byte, error) {
+	var request []byte
+	for _, stream := range req.Streams {
+		var streamMsg []byte
+		streamMsg = protowire.AppendTag(streamMsg, 1, protowire.BytesType)
+		streamMsg = protowire.AppendString(streamMsg, lokiLabelsString(stream.Stream))
+
+		for _, value := range stream.Values {
+			nanos, err := strconv.ParseInt(value[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode loki request: %w", err)
+			}
+			ts := time.Unix(0, nanos)
+
+			var timestamp []byte
+			timestamp = protowire.AppendTag(timestamp, 1, protowire.VarintType)
+			timestamp = protowire.AppendVarint(timestamp, uint64(ts.Unix()))
+			timestamp = protowire.AppendTag(timestamp, 2, protowire.VarintType)
+			timestamp = protowire.AppendVarint(timestamp, uint64(ts.Nanosecond()))
+
+			var entry []byte
+			entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+			entry = protowire.AppendBytes(entry, timestamp)
+			entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+			entry = protowire.AppendString(entry, value[1])
+
+			streamMsg = protowire.AppendTag(streamMsg, 2, protowire.BytesType)
+			streamMsg = protowire.AppendBytes(streamMsg, entry)
+		}
+
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, streamMsg)
+	}
+	return request, nil
+}
+
+// lokiLabelsString formats stream labels as a Prometheus label set, which is
+// how protobuf pushes carry them
+func lokiLabelsString(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	resp, err := l.client.Post(l.endpoint, "application/json", bytes.NewReader(body))
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+strconv.Quote(labels[name]))
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// post sends a push request to a single endpoint
+func (l *LokiExporter) post(endpoint string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to push to loki: %w", err)
+	}
+	if l.encoding == LokiEncodingSnappy {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if l.encoding != "" && l.encoding != LokiEncodingNone {
+		req.Header.Set("Content-Encoding", l.encoding)
+	}
+
+	resp, err := l.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to push to loki: %w", err)
 	}
@@ -127,33 +614,145 @@ func (l *LokiExporter) PushLogs() error {
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		return fmt.Errorf("loki returned status %d", resp.StatusCode)
 	}
+	return nil
+}
 
-	// Mark entries as seen after successful push
+// pushStreamed pushes an entry received from a streaming modem, unless it
+// has already been pushed
+func (l *LokiExporter) pushStreamed(entry utils.EventLogEntry) error {
+	l.seenLogsMu.RLock()
+	seen := l.seenLogs[logKey(entry)]
+	l.seenLogsMu.RUnlock()
+	if seen {
+		return nil
+	}
+
+	entries := []utils.EventLogEntry{entry}
+	if err := l.push(entries); err != nil {
+		l.addPending(entries)
+		return err
+	}
+	l.markSeen(entries)
+	return nil
+}
+
+// entryTime parses a log entry's timestamp, falling back to the current time
+func entryTime(entry utils.EventLogEntry) time.Time {
+	ts, err := time.Parse(time.RFC3339, entry.Timestamp)
+	if err != nil {
+		return time.Now()
+	}
+	return ts
+}
+
+// markSeen records entries as seen without pushing them
+func (l *LokiExporter) markSeen(entries []utils.EventLogEntry) {
 	l.seenLogsMu.Lock()
+	defer l.seenLogsMu.Unlock()
+
+	for _, entry := range entries {
+		l.seenLogs[logKey(entry)] = true
+	}
+	l.dropSeenPending()
+}
+
+// markPushed records a successfully pushed event log, marking the new
+// entries as seen and completing any pending reboot reset
+func (l *LokiExporter) markPushed(entries, newEntries []utils.EventLogEntry) {
+	l.seenLogsMu.Lock()
+	defer l.seenLogsMu.Unlock()
+
 	for _, entry := range newEntries {
-		l.seenLogs[l.logKey(entry)] = true
+		l.seenLogs[logKey(entry)] = true
 	}
-	l.seenLogsMu.Unlock()
+	l.dropSeenPending()
+	l.lastEntries = entries
+	l.rebootPending = false
+}
 
-	log.Printf("Pushed %d log entries to Loki", len(newEntries))
-	return nil
+// dropSeenPending stops retrying pending entries which have since been
+// pushed. The caller holds seenLogsMu.
+func (l *LokiExporter) dropSeenPending() {
+	var pending []utils.EventLogEntry
+	for _, entry := range l.pending {
+		if !l.seenLogs[logKey(entry)] {
+			pending = append(pending, entry)
+		}
+	}
+	l.pending = pending
 }
 
-// StartPolling starts a background goroutine that polls for logs at the given interval
+// StartPolling starts a background goroutine that polls for logs at the given
+// interval. Modems which can stream their event log have entries pushed as
+// they arrive instead, falling back to polling if streaming is unsupported.
 func (l *LokiExporter) StartPolling(interval time.Duration) {
-	go func() {
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	if streamer, ok := l.logProvider.(utils.EventLogStreamer); ok {
+		go l.stream(ctx, streamer, interval)
+		return
+	}
+
+	go l.poll(ctx, interval)
+}
+
+// Stop stops polling started by StartPolling, such as when the modem is
+// removed
+func (l *LokiExporter) Stop() {
+	if l.cancel != nil {
+		l.cancel()
+	}
+}
+
+func (l *LokiExporter) poll(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Initial push
+	if err := l.PushLogs(); err != nil {
+		logging.Errorf("Error pushing logs to Loki: %v", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.PushLogs(); err != nil {
+				logging.Errorf("Error pushing logs to Loki: %v", err)
+			}
+		}
+	}
+}
 
-		// Initial push
+// stream pushes entries as the modem streams them. The full event log is
+// pushed before each connection to catch up on anything missed, and a broken
+// stream is reconnected after the poll interval.
+func (l *LokiExporter) stream(ctx context.Context, streamer utils.EventLogStreamer, interval time.Duration) {
+	for {
 		if err := l.PushLogs(); err != nil {
-			log.Printf("Error pushing logs to Loki: %v", err)
+			logging.Errorf("Error pushing logs to Loki: %v", err)
 		}
 
-		for range ticker.C {
-			if err := l.PushLogs(); err != nil {
-				log.Printf("Error pushing logs to Loki: %v", err)
+		err := streamer.StreamEventLog(ctx, func(entry utils.EventLogEntry) {
+			if err := l.pushStreamed(entry); err != nil {
+				logging.Errorf("Error pushing streamed log to Loki: %v", err)
 			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, utils.ErrStreamingUnsupported) {
+			logging.Infof("Modem does not support event log streaming, polling every %v", interval)
+			l.poll(ctx, interval)
+			return
 		}
-	}()
+		logging.Warnf("Event log stream ended (%v), reconnecting in %v", err, interval)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
 }
@@ -0,0 +1,682 @@
+package outputs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// fakeLogProvider serves a fixed event log and uptime
+type fakeLogProvider struct {
+	entries []utils.EventLogEntry
+	uptime  int64
+}
+
+func (f *fakeLogProvider) FetchEventLog() ([]utils.EventLogEntry, error) {
+	return f.entries, nil
+}
+
+func (f *fakeLogProvider) FetchUptime() (int64, error) {
+	return f.uptime, nil
+}
+
+// readLokiPush decodes a push request according to its Content-Encoding
+func readLokiPush(t *testing.T, r *http.Request) lokiPushRequest {
+	body, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	switch r.Header.Get("Content-Encoding") {
+	case "gzip":
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		body, err = io.ReadAll(reader)
+		require.NoError(t, err)
+	case "snappy":
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		body, err = snappy.Decode(nil, body)
+		require.NoError(t, err)
+		return decodeLokiProto(t, body)
+	case "":
+	default:
+		t.Fatalf("unexpected Content-Encoding %q", r.Header.Get("Content-Encoding"))
+	}
+
+	var req lokiPushRequest
+	require.NoError(t, json.Unmarshal(body, &req))
+	return req
+}
+
+// decodeLokiProto decodes a logproto.PushRequest message
+func decodeLokiProto(t *testing.T, body []byte) lokiPushRequest {
+	var req lokiPushRequest
+	for _, streamMsg := range consumeLokiFields(t, body)[1] {
+		fields := consumeLokiFields(t, streamMsg)
+		require.Len(t, fields[1], 1)
+		stream := lokiStream{Stream: parseLokiLabels(t, string(fields[1][0]))}
+		for _, entryMsg := range fields[2] {
+			entry := consumeLokiFields(t, entryMsg)
+			require.Len(t, entry[1], 1)
+			require.Len(t, entry[2], 1)
+
+			var seconds, nanos uint64
+			timestamp := entry[1][0]
+			for len(timestamp) > 0 {
+				num, typ, n := protowire.ConsumeTag(timestamp)
+				require.GreaterOrEqual(t, n, 0)
+				require.Equal(t, protowire.VarintType, typ)
+				value, m := protowire.ConsumeVarint(timestamp[n:])
+				require.GreaterOrEqual(t, m, 0)
+				if num == 1 {
+					seconds = value
+				} else {
+					nanos = value
+				}
+				timestamp = timestamp[n+m:]
+			}
+
+			ts := time.Unix(int64(seconds), int64(nanos))
+			stream.Values = append(stream.Values, []string{fmt.Sprintf("%d", ts.UnixNano()), string(entry[2][0])})
+		}
+		req.Streams = append(req.Streams, stream)
+	}
+	return req
+}
+
+// consumeLokiFields splits a protobuf message of length delimited fields by
+// field number
+func consumeLokiFields(t *testing.T, msg []byte) map[protowire.Number][][]byte {
+	fields := make(map[protowire.Number][][]byte)
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		require.GreaterOrEqual(t, n, 0)
+		require.Equal(t, protowire.BytesType, typ)
+		value, m := protowire.ConsumeBytes(msg[n:])
+		require.GreaterOrEqual(t, m, 0)
+		fields[num] = append(fields[num], value)
+		msg = msg[n+m:]
+	}
+	return fields
+}
+
+// parseLokiLabels parses a Prometheus label set such as {a="b", c="d"}
+func parseLokiLabels(t *testing.T, s string) map[string]string {
+	require.True(t, strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}"), s)
+	s = s[1 : len(s)-1]
+
+	labels := make(map[string]string)
+	for s != "" {
+		eq := strings.Index(s, "=")
+		require.Greater(t, eq, 0, s)
+		name := s[:eq]
+		s = s[eq+1:]
+
+		// The value ends at the first unescaped quote after the opening one
+		end := 1
+		for ; end < len(s) && s[end] != '"'; end++ {
+			if s[end] == '\\' {
+				end++
+			}
+		}
+		require.Less(t, end, len(s), s)
+		value, err := strconv.Unquote(s[:end+1])
+		require.NoError(t, err)
+		labels[name] = value
+		s = strings.TrimPrefix(s[end+1:], ", ")
+	}
+	return labels
+}
+
+// newLokiServer returns a test Loki endpoint and a function returning the
+// messages pushed to it
+func newLokiServer(t *testing.T) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var pushed []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := readLokiPush(t, r)
+		mu.Lock()
+		for _, stream := range req.Streams {
+			for _, value := range stream.Values {
+				pushed = append(pushed, value[1])
+			}
+		}
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		messages := pushed
+		pushed = nil
+		return messages
+	}
+}
+
+func TestLokiExporter_RebootResetsDeduplication(t *testing.T) {
+	server, pushed := newLokiServer(t)
+	defer server.Close()
+
+	provider := &fakeLogProvider{
+		entries: []utils.EventLogEntry{
+			{Priority: "critical", Timestamp: "1970-01-01T00:00:12.000Z", Message: "No Ranging Response received - T3 time-out"},
+			{Priority: "notice", Timestamp: "1970-01-01T00:00:30.000Z", Message: "Honor MDD; IP provisioning mode = IPv4"},
+			{Priority: "critical", Timestamp: "2026-02-09T10:14:14.000Z", Message: "Cable Modem Reboot because of - reboot UI"},
+		},
+		uptime: 5000,
+	}
+	exporter := NewLokiExporter([]string{server.URL}, provider, nil)
+	exporter.SetMaxAge(0)
+
+	require.NoError(t, exporter.PushLogs())
+	assert.Len(t, pushed(), 3)
+
+	// Nothing new, nothing pushed
+	provider.uptime = 5060
+	require.NoError(t, exporter.PushLogs())
+	assert.Empty(t, pushed())
+
+	// The modem reboots and its log restarts with recycled timestamps/messages
+	provider.uptime = 40
+	provider.entries = []utils.EventLogEntry{
+		{Priority: "critical", Timestamp: "1970-01-01T00:00:12.000Z", Message: "No Ranging Response received - T3 time-out"},
+		{Priority: "notice", Timestamp: "1970-01-01T00:00:30.000Z", Message: "Honor MDD; IP provisioning mode = IPv4"},
+	}
+	require.NoError(t, exporter.PushLogs())
+	// Entries are pushed in one stream per priority, in no particular order
+	assert.ElementsMatch(t, []string{
+		"No Ranging Response received - T3 time-out",
+		"Honor MDD; IP provisioning mode = IPv4",
+	}, pushed())
+
+	// The post-reboot entries are deduplicated as normal afterwards
+	provider.uptime = 100
+	require.NoError(t, exporter.PushLogs())
+	assert.Empty(t, pushed())
+}
+
+func TestLokiExporter_RebootKeepsRetainedEntriesSuppressed(t *testing.T) {
+	server, pushed := newLokiServer(t)
+	defer server.Close()
+
+	oldEntries := []utils.EventLogEntry{
+		{Priority: "critical", Timestamp: "1970-01-01T00:00:12.000Z", Message: "No Ranging Response received - T3 time-out"},
+		{Priority: "warning", Timestamp: "2026-02-08T08:00:00.000Z", Message: "Dynamic Range Window violation"},
+		{Priority: "critical", Timestamp: "2026-02-09T10:14:14.000Z", Message: "Cable Modem Reboot because of - reboot UI"},
+	}
+	provider := &fakeLogProvider{entries: oldEntries, uptime: 5000}
+	exporter := NewLokiExporter([]string{server.URL}, provider, nil)
+	exporter.SetMaxAge(0)
+
+	require.NoError(t, exporter.PushLogs())
+	assert.Len(t, pushed(), 3)
+
+	// The log survives the reboot (minus its oldest entry) and gains a
+	// recycled entry which must be pushed without re-pushing the old ones
+	provider.uptime = 40
+	provider.entries = append(append([]utils.EventLogEntry{}, oldEntries[1:]...), oldEntries[0])
+	require.NoError(t, exporter.PushLogs())
+	assert.Equal(t, []string{"No Ranging Response received - T3 time-out"}, pushed())
+}
+
+func TestLokiExporter_SkipsEntriesOlderThanMaxAge(t *testing.T) {
+	server, pushed := newLokiServer(t)
+	defer server.Close()
+
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	ancient := []utils.EventLogEntry{
+		{Priority: "critical", Timestamp: "1970-01-01T00:01:40.000Z", Message: "No Ranging Response received - T3 time-out"},
+		{Priority: "notice", Timestamp: "2020-03-01T12:00:00.000Z", Message: "TLV-11 - unrecognized OID"},
+	}
+	provider := &fakeLogProvider{
+		entries: append(ancient, utils.EventLogEntry{
+			Priority: "warning", Timestamp: recent, Message: "Dynamic Range Window violation",
+		}),
+	}
+	exporter := NewLokiExporter([]string{server.URL}, provider, nil)
+
+	require.NoError(t, exporter.PushLogs())
+	assert.Equal(t, []string{"Dynamic Range Window violation"}, pushed())
+
+	for _, entry := range ancient {
+		assert.True(t, exporter.seenLogs[logKey(entry)], "ancient entry should be marked seen")
+	}
+
+	require.NoError(t, exporter.PushLogs())
+	assert.Empty(t, pushed())
+}
+
+func TestLokiExporter_SanitizesLabels(t *testing.T) {
+	validName := regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	var streams []map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := readLokiPush(t, r)
+		for _, stream := range req.Streams {
+			for name, value := range stream.Stream {
+				if !validName.MatchString(name) || strings.ContainsAny(value, " \t\n") {
+					http.Error(w, "invalid label "+name, http.StatusBadRequest)
+					return
+				}
+			}
+			streams = append(streams, stream.Stream)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	provider := &fakeLogProvider{
+		entries: []utils.EventLogEntry{
+			{Priority: "critical error", Timestamp: time.Now().UTC().Format(time.RFC3339), Message: "No Ranging Response received - T3 time-out"},
+		},
+	}
+	exporter := NewLokiExporter([]string{server.URL}, provider, map[string]string{"modem-name": "living room"})
+
+	require.NoError(t, exporter.PushLogs())
+	require.Len(t, streams, 1)
+	assert.Equal(t, map[string]string{
+		"job":        "modem-stats",
+		"modem_name": "living_room",
+		"level":      "critical_error",
+	}, streams[0])
+}
+
+func TestLokiExporter_FailsOverToSecondary(t *testing.T) {
+	var mu sync.Mutex
+	primaryPushes := 0
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		primaryPushes++
+		mu.Unlock()
+		http.Error(w, "ingester unavailable", http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	primaryCalls := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return primaryPushes
+	}
+	secondary, pushed := newLokiServer(t)
+	defer secondary.Close()
+
+	provider := &fakeLogProvider{
+		entries: []utils.EventLogEntry{
+			{Priority: "critical", Timestamp: "2026-02-09T10:14:14.000Z", Message: "Cable Modem Reboot because of - reboot UI"},
+		},
+	}
+	exporter := NewLokiExporter([]string{primary.URL, secondary.URL}, provider, nil)
+	exporter.SetMaxAge(0)
+
+	require.NoError(t, exporter.PushLogs())
+	assert.Equal(t, []string{"Cable Modem Reboot because of - reboot UI"}, pushed())
+	assert.Equal(t, 1, primaryCalls())
+
+	// The entry was marked seen once pushed to the secondary
+	require.NoError(t, exporter.PushLogs())
+	assert.Empty(t, pushed())
+
+	// The failed primary is passed over while it is backed off
+	provider.entries = append(provider.entries, utils.EventLogEntry{
+		Priority: "notice", Timestamp: "2026-02-09T10:15:00.000Z", Message: "Honor MDD; IP provisioning mode = IPv4",
+	})
+	require.NoError(t, exporter.PushLogs())
+	assert.Equal(t, []string{"Honor MDD; IP provisioning mode = IPv4"}, pushed())
+	assert.Equal(t, 1, primaryCalls())
+}
+
+func TestLokiExporter_AllEndpointsFail(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "ingester unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	entry := utils.EventLogEntry{Priority: "critical", Timestamp: "2026-02-09T10:14:14.000Z", Message: "Cable Modem Reboot because of - reboot UI"}
+	provider := &fakeLogProvider{entries: []utils.EventLogEntry{entry}}
+	exporter := NewLokiExporter([]string{failing.URL, failing.URL + "/failover"}, provider, nil)
+	exporter.SetMaxAge(0)
+
+	err := exporter.PushLogs()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "all 2 loki endpoints failed")
+	assert.False(t, exporter.seenLogs[logKey(entry)], "unpushed entry should not be marked seen")
+}
+
+// fakeStreamingProvider streams the entries sent to its events channel
+type fakeStreamingProvider struct {
+	fakeLogProvider
+	events    chan utils.EventLogEntry
+	streamErr error
+
+	mu         sync.Mutex
+	fetchCalls int
+}
+
+func (f *fakeStreamingProvider) FetchEventLog() ([]utils.EventLogEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fetchCalls++
+	return f.entries, nil
+}
+
+func (f *fakeStreamingProvider) StreamEventLog(ctx context.Context, emit func(utils.EventLogEntry)) error {
+	if f.streamErr != nil {
+		return f.streamErr
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case entry := <-f.events:
+			emit(entry)
+		}
+	}
+}
+
+func (f *fakeStreamingProvider) FetchCalls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fetchCalls
+}
+
+func TestLokiExporter_StreamsEntriesAsTheyArrive(t *testing.T) {
+	server, pushed := newLokiServer(t)
+	defer server.Close()
+
+	provider := &fakeStreamingProvider{
+		fakeLogProvider: fakeLogProvider{entries: []utils.EventLogEntry{
+			{Priority: "notice", Timestamp: "2026-02-09T10:00:00.000Z", Message: "Honor MDD; IP provisioning mode = IPv4"},
+		}},
+		events: make(chan utils.EventLogEntry),
+	}
+	exporter := NewLokiExporter([]string{server.URL}, provider, nil)
+	exporter.SetMaxAge(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go exporter.stream(ctx, provider, time.Hour)
+
+	// The existing log is caught up on before streaming
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"Honor MDD; IP provisioning mode = IPv4"}, pushed())
+	}, time.Second, 10*time.Millisecond)
+
+	// Streamed entries are pushed straight away, not after the hour long
+	// poll interval
+	for _, message := range []string{"No Ranging Response received - T3 time-out", "Ranging Request Retries exhausted"} {
+		provider.events <- utils.EventLogEntry{Priority: "critical", Timestamp: "2026-02-09T10:05:00.000Z", Message: message}
+		assert.Eventually(t, func() bool {
+			return assert.ObjectsAreEqual([]string{message}, pushed())
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	// A streamed entry which has already been pushed is not pushed again
+	provider.events <- utils.EventLogEntry{Priority: "notice", Timestamp: "2026-02-09T10:00:00.000Z", Message: "Honor MDD; IP provisioning mode = IPv4"}
+	provider.events <- utils.EventLogEntry{Priority: "notice", Timestamp: "2026-02-09T10:06:00.000Z", Message: "TLV-11 - unrecognized OID"}
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"TLV-11 - unrecognized OID"}, pushed())
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, provider.FetchCalls())
+}
+
+func TestLokiExporter_FallsBackToPolling(t *testing.T) {
+	server, pushed := newLokiServer(t)
+	defer server.Close()
+
+	provider := &fakeStreamingProvider{
+		fakeLogProvider: fakeLogProvider{entries: []utils.EventLogEntry{
+			{Priority: "notice", Timestamp: "2026-02-09T10:00:00.000Z", Message: "Honor MDD; IP provisioning mode = IPv4"},
+		}},
+		streamErr: utils.ErrStreamingUnsupported,
+	}
+	exporter := NewLokiExporter([]string{server.URL}, provider, nil)
+	exporter.SetMaxAge(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go exporter.stream(ctx, provider, 10*time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		return provider.FetchCalls() >= 3
+	}, time.Second, 10*time.Millisecond, "the event log should be polled")
+	assert.Equal(t, []string{"Honor MDD; IP provisioning mode = IPv4"}, pushed())
+}
+
+func TestLokiExporter_RetriesEntriesDroppedFromModemLog(t *testing.T) {
+	var mu sync.Mutex
+	down := true
+	server, pushed := newLokiServer(t)
+	defer server.Close()
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			http.Error(w, "ingester unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer flaky.Close()
+
+	rebootEntry := utils.EventLogEntry{Priority: "critical", Timestamp: "2026-02-09T10:14:14.000Z", Message: "Cable Modem Reboot because of - reboot UI"}
+	provider := &fakeLogProvider{entries: []utils.EventLogEntry{rebootEntry}}
+	exporter := NewLokiExporter([]string{flaky.URL}, provider, nil)
+	exporter.SetMaxAge(0)
+
+	require.Error(t, exporter.PushLogs())
+
+	// The modem's log rotates, losing the entry which failed to push
+	provider.entries = []utils.EventLogEntry{
+		{Priority: "notice", Timestamp: "2026-02-09T10:15:00.000Z", Message: "Honor MDD; IP provisioning mode = IPv4"},
+	}
+	require.Error(t, exporter.PushLogs())
+
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	require.NoError(t, exporter.PushLogs())
+	assert.ElementsMatch(t, []string{
+		"Cable Modem Reboot because of - reboot UI",
+		"Honor MDD; IP provisioning mode = IPv4",
+	}, pushed())
+
+	// Nothing is left to retry
+	require.NoError(t, exporter.PushLogs())
+	assert.Empty(t, pushed())
+}
+
+func TestLokiExporter_BoundsPendingEntries(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "ingester unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	provider := &fakeLogProvider{}
+	exporter := NewLokiExporter([]string{failing.URL}, provider, nil)
+	exporter.SetMaxAge(0)
+	exporter.SetMaxPending(2)
+
+	for _, message := range []string{"first", "second", "third"} {
+		provider.entries = []utils.EventLogEntry{{Priority: "notice", Timestamp: "2026-02-09T10:15:00.000Z", Message: message}}
+		require.Error(t, exporter.PushLogs())
+	}
+
+	// The oldest entry is dropped
+	require.Len(t, exporter.pending, 2)
+	assert.Equal(t, "second", exporter.pending[0].Message)
+	assert.Equal(t, "third", exporter.pending[1].Message)
+}
+
+func TestLokiExporter_CacheMetrics(t *testing.T) {
+	var mu sync.Mutex
+	succeed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !succeed {
+			http.Error(w, "ingester unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	provider := &fakeLogProvider{entries: []utils.EventLogEntry{
+		{Priority: "notice", Timestamp: "2026-02-09T10:15:00.000Z", Message: "first"},
+		{Priority: "notice", Timestamp: "2026-02-09T10:16:00.000Z", Message: "second"},
+		{Priority: "error", Timestamp: "2026-02-09T10:17:00.000Z", Message: "third"},
+	}}
+	exporter := NewLokiExporter([]string{server.URL}, provider, nil)
+	exporter.SetMaxAge(0)
+
+	expect := func(seen, pending int) {
+		t.Helper()
+		err := testutil.CollectAndCompare(exporter, strings.NewReader(fmt.Sprintf(`
+			# HELP modemstats_loki_pending_entries Number of event log entries which failed to push to Loki and are waiting to be retried
+			# TYPE modemstats_loki_pending_entries gauge
+			modemstats_loki_pending_entries %d
+			# HELP modemstats_loki_seen_entries Number of event log entries remembered so they are not pushed to Loki twice
+			# TYPE modemstats_loki_seen_entries gauge
+			modemstats_loki_seen_entries %d
+		`, pending, seen)), "modemstats_loki_pending_entries", "modemstats_loki_seen_entries")
+		assert.NoError(t, err)
+	}
+
+	require.Error(t, exporter.PushLogs())
+	expect(0, 3)
+
+	mu.Lock()
+	succeed = true
+	mu.Unlock()
+	require.NoError(t, exporter.PushLogs())
+	expect(3, 0)
+}
+
+func TestLokiExporter_PushMetrics(t *testing.T) {
+	var mu sync.Mutex
+	var received int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		mu.Lock()
+		received += len(body)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	provider := &fakeLogProvider{entries: []utils.EventLogEntry{
+		{Priority: "notice", Timestamp: "2026-02-09T10:15:00.000Z", Message: "first"},
+		{Priority: "error", Timestamp: "2026-02-09T10:17:00.000Z", Message: "second"},
+	}}
+	exporter := NewLokiExporter([]string{server.URL}, provider, nil)
+	exporter.SetMaxAge(0)
+	require.NoError(t, exporter.PushLogs())
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(exporter)
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	histograms := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			if h := metric.GetHistogram(); h != nil {
+				assert.Equal(t, uint64(1), h.GetSampleCount(), "%s should be observed once per push", family.GetName())
+				histograms[family.GetName()] = h.GetSampleSum()
+			}
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, float64(received), histograms["modemstats_loki_push_bytes"])
+	assert.Contains(t, histograms, "modemstats_loki_push_duration_seconds")
+}
+
+func TestLokiExporter_Encoding(t *testing.T) {
+	for _, encoding := range LokiEncodings {
+		t.Run(encoding, func(t *testing.T) {
+			var mu sync.Mutex
+			var header string
+			var pushed []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				req := readLokiPush(t, r)
+				mu.Lock()
+				defer mu.Unlock()
+				header = r.Header.Get("Content-Encoding")
+				for _, stream := range req.Streams {
+					for _, value := range stream.Values {
+						pushed = append(pushed, value[1])
+					}
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			provider := &fakeLogProvider{entries: []utils.EventLogEntry{
+				{Priority: "notice", Timestamp: "2026-02-09T10:15:00.000Z", Message: "first"},
+			}}
+			exporter := NewLokiExporter([]string{server.URL}, provider, nil)
+			exporter.SetMaxAge(0)
+			exporter.SetEncoding(encoding)
+			require.NoError(t, exporter.PushLogs())
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, []string{"first"}, pushed)
+			if encoding == LokiEncodingNone {
+				assert.Empty(t, header)
+			} else {
+				assert.Equal(t, encoding, header)
+			}
+		})
+	}
+}
+
+func TestEncodeLokiBody_SnappyProtoRoundTrip(t *testing.T) {
+	req := lokiPushRequest{Streams: []lokiStream{
+		{
+			Stream: map[string]string{"job": "modem-stats", "priority": "notice", "site": `home "main", 2`},
+			Values: [][]string{
+				{"1770632100000000001", "first"},
+				{"1770632160123456789", "second\nline"},
+			},
+		},
+		{
+			Stream: map[string]string{"job": "modem-stats", "priority": "critical"},
+			Values: [][]string{{"1770632200000000000", "T3 time-out"}},
+		},
+	}}
+
+	body, err := encodeLokiBody(LokiEncodingSnappy, req)
+	require.NoError(t, err)
+	decoded, err := snappy.Decode(nil, body)
+	require.NoError(t, err)
+	assert.Equal(t, req, decodeLokiProto(t, decoded))
+}
+
+func TestLokiLabelsString(t *testing.T) {
+	assert.Equal(t, `{a="1", b="x \"y\""}`, lokiLabelsString(map[string]string{"b": `x "y"`, "a": "1"}))
+}
+
+func TestIsKnownLokiEncoding(t *testing.T) {
+	assert.True(t, IsKnownLokiEncoding(LokiEncodingSnappy))
+	assert.False(t, IsKnownLokiEncoding("brotli"))
+	assert.False(t, IsKnownLokiEncoding(""))
+}
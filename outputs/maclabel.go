@@ -0,0 +1,26 @@
+package outputs
+
+import (
+	"github.com/msh100/modem-stats/utils"
+	"github.com/msh100/modem-stats/utils/logging"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// macLabels scrapes the modem to learn its MAC address, returning it as the
+// mac label. Without it, as when the modem cannot be reached, the metrics go
+// without the label rather than the exporter failing to start.
+func macLabels(modem utils.DocsisModem) prometheus.Labels {
+	utils.ResetStats(modem)
+	stats, err := utils.FetchStats(modem)
+	if err != nil {
+		logging.Warnf("Failed to fetch the modem's MAC address, metrics will not have a mac label: %v", err)
+		return nil
+	}
+
+	mac := utils.NormalizeMAC(stats.MACAddress)
+	if mac == "" {
+		logging.Warnf("Modem %T does not report its MAC address, metrics will not have a mac label", modem)
+		return nil
+	}
+	return prometheus.Labels{"mac": mac}
+}
@@ -0,0 +1,349 @@
+package outputs
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/msh100/modem-stats/utils"
+	"github.com/msh100/modem-stats/utils/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/model"
+)
+
+// MultiModem exports the metrics of several modems, each tagged with its own
+// labels so their series do not collide. Modems can be set and removed after
+// the exporters are registered, such as when their config files change.
+//
+// Each modem has one exporter, shared by every registration and output, so
+// the modem is fetched from by one throttle however many outputs read it.
+type MultiModem struct {
+	mu            sync.Mutex
+	opts          []ExporterOption
+	modems        []multiModemEntry
+	added         int
+	registrations []*multiRegistration
+}
+
+type multiModemEntry struct {
+	key      string
+	modem    utils.DocsisModem
+	exporter *PrometheusExporter
+	labels   map[string]string
+}
+
+// multiRegistration is the exporter of each modem collected for a
+// registerer, wrapped with the modem's labels
+type multiRegistration struct {
+	names     []string
+	exporters map[string]registeredExporter
+}
+
+type registeredExporter struct {
+	exporter *PrometheusExporter
+	wrapped  prometheus.Collector
+}
+
+// NewMultiModem creates a set of modems whose exporters are created with the
+// given options
+func NewMultiModem(opts ...ExporterOption) *MultiModem {
+	return &MultiModem{opts: opts}
+}
+
+// Add includes a modem, identified by the given labels. A "modem" label of
+// its number, counting from 1 as modems are numbered in the config, is added
+// when none is given. It returns the modem's exporter, and the labels the
+// modem is identified by, for its other outputs to read and be labelled
+// alike.
+func (m *MultiModem) Add(modem utils.DocsisModem, labels map[string]string) (*PrometheusExporter, map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.added++
+	entry := m.put(strconv.Itoa(m.added), modem, labels)
+	return entry.exporter, withModemLabel(entry.key, entry.labels)
+}
+
+// Set includes a modem under a key, replacing any modem already set under it,
+// and registers its exporter. The key is its "modem" label when none is
+// given. Another modem with the same labels is an error, as their series
+// would collide. It returns the modem's exporter and labels, as Add does.
+func (m *MultiModem) Set(key string, modem utils.DocsisModem, labels map[string]string) (*PrometheusExporter, map[string]string, error) {
+	if err := checkLabelNames(labels); err != nil {
+		return nil, nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	labels = withModemLabel(key, labels)
+	for _, entry := range m.modems {
+		if entry.key != key && sameLabels(entry.labels, labels) {
+			return nil, nil, fmt.Errorf("labels %v are already used by another modem", labels)
+		}
+	}
+
+	entry := m.put(key, modem, labels)
+	m.sync()
+	return entry.exporter, withModemLabel(entry.key, entry.labels), nil
+}
+
+// Remove leaves out the modem set under a key, stopping its exporter
+func (m *MultiModem) Remove(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, entry := range m.modems {
+		if entry.key == key {
+			entry.exporter.Stop()
+			m.modems = append(m.modems[:i], m.modems[i+1:]...)
+			break
+		}
+	}
+	m.sync()
+}
+
+// Len returns the number of modems
+func (m *MultiModem) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.modems)
+}
+
+// withModemLabel returns a copy of the labels, with the key as the "modem"
+// label when none is given
+func withModemLabel(key string, labels map[string]string) map[string]string {
+	copied := make(map[string]string)
+	for k, v := range labels {
+		copied[k] = v
+	}
+	if _, ok := copied["modem"]; !ok {
+		copied["modem"] = key
+	}
+	return copied
+}
+
+// sameLabels reports whether two modems' series would have the same labels.
+// A label missing from one modem is registered empty, so is the same as an
+// empty one.
+func sameLabels(a, b map[string]string) bool {
+	for name, value := range a {
+		if b[name] != value {
+			return false
+		}
+	}
+	for name, value := range b {
+		if a[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// put sets the modem under a key with a new exporter, stopping the exporter
+// of any modem it replaces
+func (m *MultiModem) put(key string, modem utils.DocsisModem, labels map[string]string) multiModemEntry {
+	entry := multiModemEntry{
+		key:      key,
+		modem:    modem,
+		exporter: ProExporter(modem, m.opts...),
+		labels:   withModemLabel(key, labels),
+	}
+	for i := range m.modems {
+		if m.modems[i].key == key {
+			m.modems[i].exporter.Stop()
+			m.modems[i] = entry
+			return entry
+		}
+	}
+	m.modems = append(m.modems, entry)
+	return entry
+}
+
+// Register registers the exporter of every modem. Prometheus requires every
+// series of a metric to have the same label names, so labels missing from
+// some modems are registered empty.
+//
+// The exporters are collected through one collector which describes no
+// metrics, as the registry would otherwise hold the label names of the
+// first modems against any later set with others. The registry cannot then
+// catch modems with the same labels, so they are refused here, as by Set.
+func (m *MultiModem) Register(registerer prometheus.Registerer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, entry := range m.modems {
+		if err := checkLabelNames(entry.labels); err != nil {
+			return fmt.Errorf("failed to register modem %v: %w", entry.labels, err)
+		}
+		for _, other := range m.modems[:i] {
+			if sameLabels(entry.labels, other.labels) {
+				return fmt.Errorf("failed to register modem %v: labels are already used by another modem", entry.labels)
+			}
+		}
+	}
+
+	r := &multiRegistration{
+		exporters: make(map[string]registeredExporter),
+	}
+	if err := registerer.Register(&multiCollector{multi: m, registration: r}); err != nil {
+		return fmt.Errorf("failed to register modems: %w", err)
+	}
+	m.registrations = append(m.registrations, r)
+	m.sync()
+	return nil
+}
+
+// sync brings the exporters of every registration in line with the modems,
+// adding those of modems set since and leaving out those of modems replaced
+// or removed
+func (m *MultiModem) sync() {
+	names := make(map[string]bool)
+	byKey := make(map[string]*PrometheusExporter)
+	for _, entry := range m.modems {
+		byKey[entry.key] = entry.exporter
+		for name := range entry.labels {
+			names[name] = true
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, r := range m.registrations {
+		for key, registered := range r.exporters {
+			if byKey[key] != registered.exporter {
+				delete(r.exporters, key)
+			}
+		}
+
+		relabel := !reflect.DeepEqual(r.names, sorted)
+		r.names = sorted
+		for _, entry := range m.modems {
+			registered, ok := r.exporters[entry.key]
+			if ok && !relabel {
+				continue
+			}
+			if !ok {
+				registered = registeredExporter{exporter: entry.exporter}
+			}
+
+			labels := prometheus.Labels{}
+			for name := range names {
+				labels[name] = entry.labels[name]
+			}
+			registered.wrapped = wrapCollector(labels, registered.exporter)
+			r.exporters[entry.key] = registered
+		}
+	}
+}
+
+func checkLabelNames(labels map[string]string) error {
+	for name := range labels {
+		if !model.LabelName(name).IsValid() {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+	}
+	return nil
+}
+
+// multiCollector collects the exporters of a registration concurrently, as
+// the registry would collect them were each registered
+type multiCollector struct {
+	multi        *MultiModem
+	registration *multiRegistration
+}
+
+func (c *multiCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *multiCollector) Collect(ch chan<- prometheus.Metric) {
+	c.multi.mu.Lock()
+	collectors := make([]prometheus.Collector, 0, len(c.registration.exporters))
+	for _, registered := range c.registration.exporters {
+		collectors = append(collectors, registered.wrapped)
+	}
+	c.multi.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, collector := range collectors {
+		wg.Add(1)
+		go func(collector prometheus.Collector) {
+			defer wg.Done()
+			collector.Collect(ch)
+		}(collector)
+	}
+	wg.Wait()
+}
+
+// wrapCollector labels every metric of a collector, as WrapRegistererWith
+// does for those registered through it
+func wrapCollector(labels prometheus.Labels, collector prometheus.Collector) prometheus.Collector {
+	capture := &capturingRegisterer{}
+	prometheus.WrapRegistererWith(labels, capture).MustRegister(collector)
+	return capture.collector
+}
+
+// capturingRegisterer keeps the collector registered with it
+type capturingRegisterer struct {
+	collector prometheus.Collector
+}
+
+func (c *capturingRegisterer) Register(collector prometheus.Collector) error {
+	c.collector = collector
+	return nil
+}
+
+func (c *capturingRegisterer) MustRegister(collectors ...prometheus.Collector) {
+	for _, collector := range collectors {
+		c.collector = collector
+	}
+}
+
+func (c *capturingRegisterer) Unregister(prometheus.Collector) bool {
+	return false
+}
+
+// registerMulti registers the exporters of several modems and the /metrics
+// handler
+func registerMulti(multi *MultiModem, opts ...ExporterOption) error {
+	if err := multi.Register(prometheus.DefaultRegisterer); err != nil {
+		return err
+	}
+	if err := registerBuildInfo(prometheus.DefaultRegisterer, opts); err != nil {
+		return err
+	}
+	http.Handle("/metrics", promhttp.Handler())
+	return nil
+}
+
+// PrometheusMulti serves the metrics of several modems on one port, returning
+// once the server fails
+func PrometheusMulti(multi *MultiModem, port int, opts ...ExporterOption) error {
+	if err := registerMulti(multi, opts...); err != nil {
+		return err
+	}
+
+	logging.Infof("Starting Prometheus exporter for %d modems on port %d", multi.Len(), port)
+	return http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
+}
+
+// PrometheusMultiUnixSocket serves the metrics of several modems over a Unix
+// domain socket, returning once the server fails
+func PrometheusMultiUnixSocket(multi *MultiModem, path string, opts ...ExporterOption) error {
+	if err := registerMulti(multi, opts...); err != nil {
+		return err
+	}
+
+	listener, err := listenUnixSocket(path)
+	if err != nil {
+		return err
+	}
+	logging.Infof("Starting Prometheus exporter for %d modems on socket %s", multi.Len(), path)
+	return http.Serve(listener, nil)
+}
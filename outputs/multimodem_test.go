@@ -0,0 +1,160 @@
+package outputs
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/msh100/modem-stats/modems/fake"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiModem_TagsMetricsPerModem(t *testing.T) {
+	upstairs := &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{{ChannelID: 5, Channel: 1, Snr: 410, Modulation: "QAM256", Scheme: "SC-QAM"}},
+	}}
+	downstairs := &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{{ChannelID: 5, Channel: 1, Snr: 330, Modulation: "QAM256", Scheme: "SC-QAM"}},
+	}}
+
+	multi := &MultiModem{}
+	multi.Add(upstairs, map[string]string{"modem": "upstairs", "isp": "virgin"})
+	multi.Add(downstairs, map[string]string{"modem": "downstairs"})
+
+	registry := prometheus.NewRegistry()
+	require.NoError(t, multi.Register(registry))
+
+	expected := `
+		# HELP modemstats_downstream_snr Downstream SNR in dB
+		# TYPE modemstats_downstream_snr gauge
+		modemstats_downstream_snr{channel="1",id="5",isp="",modem="downstairs",modulation="QAM256",scheme="SC-QAM"} 330
+		modemstats_downstream_snr{channel="1",id="5",isp="virgin",modem="upstairs",modulation="QAM256",scheme="SC-QAM"} 410
+	`
+	err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "modemstats_downstream_snr")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, upstairs.ParseCalls())
+	assert.Equal(t, 1, downstairs.ParseCalls())
+}
+
+func TestMultiModem_DefaultModemLabel(t *testing.T) {
+	multi := &MultiModem{}
+	multi.Add(&fake.Modem{}, nil)
+	multi.Add(&fake.Modem{}, nil)
+
+	registry := prometheus.NewRegistry()
+	require.NoError(t, multi.Register(registry))
+
+	expected := `
+		# HELP modemstats_shstatsinfo_timems Time to fetch statistics from the modem in milliseconds
+		# TYPE modemstats_shstatsinfo_timems gauge
+		modemstats_shstatsinfo_timems{modem="1"} 0
+		modemstats_shstatsinfo_timems{modem="2"} 0
+	`
+	err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "modemstats_shstatsinfo_timems")
+	assert.NoError(t, err)
+}
+
+func TestMultiModem_AddReturnsLabels(t *testing.T) {
+	multi := &MultiModem{}
+	first, second := &fake.Modem{}, &fake.Modem{}
+	_, firstLabels := multi.Add(first, nil)
+	_, secondLabels := multi.Add(second, nil)
+	assert.Equal(t, map[string]string{"modem": "1"}, firstLabels)
+	assert.Equal(t, map[string]string{"modem": "2"}, secondLabels)
+
+	// The Loki exporters of modems without labels register apart when
+	// labelled alike
+	registry := prometheus.NewRegistry()
+	for modem, labels := range map[*fake.Modem]map[string]string{first: firstLabels, second: secondLabels} {
+		loki := NewLokiExporter([]string{"http://loki:3100/loki/api/v1/push"}, modem, labels)
+		require.NoError(t, prometheus.WrapRegistererWith(labels, registry).Register(loki))
+	}
+}
+
+func TestMultiModem_SharesExporter(t *testing.T) {
+	modem := &fake.Modem{}
+	multi := NewMultiModem(WithMinScrapeInterval(time.Minute))
+	multi.Add(modem, nil)
+
+	// The pull exporter and a push output registering the modems share its
+	// exporter, so fetch from the modem through one throttle
+	pull, push := prometheus.NewRegistry(), prometheus.NewRegistry()
+	require.NoError(t, multi.Register(pull))
+	require.NoError(t, multi.Register(push))
+	_, err := pull.Gather()
+	require.NoError(t, err)
+	_, err = push.Gather()
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, modem.ParseCalls())
+}
+
+func TestMultiModem_SetAndRemoveAfterRegister(t *testing.T) {
+	multi := &MultiModem{}
+	multi.Add(&fake.Modem{}, nil)
+
+	registry := prometheus.NewRegistry()
+	require.NoError(t, multi.Register(registry))
+
+	replaced := &fake.Modem{Stats: utils.ModemStats{FetchTime: 5}}
+	_, _, err := multi.Set("attic", &fake.Modem{}, map[string]string{"isp": "virgin"})
+	require.NoError(t, err)
+	_, _, err = multi.Set("attic", replaced, map[string]string{"isp": "virgin"})
+	require.NoError(t, err)
+
+	expected := `
+		# HELP modemstats_shstatsinfo_timems Time to fetch statistics from the modem in milliseconds
+		# TYPE modemstats_shstatsinfo_timems gauge
+		modemstats_shstatsinfo_timems{isp="",modem="1"} 0
+		modemstats_shstatsinfo_timems{isp="virgin",modem="attic"} 5
+	`
+	err = testutil.GatherAndCompare(registry, strings.NewReader(expected), "modemstats_shstatsinfo_timems")
+	assert.NoError(t, err)
+
+	multi.Remove("attic")
+	assert.Equal(t, 1, multi.Len())
+
+	expected = `
+		# HELP modemstats_shstatsinfo_timems Time to fetch statistics from the modem in milliseconds
+		# TYPE modemstats_shstatsinfo_timems gauge
+		modemstats_shstatsinfo_timems{modem="1"} 0
+	`
+	err = testutil.GatherAndCompare(registry, strings.NewReader(expected), "modemstats_shstatsinfo_timems")
+	assert.NoError(t, err)
+}
+
+func TestMultiModem_SetInvalidLabel(t *testing.T) {
+	multi := &MultiModem{}
+	multi.Add(&fake.Modem{}, nil)
+
+	_, _, err := multi.Set("attic", &fake.Modem{}, map[string]string{"floor-2": "attic"})
+	assert.EqualError(t, err, `invalid label name "floor-2"`)
+	assert.Equal(t, 1, multi.Len())
+}
+
+func TestMultiModem_DuplicateLabels(t *testing.T) {
+	multi := &MultiModem{}
+	multi.Add(&fake.Modem{}, map[string]string{"modem": "upstairs"})
+	multi.Add(&fake.Modem{}, map[string]string{"modem": "upstairs", "isp": ""})
+
+	err := multi.Register(prometheus.NewRegistry())
+	assert.EqualError(t, err, "failed to register modem map[isp: modem:upstairs]: labels are already used by another modem")
+
+	multi = &MultiModem{}
+	multi.Add(&fake.Modem{}, nil)
+	require.NoError(t, multi.Register(prometheus.NewRegistry()))
+	_, _, err = multi.Set("attic", &fake.Modem{}, map[string]string{"isp": "virgin"})
+	require.NoError(t, err)
+
+	_, _, err = multi.Set("loft", &fake.Modem{}, map[string]string{"modem": "attic", "isp": "virgin"})
+	assert.EqualError(t, err, "labels map[isp:virgin modem:attic] are already used by another modem")
+	assert.Equal(t, 2, multi.Len())
+
+	// Replacing a modem keeps its own labels
+	_, _, err = multi.Set("attic", &fake.Modem{}, map[string]string{"isp": "virgin"})
+	assert.NoError(t, err)
+}
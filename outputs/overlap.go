@@ -0,0 +1,84 @@
+package outputs
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/msh100/modem-stats/utils"
+)
+
+// narrowestChannelWidths (in Hz) are assumed for a single carrier channel
+// whose width the modem does not report, by direction. Assuming the narrowest
+// width in use (6 MHz DOCSIS downstream, 1.6 MHz upstream) means a plan of
+// narrow channels is not mistaken for one of overlapping wide channels.
+var narrowestChannelWidths = map[string]int{
+	"downstream": 6000000,
+	"upstream":   1600000,
+}
+
+// overlapChecker counts the pairs of single carrier (SC-QAM or ATDMA)
+// channels whose frequencies overlap given their widths, which points to a
+// driver misparsing frequencies or a misconfigured plant. OFDM channels span
+// the single carrier channels they share the spectrum with, so are left out.
+type overlapChecker struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newOverlapChecker() *overlapChecker {
+	return &overlapChecker{counts: make(map[string]int)}
+}
+
+// frequencyRange is the span of a channel's frequencies in Hz, exclusive
+type frequencyRange struct {
+	low, high int
+}
+
+// singleCarrierRanges returns the frequency ranges of the single carrier
+// channels with a frequency, in order of their lowest frequency
+func singleCarrierRanges(direction string, channels []utils.ModemChannel) []frequencyRange {
+	var ranges []frequencyRange
+	for _, c := range channels {
+		if c.Frequency <= 0 || strings.HasPrefix(c.Scheme, "OFDM") {
+			continue
+		}
+		width := c.ChannelWidth
+		if width <= 0 {
+			width = narrowestChannelWidths[direction]
+		}
+		ranges = append(ranges, frequencyRange{c.Frequency - width/2, c.Frequency + width/2})
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].low < ranges[j].low })
+	return ranges
+}
+
+// overlappingPairs counts the pairs of ranges which overlap, ranges sharing
+// only an edge (as adjacent channels do) not counting
+func overlappingPairs(ranges []frequencyRange) int {
+	pairs := 0
+	for i := range ranges {
+		for j := i + 1; j < len(ranges) && ranges[j].low < ranges[i].high; j++ {
+			pairs++
+		}
+	}
+	return pairs
+}
+
+// observe counts the overlapping pairs of channels for the direction and
+// returns the total counted so far
+func (o *overlapChecker) observe(direction string, channels []utils.ModemChannel) int {
+	pairs := overlappingPairs(singleCarrierRanges(direction, channels))
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.counts[direction] += pairs
+	return o.counts[direction]
+}
+
+// count returns the total counted so far for the direction
+func (o *overlapChecker) count(direction string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.counts[direction]
+}
@@ -0,0 +1,69 @@
+package outputs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/msh100/modem-stats/modems/fake"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func expectFrequencyOverlap(t *testing.T, exporter *PrometheusExporter, downstream, upstream int) {
+	t.Helper()
+	expected := fmt.Sprintf(`
+		# HELP modemstats_channel_frequency_overlap_total Number of times a pair of single carrier channels has been reported with overlapping frequencies, by direction
+		# TYPE modemstats_channel_frequency_overlap_total counter
+		modemstats_channel_frequency_overlap_total{direction="downstream"} %d
+		modemstats_channel_frequency_overlap_total{direction="upstream"} %d
+	`, downstream, upstream)
+	err := testutil.CollectAndCompare(exporter, strings.NewReader(expected), "modemstats_channel_frequency_overlap_total")
+	assert.NoError(t, err)
+}
+
+func TestPrometheusExporter_FrequencyOverlap(t *testing.T) {
+	modem := &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			{ChannelID: 1, Channel: 1, Frequency: 331000000, Modulation: "QAM256", Scheme: "SC-QAM"},
+			// Reported 3 MHz from its neighbour, inside its 8 MHz width
+			{ChannelID: 2, Channel: 2, Frequency: 334000000, ChannelWidth: 8000000, Modulation: "QAM256", Scheme: "SC-QAM"},
+			{ChannelID: 3, Channel: 3, Frequency: 339000000, Modulation: "QAM256", Scheme: "SC-QAM"},
+			// The OFDM channel spans the others, so is not counted
+			{ChannelID: 33, Channel: 4, Frequency: 330000000, ChannelWidth: 96000000, Modulation: "QAM4096", Scheme: "OFDM"},
+		},
+		UpChannels: []utils.ModemChannel{
+			// The same channel reported twice under different IDs
+			{ChannelID: 1, Channel: 1, Frequency: 49600000, ChannelWidth: 6400000, Scheme: "ATDMA"},
+			{ChannelID: 2, Channel: 2, Frequency: 49600000, ChannelWidth: 6400000, Scheme: "ATDMA"},
+		},
+	}}
+	exporter := ProExporter(modem)
+
+	expectFrequencyOverlap(t, exporter, 2, 1)
+	// The channels are counted again on each scrape they overlap
+	expectFrequencyOverlap(t, exporter, 4, 2)
+}
+
+func TestPrometheusExporter_FrequencyOverlapNone(t *testing.T) {
+	modem := &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			// Adjacent EuroDOCSIS channels share only an edge
+			{ChannelID: 1, Channel: 1, Frequency: 331000000, ChannelWidth: 8000000, Modulation: "QAM256", Scheme: "SC-QAM"},
+			{ChannelID: 2, Channel: 2, Frequency: 339000000, ChannelWidth: 8000000, Modulation: "QAM256", Scheme: "SC-QAM"},
+			// Without widths, 6 MHz DOCSIS channels are not taken to overlap
+			{ChannelID: 3, Channel: 3, Frequency: 603000000, Modulation: "QAM256"},
+			{ChannelID: 4, Channel: 4, Frequency: 609000000, Modulation: "QAM256"},
+			{ChannelID: 33, Channel: 5, Frequency: 330000000, Modulation: "QAM4096", Scheme: "OFDM"},
+		},
+		UpChannels: []utils.ModemChannel{
+			{ChannelID: 1, Channel: 1, Frequency: 49600000, Scheme: "ATDMA"},
+			{ChannelID: 2, Channel: 2, Frequency: 56000000, Scheme: "ATDMA"},
+		},
+	}}
+	exporter := ProExporter(modem)
+
+	expectFrequencyOverlap(t, exporter, 0, 0)
+	expectFrequencyOverlap(t, exporter, 0, 0)
+}
@@ -0,0 +1,102 @@
+package outputs
+
+import (
+	"sync"
+	"time"
+)
+
+// powerTrendSamples is how many scrapes the power trend is calculated over,
+// and minPowerTrendSamples how many are needed before it is reported
+const (
+	powerTrendSamples    = 10
+	minPowerTrendSamples = 3
+)
+
+type powerSample struct {
+	at    time.Time
+	power float64
+}
+
+// powerTrend tracks the power of channels over recent scrapes. A level which
+// keeps drifting (such as from a degrading connector or amplifier) shows in
+// its slope long before the power itself is out of range.
+type powerTrend struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	channels map[string][]powerSample
+}
+
+func newPowerTrend() *powerTrend {
+	return &powerTrend{
+		now:      time.Now,
+		channels: make(map[string][]powerSample),
+	}
+}
+
+// observe records the power in tenths of a dB of each channel, keyed by
+// channel, and returns the slopes. A channel which is missing from a scrape is forgotten,
+// so one which comes back (such as after the modem reboots) starts afresh
+// rather than being compared with its level from before.
+func (p *powerTrend) observe(powers map[string]float64) map[string]float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	for key := range p.channels {
+		if _, ok := powers[key]; !ok {
+			delete(p.channels, key)
+		}
+	}
+	for key, power := range powers {
+		samples := append(p.channels[key], powerSample{at: now, power: power})
+		if len(samples) > powerTrendSamples {
+			samples = samples[len(samples)-powerTrendSamples:]
+		}
+		p.channels[key] = samples
+	}
+
+	return p.slopesLocked()
+}
+
+// slopes returns the slope of each channel's power in dB per minute, for the
+// channels with enough samples
+func (p *powerTrend) slopes() map[string]float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.slopesLocked()
+}
+
+func (p *powerTrend) slopesLocked() map[string]float64 {
+	slopes := make(map[string]float64)
+	for key, samples := range p.channels {
+		if slope, ok := leastSquaresSlope(samples); ok {
+			slopes[key] = slope
+		}
+	}
+	return slopes
+}
+
+// leastSquaresSlope fits a line to the samples, returning its slope in dB per
+// minute
+func leastSquaresSlope(samples []powerSample) (float64, bool) {
+	if len(samples) < minPowerTrendSamples {
+		return 0, false
+	}
+
+	n := float64(len(samples))
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := s.at.Sub(samples[0].at).Minutes()
+		sumX += x
+		sumY += s.power
+		sumXY += x * s.power
+		sumXX += x * x
+	}
+
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false
+	}
+	// Power is in tenths of a dB, work in tenths to avoid float noise
+	return (n*sumXY - sumX*sumY) / denominator / 10, true
+}
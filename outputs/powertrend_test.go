@@ -0,0 +1,82 @@
+package outputs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/msh100/modem-stats/modems/fake"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPowerTrend_LinearSlope(t *testing.T) {
+	trend := newPowerTrend()
+	now := time.Date(2026, 2, 9, 10, 0, 0, 0, time.UTC)
+	trend.now = func() time.Time { return now }
+
+	// Rising by 0.25 dB every 30 seconds, 0.5 dB per minute
+	for i := 0; i < 15; i++ {
+		slopes := trend.observe(map[string]float64{"1|5": 40 + 2.5*float64(i)})
+		if i+1 < minPowerTrendSamples {
+			assert.Empty(t, slopes)
+		} else {
+			assert.InDelta(t, 0.5, slopes["1|5"], 1e-9)
+		}
+		now = now.Add(30 * time.Second)
+	}
+	assert.Len(t, trend.channels["1|5"], powerTrendSamples)
+}
+
+func TestPowerTrend_ChannelDisappears(t *testing.T) {
+	trend := newPowerTrend()
+	now := time.Date(2026, 2, 9, 10, 0, 0, 0, time.UTC)
+	trend.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		trend.observe(map[string]float64{"1|5": 40 + 10*float64(i), "2|6": 30})
+		now = now.Add(time.Minute)
+	}
+	assert.Len(t, trend.slopes(), 2)
+
+	// The modem reboots and channel 5 is lost
+	trend.observe(map[string]float64{"2|6": 30})
+	assert.NotContains(t, trend.slopes(), "1|5")
+
+	// When channel 5 comes back at a new level it is not compared with its
+	// level from before
+	now = now.Add(time.Minute)
+	trend.observe(map[string]float64{"1|5": -20, "2|6": 30})
+	now = now.Add(time.Minute)
+	slopes := trend.observe(map[string]float64{"1|5": -20, "2|6": 30})
+	assert.NotContains(t, slopes, "1|5")
+	assert.InDelta(t, 0.0, slopes["2|6"], 1e-9)
+}
+
+func TestPrometheusExporter_PowerTrend(t *testing.T) {
+	modem := &fake.Modem{}
+	exporter := ProExporter(modem)
+	now := time.Date(2026, 2, 9, 10, 0, 0, 0, time.UTC)
+	exporter.powerTrend.now = func() time.Time { return now }
+	metric := "modemstats_downstream_power_trend_db_per_min"
+
+	// Falling by 0.3 dB a minute
+	for i := 0; i < 4; i++ {
+		modem.Stats = utils.ModemStats{DownChannels: []utils.ModemChannel{
+			{ChannelID: 5, Channel: 1, Power: 70 - 3*i, Modulation: "QAM256", Scheme: "SC-QAM"},
+		}}
+		if i < 2 {
+			assert.Equal(t, 0, testutil.CollectAndCount(exporter, metric))
+		} else {
+			expected := fmt.Sprintf(`
+				# HELP %s Slope of the downstream channel power over recent scrapes in dB per minute
+				# TYPE %s gauge
+				%s{channel="1",id="5"} -0.3
+			`, metric, metric, metric)
+			assert.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(expected), metric))
+		}
+		now = now.Add(time.Minute)
+	}
+}
@@ -0,0 +1,101 @@
+package outputs
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/msh100/modem-stats/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ModemFactory builds the driver for a modem of the given type at the given
+// address
+type ModemFactory func(modemType, target string) (utils.DocsisModem, error)
+
+var (
+	probeSuccess = prometheus.NewDesc(
+		"probe_success",
+		"Whether the modem was scraped successfully",
+		nil, nil,
+	)
+	probeDuration = prometheus.NewDesc(
+		"probe_duration_seconds",
+		"How long the scrape of the modem took",
+		nil, nil,
+	)
+)
+
+// probeCollector scrapes a single modem, reporting whether the scrape
+// succeeded and how long it took alongside the modem's metrics
+type probeCollector struct {
+	exporter *PrometheusExporter
+	err      error
+}
+
+func (p *probeCollector) Describe(ch chan<- *prometheus.Desc) {
+	p.exporter.Describe(ch)
+	ch <- probeSuccess
+	ch <- probeDuration
+}
+
+func (p *probeCollector) Collect(ch chan<- prometheus.Metric) {
+	start := time.Now()
+	p.exporter.Collect(ch)
+	duration := time.Since(start)
+
+	success := 0.0
+	if p.err == nil {
+		success = 1
+	}
+	ch <- prometheus.MustNewConstMetric(probeSuccess, prometheus.GaugeValue, success)
+	ch <- prometheus.MustNewConstMetric(probeDuration, prometheus.GaugeValue, duration.Seconds())
+}
+
+// ProbeHandler serves the metrics of the modem given by the target and type
+// query parameters (as in /probe?target=192.168.100.1&type=superhub5), so one
+// exporter can scrape any number of modems configured in Prometheus, following
+// the multi-target exporter pattern. A driver is built for every request.
+func ProbeHandler(newModem ModemFactory, opts ...ExporterOption) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			http.Error(w, "target parameter is missing", http.StatusBadRequest)
+			return
+		}
+		modemType := r.URL.Query().Get("type")
+		if modemType == "" {
+			http.Error(w, "type parameter is missing", http.StatusBadRequest)
+			return
+		}
+
+		modem, err := newModem(modemType, target)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to create modem: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		// The driver only lives for this request, so there is nothing for the
+		// watchdog to recover or to fetch in the background, and probed modems
+		// are kept out of the configured modem's snapshot archive
+		probe := &probeCollector{}
+		probeOpts := append(append([]ExporterOption{}, opts...),
+			WithWatchdog(0, false),
+			WithFetchInterval(0),
+			WithSnapshots("", 0),
+			func(o *exporterOptions) {
+				o.onScrape = func(err error) { probe.err = err }
+			},
+		)
+		probe.exporter = ProExporter(modem, probeOpts...)
+		defer probe.exporter.Stop()
+
+		registry := prometheus.NewRegistry()
+		if err := registry.Register(probe); err != nil {
+			http.Error(w, fmt.Sprintf("failed to register modem: %v", err), http.StatusInternalServerError)
+			return
+		}
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,123 @@
+package outputs
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/msh100/modem-stats/modems/superhub5"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSuperhub5Server serves a SuperHub 5 REST API with a single downstream
+// channel
+func newSuperhub5Server(t *testing.T) *httptest.Server {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/cablemodem/downstream") {
+			w.Write([]byte(`{"downstream": {"channels": [{"channelType": "sc_qam", "channelId": 37, "frequency": 419000000, "power": 2.1, "modulation": "qam_256", "snr": 41, "correctedErrors": 246832, "uncorrectedErrors": 11087, "lockStatus": true}]}}`))
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func superhub5Factory(modemType, target string) (utils.DocsisModem, error) {
+	return &superhub5.Modem{IPAddress: target}, nil
+}
+
+func probe(t *testing.T, handler http.Handler, query url.Values) (int, string) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/probe?" + query.Encode())
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res.StatusCode, string(body)
+}
+
+func TestProbeHandler(t *testing.T) {
+	modemServer := newSuperhub5Server(t)
+	target := strings.TrimPrefix(modemServer.URL, "https://")
+
+	var gotType, gotTarget string
+	handler := ProbeHandler(func(modemType, target string) (utils.DocsisModem, error) {
+		gotType, gotTarget = modemType, target
+		return superhub5Factory(modemType, target)
+	})
+
+	status, body := probe(t, handler, url.Values{"target": {target}, "type": {"superhub5"}})
+	require.Equal(t, http.StatusOK, status, body)
+	assert.Equal(t, "superhub5", gotType)
+	assert.Equal(t, target, gotTarget)
+
+	assert.Contains(t, body, "probe_success 1")
+	assert.Contains(t, body, "probe_duration_seconds ")
+	assert.Contains(t, body, `modemstats_downstream_snr{channel="1",id="37",modulation="QAM256",scheme="SC-QAM"} 41`)
+	assert.Contains(t, body, `modemstats_downstream_frequency{channel="1",id="37",modulation="QAM256",scheme="SC-QAM"} 4.19e+08`)
+	assert.NotContains(t, body, "modemstats_build_info")
+}
+
+func TestProbeHandler_ExporterOptions(t *testing.T) {
+	modemServer := newSuperhub5Server(t)
+	target := strings.TrimPrefix(modemServer.URL, "https://")
+
+	handler := ProbeHandler(superhub5Factory, WithChannelIDLabels(), WithDisabledMetrics("downstream_frequency"))
+	status, body := probe(t, handler, url.Values{"target": {target}, "type": {"superhub5"}})
+	require.Equal(t, http.StatusOK, status, body)
+
+	assert.Contains(t, body, `modemstats_downstream_snr{id="37",modulation="QAM256",scheme="SC-QAM"} 41`)
+	assert.NotContains(t, body, "modemstats_downstream_frequency")
+}
+
+func TestProbeHandler_FetchInterval(t *testing.T) {
+	modemServer := newSuperhub5Server(t)
+	target := strings.TrimPrefix(modemServer.URL, "https://")
+
+	// Each probe fetches the modem itself rather than waiting on a background
+	// fetch which outlives it
+	handler := ProbeHandler(superhub5Factory, WithFetchInterval(time.Hour))
+	status, body := probe(t, handler, url.Values{"target": {target}, "type": {"superhub5"}})
+	require.Equal(t, http.StatusOK, status, body)
+	assert.Contains(t, body, "probe_success 1")
+	assert.Contains(t, body, `modemstats_downstream_snr{channel="1",id="37",modulation="QAM256",scheme="SC-QAM"} 41`)
+}
+
+func TestProbeHandler_UnreachableTarget(t *testing.T) {
+	modemServer := newSuperhub5Server(t)
+	target := strings.TrimPrefix(modemServer.URL, "https://")
+	modemServer.Close()
+
+	status, body := probe(t, ProbeHandler(superhub5Factory), url.Values{"target": {target}, "type": {"superhub5"}})
+	require.Equal(t, http.StatusOK, status, body)
+	assert.Contains(t, body, "probe_success 0")
+	assert.NotContains(t, body, "modemstats_downstream_snr")
+}
+
+func TestProbeHandler_BadRequest(t *testing.T) {
+	handler := ProbeHandler(func(modemType, target string) (utils.DocsisModem, error) {
+		return nil, assert.AnError
+	})
+
+	status, body := probe(t, handler, url.Values{"type": {"superhub5"}})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, body, "target parameter is missing")
+
+	status, body = probe(t, handler, url.Values{"target": {"192.168.100.1"}})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, body, "type parameter is missing")
+
+	status, body = probe(t, handler, url.Values{"target": {"192.168.100.1"}, "type": {"nonsense"}})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, body, "failed to create modem")
+}
@@ -2,45 +2,683 @@ package outputs
 
 import (
 	"fmt"
-	"log"
+	"math"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"runtime/debug"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/msh100/modem-stats/utils"
+	"github.com/msh100/modem-stats/utils/logging"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+const namespace = "modemstats"
+
+// ExporterOption configures optional behaviour of a PrometheusExporter
+type ExporterOption func(*exporterOptions)
+
+type exporterOptions struct {
+	disabledMetrics map[string]bool
+	flapWindow      time.Duration
+	maxUpPower      float64
+	channelIDLabels bool
+	watchdogLimit   int
+	watchdogReboot  bool
+	clockOffset     bool
+	eventCounts     bool
+	skipFirstCount  bool
+	minInterval     time.Duration
+	collectTimeout  time.Duration
+	fetchInterval   time.Duration
+	downBand        FrequencyBand
+	expectedDown    int
+	expectedUp      int
+	upBand          FrequencyBand
+	excludedIDs     map[int]bool
+	snapshotDir     string
+	snapshotMax     int
+	macLabel        bool
+	counterDeltas   bool
+	errorHistogram  bool
+	healthWeights   HealthWeights
+	statusLimits    StatusThresholds
+	debugEndpoints  bool
+	fetchStamps     bool
+
+	// constLabels are added to every metric
+	constLabels prometheus.Labels
+
+	// onScrape is called with the result of each scrape of the modem
+	onScrape func(error)
+}
+
+func newExporterOptions(opts []ExporterOption) *exporterOptions {
+	options := &exporterOptions{
+		disabledMetrics: make(map[string]bool),
+		flapWindow:      DefaultFlapWindow,
+		maxUpPower:      DefaultMaxUpstreamPower,
+		healthWeights:   DefaultHealthWeights,
+		statusLimits:    DefaultStatusThresholds,
+		watchdogLimit:   DefaultWatchdogThreshold,
+		downBand:        DefaultDownstreamBand,
+		upBand:          DefaultUpstreamBand,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// WithDisabledMetrics prevents the named metrics from being described or
+// collected. Names may be given with or without the "modemstats_" prefix.
+func WithDisabledMetrics(names ...string) ExporterOption {
+	return func(o *exporterOptions) {
+		for _, name := range names {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if !strings.HasPrefix(name, namespace+"_") {
+				name = namespace + "_" + name
+			}
+			o.disabledMetrics[name] = true
+		}
+	}
+}
+
+// WithFlapWindow sets how far back channel lock flaps are counted for the
+// recent flaps metric
+func WithFlapWindow(window time.Duration) ExporterOption {
+	return func(o *exporterOptions) {
+		if window > 0 {
+			o.flapWindow = window
+		}
+	}
+}
+
+// DefaultMaxUpstreamPower is the maximum upstream transmit power in dBmV used
+// to calculate headroom, the DOCSIS 3.0 limit with four bonded channels
+const DefaultMaxUpstreamPower = 51.0
+
+// WithMaxUpstreamPower sets the modem's maximum upstream transmit power in
+// dBmV, from which the upstream power headroom is calculated
+func WithMaxUpstreamPower(dBmV float64) ExporterOption {
+	return func(o *exporterOptions) {
+		if dBmV > 0 {
+			o.maxUpPower = dBmV
+		}
+	}
+}
+
+// WithHealthWeights sets the weighting of the components of the health
+// score. Invalid weights, such as all zero, are ignored.
+func WithHealthWeights(weights HealthWeights) ExporterOption {
+	return func(o *exporterOptions) {
+		if weights.valid() {
+			o.healthWeights = weights
+		}
+	}
+}
+
+// WithStatusThresholds sets the thresholds by which downstream channels'
+// power and SNR are graded. Invalid thresholds, such as a good power range
+// wider than the warning range, are ignored.
+func WithStatusThresholds(thresholds StatusThresholds) ExporterOption {
+	return func(o *exporterOptions) {
+		if thresholds.valid() {
+			o.statusLimits = thresholds
+		}
+	}
+}
+
+// DefaultWatchdogThreshold is the number of consecutive failed scrapes after
+// which the watchdog resets the modem's HTTP connections
+const DefaultWatchdogThreshold = 5
+
+// WithWatchdog sets the number of consecutive failed scrapes after which the
+// watchdog triggers (0 disables it), and whether it should also reboot modems
+// which support it
+func WithWatchdog(threshold int, reboot bool) ExporterOption {
+	return func(o *exporterOptions) {
+		if threshold >= 0 {
+			o.watchdogLimit = threshold
+		}
+		o.watchdogReboot = reboot
+	}
+}
+
+// WithClockOffset reports the offset of the modem's clock from the host's,
+// estimated from its event log. This fetches the event log along with every
+// fetch of the statistics, so is only enabled on request.
+func WithClockOffset() ExporterOption {
+	return func(o *exporterOptions) {
+		o.clockOffset = true
+	}
+}
+
+// WithEventCounts counts the entries of the modem's event log by priority and
+// code. Like the clock offset, this fetches the event log along with the
+// statistics.
+func WithEventCounts() ExporterOption {
+	return func(o *exporterOptions) {
+		o.eventCounts = true
+	}
+}
+
+// WithFetchTimestamps stamps the metrics built from the modem's statistics
+// with the time they were fetched, rather than leaving Prometheus to stamp
+// them with the time of the scrape. This keeps the samples aligned with the
+// modem when fetching in the background or throttling scrapes, but
+// Prometheus treats a series as stale once its last sample is over five
+// minutes old, so the modem must be fetched more often than that.
+func WithFetchTimestamps() ExporterOption {
+	return func(o *exporterOptions) {
+		o.fetchStamps = true
+	}
+}
+
+// WithCounterDeltas reports how far each channel's codeword error and timeout
+// counters have grown since the previous scrape, for those who want "errors
+// this scrape" rather than rate() over the counters
+func WithCounterDeltas() ExporterOption {
+	return func(o *exporterOptions) {
+		o.counterDeltas = true
+	}
+}
+
+// WithErrorHistogram reports the growth of each channel's codeword error
+// counters between scrapes as a native histogram, which Prometheus only
+// ingests when scraping with the protobuf format and native histograms
+// enabled
+func WithErrorHistogram() ExporterOption {
+	return func(o *exporterOptions) {
+		o.errorHistogram = true
+	}
+}
+
+// WithDebugEndpoints serves pages under /debug for inspecting what the
+// exporter has scraped, such as /debug/channels
+func WithDebugEndpoints() ExporterOption {
+	return func(o *exporterOptions) {
+		o.debugEndpoints = true
+	}
+}
+
+// WithMinScrapeInterval sets the minimum interval between fetches from the
+// modem. Scrapes within the interval are served the previous result, so a
+// short scrape interval or manual requests cannot hammer the modem.
+func WithMinScrapeInterval(interval time.Duration) ExporterOption {
+	return func(o *exporterOptions) {
+		o.minInterval = interval
+	}
+}
+
+// WithCollectTimeout sets how long a scrape waits for the modem before it is
+// served the previous result and reported as failed, so a hung modem cannot
+// hold up a scrape past Prometheus's scrape timeout. The fetch carries on in
+// the background and is picked up by the next scrape. 0 waits indefinitely.
+func WithCollectTimeout(timeout time.Duration) ExporterOption {
+	return func(o *exporterOptions) {
+		o.collectTimeout = timeout
+	}
+}
+
+// WithFetchInterval fetches from the modem in the background on a fixed
+// interval rather than on each scrape, with every scrape served the result of
+// the last fetch without waiting on the modem. This suits modems too slow to
+// fetch within a scrape. The fetching is stopped by Stop.
+func WithFetchInterval(interval time.Duration) ExporterOption {
+	return func(o *exporterOptions) {
+		o.fetchInterval = interval
+	}
+}
+
+// WithFrequencyBands sets the downstream and upstream frequency bands in which
+// channels are expected, for regional frequency plans. Channels outside their
+// band are counted by the out of band metric. An invalid band is ignored.
+func WithFrequencyBands(downstream, upstream FrequencyBand) ExporterOption {
+	return func(o *exporterOptions) {
+		if downstream.valid() {
+			o.downBand = downstream
+		}
+		if upstream.valid() {
+			o.upBand = upstream
+		}
+	}
+}
+
+// WithExpectedChannels sets the number of downstream and upstream channels the
+// modem is expected to bond, from which the bonding ratio of each direction is
+// reported. A direction with no expected count (0) has no ratio.
+func WithExpectedChannels(downstream, upstream int) ExporterOption {
+	return func(o *exporterOptions) {
+		o.expectedDown = downstream
+		o.expectedUp = upstream
+	}
+}
+
+// WithExcludedChannels leaves the channels with the given IDs (in either
+// direction) out of the metrics, as if the modem had not reported them, so
+// known-bad or unused channels do not raise alerts
+func WithExcludedChannels(ids ...int) ExporterOption {
+	return func(o *exporterOptions) {
+		if o.excludedIDs == nil {
+			o.excludedIDs = make(map[int]bool)
+		}
+		for _, id := range ids {
+			o.excludedIDs[id] = true
+		}
+	}
+}
+
+// WithSnapshots archives each fetch from the modem in dir, keeping the newest
+// maxFiles (DefaultSnapshotMaxFiles when not positive)
+func WithSnapshots(dir string, maxFiles int) ExporterOption {
+	return func(o *exporterOptions) {
+		o.snapshotDir = dir
+		o.snapshotMax = maxFiles
+	}
+}
+
+// WithMACLabel adds the modem's MAC address to every metric as the mac label,
+// a stable identifier which survives the modem's address changing. The modem
+// is scraped when the exporter is created to learn it.
+func WithMACLabel() ExporterOption {
+	return func(o *exporterOptions) {
+		o.macLabel = true
+	}
+}
+
+// WithFirstScrapeCountersSkipped withholds the counters the modem accumulates
+// from boot (codewords and timeouts) from the first successful scrape. Their
+// series then start from the second scrape, so the first increase seen by
+// rate() is not everything counted since the modem booted. Gauges are
+// reported from the first scrape as usual.
+func WithFirstScrapeCountersSkipped() ExporterOption {
+	return func(o *exporterOptions) {
+		o.skipFirstCount = true
+	}
+}
+
+// WithChannelIDLabels labels channels by their ID alone, dropping the channel
+// label (the channel's position in the modem's list). The position changes
+// whenever the modem reorders its channels while the ID is stable.
+func WithChannelIDLabels() ExporterOption {
+	return func(o *exporterOptions) {
+		o.channelIDLabels = true
+	}
+}
+
+// channelLabelNames returns the label names identifying a channel, followed
+// by any extra labels
+func (o *exporterOptions) channelLabelNames(extra ...string) []string {
+	labels := []string{"channel", "id"}
+	if o.channelIDLabels {
+		labels = []string{"id"}
+	}
+	return append(labels, extra...)
+}
+
+// newDesc builds a metric description, returning nil if the metric is disabled
+func (o *exporterOptions) newDesc(subsystem, name, help string, labels []string) *prometheus.Desc {
+	fqName := prometheus.BuildFQName(namespace, subsystem, name)
+	if o.disabledMetrics[fqName] {
+		return nil
+	}
+	return prometheus.NewDesc(fqName, help, labels, o.constLabels)
+}
+
+// newErrorHistogram builds the native histogram of the growth of each
+// channel's codeword error counters between scrapes, returning nil if it is
+// disabled
+func (o *exporterOptions) newErrorHistogram() *prometheus.HistogramVec {
+	fqName := prometheus.BuildFQName(namespace, "downstream", "errors_scrape_distribution")
+	if o.disabledMetrics[fqName] {
+		return nil
+	}
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        fqName,
+		Help:        "Distribution of the number of codeword errors per channel between scrapes, by counter",
+		ConstLabels: o.constLabels,
+		// Without classic buckets only the native histogram is exposed,
+		// with each bucket 10% wider than the last
+		NativeHistogramBucketFactor: 1.1,
+	}, o.channelLabelNames("counter"))
+}
+
+// sendMetric emits a metric unless its description has been disabled
+func sendMetric(ch chan<- prometheus.Metric, desc *prometheus.Desc, valueType prometheus.ValueType, value float64, labels ...string) {
+	if desc == nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(desc, valueType, value, labels...)
+}
+
+// provisioningStates are always reported by the provisioning status metric so
+// that a change of state is visible as one series dropping to 0
+var provisioningStates = []string{
+	"offline",
+	"ranging",
+	"dhcp",
+	"tftp",
+	"registration",
+	"operational",
+}
+
+// rangingStates are always reported by the upstream ranging status metric, as
+// for provisioningStates
+var rangingStates = []string{
+	"success",
+	"continue",
+	"abort",
+}
+
+// sendStateSet reports each of the known states, 1 for the current state and
+// 0 for the others, followed by a state label. A current state which is not
+// known is reported as well, so it is not lost.
+func sendStateSet(ch chan<- prometheus.Metric, desc *prometheus.Desc, states []string, current string, labels ...string) {
+	current = strings.ToLower(current)
+	known := false
+	for _, state := range states {
+		value := 0.0
+		if state == current {
+			value = 1.0
+			known = true
+		}
+		sendMetric(ch, desc, prometheus.GaugeValue, value, append(labels, state)...)
+	}
+	if !known {
+		sendMetric(ch, desc, prometheus.GaugeValue, 1.0, append(labels, current)...)
+	}
+}
+
+// defaultChannelWidths (in Hz) are used for the bonded bandwidth when a modem
+// does not report a channel's width
+var defaultChannelWidths = map[string]int{
+	"SC-QAM": 8000000, // EuroDOCSIS
+	"ATDMA":  6400000,
+}
+
+// minimumSNR is the approximate SNR in dB a downstream channel needs for its
+// modulation to run without errors
+var minimumSNR = map[string]float64{
+	"QAM64":   24,
+	"QAM256":  30,
+	"QAM1024": 36,
+	"QAM4096": 42,
+}
+
+// snrMargin returns how far a downstream channel's SNR in dB is above the
+// minimum its modulation needs, as reported by the modem or otherwise from
+// minimumSNR. It returns false if the channel has no margin: OFDM channels
+// report MER rather than SNR, and some modems a link quality percentage.
+func snrMargin(c utils.ModemChannel) (float64, bool) {
+	if c.HasSNRMargin {
+		return float64(c.SNRMargin) / 10, true
+	}
+	required, ok := minimumSNR[c.Modulation]
+	if !ok || strings.HasPrefix(c.Scheme, "OFDM") || c.HasQualityPercent {
+		return 0, false
+	}
+	return float64(c.Snr)/10 - required, true
+}
+
+// frequencyCoverage returns the lowest and highest channel frequencies and the
+// total bonded bandwidth of a set of channels. Channels without a frequency
+// (such as OFDM channels on some modems) only count towards the bandwidth.
+func frequencyCoverage(channels []utils.ModemChannel) (int, int, int) {
+	minFreq, maxFreq, bandwidth := 0, 0, 0
+	for _, c := range channels {
+		if c.Frequency > 0 {
+			if minFreq == 0 || c.Frequency < minFreq {
+				minFreq = c.Frequency
+			}
+			if c.Frequency > maxFreq {
+				maxFreq = c.Frequency
+			}
+		}
+
+		if c.ChannelWidth > 0 {
+			bandwidth += c.ChannelWidth
+		} else {
+			bandwidth += defaultChannelWidths[c.Scheme]
+		}
+	}
+	return minFreq, maxFreq, bandwidth
+}
+
 type PrometheusExporter struct {
-	downFrequency   *prometheus.Desc
-	downPower       *prometheus.Desc
-	downSNR         *prometheus.Desc
-	downPreRS       *prometheus.Desc
-	downPostRS      *prometheus.Desc
-	downLocked      *prometheus.Desc
-	upFrequency     *prometheus.Desc
-	upPower         *prometheus.Desc
-	upLocked        *prometheus.Desc
-	upSymbolRate    *prometheus.Desc
-	upT1Timeout     *prometheus.Desc
-	upT2Timeout     *prometheus.Desc
-	upT3Timeout     *prometheus.Desc
-	upT4Timeout     *prometheus.Desc
-	maxrate         *prometheus.Desc
-	maxburst        *prometheus.Desc
-	fetchtime       *prometheus.Desc
-	downNoise       *prometheus.Desc
-	downAttenuation *prometheus.Desc
-	upNoise         *prometheus.Desc
-	upAttenuation   *prometheus.Desc
-
-	docsisModem utils.DocsisModem
+	downFrequency    *prometheus.Desc
+	downPower        *prometheus.Desc
+	downPowerStatus  *prometheus.Desc
+	downSNR          *prometheus.Desc
+	downSNRStatus    *prometheus.Desc
+	downQuality      *prometheus.Desc
+	downPreRS        *prometheus.Desc
+	downPostRS       *prometheus.Desc
+	downErrorsDelta  *prometheus.Desc
+	downErrorsScrape *prometheus.Desc
+	downCorrected    *prometheus.Desc
+	downInterleaver  *prometheus.Desc
+	downLocked       *prometheus.Desc
+	downPLCLocked    *prometheus.Desc
+	downPartial      *prometheus.Desc
+	downExtra        *prometheus.Desc
+	upFrequency      *prometheus.Desc
+	upPower          *prometheus.Desc
+	upLocked         *prometheus.Desc
+	upSymbolRate     *prometheus.Desc
+	upRanging        *prometheus.Desc
+	upOFDMAPower     *prometheus.Desc
+	upT1Timeout      *prometheus.Desc
+	upT2Timeout      *prometheus.Desc
+	upT3Timeout      *prometheus.Desc
+	upT4Timeout      *prometheus.Desc
+	upTimeoutsScrape *prometheus.Desc
+	maxrate          *prometheus.Desc
+	maxburst         *prometheus.Desc
+	flowActive       *prometheus.Desc
+	fetchtime        *prometheus.Desc
+	up               *prometheus.Desc
+	statsSource      *prometheus.Desc
+	downChannels     *prometheus.Desc
+	upChannels       *prometheus.Desc
+	bondingRatio     *prometheus.Desc
+	downLockRatio    *prometheus.Desc
+	upLockRatio      *prometheus.Desc
+	downNoise        *prometheus.Desc
+	downAttenuation  *prometheus.Desc
+	upNoise          *prometheus.Desc
+	upAttenuation    *prometheus.Desc
+	provisioning     *prometheus.Desc
+	docsisState      *prometheus.Desc
+	endpointUp       *prometheus.Desc
+	endpointDuration *prometheus.Desc
+	endpointSlowest  *prometheus.Desc
+	info             *prometheus.Desc
+	downFreqMin      *prometheus.Desc
+	downFreqMax      *prometheus.Desc
+	downBandwidth    *prometheus.Desc
+	upFreqMin        *prometheus.Desc
+	upFreqMax        *prometheus.Desc
+	upBandwidth      *prometheus.Desc
+	opticalRxPower   *prometheus.Desc
+	opticalTxPower   *prometheus.Desc
+	docsisVersion    *prometheus.Desc
+	downFlaps        *prometheus.Desc
+	downRecentFlaps  *prometheus.Desc
+	downPowerTrend   *prometheus.Desc
+	downSNRMargin    *prometheus.Desc
+	upPowerHeadroom  *prometheus.Desc
+	modemRequests    *prometheus.Desc
+	bridgeMode       *prometheus.Desc
+	watchdogTrigger  *prometheus.Desc
+	throttleCount    *prometheus.Desc
+	statsAge         *prometheus.Desc
+	collectPanics    *prometheus.Desc
+	outOfBand        *prometheus.Desc
+	freqOverlap      *prometheus.Desc
+	configFile       *prometheus.Desc
+	firmware         *prometheus.Desc
+	configChanges    *prometheus.Desc
+	clockOffset      *prometheus.Desc
+	events           *prometheus.Desc
+	uptime           *prometheus.Desc
+	connUptime       *prometheus.Desc
+	healthScore      *prometheus.Desc
+
+	// errorHistogram is a native histogram, which has no const form so is
+	// observed into on each scrape and collected directly
+	errorHistogram *prometheus.HistogramVec
+
+	docsisModem     utils.DocsisModem
+	requestHost     string
+	flaps           *flapDetector
+	powerTrend      *powerTrend
+	errorDeltas     *counterDeltas
+	counterDeltas   *counterDeltas
+	health          *healthScorer
+	eventCounter    *eventCounter
+	bands           *bandChecker
+	overlaps        *overlapChecker
+	configs         *configTracker
+	maxUpPower      float64
+	statusLimits    StatusThresholds
+	channelIDLabels bool
+	watchdog        *watchdog
+	throttle        *scrapeThrottle
+	expectedDown    int
+	expectedUp      int
+	excludedIDs     map[int]bool
+	onScrape        func(error)
+
+	// scrapeTimeDescs are not stamped with the time of the fetch, nil
+	// unless WithFetchTimestamps
+	scrapeTimeDescs map[*prometheus.Desc]bool
+
+	skipFirstCount bool
+	scrapedMu      sync.Mutex
+	scraped        bool
+
+	panicsMu sync.Mutex
+	panics   int
+}
+
+// Stop stops fetching from the modem in the background, if started by
+// WithFetchInterval
+func (p *PrometheusExporter) Stop() {
+	p.throttle.stopFetching()
+}
+
+// panicCount returns the number of scrapes which have panicked, whether
+// fetching from the modem or collecting the metrics
+func (p *PrometheusExporter) panicCount() int {
+	p.panicsMu.Lock()
+	defer p.panicsMu.Unlock()
+	return p.panics + p.throttle.panicCount()
+}
+
+// recoverCollect reports a scrape which panicked as failed, rather than
+// taking the exporter down with it
+func (p *PrometheusExporter) recoverCollect(ch chan<- prometheus.Metric, r interface{}) {
+	logging.Errorf("Recovered from panic collecting metrics: %v\n%s", r, debug.Stack())
+	p.panicsMu.Lock()
+	p.panics++
+	p.panicsMu.Unlock()
+
+	sendMetric(
+		ch,
+		p.collectPanics,
+		prometheus.CounterValue,
+		float64(p.panicCount()),
+	)
+	sendMetric(
+		ch,
+		p.up,
+		prometheus.GaugeValue,
+		0,
+	)
+}
+
+// withholdCounters reports whether the counters accumulated by the modem
+// should be withheld from this scrape, which is only the case for the first
+// successful scrape when WithFirstScrapeCountersSkipped is set
+func (p *PrometheusExporter) withholdCounters(err error) bool {
+	if !p.skipFirstCount || err != nil {
+		return false
+	}
+	p.scrapedMu.Lock()
+	defer p.scrapedMu.Unlock()
+	first := !p.scraped
+	p.scraped = true
+	return first
+}
+
+// channelLabels returns the label values identifying a channel, followed by
+// any extra values, matching exporterOptions.channelLabelNames
+func (p *PrometheusExporter) channelLabels(c utils.ModemChannel, extra ...string) []string {
+	labels := []string{strconv.Itoa(c.Channel), strconv.Itoa(c.ChannelID)}
+	if p.channelIDLabels {
+		labels = []string{strconv.Itoa(c.ChannelID)}
+	}
+	return append(labels, extra...)
+}
+
+// sendStatus sends a series for every status level of a downstream channel,
+// 1 for the level it is at and 0 for the others
+func (p *PrometheusExporter) sendStatus(ch chan<- prometheus.Metric, desc *prometheus.Desc, c utils.ModemChannel, status string) {
+	for _, level := range statusLevels {
+		value := 0.0
+		if level == status {
+			value = 1
+		}
+		sendMetric(ch, desc, prometheus.GaugeValue, value, p.channelLabels(c, c.Modulation, c.Scheme, level)...)
+	}
 }
 
 func (p *PrometheusExporter) Collect(ch chan<- prometheus.Metric) {
-	utils.ResetStats(p.docsisModem)
-	modemStats, _ := utils.FetchStats(p.docsisModem)
+	// ch is replaced when stamping the metrics, by a channel which is closed
+	// before recovering
+	defer func(ch chan<- prometheus.Metric) {
+		if r := recover(); r != nil {
+			p.recoverCollect(ch, r)
+		}
+	}(ch)
+
+	modemStats, fetchedAt, fetched, throttled, err := p.throttle.fetch()
+	// A scrape which timed out reports the modem down alongside the previous
+	// result, which at the previous fetch's time would contradict it
+	if p.scrapeTimeDescs != nil && !fetchedAt.IsZero() && err != errCollectTimeout {
+		stamped, done := p.stampMetrics(ch, fetchedAt)
+		defer done()
+		ch = stamped
+	}
+	modemStats = maskChannels(modemStats, p.excludedIDs)
+	// A throttled scrape repeats the last result, which the watchdog has
+	// already seen
+	var watchdogTriggers int
+	if fetched {
+		watchdogTriggers = p.watchdog.observe(err)
+	} else {
+		watchdogTriggers = p.watchdog.triggerCount()
+	}
+	if p.onScrape != nil {
+		p.onScrape(err)
+	}
+	withholdCounters := p.withholdCounters(err)
+	// A failed scrape has no counts to compare
+	var counterDeltas map[counterKey]int
+	if err == nil && (p.downErrorsScrape != nil || p.upTimeoutsScrape != nil || p.errorHistogram != nil) {
+		counterDeltas, _ = p.counterDeltas.observe(modemStats)
+	}
 
 	for _, c := range modemStats.DownChannels {
 		var labels []string
@@ -50,67 +688,184 @@ func (p *PrometheusExporter) Collect(ch chan<- prometheus.Metric) {
 				strconv.Itoa(c.ChannelID),
 			}
 
-			ch <- prometheus.MustNewConstMetric(
+			sendMetric(
+				ch,
 				p.downNoise,
 				prometheus.GaugeValue,
 				float64(c.Noise),
 				labels...,
 			)
-			ch <- prometheus.MustNewConstMetric(
+			sendMetric(
+				ch,
 				p.downAttenuation,
 				prometheus.GaugeValue,
 				float64(c.Attenuation),
 				labels...,
 			)
 		} else {
-			labels = []string{
-				strconv.Itoa(c.Channel),
-				strconv.Itoa(c.ChannelID),
-				c.Modulation,
-				c.Scheme,
-			}
+			labels = p.channelLabels(c, c.Modulation, c.Scheme)
 
-			ch <- prometheus.MustNewConstMetric(
+			sendMetric(
+				ch,
 				p.downFrequency,
 				prometheus.GaugeValue,
 				float64(c.Frequency),
 				labels...,
 			)
-			ch <- prometheus.MustNewConstMetric(
+			sendMetric(
+				ch,
 				p.downPower,
 				prometheus.GaugeValue,
 				float64(c.Power),
 				labels...,
 			)
-			ch <- prometheus.MustNewConstMetric(
-				p.downSNR,
+			// A link quality percentage does not convert to dB, so is
+			// reported in place of the SNR and its margin
+			if c.HasQualityPercent {
+				sendMetric(
+					ch,
+					p.downQuality,
+					prometheus.GaugeValue,
+					c.QualityPercent,
+					labels...,
+				)
+			} else {
+				sendMetric(
+					ch,
+					p.downSNR,
+					prometheus.GaugeValue,
+					float64(c.Snr),
+					labels...,
+				)
+				p.sendStatus(ch, p.downSNRStatus, c, p.statusLimits.snrStatus(c.Snr))
+			}
+			p.sendStatus(ch, p.downPowerStatus, c, p.statusLimits.powerStatus(c.Power))
+			if margin, ok := snrMargin(c); ok {
+				sendMetric(
+					ch,
+					p.downSNRMargin,
+					prometheus.GaugeValue,
+					margin,
+					labels...,
+				)
+			}
+			if !withholdCounters {
+				sendMetric(
+					ch,
+					p.downPreRS,
+					prometheus.CounterValue,
+					float64(c.Prerserr),
+					labels...,
+				)
+				sendMetric(
+					ch,
+					p.downPostRS,
+					prometheus.CounterValue,
+					float64(c.Postrserr),
+					labels...,
+				)
+			}
+			for _, counter := range []string{"prerserr", "postrserr"} {
+				if d, ok := counterDeltas[channelCounterKey("downstream", c, counter)]; ok {
+					sendMetric(
+						ch,
+						p.downErrorsScrape,
+						prometheus.GaugeValue,
+						float64(d),
+						p.channelLabels(c, c.Modulation, c.Scheme, counter)...,
+					)
+					// A throttled scrape repeats the last counts, which
+					// would be observed as a scrape without errors
+					if p.errorHistogram != nil && fetched {
+						p.errorHistogram.WithLabelValues(p.channelLabels(c, counter)...).Observe(float64(d))
+					}
+				}
+			}
+			if c.InterleaverDepth > 0 {
+				sendMetric(
+					ch,
+					p.downInterleaver,
+					prometheus.GaugeValue,
+					float64(c.InterleaverDepth),
+					labels...,
+				)
+			}
+			if ratio, ok := utils.CorrectedRatio(c); ok {
+				sendMetric(
+					ch,
+					p.downCorrected,
+					prometheus.GaugeValue,
+					ratio,
+					labels...,
+				)
+			}
+			lockedVal := 0.0
+			if c.Locked {
+				lockedVal = 1.0
+			}
+			sendMetric(
+				ch,
+				p.downLocked,
 				prometheus.GaugeValue,
-				float64(c.Snr),
+				lockedVal,
 				labels...,
 			)
-			ch <- prometheus.MustNewConstMetric(
-				p.downPreRS,
-				prometheus.GaugeValue,
-				float64(c.Prerserr),
-				labels...,
+			if c.HasPLCLock && strings.HasPrefix(c.Scheme, "OFDM") {
+				plcLockedVal := 0.0
+				if c.PLCLocked {
+					plcLockedVal = 1.0
+				}
+				sendMetric(
+					ch,
+					p.downPLCLocked,
+					prometheus.GaugeValue,
+					plcLockedVal,
+					labels...,
+				)
+			}
+			flapLabels := p.channelLabels(c)
+			totalFlaps, recentFlaps := p.flaps.observe(strings.Join(flapLabels, "|"), c.Locked)
+			sendMetric(
+				ch,
+				p.downFlaps,
+				prometheus.CounterValue,
+				float64(totalFlaps),
+				flapLabels...,
 			)
-			ch <- prometheus.MustNewConstMetric(
-				p.downPostRS,
+			sendMetric(
+				ch,
+				p.downRecentFlaps,
 				prometheus.GaugeValue,
-				float64(c.Postrserr),
-				labels...,
+				float64(recentFlaps),
+				flapLabels...,
 			)
-			lockedVal := 0.0
-			if c.Locked {
-				lockedVal = 1.0
+			partialVal := 0.0
+			if c.PartialService {
+				partialVal = 1.0
 			}
-			ch <- prometheus.MustNewConstMetric(
-				p.downLocked,
+			sendMetric(
+				ch,
+				p.downPartial,
 				prometheus.GaugeValue,
-				lockedVal,
+				partialVal,
 				labels...,
 			)
 		}
+
+		fields := make([]string, 0, len(c.Extra))
+		for field := range c.Extra {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			sendMetric(
+				ch,
+				p.downExtra,
+				prometheus.GaugeValue,
+				c.Extra[field],
+				append(labels, field)...,
+			)
+		}
 	}
 
 	for _, c := range modemStats.UpChannels {
@@ -121,84 +876,127 @@ func (p *PrometheusExporter) Collect(ch chan<- prometheus.Metric) {
 				strconv.Itoa(c.ChannelID),
 			}
 
-			ch <- prometheus.MustNewConstMetric(
+			sendMetric(
+				ch,
 				p.upNoise,
 				prometheus.GaugeValue,
 				float64(c.Noise),
 				labels...,
 			)
-			ch <- prometheus.MustNewConstMetric(
+			sendMetric(
+				ch,
 				p.upAttenuation,
 				prometheus.GaugeValue,
 				float64(c.Attenuation),
 				labels...,
 			)
 		} else {
-			labels = []string{
-				strconv.Itoa(c.Channel),
-				strconv.Itoa(c.ChannelID),
-			}
+			labels = p.channelLabels(c)
 
-			ch <- prometheus.MustNewConstMetric(
+			sendMetric(
+				ch,
 				p.upPower,
 				prometheus.GaugeValue,
 				float64(c.Power),
 				labels...,
 			)
-			ch <- prometheus.MustNewConstMetric(
+			sendMetric(
+				ch,
 				p.upFrequency,
 				prometheus.GaugeValue,
 				float64(c.Frequency),
 				labels...,
 			)
+			// Power is in tenths of a dBmV, work in tenths to avoid float noise
+			sendMetric(
+				ch,
+				p.upPowerHeadroom,
+				prometheus.GaugeValue,
+				(math.Round(p.maxUpPower*10)-float64(c.Power))/10,
+				labels...,
+			)
 			lockedVal := 0.0
 			if c.Locked {
 				lockedVal = 1.0
 			}
-			ch <- prometheus.MustNewConstMetric(
+			sendMetric(
+				ch,
 				p.upLocked,
 				prometheus.GaugeValue,
 				lockedVal,
 				labels...,
 			)
 			if c.SymbolRate > 0 {
-				ch <- prometheus.MustNewConstMetric(
+				sendMetric(
+					ch,
 					p.upSymbolRate,
 					prometheus.GaugeValue,
 					float64(c.SymbolRate),
 					labels...,
 				)
 			}
-			ch <- prometheus.MustNewConstMetric(
-				p.upT1Timeout,
-				prometheus.CounterValue,
-				float64(c.T1Timeout),
-				labels...,
-			)
-			ch <- prometheus.MustNewConstMetric(
-				p.upT2Timeout,
-				prometheus.CounterValue,
-				float64(c.T2Timeout),
-				labels...,
-			)
-			ch <- prometheus.MustNewConstMetric(
-				p.upT3Timeout,
-				prometheus.CounterValue,
-				float64(c.T3Timeout),
-				labels...,
-			)
-			ch <- prometheus.MustNewConstMetric(
-				p.upT4Timeout,
-				prometheus.CounterValue,
-				float64(c.T4Timeout),
-				labels...,
-			)
+			if c.RangingStatus != "" {
+				sendStateSet(ch, p.upRanging, rangingStates, c.RangingStatus, labels...)
+			}
+			if c.Scheme == "OFDMA" {
+				for _, subcarriers := range c.SubcarrierPowers {
+					sendMetric(
+						ch,
+						p.upOFDMAPower,
+						prometheus.GaugeValue,
+						float64(subcarriers.Power)/10,
+						p.channelLabels(c, fmt.Sprintf("%d-%d", subcarriers.FirstSubcarrier, subcarriers.LastSubcarrier))...,
+					)
+				}
+			}
+			if !withholdCounters {
+				sendMetric(
+					ch,
+					p.upT1Timeout,
+					prometheus.CounterValue,
+					float64(c.T1Timeout),
+					labels...,
+				)
+				sendMetric(
+					ch,
+					p.upT2Timeout,
+					prometheus.CounterValue,
+					float64(c.T2Timeout),
+					labels...,
+				)
+				sendMetric(
+					ch,
+					p.upT3Timeout,
+					prometheus.CounterValue,
+					float64(c.T3Timeout),
+					labels...,
+				)
+				sendMetric(
+					ch,
+					p.upT4Timeout,
+					prometheus.CounterValue,
+					float64(c.T4Timeout),
+					labels...,
+				)
+			}
+			for _, timeout := range []string{"t1", "t2", "t3", "t4"} {
+				if d, ok := counterDeltas[channelCounterKey("upstream", c, timeout)]; ok {
+					sendMetric(
+						ch,
+						p.upTimeoutsScrape,
+						prometheus.GaugeValue,
+						float64(d),
+						p.channelLabels(c, timeout)...,
+					)
+				}
+			}
 		}
 	}
 
 	for _, config := range modemStats.Configs {
 		serviceFlowId := strconv.Itoa(config.ServiceFlowId)
-		ch <- prometheus.MustNewConstMetric(
+		sendMetric(
+			ch,
 			p.maxrate,
 			prometheus.GaugeValue,
 			float64(config.Maxrate),
@@ -206,7 +1004,8 @@ func (p *PrometheusExporter) Collect(ch chan<- prometheus.Metric) {
 			serviceFlowId,
 		)
 		if config.Maxburst != 0 {
-			ch <- prometheus.MustNewConstMetric(
+			sendMetric(
+				ch,
 				p.maxburst,
 				prometheus.GaugeValue,
 				float64(config.Maxburst),
@@ -214,41 +1013,475 @@ func (p *PrometheusExporter) Collect(ch chan<- prometheus.Metric) {
 				serviceFlowId,
 			)
 		}
+		if config.State != "" {
+			activeVal := 0.0
+			if config.State == utils.ServiceFlowActive {
+				activeVal = 1.0
+			}
+			sendMetric(ch, p.flowActive, prometheus.GaugeValue, activeVal, config.Config, serviceFlowId)
+		}
+	}
+
+	if modemStats.ModemType != utils.TypeVDSL {
+		p.collectFrequencyCoverage(ch, modemStats.DownChannels, p.downFreqMin, p.downFreqMax, p.downBandwidth)
+		p.collectFrequencyCoverage(ch, modemStats.UpChannels, p.upFreqMin, p.upFreqMax, p.upBandwidth)
+		// A throttled scrape repeats channels which have already been counted
+		p.collectOutOfBand(ch, "downstream", utils.CapDownstreamChannels, modemStats.DownChannels, fetched && err == nil)
+		p.collectOutOfBand(ch, "upstream", utils.CapUpstreamChannels, modemStats.UpChannels, fetched && err == nil)
+		p.collectFrequencyOverlap(ch, "downstream", utils.CapDownstreamChannels, modemStats.DownChannels, fetched && err == nil)
+		p.collectFrequencyOverlap(ch, "upstream", utils.CapUpstreamChannels, modemStats.UpChannels, fetched && err == nil)
+		p.collectPowerTrend(ch, modemStats.DownChannels, fetched && err == nil)
 	}
 
-	ch <- prometheus.MustNewConstMetric(
+	if modemStats.ModemType != utils.TypeVDSL {
+		negotiated := utils.NegotiatedDocsisVersion(modemStats)
+		if modemStats.DocsisCapability != "" || negotiated != "" {
+			sendMetric(
+				ch,
+				p.docsisVersion,
+				prometheus.GaugeValue,
+				1.0,
+				modemStats.DocsisCapability,
+				negotiated,
+			)
+		}
+	}
+
+	if modemStats.HasOperatingMode {
+		bridgeVal := 0.0
+		if modemStats.BridgeMode {
+			bridgeVal = 1.0
+		}
+		sendMetric(
+			ch,
+			p.bridgeMode,
+			prometheus.GaugeValue,
+			bridgeVal,
+		)
+	}
+
+	if modemStats.HasUptime {
+		sendMetric(
+			ch,
+			p.uptime,
+			prometheus.GaugeValue,
+			float64(modemStats.Uptime),
+		)
+	}
+	if modemStats.HasConnectivityUptime {
+		sendMetric(
+			ch,
+			p.connUptime,
+			prometheus.GaugeValue,
+			float64(modemStats.ConnectivityUptime),
+		)
+	}
+
+	if modemStats.HasOptics {
+		sendMetric(
+			ch,
+			p.opticalRxPower,
+			prometheus.GaugeValue,
+			float64(modemStats.OpticalRxPower)/10,
+		)
+		sendMetric(
+			ch,
+			p.opticalTxPower,
+			prometheus.GaugeValue,
+			float64(modemStats.OpticalTxPower)/10,
+		)
+	}
+
+	if modemStats.ProvisioningStatus != "" {
+		sendStateSet(ch, p.provisioning, provisioningStates, modemStats.ProvisioningStatus)
+	}
+	if modemStats.DocsisState != "" {
+		state := utils.NormalizeDocsisState(modemStats.DocsisState)
+		sendMetric(ch, p.docsisState, prometheus.GaugeValue, float64(utils.DocsisStateOrdinal(state)), state)
+	}
+	for endpoint, up := range modemStats.EndpointUp {
+		endpointVal := 0.0
+		if up {
+			endpointVal = 1.0
+		}
+		sendMetric(ch, p.endpointUp, prometheus.GaugeValue, endpointVal, endpoint)
+	}
+	for endpoint, duration := range modemStats.EndpointDurations {
+		sendMetric(ch, p.endpointDuration, prometheus.GaugeValue, duration.Seconds(), endpoint)
+	}
+	if slowest, ok := slowestEndpoint(modemStats.EndpointDurations); ok {
+		sendMetric(ch, p.endpointSlowest, prometheus.GaugeValue, 1, slowest)
+	}
+
+	annex := utils.DownstreamAnnex(modemStats)
+	if modemStats.WanIP != "" || annex != "" {
+		sendMetric(
+			ch,
+			p.info,
+			prometheus.GaugeValue,
+			1.0,
+			modemStats.WanIP,
+			annex,
+		)
+	}
+
+	for key, count := range utils.HostRequestCounts(p.requestHost) {
+		sendMetric(
+			ch,
+			p.modemRequests,
+			prometheus.CounterValue,
+			float64(count),
+			key.Endpoint,
+			key.Result,
+		)
+	}
+
+	// A failed scrape has no counts to compare, while a throttled one repeats
+	// the last counts and so reports no new errors
+	if err == nil && p.downErrorsDelta != nil {
+		if deltas, ok := p.errorDeltas.observe(modemStats); ok {
+			for _, counter := range []string{"prerserr", "postrserr"} {
+				sendMetric(ch, p.downErrorsDelta, prometheus.GaugeValue, float64(sumCounter(deltas, counter)), counter)
+			}
+		}
+	}
+	if p.errorHistogram != nil {
+		p.errorHistogram.Collect(ch)
+	}
+	if err == nil && p.healthScore != nil {
+		if score, ok := p.health.observe(modemStats, fetched); ok {
+			sendMetric(ch, p.healthScore, prometheus.GaugeValue, score)
+		}
+	}
+
+	p.collectEventLog(ch, fetched)
+	// A throttled scrape repeats a config which has already been compared
+	p.collectConfig(ch, modemStats, err == nil, fetched && err == nil)
+
+	// Channel counts are reported even when there are no channels (such as
+	// while the modem reboots), but not when the modem could not be scraped,
+	// so the two can be told apart
+	if err == nil {
+		sendMetric(
+			ch,
+			p.downChannels,
+			prometheus.GaugeValue,
+			float64(len(modemStats.DownChannels)),
+		)
+		sendMetric(
+			ch,
+			p.upChannels,
+			prometheus.GaugeValue,
+			float64(len(modemStats.UpChannels)),
+		)
+		// Losing upstream channels while the downstream stays bonded (or
+		// the reverse) points at a problem in one direction of the plant
+		if p.expectedDown > 0 && utils.HasCapability(p.docsisModem, utils.CapDownstreamChannels) {
+			sendMetric(
+				ch,
+				p.bondingRatio,
+				prometheus.GaugeValue,
+				float64(len(modemStats.DownChannels))/float64(p.expectedDown),
+				"downstream",
+			)
+		}
+		if p.expectedUp > 0 && utils.HasCapability(p.docsisModem, utils.CapUpstreamChannels) {
+			sendMetric(
+				ch,
+				p.bondingRatio,
+				prometheus.GaugeValue,
+				float64(len(modemStats.UpChannels))/float64(p.expectedUp),
+				"upstream",
+			)
+		}
+		if ratio, ok := channelLockRatio(modemStats.DownChannels); ok {
+			sendMetric(ch, p.downLockRatio, prometheus.GaugeValue, ratio)
+		}
+		if ratio, ok := channelLockRatio(modemStats.UpChannels); ok {
+			sendMetric(ch, p.upLockRatio, prometheus.GaugeValue, ratio)
+		}
+	}
+
+	sendMetric(
+		ch,
+		p.watchdogTrigger,
+		prometheus.CounterValue,
+		float64(watchdogTriggers),
+	)
+	sendMetric(
+		ch,
+		p.throttleCount,
+		prometheus.CounterValue,
+		float64(throttled),
+	)
+	if !fetchedAt.IsZero() {
+		sendMetric(
+			ch,
+			p.statsAge,
+			prometheus.GaugeValue,
+			p.throttle.now().Sub(fetchedAt).Seconds(),
+		)
+	}
+	sendMetric(
+		ch,
+		p.collectPanics,
+		prometheus.CounterValue,
+		float64(p.panicCount()),
+	)
+
+	sendMetric(
+		ch,
 		p.fetchtime,
 		prometheus.GaugeValue,
 		float64(modemStats.FetchTime),
 	)
+
+	upVal := 0.0
+	if err == nil {
+		upVal = 1.0
+	}
+	sendMetric(
+		ch,
+		p.up,
+		prometheus.GaugeValue,
+		upVal,
+	)
+	if err == nil && modemStats.Source != "" {
+		sendMetric(
+			ch,
+			p.statsSource,
+			prometheus.GaugeValue,
+			1.0,
+			modemStats.Source,
+		)
+	}
+}
+
+// collectEventLog reports the offset of the modem's clock and the number of
+// event log entries, if enabled, from the event log fetched along with the
+// statistics. A throttled scrape repeats the last log, whose entries have
+// already been counted.
+func (p *PrometheusExporter) collectEventLog(ch chan<- prometheus.Metric, fetched bool) {
+	if p.clockOffset == nil && p.events == nil {
+		return
+	}
+
+	entries, fetchedAt, err := p.throttle.lastEventLog()
+	if err != nil {
+		if fetched {
+			logging.Warnf("Failed to fetch event log: %v", err)
+		}
+	} else if !fetchedAt.IsZero() {
+		p.eventCounter.observe(entries)
+		if offset, ok := utils.ClockOffset(entries, fetchedAt); ok {
+			sendMetric(ch, p.clockOffset, prometheus.GaugeValue, offset.Seconds())
+		}
+	}
+
+	// Counts are reported even when the log cannot be fetched, so the
+	// counters do not drop out
+	if p.events != nil {
+		for t, count := range p.eventCounter.totals() {
+			sendMetric(ch, p.events, prometheus.CounterValue, float64(count), t.priority, t.code)
+		}
+	}
+}
+
+// collectConfig reports the modem's config file and firmware version if
+// current is set, and the number of times they have changed, comparing them
+// with the previous scrape if observe is set
+func (p *PrometheusExporter) collectConfig(ch chan<- prometheus.Metric, stats utils.ModemStats, current, observe bool) {
+	if current && stats.ConfigFile != "" {
+		sendMetric(ch, p.configFile, prometheus.GaugeValue, 1, stats.ConfigFile)
+	}
+	if current && stats.FirmwareVersion != "" {
+		sendMetric(ch, p.firmware, prometheus.GaugeValue, 1, stats.FirmwareVersion)
+	}
+
+	changes, seen := p.configs.count()
+	if observe {
+		changes, seen = p.configs.observe(stats.ConfigFile, stats.FirmwareVersion)
+	}
+	if seen {
+		sendMetric(ch, p.configChanges, prometheus.CounterValue, float64(changes))
+	}
+}
+
+// collectOutOfBand reports the number of channels found outside the frequency
+// band for the direction, counting the given channels if observe is set
+func (p *PrometheusExporter) collectOutOfBand(ch chan<- prometheus.Metric, direction string, capability utils.Capability, channels []utils.ModemChannel, observe bool) {
+	if p.outOfBand == nil || !utils.HasCapability(p.docsisModem, capability) {
+		return
+	}
+	count := p.bands.count(direction)
+	if observe {
+		count = p.bands.observe(direction, channels)
+	}
+	sendMetric(ch, p.outOfBand, prometheus.CounterValue, float64(count), direction)
+}
+
+// collectFrequencyOverlap reports the number of overlapping pairs of channels
+// found for the direction, counting the given channels if observe is set
+func (p *PrometheusExporter) collectFrequencyOverlap(ch chan<- prometheus.Metric, direction string, capability utils.Capability, channels []utils.ModemChannel, observe bool) {
+	if p.freqOverlap == nil || !utils.HasCapability(p.docsisModem, capability) {
+		return
+	}
+	count := p.overlaps.count(direction)
+	if observe {
+		count = p.overlaps.observe(direction, channels)
+	}
+	sendMetric(ch, p.freqOverlap, prometheus.CounterValue, float64(count), direction)
+}
+
+// collectPowerTrend reports the slope of each downstream channel's power,
+// adding the given channels to the trend if observe is set
+func (p *PrometheusExporter) collectPowerTrend(ch chan<- prometheus.Metric, channels []utils.ModemChannel, observe bool) {
+	if p.downPowerTrend == nil {
+		return
+	}
+
+	powers := make(map[string]float64, len(channels))
+	labels := make(map[string][]string, len(channels))
+	for _, c := range channels {
+		channelLabels := p.channelLabels(c)
+		key := strings.Join(channelLabels, "|")
+		powers[key] = float64(c.Power)
+		labels[key] = channelLabels
+	}
+
+	var slopes map[string]float64
+	if observe {
+		slopes = p.powerTrend.observe(powers)
+	} else {
+		slopes = p.powerTrend.slopes()
+	}
+	for key, slope := range slopes {
+		if channelLabels, ok := labels[key]; ok {
+			sendMetric(ch, p.downPowerTrend, prometheus.GaugeValue, slope, channelLabels...)
+		}
+	}
+}
+
+func (p *PrometheusExporter) collectFrequencyCoverage(ch chan<- prometheus.Metric, channels []utils.ModemChannel, minDesc, maxDesc, bandwidthDesc *prometheus.Desc) {
+	minFreq, maxFreq, bandwidth := frequencyCoverage(channels)
+	if minFreq > 0 {
+		sendMetric(ch, minDesc, prometheus.GaugeValue, float64(minFreq))
+		sendMetric(ch, maxDesc, prometheus.GaugeValue, float64(maxFreq))
+	}
+	if bandwidth > 0 {
+		sendMetric(ch, bandwidthDesc, prometheus.GaugeValue, float64(bandwidth))
+	}
+}
+
+// slowestEndpoint returns the endpoint which took the longest to respond, the
+// first by name of any taking as long as each other, and false if there are
+// none
+func slowestEndpoint(durations map[string]time.Duration) (string, bool) {
+	var slowest string
+	for endpoint, duration := range durations {
+		if slowest == "" || duration > durations[slowest] || (duration == durations[slowest] && endpoint < slowest) {
+			slowest = endpoint
+		}
+	}
+	return slowest, slowest != ""
 }
 
 func (p *PrometheusExporter) Describe(ch chan<- *prometheus.Desc) {
-	ch <- p.downFrequency
-	ch <- p.upFrequency
-	ch <- p.downPower
-	ch <- p.upPower
-	ch <- p.downSNR
-	ch <- p.downPostRS
-	ch <- p.downPreRS
-	ch <- p.downLocked
-	ch <- p.upLocked
-	ch <- p.upSymbolRate
-	ch <- p.upT1Timeout
-	ch <- p.upT2Timeout
-	ch <- p.upT3Timeout
-	ch <- p.upT4Timeout
-	ch <- p.maxrate
-	ch <- p.maxburst
-	ch <- p.fetchtime
-	ch <- p.downNoise
-	ch <- p.downAttenuation
-	ch <- p.upNoise
-	ch <- p.upAttenuation
-}
-
-func ProExporter(docsisModem utils.DocsisModem) *PrometheusExporter {
-	namespace := "modemstats"
+	for _, desc := range []*prometheus.Desc{
+		p.downFrequency,
+		p.upFrequency,
+		p.downPower,
+		p.upPower,
+		p.downSNR,
+		p.downSNRStatus,
+		p.downPowerStatus,
+		p.downQuality,
+		p.downPostRS,
+		p.downPreRS,
+		p.downErrorsDelta,
+		p.downErrorsScrape,
+		p.downCorrected,
+		p.downInterleaver,
+		p.downLocked,
+		p.downPLCLocked,
+		p.downPartial,
+		p.downExtra,
+		p.upLocked,
+		p.upSymbolRate,
+		p.upRanging,
+		p.upOFDMAPower,
+		p.upT1Timeout,
+		p.upT2Timeout,
+		p.upT3Timeout,
+		p.upT4Timeout,
+		p.upTimeoutsScrape,
+		p.maxrate,
+		p.maxburst,
+		p.flowActive,
+		p.fetchtime,
+		p.up,
+		p.statsSource,
+		p.downChannels,
+		p.upChannels,
+		p.bondingRatio,
+		p.downLockRatio,
+		p.upLockRatio,
+		p.downNoise,
+		p.downAttenuation,
+		p.upNoise,
+		p.upAttenuation,
+		p.provisioning,
+		p.docsisState,
+		p.endpointUp,
+		p.endpointDuration,
+		p.endpointSlowest,
+		p.info,
+		p.downFreqMin,
+		p.downFreqMax,
+		p.downBandwidth,
+		p.upFreqMin,
+		p.upFreqMax,
+		p.upBandwidth,
+		p.opticalRxPower,
+		p.opticalTxPower,
+		p.docsisVersion,
+		p.downFlaps,
+		p.downRecentFlaps,
+		p.downPowerTrend,
+		p.downSNRMargin,
+		p.upPowerHeadroom,
+		p.modemRequests,
+		p.bridgeMode,
+		p.watchdogTrigger,
+		p.throttleCount,
+		p.statsAge,
+		p.collectPanics,
+		p.outOfBand,
+		p.freqOverlap,
+		p.configFile,
+		p.firmware,
+		p.configChanges,
+		p.clockOffset,
+		p.events,
+		p.uptime,
+		p.connUptime,
+		p.healthScore,
+	} {
+		// Disabled metrics have no description and must not be described
+		if desc != nil {
+			ch <- desc
+		}
+	}
+	if p.errorHistogram != nil {
+		p.errorHistogram.Describe(ch)
+	}
+}
+
+func ProExporter(docsisModem utils.DocsisModem, opts ...ExporterOption) *PrometheusExporter {
+	options := newExporterOptions(opts)
+	if options.macLabel {
+		options.constLabels = macLabels(docsisModem)
+	}
 	downLabels := []string{}
 	upLabels := []string{}
 
@@ -256,146 +1489,568 @@ func ProExporter(docsisModem utils.DocsisModem) *PrometheusExporter {
 		downLabels = []string{"id"}
 		upLabels = []string{"id"}
 	} else {
-		downLabels = []string{"channel", "id", "modulation", "scheme"}
-		upLabels = []string{"channel", "id"}
+		downLabels = options.channelLabelNames("modulation", "scheme")
+		upLabels = options.channelLabelNames()
 	}
 
-	return &PrometheusExporter{
-		docsisModem: docsisModem,
-		downFrequency: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "downstream", "frequency"),
+	exporter := &PrometheusExporter{
+		docsisModem:     docsisModem,
+		flaps:           newFlapDetector(options.flapWindow),
+		powerTrend:      newPowerTrend(),
+		errorDeltas:     newCounterDeltas(downstreamErrorCounters),
+		counterDeltas:   newCounterDeltas(channelCounters),
+		health:          newHealthScorer(docsisModem, options.healthWeights, options.maxUpPower),
+		eventCounter:    newEventCounter(),
+		bands:           newBandChecker(options.downBand, options.upBand),
+		overlaps:        newOverlapChecker(),
+		configs:         &configTracker{},
+		maxUpPower:      options.maxUpPower,
+		statusLimits:    options.statusLimits,
+		channelIDLabels: options.channelIDLabels,
+		watchdog:        newWatchdog(docsisModem, options.watchdogLimit, options.watchdogReboot),
+		throttle:        newScrapeThrottle(docsisModem, options.minInterval, options.collectTimeout),
+		onScrape:        options.onScrape,
+		skipFirstCount:  options.skipFirstCount,
+		expectedDown:    options.expectedDown,
+		expectedUp:      options.expectedUp,
+		excludedIDs:     options.excludedIDs,
+		downFrequency: options.newDesc(
+			"downstream", "frequency",
 			"Downstream Frequency in HZ",
 			downLabels,
-			nil,
 		),
-		downPower: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "downstream", "power"),
+		downPower: options.newDesc(
+			"downstream", "power",
 			"Downstream Power level in dBmv",
 			downLabels,
-			nil,
 		),
-		downSNR: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "downstream", "snr"),
+		downSNR: options.newDesc(
+			"downstream", "snr",
 			"Downstream SNR in dB",
 			downLabels,
-			nil,
 		),
-		downPostRS: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "downstream", "postrserr"),
+		downPowerStatus: options.newDesc(
+			"downstream", "power_status",
+			"Grade of the downstream power level, 1 for the level it is at (good, warn or bad)",
+			options.channelLabelNames("modulation", "scheme", "level"),
+		),
+		downSNRStatus: options.newDesc(
+			"downstream", "snr_status",
+			"Grade of the downstream SNR, 1 for the level it is at (good, warn or bad)",
+			options.channelLabelNames("modulation", "scheme", "level"),
+		),
+		downQuality: options.newDesc(
+			"downstream", "quality_percent",
+			"Downstream link quality as a percentage, where reported in place of SNR",
+			downLabels,
+		),
+		downSNRMargin: options.newDesc(
+			"downstream", "snr_margin_db",
+			"Downstream SNR above the minimum required for the channel's modulation in dB",
+			downLabels,
+		),
+		downPostRS: options.newDesc(
+			"downstream", "postrserr_total",
 			"Number of Errors per channel Post RS",
 			downLabels,
-			nil,
 		),
-		downPreRS: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "downstream", "prerserr"),
+		downPreRS: options.newDesc(
+			"downstream", "prerserr_total",
 			"Number of Errors per channel Pre RS",
 			downLabels,
-			nil,
 		),
-		downLocked: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "downstream", "locked"),
+		downErrorsScrape: options.newDesc(
+			"downstream", "errors_scrape",
+			"Number of codeword errors per channel since the last scrape, by counter",
+			options.channelLabelNames("modulation", "scheme", "counter"),
+		),
+		downErrorsDelta: options.newDesc(
+			"downstream", "errors_interval",
+			"Number of downstream codeword errors across all channels since the last scrape, by counter",
+			[]string{"counter"},
+		),
+		downCorrected: options.newDesc(
+			"downstream", "corrected_ratio",
+			"Fraction of errored downstream codewords which were corrected",
+			downLabels,
+		),
+		downInterleaver: options.newDesc(
+			"downstream", "interleaver_depth",
+			"Downstream SC-QAM channel interleaver depth (I)",
+			downLabels,
+		),
+		downLocked: options.newDesc(
+			"downstream", "locked",
 			"Downstream channel lock status (1=locked, 0=unlocked)",
 			downLabels,
-			nil,
 		),
-		downAttenuation: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "downstream", "attenuation"),
+		downPLCLocked: options.newDesc(
+			"downstream", "plc_locked",
+			"OFDM downstream channel PLC lock status (1=locked, 0=unlocked)",
+			downLabels,
+		),
+		downFlaps: options.newDesc(
+			"downstream", "lock_flaps_total",
+			"Number of times the downstream channel lock status has changed",
+			options.channelLabelNames(),
+		),
+		downRecentFlaps: options.newDesc(
+			"downstream", "lock_flaps_recent",
+			"Number of downstream channel lock status changes within the flap window",
+			options.channelLabelNames(),
+		),
+		downPowerTrend: options.newDesc(
+			"downstream", "power_trend_db_per_min",
+			"Slope of the downstream channel power over recent scrapes in dB per minute",
+			options.channelLabelNames(),
+		),
+		downPartial: options.newDesc(
+			"downstream", "partial_service",
+			"Downstream channel partial service status (1=partial service, 0=normal)",
+			downLabels,
+		),
+		downExtra: options.newDesc(
+			"downstream", "extra",
+			"Vendor specific downstream channel field reported by the modem",
+			append(append([]string{}, downLabels...), "field"),
+		),
+		downAttenuation: options.newDesc(
+			"downstream", "attenuation",
 			"Downstream attenuation in TODO: wtf is this?",
 			downLabels,
-			nil,
 		),
-		downNoise: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "downstream", "noise"),
+		downNoise: options.newDesc(
+			"downstream", "noise",
 			"Downstream noise level in dB",
 			downLabels,
-			nil,
 		),
-		upFrequency: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "upstream", "frequency"),
+		upFrequency: options.newDesc(
+			"upstream", "frequency",
 			"Upstream Frequency in HZ",
 			upLabels,
-			nil,
 		),
-		upPower: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "upstream", "power"),
+		upPower: options.newDesc(
+			"upstream", "power",
 			"Upstream Power level in dBmv",
 			upLabels,
-			nil,
 		),
-		upLocked: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "upstream", "locked"),
+		upPowerHeadroom: options.newDesc(
+			"upstream", "power_headroom_db",
+			"Difference between the maximum and current upstream transmit power in dB",
+			upLabels,
+		),
+		upLocked: options.newDesc(
+			"upstream", "locked",
 			"Upstream channel lock status (1=locked, 0=unlocked)",
 			upLabels,
-			nil,
 		),
-		upSymbolRate: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "upstream", "symbol_rate"),
+		upSymbolRate: options.newDesc(
+			"upstream", "symbol_rate",
 			"Upstream symbol rate in ksym/s",
 			upLabels,
-			nil,
 		),
-		upT1Timeout: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "upstream", "t1_timeout_total"),
+		upRanging: options.newDesc(
+			"upstream", "ranging_status",
+			"Upstream channel ranging status (1 for the current status)",
+			options.channelLabelNames("status"),
+		),
+		upOFDMAPower: options.newDesc(
+			"upstream", "ofdma_tx_power",
+			"OFDMA upstream transmit power across a range of subcarriers in dBmV",
+			options.channelLabelNames("subcarriers"),
+		),
+		upT1Timeout: options.newDesc(
+			"upstream", "t1_timeout_total",
 			"Upstream T1 timeout count",
 			upLabels,
-			nil,
 		),
-		upT2Timeout: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "upstream", "t2_timeout_total"),
+		upT2Timeout: options.newDesc(
+			"upstream", "t2_timeout_total",
 			"Upstream T2 timeout count",
 			upLabels,
-			nil,
 		),
-		upT3Timeout: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "upstream", "t3_timeout_total"),
+		upT3Timeout: options.newDesc(
+			"upstream", "t3_timeout_total",
 			"Upstream T3 timeout count",
 			upLabels,
-			nil,
 		),
-		upT4Timeout: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "upstream", "t4_timeout_total"),
+		upT4Timeout: options.newDesc(
+			"upstream", "t4_timeout_total",
 			"Upstream T4 timeout count",
 			upLabels,
-			nil,
 		),
-		upAttenuation: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "upstream", "attenuation"),
+		upTimeoutsScrape: options.newDesc(
+			"upstream", "timeouts_scrape",
+			"Number of upstream timeouts per channel since the last scrape, by timeout",
+			options.channelLabelNames("timeout"),
+		),
+		upAttenuation: options.newDesc(
+			"upstream", "attenuation",
 			"Upstream attenuation in TODO: wtf is this?",
 			downLabels,
-			nil,
 		),
-		upNoise: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "upstream", "noise"),
+		upNoise: options.newDesc(
+			"upstream", "noise",
 			"Upstream noise level in dB",
 			downLabels,
-			nil,
 		),
-		maxrate: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "config", "maxrate"),
+		maxrate: options.newDesc(
+			"config", "maxrate",
 			"Maximum link rate",
 			[]string{"config", "serviceflow_id"},
-			nil,
 		),
-		maxburst: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "config", "maxburst"),
+		maxburst: options.newDesc(
+			"config", "maxburst",
 			"Maximum link burst rate",
 			[]string{"config", "serviceflow_id"},
-			nil,
 		),
-		fetchtime: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "shstatsinfo", "timems"),
+		flowActive: options.newDesc(
+			"config", "active",
+			"Whether each service flow is active (1=active, 0=admitted or only provisioned)",
+			[]string{"config", "serviceflow_id"},
+		),
+		provisioning: options.newDesc(
+			"", "provisioning_status",
+			"Modem provisioning state (1 for the current state, 0 otherwise)",
+			[]string{"status"},
+		),
+		docsisState: options.newDesc(
+			"", "docsis_state",
+			"Stage of DOCSIS registration the modem has reached, from 1 (not synchronized) to 9 (operational), 0 if unknown",
+			[]string{"state"},
+		),
+		endpointUp: options.newDesc(
+			"", "endpoint_up",
+			"Whether each of the modem's statistics endpoints responded on the last fetch (1=success, 0=failure)",
+			[]string{"endpoint"},
+		),
+		endpointDuration: options.newDesc(
+			"fetch", "endpoint_duration_seconds",
+			"Time taken by each of the modem's statistics endpoints to respond on the last fetch",
+			[]string{"endpoint"},
+		),
+		endpointSlowest: options.newDesc(
+			"fetch", "endpoint_slowest",
+			"The modem's statistics endpoint which was slowest to respond on the last fetch (always 1)",
+			[]string{"endpoint"},
+		),
+		info: options.newDesc(
+			"", "info",
+			"Modem information, value is always 1",
+			[]string{"wan_ip", "annex"},
+		),
+		downFreqMin: options.newDesc(
+			"downstream", "freq_min_hz",
+			"Lowest downstream channel frequency in HZ",
+			[]string{},
+		),
+		downFreqMax: options.newDesc(
+			"downstream", "freq_max_hz",
+			"Highest downstream channel frequency in HZ",
+			[]string{},
+		),
+		downBandwidth: options.newDesc(
+			"downstream", "total_bandwidth_hz",
+			"Total bonded downstream bandwidth in HZ",
+			[]string{},
+		),
+		upFreqMin: options.newDesc(
+			"upstream", "freq_min_hz",
+			"Lowest upstream channel frequency in HZ",
+			[]string{},
+		),
+		upFreqMax: options.newDesc(
+			"upstream", "freq_max_hz",
+			"Highest upstream channel frequency in HZ",
+			[]string{},
+		),
+		upBandwidth: options.newDesc(
+			"upstream", "total_bandwidth_hz",
+			"Total bonded upstream bandwidth in HZ",
+			[]string{},
+		),
+		opticalRxPower: options.newDesc(
+			"optical", "rx_power_dbm",
+			"Optical receive power in dBm",
+			[]string{},
+		),
+		opticalTxPower: options.newDesc(
+			"optical", "tx_power_dbm",
+			"Optical transmit power in dBm",
+			[]string{},
+		),
+		docsisVersion: options.newDesc(
+			"", "docsis_version",
+			"DOCSIS version supported by the modem and negotiated with the CMTS, value is always 1",
+			[]string{"capability", "negotiated"},
+		),
+		bridgeMode: options.newDesc(
+			"modem", "bridge_mode",
+			"Modem operating mode (1=modem/bridge mode, 0=router mode)",
+			[]string{},
+		),
+		uptime: options.newDesc(
+			"", "uptime_seconds",
+			"Seconds since the modem booted",
+			[]string{},
+		),
+		connUptime: options.newDesc(
+			"", "connectivity_uptime_seconds",
+			"Seconds since the modem last registered with the CMTS",
+			[]string{},
+		),
+		healthScore: options.newDesc(
+			"", "health_score",
+			"Overall health of the modem from 0 to 100, combining channel lock, SNR margin, power and uncorrectable errors",
+			[]string{},
+		),
+		events: options.newDesc(
+			"", "events_total",
+			"Number of entries in the modem's event log, by priority and event code",
+			[]string{"priority", "code"},
+		),
+		clockOffset: options.newDesc(
+			"modem", "clock_offset_seconds",
+			"Offset of the modem's clock from the host's, estimated from the newest event log entry",
+			[]string{},
+		),
+		watchdogTrigger: options.newDesc(
+			"modem", "watchdog_triggers_total",
+			"Number of times repeated scrape failures have triggered the watchdog",
+			[]string{},
+		),
+		throttleCount: options.newDesc(
+			"", "throttled_scrapes_total",
+			"Number of scrapes served the previous result as they came within the minimum scrape interval",
+			[]string{},
+		),
+		statsAge: options.newDesc(
+			"", "stats_age_seconds",
+			"Seconds since the statistics served were fetched from the modem, growing while a cached result is served",
+			[]string{},
+		),
+		collectPanics: options.newDesc(
+			"", "collect_panics_total",
+			"Number of scrapes which panicked, fetching from the modem or collecting the metrics, and were reported as failed",
+			[]string{},
+		),
+		outOfBand: options.newDesc(
+			"", "channel_out_of_band_total",
+			"Number of times a channel has been reported outside the expected frequency band, by direction",
+			[]string{"direction"},
+		),
+		freqOverlap: options.newDesc(
+			"", "channel_frequency_overlap_total",
+			"Number of times a pair of single carrier channels has been reported with overlapping frequencies, by direction",
+			[]string{"direction"},
+		),
+		configFile: options.newDesc(
+			"", "config_file_info",
+			"Name of the config file the modem was provisioned with, value is always 1",
+			[]string{"name"},
+		),
+		firmware: options.newDesc(
+			"", "firmware_info",
+			"Firmware version the modem runs, value is always 1",
+			[]string{"version"},
+		),
+		configChanges: options.newDesc(
+			"", "config_changes_total",
+			"Number of times the modem's config file or firmware version has changed between scrapes",
+			[]string{},
+		),
+		modemRequests: options.newDesc(
+			"modem", "requests_total",
+			"Number of HTTP requests made to the modem",
+			[]string{"endpoint", "result"},
+		),
+		fetchtime: options.newDesc(
+			"shstatsinfo", "timems",
 			"Time to fetch statistics from the modem in milliseconds",
 			[]string{},
-			nil,
 		),
+		up: options.newDesc(
+			"", "up",
+			"Whether the last scrape of the modem succeeded (1=success, 0=failure)",
+			[]string{},
+		),
+		statsSource: options.newDesc(
+			"", "stats_source",
+			"Where the modem's statistics were read from, for modems which fall back to another source when the usual one is unavailable",
+			[]string{"source"},
+		),
+		downChannels: options.newDesc(
+			"downstream", "channels",
+			"Number of downstream channels reported by the modem",
+			[]string{},
+		),
+		upChannels: options.newDesc(
+			"upstream", "channels",
+			"Number of upstream channels reported by the modem",
+			[]string{},
+		),
+		bondingRatio: options.newDesc(
+			"", "bonding_ratio",
+			"Number of channels reported by the modem as a fraction of the number expected, by direction",
+			[]string{"direction"},
+		),
+		downLockRatio: options.newDesc(
+			"downstream", "lock_ratio",
+			"Fraction of the downstream channels which are locked",
+			[]string{},
+		),
+		upLockRatio: options.newDesc(
+			"upstream", "lock_ratio",
+			"Fraction of the upstream channels which are locked",
+			[]string{},
+		),
+	}
+	exporter.dropUnsupported()
+
+	// Requests are counted by the host they are made to, so can only be
+	// reported for a modem which says which host its go to
+	if hosts, ok := docsisModem.(utils.HostProvider); ok {
+		exporter.requestHost = hosts.Host()
+	} else {
+		exporter.modemRequests = nil
+	}
+
+	// The clock offset is estimated from the event log, fetched along with
+	// the statistics, so is opt in
+	if _, ok := docsisModem.(utils.EventLogProvider); !ok || !options.clockOffset {
+		exporter.clockOffset = nil
+	}
+	if _, ok := docsisModem.(utils.EventLogProvider); !ok || !options.eventCounts {
+		exporter.events = nil
+	}
+	exporter.throttle.eventLog = exporter.clockOffset != nil || exporter.events != nil
+	if options.minInterval <= 0 {
+		exporter.throttleCount = nil
+	}
+	// Without a cache every scrape is served a fresh fetch
+	if options.minInterval <= 0 && options.collectTimeout <= 0 && options.fetchInterval <= 0 {
+		exporter.statsAge = nil
+	}
+	if !options.counterDeltas || docsisModem.Type() == utils.TypeVDSL {
+		exporter.downErrorsScrape = nil
+		exporter.upTimeoutsScrape = nil
+	}
+	if options.errorHistogram && docsisModem.Type() != utils.TypeVDSL && utils.HasCapability(docsisModem, utils.CapCodewords) {
+		exporter.errorHistogram = options.newErrorHistogram()
+	}
+	if options.expectedDown <= 0 && options.expectedUp <= 0 {
+		exporter.bondingRatio = nil
+	}
+	if options.fetchStamps {
+		exporter.scrapeTimeDescs = exporter.perScrapeDescs()
+	}
+	if options.snapshotDir != "" {
+		exporter.throttle.archive = newSnapshotArchive(options.snapshotDir, options.snapshotMax)
+	}
+	if options.fetchInterval > 0 {
+		exporter.throttle.fetchEvery(options.fetchInterval)
+	}
+
+	return exporter
+}
+
+// dropUnsupported removes the descriptions of metrics built from statistics
+// the modem does not populate, so they are neither described nor collected
+func (p *PrometheusExporter) dropUnsupported() {
+	for capability, descs := range map[utils.Capability][]**prometheus.Desc{
+		utils.CapDownstreamChannels: {&p.downFrequency, &p.downPower, &p.downPowerTrend, &p.downSNR, &p.downSNRStatus, &p.downPowerStatus, &p.downQuality, &p.downSNRMargin, &p.downFreqMin, &p.downFreqMax, &p.downBandwidth, &p.downChannels, &p.downLockRatio},
+		utils.CapUpstreamChannels:   {&p.upFrequency, &p.upPower, &p.upPowerHeadroom, &p.upFreqMin, &p.upFreqMax, &p.upBandwidth, &p.upChannels, &p.upLockRatio},
+		utils.CapCodewords:          {&p.downPreRS, &p.downPostRS, &p.downErrorsDelta, &p.downErrorsScrape, &p.downCorrected},
+		utils.CapTimeouts:           {&p.upT1Timeout, &p.upT2Timeout, &p.upT3Timeout, &p.upT4Timeout, &p.upTimeoutsScrape},
+		utils.CapLockStatus:         {&p.downLocked, &p.downPLCLocked, &p.downLockRatio, &p.upLockRatio, &p.upLocked, &p.downFlaps, &p.downRecentFlaps},
+		utils.CapPartialService:     {&p.downPartial},
+		utils.CapSymbolRate:         {&p.upSymbolRate},
+		utils.CapRangingStatus:      {&p.upRanging},
+		utils.CapSubcarrierPower:    {&p.upOFDMAPower},
+		utils.CapServiceFlows:       {&p.maxrate, &p.maxburst, &p.flowActive},
+		utils.CapNoise:              {&p.downNoise, &p.upNoise},
+		utils.CapAttenuation:        {&p.downAttenuation, &p.upAttenuation},
+		utils.CapProvisioning:       {&p.provisioning, &p.info},
+		utils.CapOptics:             {&p.opticalRxPower, &p.opticalTxPower},
+		utils.CapOperatingMode:      {&p.bridgeMode},
+		utils.CapUptime:             {&p.uptime},
+		utils.CapConnectivityUptime: {&p.connUptime},
+		utils.CapInterleaver:        {&p.downInterleaver},
+		utils.CapConfigFile:         {&p.configFile, &p.firmware, &p.configChanges},
+		utils.CapDocsisState:        {&p.docsisState},
+		utils.CapEndpointHealth:     {&p.endpointUp},
+		utils.CapEndpointTiming:     {&p.endpointDuration, &p.endpointSlowest},
+	} {
+		if utils.HasCapability(p.docsisModem, capability) {
+			continue
+		}
+		for _, desc := range descs {
+			*desc = nil
+		}
 	}
 }
 
-func Prometheus(modem utils.DocsisModem, port int) {
-	exporter := ProExporter(modem)
-	prometheus.MustRegister(exporter)
+func registerExporter(exporter *PrometheusExporter, opts ...ExporterOption) error {
+	if err := prometheus.Register(exporter); err != nil {
+		return err
+	}
+	if err := registerBuildInfo(prometheus.DefaultRegisterer, opts); err != nil {
+		return err
+	}
 
 	http.Handle("/metrics", promhttp.Handler())
-	fmt.Println(fmt.Sprintf("Starting Prometheus exporter on port %d", port))
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), nil))
+	if newExporterOptions(opts).debugEndpoints {
+		http.Handle("/debug/channels", exporter.ChannelsHandler())
+	}
+	return nil
+}
+
+// Prometheus serves the exporter on a TCP port, returning once the server
+// fails. The options are those the exporter was created with.
+func Prometheus(exporter *PrometheusExporter, port int, opts ...ExporterOption) error {
+	if err := registerExporter(exporter, opts...); err != nil {
+		return err
+	}
+	logging.Infof("Starting Prometheus exporter on port %d", port)
+	return http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
+}
+
+// PrometheusUnixSocket serves the exporter over a Unix domain socket rather
+// than a TCP port, returning once the server fails
+func PrometheusUnixSocket(exporter *PrometheusExporter, path string, opts ...ExporterOption) error {
+	if err := registerExporter(exporter, opts...); err != nil {
+		return err
+	}
+
+	listener, err := listenUnixSocket(path)
+	if err != nil {
+		return err
+	}
+	logging.Infof("Starting Prometheus exporter on socket %s", path)
+	return http.Serve(listener, nil)
+}
+
+// listenUnixSocket listens on a Unix domain socket, removing a stale socket
+// left behind by a previous run. The socket is only accessible to its owner
+// and group.
+func listenUnixSocket(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("refusing to replace %s: not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on socket: %w", err)
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+
+	return listener, nil
 }
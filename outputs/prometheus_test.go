@@ -0,0 +1,378 @@
+package outputs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/msh100/modem-stats/modems/fake"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeModem returns a fixed set of statistics
+type fakeModem struct {
+	stats utils.ModemStats
+}
+
+func (f *fakeModem) ParseStats() (utils.ModemStats, error) {
+	return f.stats, nil
+}
+
+func (f *fakeModem) ClearStats() {}
+
+func (f *fakeModem) Type() string {
+	return utils.TypeDocsis
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "modem-stats.sock")
+
+	// Leave a stale socket behind, as a crashed process would
+	stale, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := listenUnixSocket(socketPath)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	info, err := os.Stat(socketPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0660), info.Mode().Perm())
+
+	modem := &fakeModem{stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			{ChannelID: 5, Channel: 1, Frequency: 171000000, Snr: 420, Modulation: "QAM256", Scheme: "SC-QAM"},
+		},
+		ModemType: utils.TypeDocsis,
+	}}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(ProExporter(modem))
+	go http.Serve(listener, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+	resp, err := client.Get("http://modem-stats/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `modemstats_downstream_snr{channel="1",id="5",modulation="QAM256",scheme="SC-QAM"} 420`)
+}
+
+func TestListenUnixSocket_RefusesRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not-a-socket")
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0644))
+
+	_, err := listenUnixSocket(path)
+	assert.Error(t, err)
+
+	_, err = os.Stat(path)
+	assert.NoError(t, err, "regular file should not be removed")
+}
+
+func TestPrometheusExporter_LockFlaps(t *testing.T) {
+	modem := &fakeModem{stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			{ChannelID: 5, Channel: 1, Frequency: 171000000, Modulation: "QAM256", Scheme: "SC-QAM", Locked: true},
+		},
+		ModemType: utils.TypeDocsis,
+	}}
+	exporter := ProExporter(modem, WithFlapWindow(10*time.Minute))
+
+	now := time.Date(2026, 2, 9, 10, 0, 0, 0, time.UTC)
+	exporter.flaps.now = func() time.Time { return now }
+
+	expectFlaps := func(total, recent int) {
+		t.Helper()
+		expected := fmt.Sprintf(`
+			# HELP modemstats_downstream_lock_flaps_recent Number of downstream channel lock status changes within the flap window
+			# TYPE modemstats_downstream_lock_flaps_recent gauge
+			modemstats_downstream_lock_flaps_recent{channel="1",id="5"} %d
+			# HELP modemstats_downstream_lock_flaps_total Number of times the downstream channel lock status has changed
+			# TYPE modemstats_downstream_lock_flaps_total counter
+			modemstats_downstream_lock_flaps_total{channel="1",id="5"} %d
+		`, recent, total)
+		err := testutil.CollectAndCompare(exporter, strings.NewReader(expected),
+			"modemstats_downstream_lock_flaps_total",
+			"modemstats_downstream_lock_flaps_recent",
+		)
+		assert.NoError(t, err)
+	}
+
+	// The first scrape only establishes the lock state
+	expectFlaps(0, 0)
+
+	// Each change of lock state between scrapes is a flap
+	for i := 1; i <= 4; i++ {
+		now = now.Add(time.Minute)
+		modem.stats.DownChannels[0].Locked = !modem.stats.DownChannels[0].Locked
+		expectFlaps(i, i)
+	}
+
+	// A stable channel keeps its total but slides out of the window
+	now = now.Add(8 * time.Minute)
+	expectFlaps(4, 2)
+	now = now.Add(time.Hour)
+	expectFlaps(4, 0)
+}
+
+func TestPrometheusExporter_DownstreamExtraFields(t *testing.T) {
+	modem := &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			{ChannelID: 5, Channel: 1, Modulation: "QAM256", Scheme: "SC-QAM", Extra: map[string]float64{
+				"interleaver_depth": 32,
+				"annex":             1,
+			}},
+			{ChannelID: 6, Channel: 2, Modulation: "QAM256", Scheme: "SC-QAM"},
+		},
+	}}
+
+	expected := `
+		# HELP modemstats_downstream_extra Vendor specific downstream channel field reported by the modem
+		# TYPE modemstats_downstream_extra gauge
+		modemstats_downstream_extra{channel="1",field="annex",id="5",modulation="QAM256",scheme="SC-QAM"} 1
+		modemstats_downstream_extra{channel="1",field="interleaver_depth",id="5",modulation="QAM256",scheme="SC-QAM"} 32
+	`
+	err := testutil.CollectAndCompare(ProExporter(modem), strings.NewReader(expected), "modemstats_downstream_extra")
+	assert.NoError(t, err)
+}
+
+func TestPrometheusExporter_ChannelIDLabels(t *testing.T) {
+	modem := &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			{ChannelID: 5, Channel: 1, Snr: 410, Modulation: "QAM256", Scheme: "SC-QAM"},
+			{ChannelID: 9, Channel: 2, Snr: 380, Modulation: "QAM256", Scheme: "SC-QAM"},
+		},
+		UpChannels: []utils.ModemChannel{
+			{ChannelID: 1, Channel: 1, Power: 440},
+		},
+	}}
+	exporter := ProExporter(modem, WithChannelIDLabels())
+
+	expected := `
+		# HELP modemstats_downstream_snr Downstream SNR in dB
+		# TYPE modemstats_downstream_snr gauge
+		modemstats_downstream_snr{id="5",modulation="QAM256",scheme="SC-QAM"} 410
+		modemstats_downstream_snr{id="9",modulation="QAM256",scheme="SC-QAM"} 380
+		# HELP modemstats_upstream_power Upstream Power level in dBmv
+		# TYPE modemstats_upstream_power gauge
+		modemstats_upstream_power{id="1"} 440
+	`
+	metrics := []string{"modemstats_downstream_snr", "modemstats_upstream_power"}
+	err := testutil.CollectAndCompare(exporter, strings.NewReader(expected), metrics...)
+	assert.NoError(t, err)
+
+	// The modem reorders its channels, which changes their sequence index but
+	// not their series
+	modem.Stats.DownChannels = []utils.ModemChannel{
+		{ChannelID: 9, Channel: 1, Snr: 380, Modulation: "QAM256", Scheme: "SC-QAM"},
+		{ChannelID: 5, Channel: 2, Snr: 410, Modulation: "QAM256", Scheme: "SC-QAM"},
+	}
+	err = testutil.CollectAndCompare(exporter, strings.NewReader(expected), metrics...)
+	assert.NoError(t, err)
+
+	// By default both the sequence index and ID are labels
+	expected = `
+		# HELP modemstats_downstream_snr Downstream SNR in dB
+		# TYPE modemstats_downstream_snr gauge
+		modemstats_downstream_snr{channel="1",id="9",modulation="QAM256",scheme="SC-QAM"} 380
+		modemstats_downstream_snr{channel="2",id="5",modulation="QAM256",scheme="SC-QAM"} 410
+	`
+	err = testutil.CollectAndCompare(ProExporter(modem), strings.NewReader(expected), "modemstats_downstream_snr")
+	assert.NoError(t, err)
+}
+
+func TestPrometheusExporter_FirstScrapeCountersSkipped(t *testing.T) {
+	modem := &fake.Modem{
+		Stats: utils.ModemStats{
+			DownChannels: []utils.ModemChannel{
+				{ChannelID: 5, Channel: 1, Snr: 410, Prerserr: 123456, Postrserr: 789, Modulation: "QAM256", Scheme: "SC-QAM"},
+			},
+			UpChannels: []utils.ModemChannel{
+				{ChannelID: 1, Channel: 1, Power: 440, T3Timeout: 42},
+			},
+		},
+		StatsErr: errors.New("modem unreachable"),
+	}
+	exporter := ProExporter(modem, WithFirstScrapeCountersSkipped())
+
+	counters := []string{
+		"modemstats_downstream_prerserr_total",
+		"modemstats_downstream_postrserr_total",
+		"modemstats_upstream_t3_timeout_total",
+	}
+	gauges := `
+		# HELP modemstats_downstream_snr Downstream SNR in dB
+		# TYPE modemstats_downstream_snr gauge
+		modemstats_downstream_snr{channel="1",id="5",modulation="QAM256",scheme="SC-QAM"} 410
+		# HELP modemstats_upstream_power Upstream Power level in dBmv
+		# TYPE modemstats_upstream_power gauge
+		modemstats_upstream_power{channel="1",id="1"} 440
+	`
+
+	// A failed scrape does not use up the first scrape
+	assert.Equal(t, 0, testutil.CollectAndCount(exporter, counters...))
+	modem.StatsErr = nil
+
+	// The first successful scrape reports gauges but withholds the counters
+	assert.Equal(t, 0, testutil.CollectAndCount(exporter, counters...))
+	assert.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(gauges),
+		"modemstats_downstream_snr", "modemstats_upstream_power"))
+
+	// Later scrapes report everything
+	expected := `
+		# HELP modemstats_downstream_postrserr_total Number of Errors per channel Post RS
+		# TYPE modemstats_downstream_postrserr_total counter
+		modemstats_downstream_postrserr_total{channel="1",id="5",modulation="QAM256",scheme="SC-QAM"} 789
+		# HELP modemstats_downstream_prerserr_total Number of Errors per channel Pre RS
+		# TYPE modemstats_downstream_prerserr_total counter
+		modemstats_downstream_prerserr_total{channel="1",id="5",modulation="QAM256",scheme="SC-QAM"} 123456
+		# HELP modemstats_upstream_t3_timeout_total Upstream T3 timeout count
+		# TYPE modemstats_upstream_t3_timeout_total counter
+		modemstats_upstream_t3_timeout_total{channel="1",id="1"} 42
+	`
+	assert.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(expected), counters...))
+
+	// Without the option the counters are reported from the first scrape
+	assert.Equal(t, 3, testutil.CollectAndCount(ProExporter(modem), counters...))
+}
+
+func TestPrometheusExporter_ChannelCounts(t *testing.T) {
+	modem := &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			{ChannelID: 5, Channel: 1, Modulation: "QAM256", Scheme: "SC-QAM"},
+			{ChannelID: 6, Channel: 2, Modulation: "QAM256", Scheme: "SC-QAM"},
+		},
+		UpChannels: []utils.ModemChannel{
+			{ChannelID: 1, Channel: 1},
+		},
+	}}
+	exporter := ProExporter(modem)
+	metrics := []string{"modemstats_downstream_channels", "modemstats_upstream_channels"}
+
+	expected := `
+		# HELP modemstats_downstream_channels Number of downstream channels reported by the modem
+		# TYPE modemstats_downstream_channels gauge
+		modemstats_downstream_channels 2
+		# HELP modemstats_upstream_channels Number of upstream channels reported by the modem
+		# TYPE modemstats_upstream_channels gauge
+		modemstats_upstream_channels 1
+	`
+	assert.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(expected), metrics...))
+
+	// A modem which cannot be scraped has no channel count, unlike one with
+	// no channels
+	modem.StatsErr = errors.New("modem unreachable")
+	assert.Equal(t, 0, testutil.CollectAndCount(exporter, metrics...))
+	assert.Equal(t, 1, testutil.CollectAndCount(exporter, "modemstats_shstatsinfo_timems"))
+}
+
+func TestPrometheusExporter_LockRatio(t *testing.T) {
+	modem := &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			{ChannelID: 5, Channel: 1, Modulation: "QAM256", Scheme: "SC-QAM", Locked: true},
+			{ChannelID: 6, Channel: 2, Modulation: "QAM256", Scheme: "SC-QAM", Locked: true},
+			{ChannelID: 7, Channel: 3, Modulation: "QAM256", Scheme: "SC-QAM", Locked: true},
+			{ChannelID: 8, Channel: 4, Modulation: "QAM256", Scheme: "SC-QAM"},
+		},
+		UpChannels: []utils.ModemChannel{
+			{ChannelID: 1, Channel: 1},
+			{ChannelID: 2, Channel: 2},
+		},
+	}}
+	exporter := ProExporter(modem)
+	metrics := []string{"modemstats_downstream_lock_ratio", "modemstats_upstream_lock_ratio"}
+
+	expected := `
+		# HELP modemstats_downstream_lock_ratio Fraction of the downstream channels which are locked
+		# TYPE modemstats_downstream_lock_ratio gauge
+		modemstats_downstream_lock_ratio 0.75
+		# HELP modemstats_upstream_lock_ratio Fraction of the upstream channels which are locked
+		# TYPE modemstats_upstream_lock_ratio gauge
+		modemstats_upstream_lock_ratio 0
+	`
+	assert.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(expected), metrics...))
+
+	// With no channels there is no ratio
+	modem.SetStats(utils.ModemStats{})
+	assert.Equal(t, 0, testutil.CollectAndCount(exporter, metrics...))
+
+	// Nor for a modem which does not report lock status
+	modem = &fake.Modem{
+		Stats:          utils.ModemStats{DownChannels: []utils.ModemChannel{{ChannelID: 5, Channel: 1}}},
+		CapabilityList: []utils.Capability{utils.CapDownstreamChannels},
+	}
+	assert.Equal(t, 0, testutil.CollectAndCount(ProExporter(modem), metrics...))
+}
+
+func TestPrometheusExporter_RecoversFromPanics(t *testing.T) {
+	expected := func(panics int) string {
+		return fmt.Sprintf(`
+			# HELP modemstats_collect_panics_total Number of scrapes which panicked, fetching from the modem or collecting the metrics, and were reported as failed
+			# TYPE modemstats_collect_panics_total counter
+			modemstats_collect_panics_total %d
+			# HELP modemstats_up Whether the last scrape of the modem succeeded (1=success, 0=failure)
+			# TYPE modemstats_up gauge
+			modemstats_up 0
+		`, panics)
+	}
+
+	// A driver panicking while fetching from the modem
+	modem := &fake.Modem{StatsPanic: "index out of range"}
+	exporter := ProExporter(modem)
+	for i := 1; i <= 2; i++ {
+		err := testutil.CollectAndCompare(exporter, strings.NewReader(expected(i)),
+			"modemstats_collect_panics_total", "modemstats_up")
+		assert.NoError(t, err)
+	}
+
+	// A panic while collecting the metrics
+	modem = &fake.Modem{}
+	exporter = ProExporter(modem, func(o *exporterOptions) {
+		o.onScrape = func(error) { panic("duplicate label set") }
+	})
+	err := testutil.CollectAndCompare(exporter, strings.NewReader(expected(1)),
+		"modemstats_collect_panics_total", "modemstats_up")
+	assert.NoError(t, err)
+}
+
+func TestSlowestEndpoint(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		durations map[string]time.Duration
+		expected  string
+	}{
+		{"none", nil, ""},
+		{"single", map[string]time.Duration{"state": time.Second}, "state"},
+		{"slowest", map[string]time.Duration{"state": time.Second, "serviceflows": 3 * time.Second, "upstream": 2 * time.Second}, "serviceflows"},
+		{"tied", map[string]time.Duration{"upstream": time.Second, "downstream": time.Second}, "downstream"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			slowest, ok := slowestEndpoint(tc.durations)
+			assert.Equal(t, tc.expected, slowest)
+			assert.Equal(t, tc.expected != "", ok)
+		})
+	}
+}
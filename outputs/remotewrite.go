@@ -0,0 +1,237 @@
+package outputs
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/msh100/modem-stats/utils/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RemoteWriter pushes the Prometheus metric set to a remote-write endpoint
+type RemoteWriter struct {
+	endpoint string
+	client   *http.Client
+	username string
+	password string
+	tenantID string
+	gatherer prometheus.Gatherer
+}
+
+// remoteWriteLabel and remoteWriteSeries mirror the prompb.Label and
+// prompb.TimeSeries messages of the remote-write protocol
+type remoteWriteLabel struct {
+	name  string
+	value string
+}
+
+type remoteWriteSeries struct {
+	labels    []remoteWriteLabel
+	value     float64
+	timestamp int64
+}
+
+// NewRemoteWriter creates a remote writer which collects the metrics of the
+// modem's exporter, shared with the pull exporter so the modem is only
+// fetched from through its throttle. The options are those the exporter was
+// created with.
+func NewRemoteWriter(endpoint string, exporter *PrometheusExporter, opts ...ExporterOption) *RemoteWriter {
+	return newRemoteWriter(endpoint, newPushRegistry(exporter, opts))
+}
+
+// NewMultiRemoteWriter creates a remote writer for several modems, tagged with
+// their labels as by the pull exporter whose exporters it shares
+func NewMultiRemoteWriter(endpoint string, multi *MultiModem, opts ...ExporterOption) (*RemoteWriter, error) {
+	registry, err := newMultiPushRegistry(multi, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newRemoteWriter(endpoint, registry), nil
+}
+
+// newPushRegistry collects the metrics pushed for a modem from its exporter,
+// the same as those of the pull exporter
+func newPushRegistry(exporter *PrometheusExporter, opts []ExporterOption) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	if buildInfo := newBuildInfo(opts); buildInfo != nil {
+		registry.MustRegister(buildInfo)
+	}
+	return registry
+}
+
+// newMultiPushRegistry collects the metrics pushed for several modems
+func newMultiPushRegistry(multi *MultiModem, opts []ExporterOption) (*prometheus.Registry, error) {
+	registry := prometheus.NewRegistry()
+	if err := multi.Register(registry); err != nil {
+		return nil, err
+	}
+	if err := registerBuildInfo(registry, opts); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+func newRemoteWriter(endpoint string, gatherer prometheus.Gatherer) *RemoteWriter {
+	return &RemoteWriter{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		gatherer: gatherer,
+	}
+}
+
+// SetBasicAuth configures HTTP basic authentication for pushes
+func (r *RemoteWriter) SetBasicAuth(username, password string) {
+	r.username = username
+	r.password = password
+}
+
+// SetTenantID configures the X-Scope-OrgID header used by multi-tenant
+// backends such as Mimir, Cortex and Loki
+func (r *RemoteWriter) SetTenantID(tenantID string) {
+	r.tenantID = tenantID
+}
+
+// Push gathers the current metrics and sends them to the remote endpoint
+func (r *RemoteWriter) Push() error {
+	families, err := r.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("failed to gather metrics: %w", err)
+	}
+
+	series := familiesToSeries(families, time.Now().UnixMilli())
+	if len(series) == 0 {
+		return nil
+	}
+
+	body := snappy.Encode(nil, encodeWriteRequest(series))
+
+	req, err := http.NewRequest("POST", r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build remote-write request: %w", err)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if r.username != "" || r.password != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+	if r.tenantID != "" {
+		req.Header.Set("X-Scope-OrgID", r.tenantID)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push to remote-write endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("remote-write endpoint returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// StartPushing starts a background goroutine that pushes metrics at the given interval
+func (r *RemoteWriter) StartPushing(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// Initial push
+		if err := r.Push(); err != nil {
+			logging.Errorf("Error pushing metrics to remote-write endpoint: %v", err)
+		}
+
+		for range ticker.C {
+			if err := r.Push(); err != nil {
+				logging.Errorf("Error pushing metrics to remote-write endpoint: %v", err)
+			}
+		}
+	}()
+}
+
+// familiesToSeries flattens gathered metric families into remote-write
+// series. Only gauges, counters and untyped metrics are produced by the
+// exporter, so other metric types are skipped.
+func familiesToSeries(families []*dto.MetricFamily, timestamp int64) []remoteWriteSeries {
+	var series []remoteWriteSeries
+
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			var value float64
+			switch family.GetType() {
+			case dto.MetricType_GAUGE:
+				value = metric.GetGauge().GetValue()
+			case dto.MetricType_COUNTER:
+				value = metric.GetCounter().GetValue()
+			case dto.MetricType_UNTYPED:
+				value = metric.GetUntyped().GetValue()
+			default:
+				continue
+			}
+
+			labels := []remoteWriteLabel{{name: "__name__", value: family.GetName()}}
+			for _, label := range metric.GetLabel() {
+				labels = append(labels, remoteWriteLabel{name: label.GetName(), value: label.GetValue()})
+			}
+			// The remote-write spec requires labels sorted by name
+			sort.Slice(labels, func(i, j int) bool {
+				return labels[i].name < labels[j].name
+			})
+
+			// Metrics stamped with the time of their fetch keep it
+			sampleTime := timestamp
+			if metric.TimestampMs != nil {
+				sampleTime = metric.GetTimestampMs()
+			}
+
+			series = append(series, remoteWriteSeries{
+				labels:    labels,
+				value:     value,
+				timestamp: sampleTime,
+			})
+		}
+	}
+
+	return series
+}
+
+// encodeWriteRequest serializes series as a prompb.WriteRequest message
+func encodeWriteRequest(series []remoteWriteSeries) []byte {
+	var request []byte
+	for _, s := range series {
+		var timeSeries []byte
+		for _, label := range s.labels {
+			var labelMsg []byte
+			labelMsg = protowire.AppendTag(labelMsg, 1, protowire.BytesType)
+			labelMsg = protowire.AppendString(labelMsg, label.name)
+			labelMsg = protowire.AppendTag(labelMsg, 2, protowire.BytesType)
+			labelMsg = protowire.AppendString(labelMsg, label.value)
+
+			timeSeries = protowire.AppendTag(timeSeries, 1, protowire.BytesType)
+			timeSeries = protowire.AppendBytes(timeSeries, labelMsg)
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.timestamp))
+
+		timeSeries = protowire.AppendTag(timeSeries, 2, protowire.BytesType)
+		timeSeries = protowire.AppendBytes(timeSeries, sample)
+
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, timeSeries)
+	}
+	return request
+}
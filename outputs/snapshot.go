@@ -0,0 +1,97 @@
+package outputs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/msh100/modem-stats/utils"
+	"github.com/msh100/modem-stats/utils/logging"
+)
+
+// DefaultSnapshotMaxFiles is how many scrapes are kept in a snapshot archive
+// unless set otherwise
+const DefaultSnapshotMaxFiles = 100
+
+// snapshotTimeFormat names snapshots so they sort in the order they were taken
+const snapshotTimeFormat = "20060102T150405.000000000Z"
+
+// snapshotArchive keeps each scrape of the modem in a directory for later
+// analysis: the parsed statistics as <time>.json, and the statistics as
+// fetched from the modem (where the driver keeps them) as <time>.raw, which can
+// be replayed through LOCAL_FILE. Only the newest maxFiles scrapes are kept.
+type snapshotArchive struct {
+	dir      string
+	maxFiles int
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+func newSnapshotArchive(dir string, maxFiles int) *snapshotArchive {
+	if maxFiles <= 0 {
+		maxFiles = DefaultSnapshotMaxFiles
+	}
+	return &snapshotArchive{dir: dir, maxFiles: maxFiles, now: time.Now}
+}
+
+// save writes a scrape of the modem to the archive and prunes the oldest
+// scrapes. Failures are logged rather than failing the scrape.
+func (a *snapshotArchive) save(modem utils.DocsisModem, stats utils.ModemStats) {
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		logging.Warnf("Failed to create snapshot directory: %v", err)
+		return
+	}
+
+	name := filepath.Join(a.dir, a.now().UTC().Format(snapshotTimeFormat))
+	parsed, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		logging.Warnf("Failed to encode snapshot: %v", err)
+		return
+	}
+	if err := ioutil.WriteFile(name+".json", parsed, 0644); err != nil {
+		logging.Warnf("Failed to write snapshot: %v", err)
+		return
+	}
+	if provider, ok := modem.(utils.RawStatsProvider); ok {
+		if raw := provider.RawStats(); len(raw) > 0 {
+			if err := ioutil.WriteFile(name+".raw", raw, 0644); err != nil {
+				logging.Warnf("Failed to write raw snapshot: %v", err)
+			}
+		}
+	}
+
+	a.prune()
+}
+
+// prune removes the oldest scrapes beyond maxFiles
+func (a *snapshotArchive) prune() {
+	files, err := ioutil.ReadDir(a.dir)
+	if err != nil {
+		logging.Warnf("Failed to list snapshots: %v", err)
+		return
+	}
+
+	var snapshots []string
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") {
+			snapshots = append(snapshots, strings.TrimSuffix(file.Name(), ".json"))
+		}
+	}
+	if len(snapshots) <= a.maxFiles {
+		return
+	}
+
+	sort.Strings(snapshots)
+	for _, snapshot := range snapshots[:len(snapshots)-a.maxFiles] {
+		for _, ext := range []string{".json", ".raw"} {
+			if err := os.Remove(filepath.Join(a.dir, snapshot+ext)); err != nil && !os.IsNotExist(err) {
+				logging.Warnf("Failed to remove snapshot: %v", err)
+			}
+		}
+	}
+}
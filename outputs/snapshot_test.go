@@ -0,0 +1,78 @@
+package outputs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/msh100/modem-stats/modems/fake"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func snapshotNames(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	return names
+}
+
+func TestSnapshotArchive_WritesEachScrapeAndPrunes(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "snapshots")
+	modem := &fake.Modem{
+		Stats: utils.ModemStats{DownChannels: []utils.ModemChannel{{ChannelID: 5, Channel: 1, Snr: 410}}},
+		Raw:   []byte(`{"downstream": []}`),
+	}
+	exporter := ProExporter(modem, WithSnapshots(dir, 2))
+	now := time.Date(2026, 2, 9, 10, 0, 0, 0, time.UTC)
+	exporter.throttle.archive.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		testutil.CollectAndCount(exporter)
+		now = now.Add(time.Minute)
+	}
+
+	assert.Equal(t, []string{
+		"20260209T100100.000000000Z.json",
+		"20260209T100100.000000000Z.raw",
+		"20260209T100200.000000000Z.json",
+		"20260209T100200.000000000Z.raw",
+	}, snapshotNames(t, dir), "only the newest two scrapes should be kept")
+
+	raw, err := ioutil.ReadFile(filepath.Join(dir, "20260209T100200.000000000Z.raw"))
+	require.NoError(t, err)
+	assert.Equal(t, `{"downstream": []}`, string(raw))
+
+	parsed, err := ioutil.ReadFile(filepath.Join(dir, "20260209T100200.000000000Z.json"))
+	require.NoError(t, err)
+	var stats utils.ModemStats
+	require.NoError(t, json.Unmarshal(parsed, &stats))
+	assert.Equal(t, modem.Stats, stats)
+}
+
+func TestSnapshotArchive_SkipsFailedScrapes(t *testing.T) {
+	dir := t.TempDir()
+	modem := &fake.Modem{StatsErr: errCollectTimeout}
+	exporter := ProExporter(modem, WithSnapshots(dir, 2))
+
+	testutil.CollectAndCount(exporter)
+	assert.Empty(t, snapshotNames(t, dir))
+}
+
+func TestSnapshotArchive_WithoutRawStats(t *testing.T) {
+	dir := t.TempDir()
+	archive := newSnapshotArchive(dir, 0)
+	archive.now = func() time.Time { return time.Date(2026, 2, 9, 10, 0, 0, 0, time.UTC) }
+
+	archive.save(&fake.Modem{}, utils.ModemStats{ModemType: utils.TypeDocsis})
+	assert.Equal(t, []string{"20260209T100000.000000000Z.json"}, snapshotNames(t, dir))
+	assert.Equal(t, DefaultSnapshotMaxFiles, archive.maxFiles)
+}
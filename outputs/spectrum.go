@@ -0,0 +1,72 @@
+package outputs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/msh100/modem-stats/utils"
+)
+
+// spectrumPoint is a point of a spectrum sweep as written in JSON
+type spectrumPoint struct {
+	Frequency int     `json:"frequency_hz"`
+	Power     float64 `json:"power_dbmv"`
+}
+
+type spectrumDocument struct {
+	Points []spectrumPoint `json:"points"`
+}
+
+// fetchSpectrum sweeps the spectrum of a modem which supports it
+func fetchSpectrum(modem utils.DocsisModem) ([]spectrumPoint, error) {
+	provider, ok := modem.(utils.SpectrumProvider)
+	if !ok {
+		return nil, utils.ErrSpectrumUnsupported
+	}
+	points, err := provider.FetchSpectrum()
+	if err != nil {
+		return nil, err
+	}
+
+	spectrum := make([]spectrumPoint, len(points))
+	for i, point := range points {
+		spectrum[i] = spectrumPoint{
+			Frequency: point.Frequency,
+			Power:     float64(point.Power) / 10,
+		}
+	}
+	return spectrum, nil
+}
+
+// WriteSpectrum writes the modem's downstream spectrum as JSON
+func WriteSpectrum(w io.Writer, modem utils.DocsisModem) error {
+	spectrum, err := fetchSpectrum(modem)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(spectrumDocument{spectrum})
+}
+
+// SpectrumHandler serves the modem's downstream spectrum as JSON, sweeping it
+// on every request. Modems which cannot sweep the spectrum are served a 404.
+func SpectrumHandler(modem utils.DocsisModem) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		spectrum, err := fetchSpectrum(modem)
+		if errors.Is(err, utils.ErrSpectrumUnsupported) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to fetch spectrum: %v", err), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(spectrumDocument{spectrum})
+	})
+}
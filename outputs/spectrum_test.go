@@ -0,0 +1,48 @@
+package outputs
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/msh100/modem-stats/modems/fake"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteSpectrum(t *testing.T) {
+	modem := &fake.Modem{Spectrum: []utils.SpectrumPoint{
+		{Frequency: 258000000, Power: 40},
+		{Frequency: 264000000, Power: -15},
+	}}
+
+	var out bytes.Buffer
+	require.NoError(t, WriteSpectrum(&out, modem))
+	assert.JSONEq(t, `{"points": [
+		{"frequency_hz": 258000000, "power_dbmv": 4},
+		{"frequency_hz": 264000000, "power_dbmv": -1.5}
+	]}`, out.String())
+}
+
+func TestSpectrumHandler(t *testing.T) {
+	modem := &fake.Modem{Spectrum: []utils.SpectrumPoint{{Frequency: 258000000, Power: 40}}}
+
+	recorder := httptest.NewRecorder()
+	SpectrumHandler(modem).ServeHTTP(recorder, httptest.NewRequest("GET", "/spectrum", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"points": [{"frequency_hz": 258000000, "power_dbmv": 4}]}`, recorder.Body.String())
+
+	modem.SpectrumErr = utils.ErrSpectrumUnsupported
+	recorder = httptest.NewRecorder()
+	SpectrumHandler(modem).ServeHTTP(recorder, httptest.NewRequest("GET", "/spectrum", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	modem.SpectrumErr = errors.New("modem unreachable")
+	recorder = httptest.NewRecorder()
+	SpectrumHandler(modem).ServeHTTP(recorder, httptest.NewRequest("GET", "/spectrum", nil))
+	assert.Equal(t, http.StatusBadGateway, recorder.Code)
+}
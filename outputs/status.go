@@ -0,0 +1,57 @@
+package outputs
+
+import "math"
+
+// Status levels of a channel's power or SNR, for colouring dashboards
+const (
+	StatusGood = "good"
+	StatusWarn = "warn"
+	StatusBad  = "bad"
+)
+
+// statusLevels are every status level, each channel having a series for each
+// with the one it is at set to 1
+var statusLevels = []string{StatusGood, StatusWarn, StatusBad}
+
+// StatusThresholds grade downstream channels' power and SNR. Power is good
+// within PowerGood dBmV either side of 0 and a warning within PowerWarn, and
+// SNR good from SNRGood dB and a warning from SNRWarn. Anything beyond is bad.
+type StatusThresholds struct {
+	PowerGood float64
+	PowerWarn float64
+	SNRGood   float64
+	SNRWarn   float64
+}
+
+// DefaultStatusThresholds follow common DOCSIS recommendations: downstream
+// power ideally within ±7 dBmV and at most ±15 dBmV, and SNR ideally 33 dB or
+// more and at least 30 dB (the minimum for QAM256)
+var DefaultStatusThresholds = StatusThresholds{PowerGood: 7, PowerWarn: 15, SNRGood: 33, SNRWarn: 30}
+
+func (t StatusThresholds) valid() bool {
+	return t.PowerGood >= 0 && t.PowerGood <= t.PowerWarn && t.SNRWarn >= 0 && t.SNRWarn <= t.SNRGood
+}
+
+// powerStatus grades a downstream channel's power in tenths of a dBmV
+func (t StatusThresholds) powerStatus(power int) string {
+	dBmV := math.Abs(float64(power) / 10)
+	switch {
+	case dBmV <= t.PowerGood:
+		return StatusGood
+	case dBmV <= t.PowerWarn:
+		return StatusWarn
+	}
+	return StatusBad
+}
+
+// snrStatus grades a downstream channel's SNR in tenths of a dB
+func (t StatusThresholds) snrStatus(snr int) string {
+	dB := float64(snr) / 10
+	switch {
+	case dB >= t.SNRGood:
+		return StatusGood
+	case dB >= t.SNRWarn:
+		return StatusWarn
+	}
+	return StatusBad
+}
@@ -0,0 +1,84 @@
+package outputs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/msh100/modem-stats/modems/fake"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusThresholds(t *testing.T) {
+	thresholds := DefaultStatusThresholds
+
+	assert.Equal(t, StatusGood, thresholds.powerStatus(-70))
+	assert.Equal(t, StatusWarn, thresholds.powerStatus(71))
+	assert.Equal(t, StatusWarn, thresholds.powerStatus(-150))
+	assert.Equal(t, StatusBad, thresholds.powerStatus(151))
+
+	assert.Equal(t, StatusGood, thresholds.snrStatus(330))
+	assert.Equal(t, StatusWarn, thresholds.snrStatus(300))
+	assert.Equal(t, StatusBad, thresholds.snrStatus(299))
+
+	assert.True(t, thresholds.valid())
+	assert.False(t, StatusThresholds{PowerGood: 10, PowerWarn: 7, SNRGood: 33, SNRWarn: 30}.valid())
+	assert.False(t, StatusThresholds{PowerGood: 7, PowerWarn: 15, SNRGood: 30, SNRWarn: 33}.valid())
+}
+
+func TestPrometheusExporter_ChannelStatus(t *testing.T) {
+	modem := &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			{ChannelID: 1, Channel: 1, Power: 32, Snr: 403, Modulation: "QAM256", Scheme: "SC-QAM"},
+			{ChannelID: 2, Channel: 2, Power: -95, Snr: 312, Modulation: "QAM256", Scheme: "SC-QAM"},
+			{ChannelID: 3, Channel: 3, Power: 172, Snr: 281, Modulation: "QAM256", Scheme: "SC-QAM"},
+		},
+	}}
+
+	expected := `
+		# HELP modemstats_downstream_power_status Grade of the downstream power level, 1 for the level it is at (good, warn or bad)
+		# TYPE modemstats_downstream_power_status gauge
+		modemstats_downstream_power_status{channel="1",id="1",level="bad",modulation="QAM256",scheme="SC-QAM"} 0
+		modemstats_downstream_power_status{channel="1",id="1",level="good",modulation="QAM256",scheme="SC-QAM"} 1
+		modemstats_downstream_power_status{channel="1",id="1",level="warn",modulation="QAM256",scheme="SC-QAM"} 0
+		modemstats_downstream_power_status{channel="2",id="2",level="bad",modulation="QAM256",scheme="SC-QAM"} 0
+		modemstats_downstream_power_status{channel="2",id="2",level="good",modulation="QAM256",scheme="SC-QAM"} 0
+		modemstats_downstream_power_status{channel="2",id="2",level="warn",modulation="QAM256",scheme="SC-QAM"} 1
+		modemstats_downstream_power_status{channel="3",id="3",level="bad",modulation="QAM256",scheme="SC-QAM"} 1
+		modemstats_downstream_power_status{channel="3",id="3",level="good",modulation="QAM256",scheme="SC-QAM"} 0
+		modemstats_downstream_power_status{channel="3",id="3",level="warn",modulation="QAM256",scheme="SC-QAM"} 0
+		# HELP modemstats_downstream_snr_status Grade of the downstream SNR, 1 for the level it is at (good, warn or bad)
+		# TYPE modemstats_downstream_snr_status gauge
+		modemstats_downstream_snr_status{channel="1",id="1",level="bad",modulation="QAM256",scheme="SC-QAM"} 0
+		modemstats_downstream_snr_status{channel="1",id="1",level="good",modulation="QAM256",scheme="SC-QAM"} 1
+		modemstats_downstream_snr_status{channel="1",id="1",level="warn",modulation="QAM256",scheme="SC-QAM"} 0
+		modemstats_downstream_snr_status{channel="2",id="2",level="bad",modulation="QAM256",scheme="SC-QAM"} 0
+		modemstats_downstream_snr_status{channel="2",id="2",level="good",modulation="QAM256",scheme="SC-QAM"} 0
+		modemstats_downstream_snr_status{channel="2",id="2",level="warn",modulation="QAM256",scheme="SC-QAM"} 1
+		modemstats_downstream_snr_status{channel="3",id="3",level="bad",modulation="QAM256",scheme="SC-QAM"} 1
+		modemstats_downstream_snr_status{channel="3",id="3",level="good",modulation="QAM256",scheme="SC-QAM"} 0
+		modemstats_downstream_snr_status{channel="3",id="3",level="warn",modulation="QAM256",scheme="SC-QAM"} 0
+	`
+	err := testutil.CollectAndCompare(ProExporter(modem), strings.NewReader(expected),
+		"modemstats_downstream_power_status", "modemstats_downstream_snr_status")
+	assert.NoError(t, err)
+
+	// Stricter thresholds grade channel 1's power as a warning
+	exporter := ProExporter(modem, WithStatusThresholds(StatusThresholds{PowerGood: 3, PowerWarn: 10, SNRGood: 33, SNRWarn: 30}))
+	expected = `
+		# HELP modemstats_downstream_power_status Grade of the downstream power level, 1 for the level it is at (good, warn or bad)
+		# TYPE modemstats_downstream_power_status gauge
+		modemstats_downstream_power_status{channel="1",id="1",level="bad",modulation="QAM256",scheme="SC-QAM"} 0
+		modemstats_downstream_power_status{channel="1",id="1",level="good",modulation="QAM256",scheme="SC-QAM"} 0
+		modemstats_downstream_power_status{channel="1",id="1",level="warn",modulation="QAM256",scheme="SC-QAM"} 1
+		modemstats_downstream_power_status{channel="2",id="2",level="bad",modulation="QAM256",scheme="SC-QAM"} 0
+		modemstats_downstream_power_status{channel="2",id="2",level="good",modulation="QAM256",scheme="SC-QAM"} 0
+		modemstats_downstream_power_status{channel="2",id="2",level="warn",modulation="QAM256",scheme="SC-QAM"} 1
+		modemstats_downstream_power_status{channel="3",id="3",level="bad",modulation="QAM256",scheme="SC-QAM"} 1
+		modemstats_downstream_power_status{channel="3",id="3",level="good",modulation="QAM256",scheme="SC-QAM"} 0
+		modemstats_downstream_power_status{channel="3",id="3",level="warn",modulation="QAM256",scheme="SC-QAM"} 0
+	`
+	err = testutil.CollectAndCompare(exporter, strings.NewReader(expected), "modemstats_downstream_power_status")
+	assert.NoError(t, err)
+}
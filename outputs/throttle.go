@@ -0,0 +1,308 @@
+package outputs
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/msh100/modem-stats/utils"
+	"github.com/msh100/modem-stats/utils/logging"
+)
+
+// errCollectTimeout is reported for a scrape whose fetch from the modem did
+// not complete within the collect timeout
+var errCollectTimeout = errors.New("timed out fetching statistics from the modem")
+
+// errNotFetched is reported for a scrape served from the background fetch
+// before it has first completed
+var errNotFetched = errors.New("statistics not yet fetched from the modem")
+
+// scrapeThrottle protects a modem from being scraped more often than a
+// minimum interval, however often the exporter itself is scraped. Scrapes
+// within the interval are served the result of the last fetch.
+//
+// Concurrent scrapes, such as from a pair of Prometheus servers, share the
+// fetch in flight rather than each fetching from the modem. Only the first
+// to be served its result counts it as fetched, the others being served it
+// as a repeat like a throttled scrape.
+//
+// With a timeout, a scrape whose fetch takes too long is served the result of
+// the last fetch with errCollectTimeout. The fetch is left to finish in the
+// background and later scrapes wait on it rather than starting another, so
+// fetches from a hung modem do not pile up.
+//
+// Fetching in the background, the modem is instead fetched on a fixed
+// interval and every scrape is served the result of the last fetch without
+// waiting on the modem.
+type scrapeThrottle struct {
+	mu          sync.Mutex
+	modem       utils.DocsisModem
+	minInterval time.Duration
+	timeout     time.Duration
+	stats       utils.ModemStats
+	err         error
+	throttled   int
+	panics      int
+
+	// lastFetch is when the last fetch started, which the minimum interval
+	// is measured from, and fetchedAt when it completed, which is when the
+	// statistics served were fetched
+	lastFetch time.Time
+	fetchedAt time.Time
+
+	// fetches counts the completed fetches, and served the fetches whose
+	// result has been served to a scrape, so a fetch shared by concurrent
+	// scrapes is only counted as fetched by one
+	fetches int
+	served  int
+
+	// stop is closed to stop fetching in the background, nil unless
+	// fetching in the background
+	stop chan struct{}
+
+	// archive keeps each fetch, nil unless snapshots are enabled
+	archive *snapshotArchive
+
+	// eventLog is whether the modem's event log is fetched along with its
+	// statistics, so is throttled and timed out alike. events and eventsErr
+	// are the result of the last fetch of it.
+	eventLog  bool
+	events    []utils.EventLogEntry
+	eventsErr error
+
+	// inFlight is closed when the running fetch completes, nil when there
+	// is none
+	inFlight chan struct{}
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+func newScrapeThrottle(modem utils.DocsisModem, minInterval, timeout time.Duration) *scrapeThrottle {
+	return &scrapeThrottle{
+		modem:       modem,
+		minInterval: minInterval,
+		timeout:     timeout,
+		now:         time.Now,
+	}
+}
+
+// fetch returns the modem's statistics, fetched afresh unless the last fetch
+// was within the minimum interval, when the fetch they came from completed
+// (the zero time before the first fetch), whether they are yet to be served
+// to a scrape and the number of scrapes which have been throttled. A scrape
+// which times out is always reported as fetched, so that the watchdog counts
+// each timeout even though the same stale statistics are served again.
+func (t *scrapeThrottle) fetch() (utils.ModemStats, time.Time, bool, int, error) {
+	return t.serve(true)
+}
+
+// peek returns the modem's statistics as fetch does, for an output other than
+// the exporter. They are left to be counted as fetched by the exporter's next
+// scrape, and a peek is not counted as throttled.
+func (t *scrapeThrottle) peek() (utils.ModemStats, time.Time, error) {
+	stats, fetchedAt, _, _, err := t.serve(false)
+	return stats, fetchedAt, err
+}
+
+// serve returns the modem's statistics for fetch if scrape is set, counting
+// them as served to a scrape, otherwise for peek
+func (t *scrapeThrottle) serve(scrape bool) (utils.ModemStats, time.Time, bool, int, error) {
+	t.mu.Lock()
+	if t.stop != nil {
+		defer t.mu.Unlock()
+		return t.cached(scrape)
+	}
+
+	now := t.now()
+	if t.minInterval > 0 && !t.lastFetch.IsZero() && now.Sub(t.lastFetch) < t.minInterval {
+		if scrape {
+			t.throttled++
+		}
+		defer t.mu.Unlock()
+		// A fetch made for peek is yet to be served to a scrape
+		return t.stats, t.fetchedAt, t.markServed(scrape), t.throttled, t.err
+	}
+
+	if t.inFlight == nil {
+		t.inFlight = make(chan struct{})
+		go t.fetchModem(t.inFlight, now)
+	}
+	done := t.inFlight
+	t.mu.Unlock()
+
+	var timedOut <-chan time.Time
+	if t.timeout > 0 {
+		timer := time.NewTimer(t.timeout)
+		defer timer.Stop()
+		timedOut = timer.C
+	}
+
+	select {
+	case <-done:
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		return t.stats, t.fetchedAt, t.markServed(scrape), t.throttled, t.err
+	case <-timedOut:
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		return t.stats, t.fetchedAt, true, t.throttled, errCollectTimeout
+	}
+}
+
+// cached returns the result of the last background fetch, and whether it is
+// yet to be served to a scrape, counting it as served if scrape is set. t.mu
+// must be held.
+func (t *scrapeThrottle) cached(scrape bool) (utils.ModemStats, time.Time, bool, int, error) {
+	if t.fetches == 0 {
+		return t.stats, time.Time{}, false, t.throttled, errNotFetched
+	}
+	return t.stats, t.fetchedAt, t.markServed(scrape), t.throttled, t.err
+}
+
+// markServed reports whether the last fetch is yet to be served to a scrape,
+// counting it as served if scrape is set. t.mu must be held.
+func (t *scrapeThrottle) markServed(scrape bool) bool {
+	fetched := t.served != t.fetches
+	if scrape {
+		t.served = t.fetches
+	}
+	return fetched
+}
+
+// fetchEvery starts fetching from the modem in the background, immediately
+// and then on every interval, until stopped. A fetch which overruns the
+// interval is followed straight away by the next.
+func (t *scrapeThrottle) fetchEvery(interval time.Duration) {
+	t.mu.Lock()
+	t.stop = make(chan struct{})
+	stop := t.stop
+	t.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			// A tick may be due at the same time as stopping, and select
+			// would pick between them at random
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			t.mu.Lock()
+			started := t.now()
+			t.mu.Unlock()
+			t.fetchModem(make(chan struct{}), started)
+
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stopFetching stops fetching in the background
+func (t *scrapeThrottle) stopFetching() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stop != nil {
+		close(t.stop)
+		t.stop = nil
+	}
+}
+
+// last returns the result of the last completed fetch and when it completed,
+// the zero time if there has been none
+func (t *scrapeThrottle) last() (utils.ModemStats, time.Time, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats, t.fetchedAt, t.err
+}
+
+// lastEventLog returns the event log as last fetched along with the
+// statistics and when it was fetched, the zero time if it has not been
+func (t *scrapeThrottle) lastEventLog() ([]utils.EventLogEntry, time.Time, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.events, t.fetchedAt, t.eventsErr
+}
+
+// panicCount returns the number of fetches which have panicked
+func (t *scrapeThrottle) panicCount() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.panics
+}
+
+// fetchModem fetches the modem's statistics, storing the result and closing
+// done once complete
+func (t *scrapeThrottle) fetchModem(done chan struct{}, started time.Time) {
+	stats, panicked, err := t.fetchStats()
+	if err == nil && t.archive != nil {
+		t.archive.save(t.modem, stats)
+	}
+	var events []utils.EventLogEntry
+	var eventsPanicked bool
+	var eventsErr error
+	if t.eventLog {
+		events, eventsPanicked, eventsErr = t.fetchEventLog()
+	}
+
+	t.mu.Lock()
+	t.stats, t.err = stats, err
+	if panicked {
+		t.panics++
+	}
+	t.lastFetch, t.fetchedAt = started, t.now()
+	if t.eventLog {
+		t.events, t.eventsErr = events, eventsErr
+	}
+	if eventsPanicked {
+		t.panics++
+	}
+	t.fetches++
+	t.inFlight = nil
+	t.mu.Unlock()
+	close(done)
+}
+
+// fetchStats fetches the modem's statistics. As the fetch runs outside of the
+// scrape, a driver panicking (such as on malformed data) would take the
+// exporter down with it, so the panic is reported as the fetch failing.
+func (t *scrapeThrottle) fetchStats() (stats utils.ModemStats, panicked bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logging.Errorf("Recovered from panic fetching statistics from the modem: %v\n%s", r, debug.Stack())
+			stats, panicked, err = utils.ModemStats{}, true, fmt.Errorf("panic fetching statistics from the modem: %v", r)
+		}
+	}()
+
+	utils.ResetStats(t.modem)
+	stats, err = utils.FetchStats(t.modem)
+	return stats, false, err
+}
+
+// fetchEventLog fetches the modem's event log, reporting a panic as the fetch
+// failing as fetchStats does
+func (t *scrapeThrottle) fetchEventLog() (entries []utils.EventLogEntry, panicked bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logging.Errorf("Recovered from panic fetching the event log from the modem: %v\n%s", r, debug.Stack())
+			entries, panicked, err = nil, true, fmt.Errorf("panic fetching the event log from the modem: %v", r)
+		}
+	}()
+
+	logProvider, ok := t.modem.(utils.EventLogProvider)
+	if !ok {
+		return nil, false, nil
+	}
+	entries, err = logProvider.FetchEventLog()
+	return entries, false, err
+}
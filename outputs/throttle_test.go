@@ -0,0 +1,342 @@
+package outputs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/msh100/modem-stats/modems/fake"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScrapeThrottle_ServesCachedResult(t *testing.T) {
+	modem := &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			{ChannelID: 5, Channel: 1, Snr: 410, Modulation: "QAM256", Scheme: "SC-QAM"},
+		},
+	}}
+	exporter := ProExporter(modem, WithMinScrapeInterval(10*time.Second))
+	now := time.Date(2026, 2, 9, 10, 0, 0, 0, time.UTC)
+	exporter.throttle.now = func() time.Time { return now }
+
+	expect := func(snr, throttled int) {
+		t.Helper()
+		expected := fmt.Sprintf(`
+			# HELP modemstats_downstream_snr Downstream SNR in dB
+			# TYPE modemstats_downstream_snr gauge
+			modemstats_downstream_snr{channel="1",id="5",modulation="QAM256",scheme="SC-QAM"} %d
+			# HELP modemstats_throttled_scrapes_total Number of scrapes served the previous result as they came within the minimum scrape interval
+			# TYPE modemstats_throttled_scrapes_total counter
+			modemstats_throttled_scrapes_total %d
+		`, snr, throttled)
+		err := testutil.CollectAndCompare(exporter, strings.NewReader(expected),
+			"modemstats_downstream_snr", "modemstats_throttled_scrapes_total")
+		assert.NoError(t, err)
+	}
+
+	expect(410, 0)
+	assert.Equal(t, 1, modem.ParseCalls())
+
+	// A rapid second scrape is served from the cache, not the modem
+	modem.Stats.DownChannels = []utils.ModemChannel{
+		{ChannelID: 5, Channel: 1, Snr: 380, Modulation: "QAM256", Scheme: "SC-QAM"},
+	}
+	now = now.Add(time.Second)
+	expect(410, 1)
+	assert.Equal(t, 1, modem.ParseCalls())
+
+	// Once the interval has passed the modem is fetched again
+	now = now.Add(10 * time.Second)
+	expect(380, 1)
+	assert.Equal(t, 2, modem.ParseCalls())
+}
+
+func TestScrapeThrottle_StatsAge(t *testing.T) {
+	modem := &fake.Modem{}
+	exporter := ProExporter(modem, WithMinScrapeInterval(10*time.Second))
+	now := time.Date(2026, 2, 9, 10, 0, 0, 0, time.UTC)
+	exporter.throttle.now = func() time.Time { return now }
+
+	expect := func(age float64) {
+		t.Helper()
+		expected := fmt.Sprintf(`
+			# HELP modemstats_stats_age_seconds Seconds since the statistics served were fetched from the modem, growing while a cached result is served
+			# TYPE modemstats_stats_age_seconds gauge
+			modemstats_stats_age_seconds %g
+		`, age)
+		err := testutil.CollectAndCompare(exporter, strings.NewReader(expected), "modemstats_stats_age_seconds")
+		assert.NoError(t, err)
+	}
+
+	expect(0)
+
+	// Throttled scrapes are served the cached result as it ages
+	now = now.Add(4 * time.Second)
+	expect(4)
+	now = now.Add(5500 * time.Millisecond)
+	expect(9.5)
+
+	// The next fetch is fresh again
+	now = now.Add(time.Second)
+	expect(0)
+	assert.Equal(t, 2, modem.ParseCalls())
+}
+
+// statsAge returns the age of the statistics served to a scrape, false if it
+// was not reported
+func statsAge(t *testing.T, exporter *PrometheusExporter) (float64, bool) {
+	t.Helper()
+	family, ok := gatherFamilies(t, exporter)["modemstats_stats_age_seconds"]
+	if !ok {
+		return 0, false
+	}
+	return family.GetMetric()[0].GetGauge().GetValue(), true
+}
+
+func TestScrapeThrottle_StatsAgeFromCompletion(t *testing.T) {
+	modem := &fake.Modem{StatsDelay: 200 * time.Millisecond}
+	exporter := ProExporter(modem, WithMinScrapeInterval(time.Minute))
+
+	age, ok := statsAge(t, exporter)
+	require.True(t, ok)
+	assert.Less(t, age, 0.1, "a fresh fetch should not be aged by how long it took")
+}
+
+func TestCollectTimeout_StatsAge(t *testing.T) {
+	modem := &fake.Modem{}
+	exporter := ProExporter(modem, WithCollectTimeout(50*time.Millisecond))
+
+	fresh, ok := statsAge(t, exporter)
+	require.True(t, ok)
+
+	// Once the modem hangs, the age of the result served keeps growing
+	modem.StatsDelay = time.Second
+	stale, ok := statsAge(t, exporter)
+	require.True(t, ok, "the cached result should be aged on timing out")
+	assert.Greater(t, stale, fresh)
+}
+
+func TestScrapeThrottle_Disabled(t *testing.T) {
+	modem := &fake.Modem{}
+	exporter := ProExporter(modem)
+
+	testutil.CollectAndCount(exporter)
+	testutil.CollectAndCount(exporter)
+	assert.Equal(t, 2, modem.ParseCalls())
+	assert.Equal(t, 0, testutil.CollectAndCount(exporter, "modemstats_throttled_scrapes_total"))
+	assert.Equal(t, 0, testutil.CollectAndCount(exporter, "modemstats_stats_age_seconds"))
+}
+
+func TestScrapeThrottle_WatchdogSeesEachFetchOnce(t *testing.T) {
+	modem := &fake.Modem{StatsErr: context.DeadlineExceeded}
+	exporter := ProExporter(modem, WithMinScrapeInterval(time.Minute), WithWatchdog(2, false))
+	now := time.Date(2026, 2, 9, 10, 0, 0, 0, time.UTC)
+	exporter.throttle.now = func() time.Time { return now }
+	exporter.watchdog.resetTransport = func() {}
+
+	// Repeating a failed fetch to throttled scrapes is not another failure
+	for i := 0; i < 5; i++ {
+		testutil.CollectAndCount(exporter)
+	}
+	assert.Equal(t, 0, exporter.watchdog.triggerCount())
+
+	now = now.Add(time.Minute)
+	testutil.CollectAndCount(exporter)
+	assert.Equal(t, 1, exporter.watchdog.triggerCount())
+}
+
+func TestScrapeThrottle_PeekLeavesFetchToScrape(t *testing.T) {
+	modem := &fake.Modem{StatsErr: context.DeadlineExceeded}
+	exporter := ProExporter(modem, WithMinScrapeInterval(time.Minute), WithWatchdog(1, false))
+	now := time.Date(2026, 2, 9, 10, 0, 0, 0, time.UTC)
+	exporter.throttle.now = func() time.Time { return now }
+	exporter.watchdog.resetTransport = func() {}
+
+	// A fetch made for another output is still seen by the next scrape
+	_, _, err := exporter.throttle.peek()
+	assert.Equal(t, context.DeadlineExceeded, err)
+	_, _, err = exporter.throttle.peek()
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 0, exporter.watchdog.triggerCount())
+
+	testutil.CollectAndCount(exporter)
+	assert.Equal(t, 1, exporter.watchdog.triggerCount())
+	assert.Equal(t, 1, modem.ParseCalls())
+}
+
+func TestCollectTimeout_SlowModem(t *testing.T) {
+	modem := &fake.Modem{
+		Stats: utils.ModemStats{
+			DownChannels: []utils.ModemChannel{
+				{ChannelID: 5, Channel: 1, Snr: 410, Modulation: "QAM256", Scheme: "SC-QAM"},
+			},
+		},
+		StatsDelay: time.Second,
+	}
+	exporter := ProExporter(modem, WithCollectTimeout(50*time.Millisecond))
+
+	// With nothing cached the scrape is empty, and reports the modem down
+	expected := `
+		# HELP modemstats_up Whether the last scrape of the modem succeeded (1=success, 0=failure)
+		# TYPE modemstats_up gauge
+		modemstats_up 0
+	`
+	start := time.Now()
+	err := testutil.CollectAndCompare(exporter, strings.NewReader(expected),
+		"modemstats_up", "modemstats_downstream_snr")
+	assert.NoError(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(500*time.Millisecond))
+
+	// A scrape while the slow fetch is still running waits on it rather than
+	// starting another
+	testutil.CollectAndCount(exporter)
+	assert.Equal(t, 1, modem.ParseCalls())
+}
+
+func TestCollectTimeout_ServesCachedResult(t *testing.T) {
+	modem := &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			{ChannelID: 5, Channel: 1, Snr: 410, Modulation: "QAM256", Scheme: "SC-QAM"},
+		},
+	}}
+	exporter := ProExporter(modem, WithCollectTimeout(50*time.Millisecond))
+
+	expect := func(up int) {
+		t.Helper()
+		expected := fmt.Sprintf(`
+			# HELP modemstats_downstream_snr Downstream SNR in dB
+			# TYPE modemstats_downstream_snr gauge
+			modemstats_downstream_snr{channel="1",id="5",modulation="QAM256",scheme="SC-QAM"} 410
+			# HELP modemstats_up Whether the last scrape of the modem succeeded (1=success, 0=failure)
+			# TYPE modemstats_up gauge
+			modemstats_up %d
+		`, up)
+		start := time.Now()
+		err := testutil.CollectAndCompare(exporter, strings.NewReader(expected),
+			"modemstats_downstream_snr", "modemstats_up")
+		assert.NoError(t, err)
+		assert.Less(t, int64(time.Since(start)), int64(500*time.Millisecond))
+	}
+
+	expect(1)
+
+	// Once the modem hangs, the last result is served and the modem is down
+	modem.StatsDelay = time.Second
+	expect(0)
+}
+
+func TestFetchInterval_ServesCachedResult(t *testing.T) {
+	channels := func(snr int) utils.ModemStats {
+		return utils.ModemStats{DownChannels: []utils.ModemChannel{
+			{ChannelID: 5, Channel: 1, Snr: snr, Modulation: "QAM256", Scheme: "SC-QAM"},
+		}}
+	}
+	modem := &fake.Modem{Stats: channels(410), StatsDelay: 100 * time.Millisecond}
+	exporter := ProExporter(modem, WithFetchInterval(20*time.Millisecond))
+	defer exporter.Stop()
+
+	// A scrape never waits on the modem, so one made before the first fetch
+	// completes is empty and reports the modem down
+	scrape := func(snr, up int) error {
+		t.Helper()
+		expected := fmt.Sprintf(`
+			# HELP modemstats_downstream_snr Downstream SNR in dB
+			# TYPE modemstats_downstream_snr gauge
+			modemstats_downstream_snr{channel="1",id="5",modulation="QAM256",scheme="SC-QAM"} %d
+			# HELP modemstats_up Whether the last scrape of the modem succeeded (1=success, 0=failure)
+			# TYPE modemstats_up gauge
+			modemstats_up %d
+		`, snr, up)
+		if snr == 0 {
+			expected = fmt.Sprintf(`
+				# HELP modemstats_up Whether the last scrape of the modem succeeded (1=success, 0=failure)
+				# TYPE modemstats_up gauge
+				modemstats_up %d
+			`, up)
+		}
+		start := time.Now()
+		err := testutil.CollectAndCompare(exporter, strings.NewReader(expected),
+			"modemstats_downstream_snr", "modemstats_up")
+		assert.Less(t, int64(time.Since(start)), int64(50*time.Millisecond))
+		return err
+	}
+	assert.NoError(t, scrape(0, 0))
+
+	assert.Eventually(t, func() bool { return scrape(410, 1) == nil }, 2*time.Second, 10*time.Millisecond)
+
+	// The modem is fetched on the interval without being scraped
+	calls := modem.ParseCalls()
+	assert.Eventually(t, func() bool { return modem.ParseCalls() >= calls+2 }, 2*time.Second, 10*time.Millisecond)
+
+	// Scrapes pick up the latest fetch
+	modem.SetStats(channels(380))
+	assert.Eventually(t, func() bool { return scrape(380, 1) == nil }, 2*time.Second, 10*time.Millisecond)
+
+	// Once stopped the modem is no longer fetched, beyond any fetch running
+	exporter.Stop()
+	time.Sleep(150 * time.Millisecond)
+	calls = modem.ParseCalls()
+	time.Sleep(150 * time.Millisecond)
+	assert.Equal(t, calls, modem.ParseCalls())
+}
+
+func TestScrapeThrottle_CoalescesConcurrentScrapes(t *testing.T) {
+	modem := &fake.Modem{
+		Stats: utils.ModemStats{
+			DownChannels: []utils.ModemChannel{
+				{ChannelID: 5, Channel: 1, Snr: 410, Modulation: "QAM256", Scheme: "SC-QAM"},
+			},
+		},
+		StatsDelay: 200 * time.Millisecond,
+	}
+	exporter := ProExporter(modem)
+
+	var wg sync.WaitGroup
+	counts := make([]int, 20)
+	for i := range counts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			counts[i] = testutil.CollectAndCount(exporter, "modemstats_downstream_snr")
+		}(i)
+	}
+	wg.Wait()
+
+	// Every scrape is served the one fetch
+	assert.Equal(t, 1, modem.ParseCalls())
+	for _, count := range counts {
+		assert.Equal(t, 1, count)
+	}
+
+	// Once it has completed, the next scrape fetches afresh
+	testutil.CollectAndCount(exporter)
+	assert.Equal(t, 2, modem.ParseCalls())
+}
+
+func TestScrapeThrottle_WatchdogSeesSharedFetchOnce(t *testing.T) {
+	modem := &fake.Modem{StatsErr: context.DeadlineExceeded, StatsDelay: 200 * time.Millisecond}
+	exporter := ProExporter(modem, WithWatchdog(2, false))
+	exporter.watchdog.resetTransport = func() {}
+
+	// Concurrent scrapes sharing a failed fetch are one failure, not many
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			testutil.CollectAndCount(exporter)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, modem.ParseCalls())
+	assert.Equal(t, 0, exporter.watchdog.triggerCount())
+
+	testutil.CollectAndCount(exporter)
+	assert.Equal(t, 1, exporter.watchdog.triggerCount())
+}
@@ -0,0 +1,49 @@
+package outputs
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// perScrapeDescs are the descriptions of metrics which describe the scrape
+// rather than the fetch it was served, so change between scrapes of the same
+// fetch. Stamped with the time of the fetch, each scrape would report a
+// different value for the same timestamp, which Prometheus rejects.
+func (p *PrometheusExporter) perScrapeDescs() map[*prometheus.Desc]bool {
+	descs := make(map[*prometheus.Desc]bool)
+	for _, desc := range []*prometheus.Desc{
+		p.throttleCount,
+		p.statsAge,
+		p.collectPanics,
+		p.downErrorsScrape,
+		p.upTimeoutsScrape,
+		p.downErrorsDelta,
+	} {
+		if desc != nil {
+			descs[desc] = true
+		}
+	}
+	return descs
+}
+
+// stampMetrics returns a channel whose metrics are passed on to ch stamped
+// with the time of the fetch, other than those in scrapeTimeDescs, and a
+// function to call once every metric has been sent to it
+func (p *PrometheusExporter) stampMetrics(ch chan<- prometheus.Metric, fetchedAt time.Time) (chan<- prometheus.Metric, func()) {
+	stamped := make(chan prometheus.Metric)
+	forwarded := make(chan struct{})
+	go func() {
+		defer close(forwarded)
+		for metric := range stamped {
+			if !p.scrapeTimeDescs[metric.Desc()] {
+				metric = prometheus.NewMetricWithTimestamp(fetchedAt, metric)
+			}
+			ch <- metric
+		}
+	}()
+	return stamped, func() {
+		close(stamped)
+		<-forwarded
+	}
+}
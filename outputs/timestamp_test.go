@@ -0,0 +1,102 @@
+package outputs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/msh100/modem-stats/modems/fake"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// gatherFamilies collects an exporter's metrics by name
+func gatherFamilies(t *testing.T, exporter *PrometheusExporter) map[string]*dto.MetricFamily {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(exporter))
+	gathered, err := registry.Gather()
+	require.NoError(t, err)
+
+	families := make(map[string]*dto.MetricFamily)
+	for _, family := range gathered {
+		families[family.GetName()] = family
+	}
+	return families
+}
+
+func TestPrometheusExporter_FetchTimestamps(t *testing.T) {
+	modem := &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			{ChannelID: 5, Channel: 1, Snr: 410, Modulation: "QAM256", Scheme: "SC-QAM"},
+		},
+	}}
+	exporter := ProExporter(modem, WithFetchTimestamps(), WithMinScrapeInterval(time.Minute))
+	fetchedAt := time.Date(2026, 2, 9, 10, 0, 0, 0, time.UTC)
+	now := fetchedAt
+	exporter.throttle.now = func() time.Time { return now }
+
+	gatherFamilies(t, exporter)
+
+	// A throttled scrape is stamped with the time of the fetch it is served
+	now = now.Add(30 * time.Second)
+	families := gatherFamilies(t, exporter)
+
+	for _, name := range []string{"modemstats_downstream_snr", "modemstats_up"} {
+		require.Contains(t, families, name)
+		metric := families[name].GetMetric()[0]
+		assert.Equal(t, fetchedAt.UnixMilli(), metric.GetTimestampMs(), name)
+	}
+
+	// The throttled scrape count changes between scrapes of the same fetch
+	require.Contains(t, families, "modemstats_throttled_scrapes_total")
+	throttled := families["modemstats_throttled_scrapes_total"].GetMetric()[0]
+	assert.Nil(t, throttled.TimestampMs)
+	assert.Equal(t, 1.0, throttled.GetCounter().GetValue())
+}
+
+func TestPrometheusExporter_FetchTimestampsTimedOut(t *testing.T) {
+	modem := &fake.Modem{}
+	exporter := ProExporter(modem, WithFetchTimestamps(), WithCollectTimeout(50*time.Millisecond))
+	gatherFamilies(t, exporter)
+
+	// The modem is reported down, which the previous fetch was not
+	modem.StatsDelay = time.Second
+	families := gatherFamilies(t, exporter)
+	require.Contains(t, families, "modemstats_up")
+	up := families["modemstats_up"].GetMetric()[0]
+	assert.Equal(t, 0.0, up.GetGauge().GetValue())
+	assert.Nil(t, up.TimestampMs, "a scrape which timed out should keep the time of the scrape")
+}
+
+func TestPrometheusExporter_FetchTimestampsOptIn(t *testing.T) {
+	modem := &fake.Modem{Stats: utils.ModemStats{
+		DownChannels: []utils.ModemChannel{
+			{ChannelID: 5, Channel: 1, Snr: 410, Modulation: "QAM256", Scheme: "SC-QAM"},
+		},
+	}}
+	families := gatherFamilies(t, ProExporter(modem))
+
+	require.Contains(t, families, "modemstats_downstream_snr")
+	assert.Nil(t, families["modemstats_downstream_snr"].GetMetric()[0].TimestampMs)
+}
+
+func TestFamiliesToSeries_KeepsTimestamps(t *testing.T) {
+	stamped := int64(1770631200000)
+	families := []*dto.MetricFamily{{
+		Name: proto.String("modemstats_up"),
+		Type: dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{
+			{Gauge: &dto.Gauge{Value: proto.Float64(1)}, TimestampMs: &stamped},
+			{Gauge: &dto.Gauge{Value: proto.Float64(0)}},
+		},
+	}}
+
+	series := familiesToSeries(families, 1770631260000)
+	require.Len(t, series, 2)
+	assert.Equal(t, stamped, series[0].timestamp)
+	assert.Equal(t, int64(1770631260000), series[1].timestamp)
+}
@@ -0,0 +1,113 @@
+package outputs
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/msh100/modem-stats/utils/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// VMImporter pushes the Prometheus metric set to a VictoriaMetrics import
+// endpoint (/api/v1/import/prometheus) as exposition text, which is lighter
+// than remote-write for a single host
+type VMImporter struct {
+	endpoint string
+	client   *http.Client
+	username string
+	password string
+	gatherer prometheus.Gatherer
+}
+
+// NewVMImporter creates an importer which collects the metrics of the modem's
+// exporter, shared with the pull exporter so the modem is only fetched from
+// through its throttle. The options are those the exporter was created with.
+func NewVMImporter(endpoint string, exporter *PrometheusExporter, opts ...ExporterOption) *VMImporter {
+	return newVMImporter(endpoint, newPushRegistry(exporter, opts))
+}
+
+// NewMultiVMImporter creates an importer for several modems, tagged with their
+// labels as by the pull exporter whose exporters it shares
+func NewMultiVMImporter(endpoint string, multi *MultiModem, opts ...ExporterOption) (*VMImporter, error) {
+	registry, err := newMultiPushRegistry(multi, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newVMImporter(endpoint, registry), nil
+}
+
+func newVMImporter(endpoint string, gatherer prometheus.Gatherer) *VMImporter {
+	return &VMImporter{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		gatherer: gatherer,
+	}
+}
+
+// SetBasicAuth configures HTTP basic authentication for pushes
+func (v *VMImporter) SetBasicAuth(username, password string) {
+	v.username = username
+	v.password = password
+}
+
+// Push gathers the current metrics and sends them to the import endpoint,
+// which timestamps them on arrival
+func (v *VMImporter) Push() error {
+	families, err := v.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("failed to gather metrics: %w", err)
+	}
+	if len(families) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(&body, family); err != nil {
+			return fmt.Errorf("failed to encode metrics: %w", err)
+		}
+	}
+
+	req, err := http.NewRequest("POST", v.endpoint, &body)
+	if err != nil {
+		return fmt.Errorf("failed to build import request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	if v.username != "" || v.password != "" {
+		req.SetBasicAuth(v.username, v.password)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push to import endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("import endpoint returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// StartPushing starts a background goroutine that pushes metrics at the given interval
+func (v *VMImporter) StartPushing(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// Initial push
+		if err := v.Push(); err != nil {
+			logging.Errorf("Error pushing metrics to VictoriaMetrics: %v", err)
+		}
+
+		for range ticker.C {
+			if err := v.Push(); err != nil {
+				logging.Errorf("Error pushing metrics to VictoriaMetrics: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,89 @@
+package outputs
+
+import (
+	"sync"
+
+	"github.com/msh100/modem-stats/utils"
+	"github.com/msh100/modem-stats/utils/logging"
+)
+
+// watchdog recovers from a modem whose web server has wedged, which accepts
+// connections but never responds, so every scrape times out. After a number
+// of consecutive failed scrapes it drops the cached HTTP connections to the
+// modem, leaving those to other modems be, and, where enabled and supported,
+// reboots the modem.
+type watchdog struct {
+	mu        sync.Mutex
+	modem     utils.DocsisModem
+	threshold int
+	reboot    bool
+	failures  int
+	triggers  int
+
+	// resetTransport is replaced in tests
+	resetTransport func()
+}
+
+func newWatchdog(modem utils.DocsisModem, threshold int, reboot bool) *watchdog {
+	// Every driver reports its host, so a modem which does not has no
+	// connections of its own to drop
+	resetTransport := func() {}
+	if hostProvider, ok := modem.(utils.HostProvider); ok {
+		host := hostProvider.Host()
+		resetTransport = func() { utils.ResetHTTPHost(host) }
+	}
+	return &watchdog{
+		modem:          modem,
+		threshold:      threshold,
+		reboot:         reboot,
+		resetTransport: resetTransport,
+	}
+}
+
+// triggerCount returns the number of times the watchdog has triggered
+func (w *watchdog) triggerCount() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.triggers
+}
+
+// observe records the result of a scrape, triggering the watchdog once the
+// threshold of consecutive failures is reached. It returns the number of
+// times the watchdog has triggered.
+func (w *watchdog) observe(err error) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.threshold <= 0 {
+		return w.triggers
+	}
+	if err == nil {
+		w.failures = 0
+		return w.triggers
+	}
+
+	w.failures++
+	if w.failures < w.threshold {
+		return w.triggers
+	}
+
+	// Count afresh so a modem which stays down is retried every threshold
+	// failures rather than on every scrape
+	w.failures = 0
+	w.triggers++
+	logging.Warnf("WATCHDOG: %d consecutive scrapes of %T failed (last error: %v), resetting HTTP connections", w.threshold, w.modem, err)
+	w.resetTransport()
+
+	if w.reboot {
+		if rebooter, ok := w.modem.(utils.Rebooter); ok {
+			logging.Warnf("WATCHDOG: rebooting modem")
+			if err := rebooter.Reboot(); err != nil {
+				logging.Errorf("WATCHDOG: failed to reboot modem: %v", err)
+			}
+		} else {
+			logging.Warnf("WATCHDOG: modem %T does not support rebooting", w.modem)
+		}
+	}
+
+	return w.triggers
+}
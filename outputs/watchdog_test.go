@@ -0,0 +1,121 @@
+package outputs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/msh100/modem-stats/modems/fake"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchdog_TriggersAfterThreshold(t *testing.T) {
+	// A wedged modem accepts connections but every fetch times out
+	modem := &fake.Modem{StatsErr: context.DeadlineExceeded}
+	exporter := ProExporter(modem, WithWatchdog(3, true))
+	resets := 0
+	exporter.watchdog.resetTransport = func() { resets++ }
+
+	expectTriggers := func(triggers int) {
+		t.Helper()
+		expected := fmt.Sprintf(`
+			# HELP modemstats_modem_watchdog_triggers_total Number of times repeated scrape failures have triggered the watchdog
+			# TYPE modemstats_modem_watchdog_triggers_total counter
+			modemstats_modem_watchdog_triggers_total %d
+		`, triggers)
+		err := testutil.CollectAndCompare(exporter, strings.NewReader(expected), "modemstats_modem_watchdog_triggers_total")
+		assert.NoError(t, err)
+	}
+
+	expectTriggers(0)
+	expectTriggers(0)
+	assert.Equal(t, 0, resets)
+	assert.Equal(t, 0, modem.RebootCalls())
+
+	expectTriggers(1)
+	assert.Equal(t, 1, resets)
+	assert.Equal(t, 1, modem.RebootCalls())
+
+	// A successful scrape starts the count again
+	modem.StatsErr = nil
+	expectTriggers(1)
+	modem.StatsErr = context.DeadlineExceeded
+	expectTriggers(1)
+	expectTriggers(1)
+	expectTriggers(2)
+	assert.Equal(t, 2, resets)
+	assert.Equal(t, 2, modem.RebootCalls())
+}
+
+// hostModem is a fake modem reporting the host its requests are made to
+type hostModem struct {
+	*fake.Modem
+	host string
+}
+
+func (m hostModem) Host() string {
+	return m.host
+}
+
+// connectionCountingServer serves empty pages, counting the connections made
+// to it
+func connectionCountingServer(t *testing.T) (*httptest.Server, *int32) {
+	var connections int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	return server, &connections
+}
+
+func TestWatchdog_ResetsModemConnections(t *testing.T) {
+	wedged, wedgedConnections := connectionCountingServer(t)
+	healthy, healthyConnections := connectionCountingServer(t)
+	get := func(server *httptest.Server) {
+		t.Helper()
+		resp, err := utils.InsecureHTTPClient().Get(server.URL)
+		require.NoError(t, err)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	modem := &fake.Modem{StatsErr: context.DeadlineExceeded}
+	watchdog := newWatchdog(hostModem{modem, strings.TrimPrefix(wedged.URL, "http://")}, 2, false)
+
+	get(wedged)
+	get(healthy)
+	watchdog.observe(modem.StatsErr)
+	get(wedged)
+	assert.Equal(t, int32(1), atomic.LoadInt32(wedgedConnections), "connections should be reused before the watchdog triggers")
+
+	watchdog.observe(modem.StatsErr)
+	get(wedged)
+	get(healthy)
+	assert.Equal(t, int32(2), atomic.LoadInt32(wedgedConnections), "the modem's connections should be dropped")
+	assert.Equal(t, int32(1), atomic.LoadInt32(healthyConnections), "connections to other modems should be kept")
+	assert.Equal(t, 0, modem.RebootCalls(), "rebooting was not enabled")
+}
+
+func TestWatchdog_Disabled(t *testing.T) {
+	modem := &fake.Modem{StatsErr: context.DeadlineExceeded}
+	watchdog := newWatchdog(modem, 0, true)
+	watchdog.resetTransport = func() { t.Error("disabled watchdog should not reset the transport") }
+
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, 0, watchdog.observe(modem.StatsErr))
+	}
+	assert.Equal(t, 0, modem.RebootCalls())
+}
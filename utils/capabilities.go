@@ -0,0 +1,57 @@
+package utils
+
+// Capability names a group of ModemStats fields which a driver populates
+type Capability string
+
+const (
+	CapDownstreamChannels Capability = "downstream_channels" // Frequency, Power, Snr, Modulation and Scheme
+	CapUpstreamChannels   Capability = "upstream_channels"   // Frequency and Power
+	CapCodewords          Capability = "codewords"           // Prerserr and Postrserr
+	CapTimeouts           Capability = "timeouts"            // T1Timeout to T4Timeout
+	CapLockStatus         Capability = "lock_status"
+	CapPartialService     Capability = "partial_service"
+	CapSymbolRate         Capability = "symbol_rate"
+	CapChannelWidth       Capability = "channel_width"
+	CapServiceFlows       Capability = "service_flows" // Configs
+	CapNoise              Capability = "noise"
+	CapAttenuation        Capability = "attenuation"
+	CapProvisioning       Capability = "provisioning" // ProvisioningStatus and WanIP
+	CapOptics             Capability = "optics"
+	CapOperatingMode      Capability = "operating_mode" // BridgeMode
+	CapUptime             Capability = "uptime"
+	CapConnectivityUptime Capability = "connectivity_uptime"
+	CapInterleaver        Capability = "interleaver" // InterleaverDepth and Annex
+	CapRangingStatus      Capability = "ranging_status"
+	CapConfigFile         Capability = "config_file" // ConfigFile and FirmwareVersion
+	CapDocsisState        Capability = "docsis_state"
+	CapSubcarrierPower    Capability = "subcarrier_power" // SubcarrierPowers (OFDMA upstream only)
+	CapEndpointHealth     Capability = "endpoint_health"  // EndpointUp
+	CapEndpointTiming     Capability = "endpoint_timing"  // EndpointDurations
+	CapMACAddress         Capability = "mac_address"
+)
+
+// CapabilityProvider is implemented by modems which can describe the fields
+// they populate. A nil list means the capabilities are unknown.
+type CapabilityProvider interface {
+	Capabilities() []Capability
+}
+
+// HasCapability reports whether a modem populates the given fields. Modems
+// which do not describe their capabilities are assumed to populate them all.
+func HasCapability(modem DocsisModem, capability Capability) bool {
+	provider, ok := modem.(CapabilityProvider)
+	if !ok {
+		return true
+	}
+
+	capabilities := provider.Capabilities()
+	if capabilities == nil {
+		return true
+	}
+	for _, c := range capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync"
+)
+
+var (
+	clientCertMu sync.RWMutex
+	clientCert   *tls.Certificate
+)
+
+// SetClientCertificate presents the certificate and key in the given PEM
+// files to modems which require mutual TLS, replacing the shared HTTP client
+// so later requests use it. Empty paths stop presenting a certificate.
+func SetClientCertificate(certFile, keyFile string) error {
+	var cert *tls.Certificate
+	if certFile != "" || keyFile != "" {
+		loaded, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cert = &loaded
+	}
+
+	clientCertMu.Lock()
+	clientCert = cert
+	clientCertMu.Unlock()
+	ResetHTTPClients()
+	return nil
+}
+
+// clientCertificates returns the certificates presented to modems
+func clientCertificates() []tls.Certificate {
+	clientCertMu.RLock()
+	defer clientCertMu.RUnlock()
+	if clientCert == nil {
+		return nil
+	}
+	return []tls.Certificate{*clientCert}
+}
@@ -0,0 +1,28 @@
+package utils
+
+import "time"
+
+// ClockOffset estimates how far the modem's clock is from the host's, from
+// the newest event log entry with a parseable timestamp. The newest entry can
+// be no later than now, so a modem with a correct clock reports a small
+// negative offset (the age of that entry), while one which never received
+// the time from the CMTS reports decades. It returns false if no timestamp
+// could be parsed.
+func ClockOffset(entries []EventLogEntry, now time.Time) (time.Duration, bool) {
+	var newest time.Time
+	found := false
+	for _, entry := range entries {
+		ts, err := time.Parse(time.RFC3339, entry.Timestamp)
+		if err != nil {
+			continue
+		}
+		if !found || ts.After(newest) {
+			newest = ts
+			found = true
+		}
+	}
+	if !found {
+		return 0, false
+	}
+	return newest.Sub(now), true
+}
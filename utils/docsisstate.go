@@ -0,0 +1,52 @@
+package utils
+
+import "strings"
+
+// DocsisStates lists the stages of the DOCSIS registration state machine in
+// the order a modem passes through them while it boots
+var DocsisStates = []string{
+	"not_synchronized",
+	"phy_synchronized",
+	"ranging",
+	"dhcp",
+	"time_of_day",
+	"configuration_file",
+	"registration",
+	"registration_complete",
+	"operational",
+}
+
+// docsisStateAliases maps other names firmware uses for a state to the name
+// in DocsisStates
+var docsisStateAliases = map[string]string{
+	"dhcpv4":     "dhcp",
+	"dhcpv6":     "dhcp",
+	"tod":        "time_of_day",
+	"tftp":       "configuration_file",
+	"config":     "configuration_file",
+	"registered": "registration_complete",
+}
+
+// NormalizeDocsisState maps a DOCSIS registration state as reported by the
+// modem ("Configuration File", "configuration-file", "TFTP") to its name in
+// DocsisStates. A state which is not known is returned normalized to the same
+// snake case.
+func NormalizeDocsisState(state string) string {
+	state = strings.ToLower(strings.TrimSpace(state))
+	state = strings.NewReplacer(" ", "_", "-", "_").Replace(state)
+	if alias, ok := docsisStateAliases[state]; ok {
+		return alias
+	}
+	return state
+}
+
+// DocsisStateOrdinal returns the position (from 1) of a normalized state in
+// DocsisStates, or 0 for a state which is not known
+func DocsisStateOrdinal(state string) int {
+	for i, s := range DocsisStates {
+		if s == state {
+			return i + 1
+		}
+	}
+	return 0
+}
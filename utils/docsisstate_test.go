@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeDocsisState(t *testing.T) {
+	tests := map[string]string{
+		"operational":           "operational",
+		"Configuration File":    "configuration_file",
+		" configuration-file ":  "configuration_file",
+		"TFTP":                  "configuration_file",
+		"Registration Complete": "registration_complete",
+		"DHCPv6":                "dhcp",
+		"bpi_init":              "bpi_init",
+	}
+	for state, expected := range tests {
+		assert.Equal(t, expected, NormalizeDocsisState(state), state)
+	}
+}
+
+func TestDocsisStateOrdinal(t *testing.T) {
+	assert.Equal(t, 1, DocsisStateOrdinal("not_synchronized"))
+	assert.Equal(t, 3, DocsisStateOrdinal("ranging"))
+	assert.Equal(t, 6, DocsisStateOrdinal("configuration_file"))
+	assert.Equal(t, 9, DocsisStateOrdinal("operational"))
+	assert.Equal(t, 0, DocsisStateOrdinal("bpi_init"))
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"net/http"
+	"sync"
+)
+
+// hostTransports sends each request through a transport of the host's own,
+// so the connections to one modem can be dropped without dropping those to
+// the others
+type hostTransports struct {
+	mu         sync.Mutex
+	transports map[string]*http.Transport
+}
+
+func newHostTransports() *hostTransports {
+	return &hostTransports{transports: make(map[string]*http.Transport)}
+}
+
+// transport returns the host's transport, creating it on first use
+func (h *hostTransports) transport(host string) *http.Transport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	transport, ok := h.transports[host]
+	if !ok {
+		transport = NewInsecureTransport()
+		h.transports[host] = transport
+	}
+	return transport
+}
+
+func (h *hostTransports) RoundTrip(req *http.Request) (*http.Response, error) {
+	return h.transport(req.URL.Host).RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections to every host
+func (h *hostTransports) CloseIdleConnections() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, transport := range h.transports {
+		transport.CloseIdleConnections()
+	}
+}
+
+// reset replaces the host's transport, closing its idle connections
+func (h *hostTransports) reset(host string) {
+	h.mu.Lock()
+	old := h.transports[host]
+	delete(h.transports, host)
+	h.mu.Unlock()
+
+	if old != nil {
+		old.CloseIdleConnections()
+	}
+}
+
+// ResetHTTPHost drops the connections to the modem at a host (and port, if
+// any), so that later requests to it do not reuse connections to a modem which
+// has stopped responding. Connections to other modems are kept. Requests
+// already in flight run until they time out.
+func ResetHTTPHost(host string) {
+	if transports, ok := InsecureHTTPClient().Transport.(*hostTransports); ok {
+		transports.reset(host)
+	}
+}
@@ -0,0 +1,171 @@
+// Package httprecord records the HTTP exchanges of a driver with a real modem
+// and replays them without a network, for building fixtures and regression
+// testing drivers. Both the Recorder and Replayer are http.RoundTrippers, and
+// are installed for every driver with utils.SetHTTPTransport.
+package httprecord
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ErrNotRecorded is returned by a Replayer for a request with no recording
+var ErrNotRecorded = errors.New("no recorded response")
+
+// exchange is a request and its response, as saved to disk. The body is
+// saved as text where possible so recordings can be read and edited.
+type exchange struct {
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	RequestBody  string      `json:"request_body,omitempty"`
+	Status       int         `json:"status"`
+	Header       http.Header `json:"header"`
+	Body         string      `json:"body"`
+	BodyIsBase64 bool        `json:"body_is_base64,omitempty"`
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// fileName identifies a request by its method, path, query and body. The host
+// is left out so recordings replay whatever address the modem is given.
+func fileName(req *http.Request, body []byte) string {
+	key := req.Method + " " + req.URL.RequestURI() + "\n" + string(body)
+	hash := sha256.Sum256([]byte(key))
+	path := strings.Trim(unsafeChars.ReplaceAllString(req.URL.Path, "_"), "_")
+	return fmt.Sprintf("%s_%s_%x.json", req.Method, path, hash[:4])
+}
+
+// readRequestBody reads a request's body, leaving it in place to be sent
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// Recorder sends requests on to Transport, saving each exchange to a file in
+// Dir. A repeated request replaces the earlier recording.
+type Recorder struct {
+	Dir       string
+	Transport http.RoundTripper
+
+	mu sync.Mutex
+}
+
+// NewRecorder records to dir the exchanges sent through transport
+func NewRecorder(dir string, transport http.RoundTripper) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	return &Recorder{Dir: dir, Transport: transport}, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	recorded := exchange{
+		Method:      req.Method,
+		URL:         req.URL.RequestURI(),
+		RequestBody: string(requestBody),
+		Status:      resp.StatusCode,
+		Header:      resp.Header,
+		Body:        string(body),
+	}
+	if !utf8.Valid(body) {
+		recorded.Body = base64.StdEncoding.EncodeToString(body)
+		recorded.BodyIsBase64 = true
+	}
+	data, err := json.MarshalIndent(recorded, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := os.WriteFile(filepath.Join(r.Dir, fileName(req, requestBody)), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to save recording: %w", err)
+	}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport,
+// so the watchdog can still reset them while recording
+func (r *Recorder) CloseIdleConnections() {
+	if closer, ok := r.Transport.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// Replayer serves the exchanges saved by a Recorder in Dir, without a network
+type Replayer struct {
+	Dir string
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(r.Dir, fileName(req, requestBody)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w for %s %s", ErrNotRecorded, req.Method, req.URL.RequestURI())
+	}
+	if err != nil {
+		return nil, err
+	}
+	var recorded exchange
+	if err := json.Unmarshal(data, &recorded); err != nil {
+		return nil, fmt.Errorf("failed to parse recording: %w", err)
+	}
+
+	body := []byte(recorded.Body)
+	if recorded.BodyIsBase64 {
+		if body, err = base64.StdEncoding.DecodeString(recorded.Body); err != nil {
+			return nil, fmt.Errorf("failed to decode recorded body: %w", err)
+		}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,104 @@
+package httprecord
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/msh100/modem-stats/modems/superhub5"
+	"github.com/msh100/modem-stats/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useTransport installs a transport for every driver for the rest of a test
+func useTransport(t *testing.T, transport http.RoundTripper) {
+	utils.SetHTTPTransport(transport)
+	t.Cleanup(func() { utils.SetHTTPTransport(nil) })
+}
+
+func TestRecordAndReplay_Superhub5(t *testing.T) {
+	stats, err := os.ReadFile("../../modems/superhub5/test_state/full_stats.json")
+	require.NoError(t, err)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/optics") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(stats)
+	}))
+	address := strings.TrimPrefix(server.URL, "https://")
+
+	dir := t.TempDir()
+	recorder, err := NewRecorder(dir, utils.NewInsecureTransport())
+	require.NoError(t, err)
+	useTransport(t, recorder)
+
+	recorded, err := (&superhub5.Modem{IPAddress: address}).ParseStats()
+	require.NoError(t, err)
+	require.NotEmpty(t, recorded.DownChannels)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.NotEmpty(t, files)
+
+	// Replaying needs no network, and serves the recorded 404 as well
+	server.Close()
+	useTransport(t, &Replayer{Dir: dir})
+
+	replayed, err := (&superhub5.Modem{IPAddress: "192.0.2.1"}).ParseStats()
+	require.NoError(t, err)
+	recorded.FetchTime, replayed.FetchTime = 0, 0
+	recorded.EndpointDurations, replayed.EndpointDurations = nil, nil
+	assert.Equal(t, recorded, replayed)
+}
+
+func TestRecordAndReplay_RequestBodyAndBinary(t *testing.T) {
+	binary := []byte{0x00, 0xff, 0xfe, 0x80}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) == "binary" {
+			w.Write(binary)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("text for " + string(body)))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	recorder, err := NewRecorder(dir, http.DefaultTransport)
+	require.NoError(t, err)
+	client := &http.Client{Transport: recorder}
+	for _, body := range []string{"binary", "first", "second"} {
+		resp, err := client.Post(server.URL+"/api?x=1", "text/plain", strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	client = &http.Client{Transport: &Replayer{Dir: dir}}
+	post := func(body string) (*http.Response, []byte) {
+		resp, err := client.Post("http://192.0.2.1/api?x=1", "text/plain", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, data
+	}
+
+	resp, data := post("binary")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, binary, data)
+
+	// Requests differing only by body are recorded separately
+	resp, data = post("second")
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "text for second", string(data))
+
+	_, err = client.Post("http://192.0.2.1/api?x=2", "text/plain", strings.NewReader("first"))
+	assert.ErrorIs(t, err, ErrNotRecorded)
+}
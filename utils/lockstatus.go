@@ -0,0 +1,20 @@
+package utils
+
+import "strings"
+
+// lockedStatuses are the ways firmware reports a locked channel, in lower case
+var lockedStatuses = map[string]bool{
+	"locked": true,
+	"lock":   true,
+	"ok":     true,
+	"yes":    true,
+	"true":   true,
+	"1":      true,
+}
+
+// ParseLockStatus reports whether a channel's lock status, as shown on a
+// modem's status page ("Locked", "locked", "OK" and so on), means the channel
+// is locked. Anything else, such as "Not Locked" or "Unlocked", is unlocked.
+func ParseLockStatus(status string) bool {
+	return lockedStatuses[strings.ToLower(strings.TrimSpace(status))]
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLockStatus(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"Locked", true},
+		{"locked", true},
+		{"LOCKED", true},
+		{" Locked ", true},
+		{"\tlocked\n", true},
+		{"Lock", true},
+		{"ok", true},
+		{"OK", true},
+		{"Yes", true},
+		{"true", true},
+		{"1", true},
+		{"Not Locked", false},
+		{"not locked", false},
+		{" Not Locked ", false},
+		{"Unlocked", false},
+		{"unlocked", false},
+		{"No", false},
+		{"false", false},
+		{"0", false},
+		{"", false},
+		{"Ranging", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ParseLockStatus(tt.in), "input %q", tt.in)
+	}
+}
@@ -0,0 +1,149 @@
+// Package logging writes levelled log messages as text or JSON. A package
+// level logger is used throughout modem-stats so the verbosity and format can
+// be set in one place.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log message
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel parses a level name (debug, info, warn or error)
+func ParseLevel(name string) (Level, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "warning" {
+		name = "warn"
+	}
+	for level, levelName := range levelNames {
+		if levelName == name {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", name)
+}
+
+// Formats in which messages can be written
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Logger writes messages at or above its level. It is safe for concurrent
+// use.
+type Logger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	level  Level
+	format string
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// New creates a logger writing messages at or above level to out, as text
+// unless the format is FormatJSON
+func New(out io.Writer, level Level, format string) *Logger {
+	return &Logger{
+		out:    out,
+		level:  level,
+		format: format,
+		now:    time.Now,
+	}
+}
+
+// ValidFormat reports whether format is a known format
+func ValidFormat(format string) bool {
+	return format == FormatText || format == FormatJSON
+}
+
+// jsonMessage is a message as written in the JSON format
+type jsonMessage struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"msg"`
+}
+
+// Logf writes a message at the given level
+func (l *Logger) Logf(level Level, format string, args ...interface{}) {
+	if level < l.level {
+		return
+	}
+
+	message := fmt.Sprintf(format, args...)
+	timestamp := l.now().UTC().Format(time.RFC3339)
+
+	var line []byte
+	if l.format == FormatJSON {
+		line, _ = json.Marshal(jsonMessage{Time: timestamp, Level: level.String(), Message: message})
+	} else {
+		line = []byte(fmt.Sprintf("%s %-5s %s", timestamp, strings.ToUpper(level.String()), message))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(append(line, '\n'))
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) { l.Logf(LevelDebug, format, args...) }
+func (l *Logger) Infof(format string, args ...interface{})  { l.Logf(LevelInfo, format, args...) }
+func (l *Logger) Warnf(format string, args ...interface{})  { l.Logf(LevelWarn, format, args...) }
+func (l *Logger) Errorf(format string, args ...interface{}) { l.Logf(LevelError, format, args...) }
+
+var (
+	defaultMu     sync.RWMutex
+	defaultLogger = New(os.Stderr, LevelInfo, FormatText)
+)
+
+// SetDefault replaces the logger used by the package level functions
+func SetDefault(logger *Logger) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultLogger = logger
+}
+
+// Default returns the logger used by the package level functions
+func Default() *Logger {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultLogger
+}
+
+func Debugf(format string, args ...interface{}) { Default().Logf(LevelDebug, format, args...) }
+func Infof(format string, args ...interface{})  { Default().Logf(LevelInfo, format, args...) }
+func Warnf(format string, args ...interface{})  { Default().Logf(LevelWarn, format, args...) }
+func Errorf(format string, args ...interface{}) { Default().Logf(LevelError, format, args...) }
+
+// Fatalf writes a message at the error level and exits
+func Fatalf(format string, args ...interface{}) {
+	Default().Logf(LevelError, format, args...)
+	os.Exit(1)
+}
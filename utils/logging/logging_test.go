@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLogger(level Level, format string) (*Logger, *bytes.Buffer) {
+	var out bytes.Buffer
+	logger := New(&out, level, format)
+	logger.now = func() time.Time { return time.Date(2026, 2, 9, 10, 14, 14, 0, time.UTC) }
+	return logger, &out
+}
+
+func TestLogger_ErrorLevelSuppressesInfo(t *testing.T) {
+	logger, out := newTestLogger(LevelError, FormatText)
+
+	logger.Debugf("Fetching %s", "/rest/v1/cablemodem/downstream")
+	logger.Infof("Pushed %d log entries to Loki", 3)
+	logger.Warnf("Unknown channel scheme: %s", "sc-qam")
+	logger.Errorf("Error pushing logs to Loki: %v", "loki returned status 503")
+
+	assert.Equal(t, "2026-02-09T10:14:14Z ERROR Error pushing logs to Loki: loki returned status 503\n", out.String())
+}
+
+func TestLogger_JSON(t *testing.T) {
+	logger, out := newTestLogger(LevelInfo, FormatJSON)
+
+	logger.Debugf("not written")
+	logger.Infof("Starting Prometheus exporter on port %d", 9000)
+
+	var message map[string]string
+	require.NoError(t, json.Unmarshal(out.Bytes(), &message))
+	assert.Equal(t, map[string]string{
+		"time":  "2026-02-09T10:14:14Z",
+		"level": "info",
+		"msg":   "Starting Prometheus exporter on port 9000",
+	}, message)
+	assert.Equal(t, 1, strings.Count(out.String(), "\n"))
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, expected := range map[string]Level{
+		"debug":   LevelDebug,
+		"INFO":    LevelInfo,
+		"warn":    LevelWarn,
+		"warning": LevelWarn,
+		" error ": LevelError,
+	} {
+		level, err := ParseLevel(name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, expected, level, name)
+	}
+
+	_, err := ParseLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestSetDefault(t *testing.T) {
+	original := Default()
+	defer SetDefault(original)
+
+	logger, out := newTestLogger(LevelWarn, FormatText)
+	SetDefault(logger)
+
+	Infof("suppressed")
+	Warnf("Modem does not support event log streaming")
+	assert.Equal(t, "2026-02-09T10:14:14Z WARN  Modem does not support event log streaming\n", out.String())
+}
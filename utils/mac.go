@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+// NormalizeMAC formats a MAC address as lower case, colon separated pairs
+// ("a4:91:b1:0c:3e:7f") however the firmware writes it ("A4-91-B1-0C-3E-7F",
+// "a491.b10c.3e7f", "A491B10C3E7F"). Anything which is not a MAC address is
+// returned trimmed and in lower case.
+func NormalizeMAC(mac string) string {
+	mac = strings.ToLower(strings.TrimSpace(mac))
+	digits := strings.NewReplacer(":", "", "-", "", ".", "", " ", "").Replace(mac)
+	if len(digits) != 12 {
+		return mac
+	}
+	if _, err := hex.DecodeString(digits); err != nil {
+		return mac
+	}
+
+	pairs := make([]string, 0, 6)
+	for i := 0; i < len(digits); i += 2 {
+		pairs = append(pairs, digits[i:i+2])
+	}
+	return strings.Join(pairs, ":")
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeMAC(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"a4:91:b1:0c:3e:7f", "a4:91:b1:0c:3e:7f"},
+		{"A4:91:B1:0C:3E:7F", "a4:91:b1:0c:3e:7f"},
+		{"A4-91-B1-0C-3E-7F", "a4:91:b1:0c:3e:7f"},
+		{"a491.b10c.3e7f", "a4:91:b1:0c:3e:7f"},
+		{"A491B10C3E7F", "a4:91:b1:0c:3e:7f"},
+		{" A4:91:B1:0C:3E:7F ", "a4:91:b1:0c:3e:7f"},
+		{"not a mac", "not a mac"},
+		{"A4:91:B1:0C:3E", "a4:91:b1:0c:3e"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, NormalizeMAC(tt.in), "input %q", tt.in)
+	}
+}
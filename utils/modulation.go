@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+var qamPattern = regexp.MustCompile(`^(?:QAM[-_ ]?([0-9]+)|([0-9]+)[-_ ]?QAM)$`)
+
+// NormalizeModulation maps the many ways firmware spells a QAM modulation
+// ("256QAM", "QAM256", "qam_256", "QAM 256", "256-QAM") to the canonical
+// "QAM256", so a firmware update does not start new label series.
+// Anything else is returned trimmed but otherwise unchanged.
+func NormalizeModulation(modulation string) string {
+	modulation = strings.TrimSpace(modulation)
+	match := qamPattern.FindStringSubmatch(strings.ToUpper(modulation))
+	if match == nil {
+		return modulation
+	}
+	return "QAM" + match[1] + match[2]
+}
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeModulation(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"QAM256", "QAM256"},
+		{"256QAM", "QAM256"},
+		{"qam_256", "QAM256"},
+		{"qam256", "QAM256"},
+		{"QAM 256", "QAM256"},
+		{"256-QAM", "QAM256"},
+		{" QAM64 ", "QAM64"},
+		{"64QAM", "QAM64"},
+		{"qam_64", "QAM64"},
+		{"4096QAM", "QAM4096"},
+		{"qam_4096", "QAM4096"},
+		{"QAM4096", "QAM4096"},
+		{"OFDM-PLC", "OFDM-PLC"},
+		{"QPSK", "QPSK"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, NormalizeModulation(tt.in), "input %q", tt.in)
+	}
+}
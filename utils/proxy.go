@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// ProxySchemes are the schemes of the proxies modems can be reached through,
+// an HTTP proxy tunnelling HTTPS with CONNECT
+var ProxySchemes = []string{"http", "https", "socks5"}
+
+var (
+	proxyMu sync.RWMutex
+	proxy   *url.URL
+)
+
+// ParseProxy parses the URL of a proxy, such as socks5://localhost:1080 for
+// an SSH tunnel (ssh -D 1080 jumphost)
+func ParseProxy(raw string) (*url.URL, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", raw, err)
+	}
+	for _, scheme := range ProxySchemes {
+		if parsed.Scheme == scheme {
+			if parsed.Host == "" {
+				return nil, fmt.Errorf("invalid proxy %q: missing host", raw)
+			}
+			return parsed, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid proxy %q: scheme must be one of %s", raw, strings.Join(ProxySchemes, ", "))
+}
+
+// SetProxy sends requests to modems through the proxy at the given URL, for
+// modems only reachable through a jump host, replacing the shared HTTP client
+// so later requests use it. An empty URL connects to modems directly.
+func SetProxy(raw string) error {
+	var parsed *url.URL
+	if raw != "" {
+		var err error
+		if parsed, err = ParseProxy(raw); err != nil {
+			return err
+		}
+	}
+
+	proxyMu.Lock()
+	proxy = parsed
+	proxyMu.Unlock()
+	ResetHTTPClients()
+	return nil
+}
+
+// modemProxy returns the proxy modems are reached through, nil if none
+func modemProxy() *url.URL {
+	proxyMu.RLock()
+	defer proxyMu.RUnlock()
+	return proxy
+}
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// socksProxy is a minimal SOCKS5 proxy, supporting CONNECT without
+// authentication, which records the addresses it connects to
+type socksProxy struct {
+	listener net.Listener
+
+	mu        sync.Mutex
+	connected []string
+}
+
+func newSOCKSProxy(t *testing.T) *socksProxy {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	p := &socksProxy{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go p.serve(conn)
+		}
+	}()
+	return p
+}
+
+func (p *socksProxy) serve(conn net.Conn) {
+	defer conn.Close()
+
+	// Greeting: version, number of methods and the methods, answered with
+	// no authentication
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, make([]byte, header[1])); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 0})
+
+	// Request: version, command, reserved and the address type, address and
+	// port to connect to
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return
+	}
+	var host string
+	switch request[3] {
+	case 1:
+		ip := make([]byte, net.IPv4len)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return
+		}
+		host = net.IP(ip).String()
+	case 3:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return
+		}
+		name := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return
+		}
+		host = string(name)
+	default:
+		return
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+
+	target, err := net.Dial("tcp", address)
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	p.mu.Lock()
+	p.connected = append(p.connected, address)
+	p.mu.Unlock()
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
+
+func (p *socksProxy) connections() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.connected...)
+}
+
+func TestSetProxy_SOCKS5(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+	proxy := newSOCKSProxy(t)
+
+	require.NoError(t, SetProxy("socks5://"+proxy.listener.Addr().String()))
+	t.Cleanup(func() { SetProxy("") })
+	res, err := InsecureHTTPClient().Get(server.URL)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, []string{server.Listener.Addr().String()}, proxy.connections(),
+		"the request should be routed through the proxy")
+
+	require.NoError(t, SetProxy(""))
+	res, err = InsecureHTTPClient().Get(server.URL)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Len(t, proxy.connections(), 1, "the modem should be connected to directly")
+}
+
+func TestParseProxy(t *testing.T) {
+	for _, tc := range []struct {
+		raw   string
+		valid bool
+	}{
+		{"socks5://localhost:1080", true},
+		{"http://proxy.example:3128", true},
+		{"https://proxy.example:3128", true},
+		{"ftp://proxy.example", false},
+		{"socks5://", false},
+		{"localhost:1080", false},
+	} {
+		t.Run(tc.raw, func(t *testing.T) {
+			_, err := ParseProxy(tc.raw)
+			assert.Equal(t, tc.valid, err == nil, "%v", err)
+		})
+	}
+	assert.Error(t, SetProxy("ftp://proxy.example"))
+	assert.Nil(t, modemProxy())
+}
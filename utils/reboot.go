@@ -0,0 +1,16 @@
+package utils
+
+// RebootDetector spots modem reboots from successive uptime readings
+type RebootDetector struct {
+	lastUptime int64
+	observed   bool
+}
+
+// Observe records an uptime reading (in seconds) and reports whether the
+// modem has rebooted since the previous reading
+func (r *RebootDetector) Observe(uptime int64) bool {
+	rebooted := r.observed && uptime < r.lastUptime
+	r.lastUptime = uptime
+	r.observed = true
+	return rebooted
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+const (
+	RequestSuccess = "success"
+	RequestFailure = "failure"
+)
+
+// RequestKey identifies a counted modem request by the host it was made to,
+// the endpoint path and whether it succeeded
+type RequestKey struct {
+	Host     string
+	Endpoint string
+	Result   string
+}
+
+var (
+	requestCounts   = make(map[RequestKey]int)
+	requestCountsMu sync.Mutex
+)
+
+// countRequest records the outcome of an HTTP request to the modem. Requests
+// which fail or return a non-2xx status count as failures.
+func countRequest(rawURL string, res *http.Response, err error) {
+	host, endpoint := "", rawURL
+	if parsed, parseErr := url.Parse(rawURL); parseErr == nil {
+		host, endpoint = parsed.Host, parsed.Path
+	}
+
+	result := RequestSuccess
+	if err != nil || res == nil || res.StatusCode < 200 || res.StatusCode >= 300 {
+		result = RequestFailure
+	}
+
+	requestCountsMu.Lock()
+	requestCounts[RequestKey{host, endpoint, result}]++
+	requestCountsMu.Unlock()
+}
+
+// RequestCounts returns a snapshot of how many requests have been made to
+// modems, by host, endpoint and result
+func RequestCounts() map[RequestKey]int {
+	requestCountsMu.Lock()
+	defer requestCountsMu.Unlock()
+
+	counts := make(map[RequestKey]int, len(requestCounts))
+	for key, count := range requestCounts {
+		counts[key] = count
+	}
+	return counts
+}
+
+// HostRequestCounts returns a snapshot of how many requests have been made to
+// the modem at a host, by endpoint and result
+func HostRequestCounts(host string) map[RequestKey]int {
+	requestCountsMu.Lock()
+	defer requestCountsMu.Unlock()
+
+	counts := make(map[RequestKey]int)
+	for key, count := range requestCounts {
+		if key.Host == host {
+			counts[key] = count
+		}
+	}
+	return counts
+}
+
+// URLHost returns the host (and port, if any) of a URL, empty if it cannot
+// be parsed
+func URLHost(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return parsed.Host
+}
@@ -4,32 +4,91 @@ import (
 	"crypto/md5"
 	"crypto/tls"
 	"fmt"
+	"html"
 	"io"
+	"math"
 	"math/rand/v2"
 	"net/http"
+	"net/url"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Jeffail/gabs/v2"
 )
 
-var insecureHTTPClient = &http.Client{
-	Timeout: 30 * time.Second,
-	Transport: &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	},
+var (
+	insecureHTTPClientMu sync.RWMutex
+	httpTransport        http.RoundTripper
+	insecureHTTPClient   = newInsecureHTTPClient()
+)
+
+// NewInsecureTransport returns an HTTP transport that skips TLS verification,
+// as modems serve self signed certificates, presenting the client certificate
+// if one has been set (see SetClientCertificate) and connecting through the
+// proxy if one has been set (see SetProxy)
+func NewInsecureTransport() *http.Transport {
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			Certificates:       clientCertificates(),
+		},
+	}
+	if proxy := modemProxy(); proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return transport
+}
+
+func newInsecureHTTPClient() *http.Client {
+	transport := httpTransport
+	if transport == nil {
+		transport = newHostTransports()
+	}
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: transport,
+	}
+}
+
+// SetHTTPTransport sends the requests of every driver through the given
+// transport, such as one recording or replaying the modem's responses. Nil
+// restores the default.
+func SetHTTPTransport(transport http.RoundTripper) {
+	insecureHTTPClientMu.Lock()
+	defer insecureHTTPClientMu.Unlock()
+	httpTransport = transport
+	insecureHTTPClient = newInsecureHTTPClient()
 }
 
 // InsecureHTTPClient returns an HTTP client that skips TLS verification
 func InsecureHTTPClient() *http.Client {
+	insecureHTTPClientMu.RLock()
+	defer insecureHTTPClientMu.RUnlock()
 	return insecureHTTPClient
 }
 
+// ResetHTTPClients replaces the shared HTTP client with one using a new
+// transport, so that later requests do not reuse connections to a modem which
+// has stopped responding. Requests already in flight on the old transport run
+// until they time out.
+func ResetHTTPClients() {
+	insecureHTTPClientMu.Lock()
+	old := insecureHTTPClient
+	insecureHTTPClient = newInsecureHTTPClient()
+	insecureHTTPClientMu.Unlock()
+
+	old.CloseIdleConnections()
+	http.DefaultClient.CloseIdleConnections()
+}
+
 func SimpleHTTPFetch(url string) ([]byte, int64, error) {
 	timeStart := time.Now().UnixMilli()
-	resp, err := insecureHTTPClient.Get(url)
+	resp, err := InsecureHTTPClient().Get(url)
+	countRequest(url, resp, err)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -90,6 +149,9 @@ type HttpResult struct {
 	Index int
 	Res   http.Response
 	Err   error
+
+	// Duration is how long the request took to respond, or fail
+	Duration time.Duration
 }
 
 func BoundedParallelGet(urls []string, concurrencyLimit int) []HttpResult {
@@ -99,12 +161,15 @@ func BoundedParallelGet(urls []string, concurrencyLimit int) []HttpResult {
 	for i, url := range urls {
 		go func(i int, url string) {
 			semaphoreChan <- struct{}{}
-			res, err := insecureHTTPClient.Get(url)
+			start := time.Now()
+			res, err := InsecureHTTPClient().Get(url)
+			duration := time.Since(start)
+			countRequest(url, res, err)
 			var result *HttpResult
 			if res != nil {
-				result = &HttpResult{i, *res, err}
+				result = &HttpResult{Index: i, Res: *res, Err: err, Duration: duration}
 			} else {
-				result = &HttpResult{Index: i, Err: err}
+				result = &HttpResult{Index: i, Err: err, Duration: duration}
 			}
 			resultsChan <- result
 			<-semaphoreChan
@@ -122,24 +187,56 @@ func BoundedParallelGet(urls []string, concurrencyLimit int) []HttpResult {
 	return results
 }
 
+// leadingNumber matches the signed number a value with a unit starts with,
+// such as the -7.2 of "-7.2 dBmV"
+var leadingNumber = regexp.MustCompile(`^[-+]?(?:[0-9]+(?:\.[0-9]*)?|\.[0-9]+)`)
+
+// extractNumber returns the number a value with a unit starts with, whether
+// or not the unit is separated by a space. A minus sign written as U+2212, as
+// some status pages do, is read as a hyphen.
+func extractNumber(valueWithUnit string) string {
+	value := strings.Replace(strings.TrimSpace(valueWithUnit), "\u2212", "-", 1)
+	return leadingNumber.FindString(value)
+}
+
+// ExtractIntValue returns the integer a value with a unit starts with, such
+// as -15 for "-15 dB", 0 if it does not start with one. A decimal is
+// truncated towards zero.
 func ExtractIntValue(valueWithUnit string) int {
-	parts := strings.Split(valueWithUnit, " ")
-	if len(parts) > 0 {
-		intValue, err := strconv.Atoi(parts[0])
-		if err == nil {
-			return intValue
-		}
+	number := extractNumber(valueWithUnit)
+	if intValue, err := strconv.Atoi(number); err == nil {
+		return intValue
+	}
+	if floatValue, err := strconv.ParseFloat(number, 64); err == nil {
+		return int(floatValue)
 	}
 	return 0
 }
 
+// ExtractFloatValue returns the number a value with a unit starts with, such
+// as -7.2 for "-7.2 dBmV", 0 if it does not start with one
 func ExtractFloatValue(valueWithUnit string) float64 {
-	parts := strings.Split(valueWithUnit, " ")
-	if len(parts) > 0 {
-		floatValue, err := strconv.ParseFloat(parts[0], 64)
-		if err == nil {
-			return floatValue
-		}
+	if floatValue, err := strconv.ParseFloat(extractNumber(valueWithUnit), 64); err == nil {
+		return floatValue
 	}
 	return 0.0
 }
+
+// Tenths converts a value such as a power in dBmV or an SNR in dB to the
+// tenths held in ModemChannel, rounding rather than truncating so that 2.19
+// becomes 22 and not 21
+func Tenths(value float64) int {
+	return int(math.Round(value * 10))
+}
+
+// DecodeLogMessage normalizes an event log message which some firmwares
+// return URL encoded or with HTML entities. Plain text is returned unchanged,
+// as is text which only looks URL encoded (such as "100% loss").
+func DecodeLogMessage(message string) string {
+	if strings.Contains(message, "%") {
+		if decoded, err := url.PathUnescape(message); err == nil {
+			message = decoded
+		}
+	}
+	return strings.TrimSpace(html.UnescapeString(message))
+}
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractValue(t *testing.T) {
+	tests := []struct {
+		in        string
+		wantInt   int
+		wantFloat float64
+	}{
+		{"-7.2 dBmV", -7, -7.2},
+		{"-15 dB", -15, -15},
+		{"+3.4 dBmV", 3, 3.4},
+		{"40.3 dB", 40, 40.3},
+		{"-0.5 dBmV", 0, -0.5},
+		{"-7.2dBmV", -7, -7.2},
+		{" -7.2 dBmV ", -7, -7.2},
+		{"−7.2 dBmV", -7, -7.2},
+		{"331000000 Hz", 331000000, 331000000},
+		{"-", 0, 0},
+		{"N/A", 0, 0},
+		{"", 0, 0},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.wantInt, ExtractIntValue(tt.in), "input %q", tt.in)
+		assert.Equal(t, tt.wantFloat, ExtractFloatValue(tt.in), "input %q", tt.in)
+	}
+}
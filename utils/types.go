@@ -1,5 +1,12 @@
 package utils
 
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
 type ModemChannel struct {
 	ChannelID  int
 	Channel    int
@@ -21,8 +28,56 @@ type ModemChannel struct {
 	T4Timeout int
 
 	// Additional channel info
-	Locked     bool
-	SymbolRate int
+	Locked         bool
+	PartialService bool // Bonded but degraded
+	SymbolRate     int
+	ChannelWidth   int // Hz, where reported by the modem
+
+	// Upstream ranging status ("success", "continue" or "abort"), where
+	// reported by the modem. An aborted channel has lost its upstream timing.
+	RangingStatus string
+
+	// SC-QAM downstream interleaver depth (I) and DOCSIS annex (A, B or C).
+	// OFDM channels have no interleaver.
+	InterleaverDepth int
+	Annex            string
+
+	// Fraction of errored codewords which were corrected, where the modem
+	// reports it, see CorrectedRatio
+	HasCorrectedRatio bool
+	CorrectedRatio    float64
+
+	// Link quality as a percentage, where the modem reports it in place of
+	// the SNR in dB. Snr is not set for such a channel.
+	HasQualityPercent bool
+	QualityPercent    float64
+
+	// SNR above the minimum for the channel's modulation in tenths of a dB,
+	// where the modem reports it rather than leaving it to be estimated
+	HasSNRMargin bool
+	SNRMargin    int
+
+	// Lock status of an OFDM channel's PLC (Physical Link Channel), where
+	// reported by the modem. An OFDM channel can stay locked while losing
+	// its PLC, which carries the channel's parameters.
+	HasPLCLock bool
+	PLCLocked  bool
+
+	// Vendor specific numeric fields which are not otherwise modelled, keyed
+	// by field name (downstream only)
+	Extra map[string]float64
+
+	// Transmit power across the subcarriers of an OFDMA upstream channel,
+	// where reported by the modem. Power is the channel's aggregate.
+	SubcarrierPowers []SubcarrierPower
+}
+
+// SubcarrierPower is the transmit power of a range of an OFDMA upstream
+// channel's subcarriers
+type SubcarrierPower struct {
+	FirstSubcarrier int
+	LastSubcarrier  int
+	Power           int // Tenths of a dBmV
 }
 
 type ModemConfig struct {
@@ -30,14 +85,78 @@ type ModemConfig struct {
 	Maxrate       int
 	Maxburst      int
 	ServiceFlowId int
+
+	// State of the service flow, one of the ServiceFlow states, empty where
+	// the modem does not report it
+	State string
 }
 
+// Service flow states. A flow is provisioned, then admitted once the CMTS
+// has reserved its resources, and active once it carries traffic.
+const (
+	ServiceFlowProvisioned = "provisioned"
+	ServiceFlowAdmitted    = "admitted"
+	ServiceFlowActive      = "active"
+)
+
 type ModemStats struct {
 	Configs      []ModemConfig
 	UpChannels   []ModemChannel
 	DownChannels []ModemChannel
 	FetchTime    int64
 	ModemType    string
+
+	// Modem provisioning state and WAN address (where supported)
+	ProvisioningStatus string
+	WanIP              string
+
+	// The cable modem's MAC address, see NormalizeMAC
+	MACAddress string
+
+	// Stage of DOCSIS registration, one of DocsisStates where known (see
+	// NormalizeDocsisState)
+	DocsisState string
+
+	// Optical power in tenths of dBm, for modems behind a fibre ONT
+	HasOptics      bool
+	OpticalRxPower int
+	OpticalTxPower int
+
+	// Whether the modem is in modem (bridge) mode rather than router mode
+	HasOperatingMode bool
+	BridgeMode       bool
+
+	// Seconds since the modem booted, and since it last registered with the
+	// CMTS. The link can drop and re-register while the modem stays up.
+	HasUptime             bool
+	Uptime                int64
+	HasConnectivityUptime bool
+	ConnectivityUptime    int64
+
+	// DOCSIS version the modem supports, and the version actually in use.
+	// When the modem does not report the negotiated version it is derived
+	// from the bonded channels, see NegotiatedDocsisVersion.
+	DocsisCapability string
+	DocsisNegotiated string
+
+	// Name of the config file the ISP provisioned the modem with, and the
+	// firmware version it runs, where reported. Either changing can change
+	// how the modem behaves.
+	ConfigFile      string
+	FirmwareVersion string
+
+	// Whether each endpoint the statistics were fetched from responded, by
+	// endpoint name, for modems which fetch from several
+	EndpointUp map[string]bool
+
+	// How long each endpoint the statistics were fetched from took to
+	// respond, by endpoint name, for modems which fetch from several
+	EndpointDurations map[string]time.Duration
+
+	// Where the statistics were read from, for modems which fall back to
+	// another source when the usual one is unavailable (such as "html" for
+	// a status page standing in for an API), empty for other modems
+	Source string
 }
 
 type EventLogEntry struct {
@@ -57,7 +176,112 @@ type EventLogProvider interface {
 	FetchEventLog() ([]EventLogEntry, error)
 }
 
+// EventLogStreamer is implemented by modems which can stream event log
+// entries as they are logged, such as over server-sent events or a long-poll
+// endpoint. StreamEventLog calls emit for each new entry and blocks until the
+// stream ends or ctx is cancelled. Modems which only support streaming on
+// some firmware return ErrStreamingUnsupported.
+type EventLogStreamer interface {
+	StreamEventLog(ctx context.Context, emit func(EventLogEntry)) error
+}
+
+// ErrStreamingUnsupported is returned by an EventLogStreamer which cannot
+// stream from this modem, so that its event log is polled instead
+var ErrStreamingUnsupported = errors.New("event log streaming not supported")
+
+// UptimeProvider is implemented by modems that can report their uptime
+type UptimeProvider interface {
+	FetchUptime() (int64, error)
+}
+
+// SpectrumPoint is the downstream power measured at one frequency of a
+// spectrum sweep
+type SpectrumPoint struct {
+	Frequency int // Hz
+	Power     int // Tenths of a dBmV
+}
+
+// SpectrumProvider is implemented by modems which can sweep the downstream
+// spectrum. Modems which only expose the spectrum on some firmware return
+// ErrSpectrumUnsupported.
+type SpectrumProvider interface {
+	FetchSpectrum() ([]SpectrumPoint, error)
+}
+
+// ErrSpectrumUnsupported is returned by a SpectrumProvider which cannot fetch
+// the spectrum from this modem
+var ErrSpectrumUnsupported = errors.New("spectrum analysis not supported")
+
+// RawStatsProvider is implemented by modems which keep the statistics as
+// fetched from the modem, which can be read back from LOCAL_FILE
+type RawStatsProvider interface {
+	RawStats() []byte
+}
+
+// HostProvider is implemented by modems which report the host (and port, if
+// any) their requests are made to, so requests to several modems can be told
+// apart
+type HostProvider interface {
+	Host() string
+}
+
+// Rebooter is implemented by modems which can be rebooted remotely
+type Rebooter interface {
+	Reboot() error
+}
+
 const (
 	TypeDocsis = "DOCSIS"
 	TypeVDSL   = "VDSL"
 )
+
+const (
+	Docsis30 = "3.0"
+	Docsis31 = "3.1"
+)
+
+// NegotiatedDocsisVersion returns the negotiated DOCSIS version of a modem,
+// deriving it from the presence of OFDM or OFDMA channels if it was not
+// reported explicitly
+func NegotiatedDocsisVersion(stats ModemStats) string {
+	if stats.DocsisNegotiated != "" {
+		return stats.DocsisNegotiated
+	}
+	if len(stats.DownChannels) == 0 && len(stats.UpChannels) == 0 {
+		return ""
+	}
+
+	for _, channels := range [][]ModemChannel{stats.DownChannels, stats.UpChannels} {
+		for _, c := range channels {
+			if strings.HasPrefix(c.Scheme, "OFDM") {
+				return Docsis31
+			}
+		}
+	}
+	return Docsis30
+}
+
+// CorrectedRatio returns the fraction of a channel's errored codewords which
+// were corrected. The modem's own figure is used where reported, otherwise it
+// is calculated from the codeword counts. It is undefined (and false is
+// returned) for a channel without errors.
+func CorrectedRatio(c ModemChannel) (float64, bool) {
+	if c.HasCorrectedRatio {
+		return c.CorrectedRatio, true
+	}
+	if c.Prerserr <= 0 {
+		return 0, false
+	}
+	return float64(c.Prerserr-c.Postrserr) / float64(c.Prerserr), true
+}
+
+// DownstreamAnnex returns the DOCSIS annex of a modem's SC-QAM downstream
+// channels, or an empty string if it is not reported
+func DownstreamAnnex(stats ModemStats) string {
+	for _, c := range stats.DownChannels {
+		if c.Annex != "" {
+			return c.Annex
+		}
+	}
+	return ""
+}